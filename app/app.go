@@ -1,10 +1,15 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 	"timeslot-app/db"
+	"timeslot-app/middleware"
 	"timeslot-app/models"
+	"timeslot-app/repository"
 	"timeslot-app/service"
 
 	"github.com/jackc/pgx"
@@ -13,20 +18,83 @@ import (
 
 type App struct {
 	Config          models.Config
-	DB              *pgx.Conn
+	DB              *pgx.ConnPool
 	TimeslotService *service.TimeslotServiceImplementaion
 	UserService     *service.UserService
 	EventService    *service.EventService
+	CalendarService *service.CalendarService
+	Reminders       *service.ReminderScheduler
+	WebhookService  *service.WebhookService
+	BookingService  *service.BookingService
+	Webhooks        *service.WebhookDispatcher
+	AuditService    *service.AuditService
+	SSOService      *service.SSOService
+	OrgService      *service.OrgService
+	GroupService    *service.GroupService
+	Tenancy         *middleware.Tenancy
+	Auth            *middleware.Authenticator
+	Policy          *middleware.Policy
 }
 
 var Service *App
 
+// defaultCancelledEventRetention keeps cancelled events restorable for 30 days
+const defaultCancelledEventRetention = 30 * 24 * time.Hour
+
+// defaultSSOSessionTTL is how long the API key handed out at a single sign-on login lasts
+const defaultSSOSessionTTL = 12 * time.Hour
+
 func InitApp() (*App, error) {
 
 	cfg := models.Config{}
 	cfg.DBConfig.Host = os.Getenv("host")
 	cfg.DBConfig.User = os.Getenv("user")
 	cfg.DBConfig.Password = os.Getenv("password")
+	cfg.CancelledEventRetention = defaultCancelledEventRetention
+	if retention := os.Getenv("cancelled_event_retention"); retention != "" {
+		d, err := time.ParseDuration(retention)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cancelled_event_retention: %w", err)
+		}
+		cfg.CancelledEventRetention = d
+	}
+	cfg.JWT.Secret = os.Getenv("jwt_secret")
+	cfg.JWT.JWKSFile = os.Getenv("jwt_jwks_file")
+	cfg.JWT.Issuer = os.Getenv("jwt_issuer")
+	cfg.JWT.Audience = os.Getenv("jwt_audience")
+	cfg.AdminUsers = splitList(os.Getenv("admin_users"))
+	cfg.OrgDomain = os.Getenv("org_domain")
+
+	cfg.OIDC.Issuer = os.Getenv("oidc_issuer")
+	cfg.OIDC.ClientID = os.Getenv("oidc_client_id")
+	cfg.OIDC.ClientSecret = os.Getenv("oidc_client_secret")
+	cfg.OIDC.RedirectURL = os.Getenv("oidc_redirect_url")
+	cfg.OIDC.Scopes = []string{"openid", "profile", "email"}
+	if scopes := splitList(os.Getenv("oidc_scopes")); len(scopes) > 0 {
+		cfg.OIDC.Scopes = scopes
+	}
+	cfg.OIDC.GroupsClaim = "groups"
+	if claim := os.Getenv("oidc_groups_claim"); claim != "" {
+		cfg.OIDC.GroupsClaim = claim
+	}
+	cfg.OIDC.Org = models.DefaultOrgSlug
+	if org := os.Getenv("oidc_org"); org != "" {
+		cfg.OIDC.Org = org
+	}
+	cfg.OIDC.AdminGroups = splitList(os.Getenv("oidc_admin_groups"))
+	cfg.OIDC.MemberGroups = splitList(os.Getenv("oidc_member_groups"))
+	cfg.OIDC.ViewerGroups = splitList(os.Getenv("oidc_viewer_groups"))
+	cfg.OIDC.SessionTTL = defaultSSOSessionTTL
+	if ttl := os.Getenv("oidc_session_ttl"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid oidc_session_ttl: %w", err)
+		}
+		cfg.OIDC.SessionTTL = d
+	}
+	if cfg.OIDC.Issuer != "" && (cfg.OIDC.ClientID == "" || cfg.OIDC.RedirectURL == "") {
+		return nil, fmt.Errorf("oidc_client_id and oidc_redirect_url are needed with oidc_issuer")
+	}
 
 	err := viper.Unmarshal(&cfg)
 	if err != nil {
@@ -35,6 +103,7 @@ func InitApp() (*App, error) {
 
 	fmt.Println("Config loaded successfully", cfg)
 
+	// handlers and background jobs share the pool, every query and transaction takes a connection of its own
 	database := db.Connection(cfg.DBConfig.Host, cfg.DBConfig.User, cfg.DBConfig.Password)
 
 	err = db.CreateTables(database)
@@ -45,8 +114,52 @@ func InitApp() (*App, error) {
 	app.Config = cfg
 
 	app.DB = database
-	app.TimeslotService = service.NewTimeslotService(database)
+	// bearer JWTs are only accepted when a secret or JWKS file is configured, API keys always are
+	verifier, err := middleware.NewJWTVerifier(cfg.JWT)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT configuration: %w", err)
+	}
+	app.Tenancy = middleware.NewTenancy(database, cfg.OrgDomain)
+	app.Auth = middleware.NewAuthenticator(database, verifier)
+	app.Policy = middleware.NewPolicy(database)
+	if len(cfg.AdminUsers) > 0 {
+		if err := repository.NewUserRepo(database).PromoteAdmins(models.DefaultOrgID, cfg.AdminUsers); err != nil {
+			return nil, fmt.Errorf("error promoting admin_users: %w", err)
+		}
+	}
+	app.AuditService = service.NewAuditService(database)
+	app.SSOService = service.NewSSOService(database, cfg.OIDC)
+	app.OrgService = service.NewOrgService(database)
+	app.GroupService = service.NewGroupService(database)
+	app.TimeslotService = service.Init(database)
 	app.UserService = service.NewUserService(database)
 	app.EventService = service.NewEventService(database)
+	app.CalendarService = service.NewCalendarService(database)
+	app.BookingService = service.NewBookingService(database)
+
+	go app.EventService.RunPurgeJob(cfg.CancelledEventRetention, time.Hour)
+
+	// reminders are posted to a webhook when one is configured and only logged otherwise
+	var notifier service.Notifier = service.LogNotifier{}
+	if url := os.Getenv("reminder_webhook_url"); url != "" {
+		notifier = service.NewWebhookNotifier(url)
+	}
+	app.Reminders = service.NewReminderScheduler(database, notifier)
+	go app.Reminders.Run(context.Background())
+
+	app.WebhookService = service.NewWebhookService(database)
+	app.Webhooks = service.NewWebhookDispatcher(database)
+	go app.Webhooks.Run(context.Background())
 	return app, nil
 }
+
+// splitList reads a comma separated setting, empty entries are dropped
+func splitList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
@@ -4,11 +4,18 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"timeslot-app/models"
 
 	"github.com/jackc/pgx"
 )
 
-func Connection(host, uname, pass string) *pgx.Conn {
+// maxConnections bounds how many requests and background jobs can use the database at once, the others wait
+// for a connection to be released
+const maxConnections = 20
+
+// Connection opens a pool of connections, a pgx connection can only run one statement or transaction at a time
+// so every query and transaction takes a connection of its own from the pool
+func Connection(host, uname, pass string) *pgx.ConnPool {
 
 	config := pgx.ConnConfig{
 		Host:     host,
@@ -16,13 +23,18 @@ func Connection(host, uname, pass string) *pgx.Conn {
 		Password: pass,
 		Database: "postgres",
 	}
-	db, err := pgx.Connect(config)
+	db, err := pgx.NewConnPool(pgx.ConnPoolConfig{ConnConfig: config, MaxConnections: maxConnections})
 	if err != nil {
 		panic(err)
 	}
 
 	// defer db.Close()
-	err = db.Ping(context.Background())
+	conn, err := db.Acquire()
+	if err != nil {
+		panic(err)
+	}
+	err = conn.Ping(context.Background())
+	db.Release(conn)
 	if err != nil {
 		panic(err)
 	}
@@ -32,7 +44,7 @@ func Connection(host, uname, pass string) *pgx.Conn {
 	return db
 }
 
-func CreateTables(db *pgx.Conn) error {
+func CreateTables(db *pgx.ConnPool) error {
 
 	// create table if not exists
 	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS public.users (
@@ -69,7 +81,6 @@ func CreateTables(db *pgx.Conn) error {
 		title character varying NOT NULL,
 		event_start_time timestamp with time zone NOT NULL,
 		event_end_time timestamp with time zone NOT NULL,
-		participants character varying[] NOT NULL,
 		PRIMARY KEY (id),
 		CONSTRAINT event_owner_user_id__foreign_key FOREIGN KEY (event_owner)
 			REFERENCES public.users (id) MATCH SIMPLE
@@ -81,5 +92,764 @@ func CreateTables(db *pgx.Conn) error {
 		log.Println("Error creating table: ", err)
 		return err
 	}
+
+	_, err = db.Exec(`ALTER TABLE public.events
+		ADD COLUMN IF NOT EXISTS forced boolean NOT NULL DEFAULT false,
+		ADD COLUMN IF NOT EXISTS recurrence character varying NOT NULL DEFAULT '';`)
+	if err != nil {
+		log.Println("Error altering table: ", err)
+		return err
+	}
+
+	_, err = db.Exec(`ALTER TABLE public.events
+		ADD COLUMN IF NOT EXISTS status character varying NOT NULL DEFAULT 'active',
+		ADD COLUMN IF NOT EXISTS cancelled_at timestamp with time zone,
+		ADD COLUMN IF NOT EXISTS cancelled_by uuid REFERENCES public.users (id),
+		ADD COLUMN IF NOT EXISTS cancel_reason character varying NOT NULL DEFAULT '';`)
+	if err != nil {
+		log.Println("Error altering table: ", err)
+		return err
+	}
+
+	_, err = db.Exec(`ALTER TABLE public.events
+		ADD COLUMN IF NOT EXISTS description character varying NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS location character varying NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS conference_url character varying NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS visibility character varying NOT NULL DEFAULT 'public',
+		ADD COLUMN IF NOT EXISTS labels jsonb NOT NULL DEFAULT '{}';`)
+	if err != nil {
+		log.Println("Error altering table: ", err)
+		return err
+	}
+
+	// reminder offsets are in seconds, NULL leaves the reminders to each attendee's defaults
+	_, err = db.Exec(`ALTER TABLE public.events ADD COLUMN IF NOT EXISTS reminder_offsets bigint[];`)
+	if err != nil {
+		log.Println("Error altering table: ", err)
+		return err
+	}
+
+	// time zone the event was booked in, it is what recurrences expand and calendar feeds render in
+	_, err = db.Exec(`ALTER TABLE public.events ADD COLUMN IF NOT EXISTS time_zone character varying NOT NULL DEFAULT '';`)
+	if err != nil {
+		log.Println("Error altering table: ", err)
+		return err
+	}
+
+	// CalDAV clients keep their own UID and resource name for the events they create, ETags follow the version
+	_, err = db.Exec(`ALTER TABLE public.events
+		ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1,
+		ADD COLUMN IF NOT EXISTS ical_uid character varying,
+		ADD COLUMN IF NOT EXISTS caldav_name character varying;`)
+	if err != nil {
+		log.Println("Error altering table: ", err)
+		return err
+	}
+
+	// label filters are containment checks on the jsonb column
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS events_labels_idx ON public.events USING gin (labels jsonb_path_ops);`)
+	if err != nil {
+		log.Println("Error creating index: ", err)
+		return err
+	}
+
+	// cancelled events are only kept for the retention period, the purge job finds them through this index
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS events_cancelled_at_idx ON public.events (cancelled_at) WHERE status = 'cancelled';`)
+	if err != nil {
+		log.Println("Error creating index: ", err)
+		return err
+	}
+
+	// create table if not exists
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.event_exceptions
+	(
+		event_id uuid NOT NULL,
+		original_start_time timestamp with time zone NOT NULL,
+		cancelled boolean NOT NULL DEFAULT false,
+		event_start_time timestamp with time zone,
+		event_end_time timestamp with time zone,
+		PRIMARY KEY (event_id, original_start_time),
+		CONSTRAINT event_exceptions_event_id_foreign_key FOREIGN KEY (event_id)
+			REFERENCES public.events (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE,
+		CONSTRAINT event_exceptions_cancelled_or_moved CHECK (cancelled OR (event_start_time IS NOT NULL AND event_end_time IS NOT NULL))
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	// create table if not exists
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.event_participants
+	(
+		id uuid NOT NULL,
+		event_id uuid NOT NULL,
+		user_id uuid,
+		guest_name character varying,
+		role character varying NOT NULL DEFAULT 'required',
+		status character varying NOT NULL DEFAULT 'needs_action',
+		PRIMARY KEY (id),
+		CONSTRAINT event_participants_event_id_foreign_key FOREIGN KEY (event_id)
+			REFERENCES public.events (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE,
+		CONSTRAINT event_participants_user_id_foreign_key FOREIGN KEY (user_id)
+			REFERENCES public.users (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE NO ACTION,
+		CONSTRAINT event_participants_user_or_guest CHECK ((user_id IS NULL) <> (guest_name IS NULL)),
+		CONSTRAINT event_participants_event_user_unique UNIQUE (event_id, user_id),
+		CONSTRAINT event_participants_event_guest_unique UNIQUE (event_id, guest_name)
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	_, err = db.Exec(`ALTER TABLE public.event_participants
+		ADD COLUMN IF NOT EXISTS response_comment character varying NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS proposed_start_time timestamp with time zone,
+		ADD COLUMN IF NOT EXISTS proposed_end_time timestamp with time zone,
+		ADD COLUMN IF NOT EXISTS responded_at timestamp with time zone;`)
+	if err != nil {
+		log.Println("Error altering table: ", err)
+		return err
+	}
+
+	// move the legacy free-text participants array into event_participants, names
+	// matching a user are linked to it and everything else is kept as an external guest
+	_, err = db.Exec(`DO $$
+	BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_schema = 'public' AND table_name = 'events' AND column_name = 'participants') THEN
+			INSERT INTO public.event_participants (id, event_id, user_id, guest_name)
+				SELECT DISTINCT ON (e.id, p.name) md5(e.id::text || p.name)::uuid, e.id, u.id,
+					CASE WHEN u.id IS NULL THEN p.name END
+				FROM public.events e
+				CROSS JOIN LATERAL unnest(e.participants) AS p(name)
+				LEFT JOIN public.users u ON u.name = p.name
+				ON CONFLICT DO NOTHING;
+			ALTER TABLE public.events DROP COLUMN participants;
+		END IF;
+	END $$;`)
+	if err != nil {
+		log.Println("Error migrating participants: ", err)
+		return err
+	}
+
+	// listing a user's events looks them up by owner or participant and narrows them down by start time
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS events_owner_start_time_idx ON public.events (event_owner, event_start_time);
+		CREATE INDEX IF NOT EXISTS events_start_time_idx ON public.events (event_start_time);
+		CREATE INDEX IF NOT EXISTS event_participants_user_id_idx ON public.event_participants (user_id, event_id);`)
+	if err != nil {
+		log.Println("Error creating index: ", err)
+		return err
+	}
+
+	// btree_gist lets the exclusion constraint below mix equality and range overlap
+	_, err = db.Exec(`CREATE EXTENSION IF NOT EXISTS btree_gist;`)
+	if err != nil {
+		log.Println("Error creating extension: ", err)
+		return err
+	}
+
+	// bookings used to be keyed on the attendee name, they are derived data so
+	// the old table is dropped and rebuilt from events by the backfill below
+	_, err = db.Exec(`DO $$
+	BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_schema = 'public' AND table_name = 'event_bookings' AND column_name = 'attendee') THEN
+			DROP TABLE public.event_bookings;
+		END IF;
+	END $$;`)
+	if err != nil {
+		log.Println("Error migrating bookings: ", err)
+		return err
+	}
+
+	// create table if not exists
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.event_bookings
+	(
+		event_id uuid NOT NULL,
+		user_id uuid NOT NULL,
+		during tstzrange NOT NULL,
+		forced boolean NOT NULL DEFAULT false,
+		PRIMARY KEY (event_id, user_id, during),
+		CONSTRAINT event_bookings_event_id_foreign_key FOREIGN KEY (event_id)
+			REFERENCES public.events (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE,
+		CONSTRAINT event_bookings_user_id_foreign_key FOREIGN KEY (user_id)
+			REFERENCES public.users (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE NO ACTION,
+		CONSTRAINT event_bookings_no_overlap EXCLUDE USING gist (user_id WITH =, during WITH &&)
+			WHERE (NOT forced)
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	// recurring events book every occurrence, so a user may hold several bookings per event
+	_, err = db.Exec(`DO $$
+	BEGIN
+		IF (SELECT array_length(conkey, 1) FROM pg_constraint WHERE conname = 'event_bookings_pkey') = 2 THEN
+			ALTER TABLE public.event_bookings DROP CONSTRAINT event_bookings_pkey;
+			ALTER TABLE public.event_bookings ADD PRIMARY KEY (event_id, user_id, during);
+		END IF;
+	END $$;`)
+	if err != nil {
+		log.Println("Error migrating bookings: ", err)
+		return err
+	}
+
+	// create table if not exists
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.event_reschedules
+	(
+		id uuid NOT NULL,
+		event_id uuid NOT NULL,
+		previous_start_time timestamp with time zone NOT NULL,
+		previous_end_time timestamp with time zone NOT NULL,
+		new_start_time timestamp with time zone NOT NULL,
+		new_end_time timestamp with time zone NOT NULL,
+		reason character varying NOT NULL DEFAULT '',
+		rescheduled_at timestamp with time zone NOT NULL,
+		PRIMARY KEY (id),
+		CONSTRAINT event_reschedules_event_id_foreign_key FOREIGN KEY (event_id)
+			REFERENCES public.events (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	// create table if not exists
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.event_consumed_slots
+	(
+		event_id uuid NOT NULL,
+		user_id uuid NOT NULL,
+		during tstzrange NOT NULL,
+		time_zone character varying NOT NULL,
+		PRIMARY KEY (event_id, user_id, during),
+		CONSTRAINT event_consumed_slots_event_id_foreign_key FOREIGN KEY (event_id)
+			REFERENCES public.events (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE,
+		CONSTRAINT event_consumed_slots_user_id_foreign_key FOREIGN KEY (user_id)
+			REFERENCES public.users (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE NO ACTION
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	// create table if not exists
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.user_reminder_settings
+	(
+		user_id uuid NOT NULL,
+		offsets bigint[] NOT NULL DEFAULT '{}',
+		PRIMARY KEY (user_id),
+		CONSTRAINT user_reminder_settings_user_id_foreign_key FOREIGN KEY (user_id)
+			REFERENCES public.users (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	// users without a row use models.DefaultUserProfile, preferred_times holds "15:04-15:04" windows
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.user_profiles
+	(
+		user_id uuid NOT NULL,
+		time_zone character varying(64) NOT NULL DEFAULT 'UTC',
+		locale character varying(35) NOT NULL DEFAULT 'en-US',
+		work_days text[] NOT NULL DEFAULT '{mon,tue,wed,thu,fri}',
+		work_start character varying(5) NOT NULL DEFAULT '09:00',
+		work_end character varying(5) NOT NULL DEFAULT '17:00',
+		buffer_before_minutes integer NOT NULL DEFAULT 0,
+		buffer_after_minutes integer NOT NULL DEFAULT 0,
+		preferred_times text[] NOT NULL DEFAULT '{}',
+		reminders boolean NOT NULL DEFAULT true,
+		PRIMARY KEY (user_id),
+		CONSTRAINT user_profiles_user_id_foreign_key FOREIGN KEY (user_id)
+			REFERENCES public.users (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	// only a hash of the calendar feed token is kept, the token itself is shown once when it is issued
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.user_calendar_tokens
+	(
+		user_id uuid NOT NULL,
+		token_hash character varying NOT NULL,
+		created_at timestamp with time zone NOT NULL,
+		PRIMARY KEY (user_id),
+		CONSTRAINT user_calendar_tokens_user_id_foreign_key FOREIGN KEY (user_id)
+			REFERENCES public.users (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	// what each imported calendar UID was turned into, so a re-import can replace it
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.calendar_imports
+	(
+		user_id uuid NOT NULL,
+		uid character varying NOT NULL,
+		fingerprint character varying NOT NULL,
+		event_ids uuid[] NOT NULL DEFAULT '{}',
+		time_slot_ids uuid[] NOT NULL DEFAULT '{}',
+		imported_at timestamp with time zone NOT NULL,
+		PRIMARY KEY (user_id, uid),
+		CONSTRAINT calendar_imports_user_id_foreign_key FOREIGN KEY (user_id)
+			REFERENCES public.users (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	// create table if not exists
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.event_reminders
+	(
+		id uuid NOT NULL,
+		event_id uuid NOT NULL,
+		user_id uuid NOT NULL,
+		occurrence_start timestamp with time zone NOT NULL,
+		offset_seconds bigint NOT NULL,
+		remind_at timestamp with time zone NOT NULL,
+		status character varying NOT NULL DEFAULT 'pending',
+		attempts integer NOT NULL DEFAULT 0,
+		claimed_at timestamp with time zone,
+		sent_at timestamp with time zone,
+		last_error character varying NOT NULL DEFAULT '',
+		PRIMARY KEY (id),
+		CONSTRAINT event_reminders_event_id_foreign_key FOREIGN KEY (event_id)
+			REFERENCES public.events (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE,
+		CONSTRAINT event_reminders_user_id_foreign_key FOREIGN KEY (user_id)
+			REFERENCES public.users (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE,
+		CONSTRAINT event_reminders_unique UNIQUE (event_id, user_id, occurrence_start, offset_seconds)
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	// the scheduler polls for due reminders, including ones claimed by a replica that went away
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS event_reminders_due_idx ON public.event_reminders (remind_at)
+		WHERE status IN ('pending', 'processing');`)
+	if err != nil {
+		log.Println("Error creating index: ", err)
+		return err
+	}
+
+	// create table if not exists
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.webhooks
+	(
+		id uuid NOT NULL,
+		url character varying NOT NULL,
+		events character varying[] NOT NULL,
+		secret character varying NOT NULL,
+		created_at timestamp with time zone NOT NULL,
+		PRIMARY KEY (id)
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	// every payload is queued once per subscribed webhook and kept as its delivery log
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.webhook_deliveries
+	(
+		id uuid NOT NULL,
+		webhook_id uuid NOT NULL,
+		event_type character varying NOT NULL,
+		payload jsonb NOT NULL,
+		status character varying NOT NULL DEFAULT 'pending',
+		attempts integer NOT NULL DEFAULT 0,
+		next_attempt_at timestamp with time zone NOT NULL,
+		claimed_at timestamp with time zone,
+		last_status_code integer NOT NULL DEFAULT 0,
+		last_error character varying NOT NULL DEFAULT '',
+		created_at timestamp with time zone NOT NULL,
+		delivered_at timestamp with time zone,
+		PRIMARY KEY (id),
+		CONSTRAINT webhook_deliveries_webhook_id_foreign_key FOREIGN KEY (webhook_id)
+			REFERENCES public.webhooks (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON public.webhook_deliveries (next_attempt_at)
+		WHERE status IN ('pending', 'delivering');`)
+	if err != nil {
+		log.Println("Error creating index: ", err)
+		return err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS webhook_deliveries_log_idx ON public.webhook_deliveries (webhook_id, created_at);`)
+	if err != nil {
+		log.Println("Error creating index: ", err)
+		return err
+	}
+
+	// kinds of meetings a user offers on their public booking page
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.event_types
+	(
+		id uuid NOT NULL,
+		user_id uuid NOT NULL,
+		slug character varying NOT NULL,
+		title character varying NOT NULL,
+		description character varying NOT NULL DEFAULT '',
+		location character varying NOT NULL DEFAULT '',
+		duration_minutes integer NOT NULL,
+		buffer_before_minutes integer NOT NULL DEFAULT 0,
+		buffer_after_minutes integer NOT NULL DEFAULT 0,
+		min_notice_minutes integer NOT NULL DEFAULT 0,
+		max_advance_days integer NOT NULL,
+		created_at timestamp with time zone NOT NULL,
+		PRIMARY KEY (id),
+		CONSTRAINT event_types_user_id_slug_key UNIQUE (user_id, slug),
+		CONSTRAINT event_types_user_id_foreign_key FOREIGN KEY (user_id)
+			REFERENCES public.users (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	// team event types book their members, round robin or all at once
+	_, err = db.Exec(`ALTER TABLE public.event_types
+		ADD COLUMN IF NOT EXISTS scheduling_mode character varying NOT NULL DEFAULT 'individual',
+		ADD COLUMN IF NOT EXISTS member_ids uuid[] NOT NULL DEFAULT '{}';`)
+	if err != nil {
+		log.Println("Error altering table: ", err)
+		return err
+	}
+
+	// which member each round robin booking went to, kept after the event is gone so the load stays balanced
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.booking_assignments
+	(
+		event_id uuid NOT NULL,
+		event_type_id uuid NOT NULL,
+		user_id uuid NOT NULL,
+		assigned_at timestamp with time zone NOT NULL,
+		PRIMARY KEY (event_id),
+		CONSTRAINT booking_assignments_event_type_id_foreign_key FOREIGN KEY (event_type_id)
+			REFERENCES public.event_types (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE,
+		CONSTRAINT booking_assignments_user_id_foreign_key FOREIGN KEY (user_id)
+			REFERENCES public.users (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS booking_assignments_event_type_idx ON public.booking_assignments (event_type_id, user_id);`)
+	if err != nil {
+		log.Println("Error creating index: ", err)
+		return err
+	}
+
+	// only a hash of each API key is kept, the key itself is shown once when it is issued
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.api_keys
+	(
+		id uuid NOT NULL,
+		user_id uuid NOT NULL,
+		name character varying NOT NULL,
+		prefix character varying NOT NULL,
+		key_hash character varying NOT NULL,
+		created_at timestamp with time zone NOT NULL,
+		last_used_at timestamp with time zone,
+		PRIMARY KEY (id),
+		CONSTRAINT api_keys_key_hash_key UNIQUE (key_hash),
+		CONSTRAINT api_keys_user_id_foreign_key FOREIGN KEY (user_id)
+			REFERENCES public.users (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	_, err = db.Exec(`ALTER TABLE public.users
+		ADD COLUMN IF NOT EXISTS role character varying NOT NULL DEFAULT 'member'
+			CHECK (role IN ('admin', 'member', 'viewer'));`)
+	if err != nil {
+		log.Println("Error altering table: ", err)
+		return err
+	}
+
+	// a delegate may act on the principal's time slots and events
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.user_delegates
+	(
+		principal_id uuid NOT NULL,
+		delegate_id uuid NOT NULL,
+		created_at timestamp with time zone NOT NULL,
+		PRIMARY KEY (principal_id, delegate_id),
+		CONSTRAINT user_delegates_principal_id_foreign_key FOREIGN KEY (principal_id)
+			REFERENCES public.users (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE,
+		CONSTRAINT user_delegates_delegate_id_foreign_key FOREIGN KEY (delegate_id)
+			REFERENCES public.users (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE,
+		CHECK (principal_id <> delegate_id)
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	// grants made before delegation had scopes keep what delegates could do then
+	_, err = db.Exec(`ALTER TABLE public.user_delegates
+		ADD COLUMN IF NOT EXISTS scopes text[] NOT NULL DEFAULT '{availability,events}';`)
+	if err != nil {
+		log.Println("Error altering table: ", err)
+		return err
+	}
+
+	// the delegate who booked an event on its owner's behalf
+	_, err = db.Exec(`ALTER TABLE public.events ADD COLUMN IF NOT EXISTS acting_delegate uuid
+		REFERENCES public.users (id) ON DELETE SET NULL;`)
+	if err != nil {
+		log.Println("Error altering table: ", err)
+		return err
+	}
+
+	// requests the policy refused, kept after the user is gone so the record stays complete
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.audit_log
+	(
+		id uuid NOT NULL,
+		occurred_at timestamp with time zone NOT NULL,
+		user_id uuid NOT NULL,
+		user_name character varying NOT NULL,
+		role character varying NOT NULL,
+		action character varying NOT NULL,
+		resource_type character varying NOT NULL,
+		resource_id character varying NOT NULL,
+		owner character varying NOT NULL,
+		reason character varying NOT NULL,
+		PRIMARY KEY (id)
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS audit_log_occurred_at_idx ON public.audit_log (occurred_at);`)
+	if err != nil {
+		log.Println("Error creating index: ", err)
+		return err
+	}
+
+	// single sign-on users are found by the sub claim of their provider account, never by name
+	_, err = db.Exec(`ALTER TABLE public.users
+		ADD COLUMN IF NOT EXISTS oidc_subject character varying UNIQUE;`)
+	if err != nil {
+		log.Println("Error altering table: ", err)
+		return err
+	}
+
+	_, err = db.Exec(`ALTER TABLE public.api_keys
+		ADD COLUMN IF NOT EXISTS expires_at timestamp with time zone;`)
+	if err != nil {
+		log.Println("Error altering table: ", err)
+		return err
+	}
+
+	// logins waiting for the provider to send the user back, each can be completed once
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.oidc_logins
+	(
+		state character varying NOT NULL,
+		nonce character varying NOT NULL,
+		code_verifier character varying NOT NULL,
+		expires_at timestamp with time zone NOT NULL,
+		PRIMARY KEY (state)
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	// every user, time slot, event and webhook belongs to an organization and is never seen by the others
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.organizations
+	(
+		id uuid NOT NULL,
+		slug character varying (63) NOT NULL,
+		name character varying (100) NOT NULL,
+		created_at timestamp with time zone NOT NULL,
+		PRIMARY KEY (id),
+		CONSTRAINT organizations_slug_key UNIQUE (slug)
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	// the data from before organizations existed belongs to the default one
+	_, err = db.Exec(`INSERT INTO public.organizations (id, slug, name, created_at) VALUES ($1, $2, 'Default', now())
+		ON CONFLICT DO NOTHING;`, models.DefaultOrgID, models.DefaultOrgSlug)
+	if err != nil {
+		log.Println("Error creating organization: ", err)
+		return err
+	}
+
+	// rows are backfilled from the user they belong to, or into the default organization when they have none
+	orgOwners := map[string]string{"time_slots": "user_id", "events": "event_owner", "audit_log": "user_id"}
+	for _, table := range []string{"users", "time_slots", "events", "webhooks", "audit_log", "oidc_logins"} {
+		_, err = db.Exec(`ALTER TABLE public.` + table + `
+			ADD COLUMN IF NOT EXISTS org_id uuid REFERENCES public.organizations (id);`)
+		if err != nil {
+			log.Println("Error altering table: ", err)
+			return err
+		}
+		backfill := `$1::uuid`
+		if owner, found := orgOwners[table]; found {
+			backfill = `coalesce((SELECT u.org_id FROM public.users u WHERE u.id = ` + table + `.` + owner + `), $1::uuid)`
+		}
+		_, err = db.Exec(`UPDATE public.`+table+` SET org_id = `+backfill+` WHERE org_id IS NULL;`, models.DefaultOrgID)
+		if err != nil {
+			log.Println("Error backfilling table: ", err)
+			return err
+		}
+		_, err = db.Exec(`ALTER TABLE public.` + table + ` ALTER COLUMN org_id SET NOT NULL;`)
+		if err != nil {
+			log.Println("Error altering table: ", err)
+			return err
+		}
+	}
+
+	// names and single sign-on accounts are unique within an organization, two of them can both have an alex
+	for _, constraint := range []string{"users_name_key", "users_oidc_subject_key"} {
+		_, err = db.Exec(`ALTER TABLE public.users DROP CONSTRAINT IF EXISTS ` + constraint + `;`)
+		if err != nil {
+			log.Println("Error altering table: ", err)
+			return err
+		}
+	}
+
+	for _, index := range []string{
+		`CREATE UNIQUE INDEX IF NOT EXISTS users_org_id_name_idx ON public.users (org_id, name);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS users_org_id_oidc_subject_idx ON public.users (org_id, oidc_subject);`,
+		`CREATE INDEX IF NOT EXISTS events_org_id_idx ON public.events (org_id);`,
+		`CREATE INDEX IF NOT EXISTS webhooks_org_id_idx ON public.webhooks (org_id);`,
+		`CREATE INDEX IF NOT EXISTS audit_log_org_id_occurred_at_idx ON public.audit_log (org_id, occurred_at);`,
+	} {
+		_, err = db.Exec(index)
+		if err != nil {
+			log.Println("Error creating index: ", err)
+			return err
+		}
+	}
+
+	// groups are named sets of users and other groups, usable wherever participants are listed
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.groups
+	(
+		id uuid NOT NULL,
+		org_id uuid NOT NULL,
+		name character varying(50) NOT NULL,
+		created_by uuid,
+		created_at timestamp with time zone NOT NULL,
+		PRIMARY KEY (id),
+		CONSTRAINT groups_org_id_foreign_key FOREIGN KEY (org_id)
+			REFERENCES public.organizations (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE,
+		CONSTRAINT groups_created_by_foreign_key FOREIGN KEY (created_by)
+			REFERENCES public.users (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE SET NULL,
+		CONSTRAINT groups_org_id_name_key UNIQUE (org_id, name)
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	// a member is either a user or a nested group
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS public.group_members
+	(
+		group_id uuid NOT NULL,
+		user_id uuid,
+		member_group_id uuid,
+		CONSTRAINT group_members_group_id_foreign_key FOREIGN KEY (group_id)
+			REFERENCES public.groups (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE,
+		CONSTRAINT group_members_user_id_foreign_key FOREIGN KEY (user_id)
+			REFERENCES public.users (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE,
+		CONSTRAINT group_members_member_group_id_foreign_key FOREIGN KEY (member_group_id)
+			REFERENCES public.groups (id) MATCH SIMPLE
+			ON UPDATE NO ACTION
+			ON DELETE CASCADE,
+		CONSTRAINT group_members_user_or_group CHECK ((user_id IS NULL) <> (member_group_id IS NULL)),
+		CONSTRAINT group_members_group_user_unique UNIQUE (group_id, user_id),
+		CONSTRAINT group_members_group_member_group_unique UNIQUE (group_id, member_group_id)
+	);`)
+	if err != nil {
+		log.Println("Error creating table: ", err)
+		return err
+	}
+
+	// the group a participant was invited through, kept as it was when they were invited
+	_, err = db.Exec(`ALTER TABLE public.event_participants
+		ADD COLUMN IF NOT EXISTS via_group character varying;`)
+	if err != nil {
+		log.Println("Error altering table: ", err)
+		return err
+	}
+
+	// backfill bookings for events without any, they are marked forced
+	// since historical double bookings can't be undone here
+	_, err = db.Exec(`INSERT INTO public.event_bookings (event_id, user_id, during, forced)
+		SELECT e.id, a.user_id, tstzrange(e.event_start_time, e.event_end_time, '[)'), true
+		FROM public.events e
+		CROSS JOIN LATERAL (
+			SELECT e.event_owner AS user_id
+			UNION
+			SELECT p.user_id FROM public.event_participants p WHERE p.event_id = e.id AND p.user_id IS NOT NULL
+		) a
+		WHERE e.status = 'active' AND NOT EXISTS (SELECT 1 FROM public.event_bookings b WHERE b.event_id = e.id)
+		ON CONFLICT DO NOTHING;`)
+	if err != nil {
+		log.Println("Error backfilling table: ", err)
+		return err
+	}
 	return nil
 }
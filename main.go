@@ -5,8 +5,10 @@ import (
 	"timeslot-app/app"
 	_ "timeslot-app/docs"
 	"timeslot-app/middleware"
+	"timeslot-app/models"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
 	swaggerFiles "github.com/swaggo/files"     // swagger embed files
 	ginSwagger "github.com/swaggo/gin-swagger" // gin-swagger middleware
 	// swagger embed files
@@ -15,6 +17,8 @@ import (
 // @title           OpenAPI Time Slot App API
 // @version         1.0
 // @description     This is a sample server celler server.
+// @description     Requests are made in the organization whose slug is sent in the X-Org header or used as the subdomain,
+// @description     in the default organization when they name neither.
 // @termsOfService  http://swagger.io/terms/
 
 // @contact.name   API Support
@@ -29,6 +33,15 @@ import (
 
 // @securityDefinitions.basic  BasicAuth
 
+// @securityDefinitions.apikey  BearerAuth
+// @in                          header
+// @name                        Authorization
+// @description                 "Bearer " followed by an API key or a JWT
+
+// @securityDefinitions.apikey  ApiKeyAuth
+// @in                          header
+// @name                        X-API-Key
+
 // @externalDocs.description  OpenAPI
 // @externalDocs.url          https://swagger.io/resources/open-api/
 func main() {
@@ -48,28 +61,192 @@ func NewRouter(app *app.App) *gin.Engine {
 
 	r := gin.Default()
 	r.Use(middleware.ErrorHandler)
-	v1 := r.Group("/api/v1")
+	v1 := r.Group("/api/v1", app.Tenancy.ResolveOrg)
+	{
+		orgs := v1.Group("/orgs")
+		orgs.POST("", app.Auth.Authenticate, app.OrgService.CreateOrg)
+		orgs.GET("/current", app.Auth.Authenticate, app.OrgService.GetCurrentOrg)
+	}
+
 	{
-		timeslot := v1.Group("/timeslots")
-		timeslot.POST("", app.TimeslotService.CreateTimeSlot)
+		timeslot := v1.Group("/timeslots", app.Auth.Authenticate)
+		timeslot.POST("", app.Policy.Require(middleware.ActionCreateTimeSlots, middleware.UserInBody("time_slots", timeSlotsOwner)),
+			app.TimeslotService.CreateTimeSlot)
 		timeslot.GET("/:username", app.TimeslotService.GetTimeSlotsByUserName)
 		timeslot.GET("/recommend", app.TimeslotService.RecommendSlots)
-		timeslot.DELETE("/:username", app.TimeslotService.DeleteTimeSlotsByUserName)
+		timeslot.DELETE("/:username", app.Policy.Require(middleware.ActionDeleteTimeSlots, middleware.UserInPath("time_slots", "username")),
+			app.TimeslotService.DeleteTimeSlotsByUserName)
+	}
+
+	{
+		// the calendar feed takes its own token, so it needs no credentials
+		public := v1.Group("/users")
+		public.GET("/:username/calendar.ics", app.CalendarService.GetCalendarFeed)
+
+		// admins add users, only the first user of an organization signs up without credentials
+		v1.POST("/users", app.Auth.FirstUser(app.UserService.CreateUser), app.Auth.Authenticate,
+			app.Policy.Require(middleware.ActionCreateUser, middleware.NoResource("user")), app.UserService.CreateUser)
+
+		users := v1.Group("/users", app.Auth.Authenticate)
+		users.GET("", app.UserService.ListUsers)
+		// gin needs one wildcard name per segment, so the user ID arrives as :username
+		users.GET("/:username", userIDParam(app.UserService.GetUser))
+		users.PATCH("/:username", app.Policy.Require(middleware.ActionUpdateUser, middleware.UserIDInPath("user", "username")),
+			userIDParam(app.UserService.UpdateUser))
+		users.DELETE("/:username", app.Policy.Require(middleware.ActionDeleteUser, middleware.UserIDInPath("user", "username")),
+			userIDParam(app.UserService.DeleteUser))
+		users.GET("/:username/reminders", app.UserService.GetReminderSettings)
+		users.PUT("/:username/reminders", app.Policy.Require(middleware.ActionUpdateUser, middleware.UserInPath("reminder_settings", "username")),
+			app.UserService.SetReminderSettings)
+		users.GET("/:username/profile", app.UserService.GetProfile)
+		users.PUT("/:username/profile", app.Policy.Require(middleware.ActionUpdateUser, middleware.UserInPath("profile", "username")),
+			app.UserService.SetProfile)
+		// the token opens the private feed and CalDAV writes, so only the user and admins issue it
+		users.POST("/:username/calendar/token", app.Policy.Require(middleware.ActionIssueCalendarToken, middleware.UserInPath("calendar_token", "username")),
+			app.CalendarService.IssueCalendarToken)
+		users.POST("/:username/calendar/import", app.Policy.Require(middleware.ActionImportCalendar, middleware.UserInPath("calendar", "username")),
+			app.CalendarService.ImportCalendar)
+		users.POST("/:username/event-types", app.Policy.Require(middleware.ActionManageEventTypes, middleware.UserInPath("event_types", "username")),
+			app.BookingService.CreateEventType)
+		users.GET("/:username/event-types", app.BookingService.ListEventTypes)
+		users.DELETE("/:username/event-types/:slug", app.Policy.Require(middleware.ActionManageEventTypes, middleware.UserInPath("event_types", "username")),
+			app.BookingService.DeleteEventType)
+		// API keys are only ever handled by their own user
+		users.POST("/:username/api-keys", app.Policy.Require(middleware.ActionManageAPIKeys, middleware.UserInPath("api_keys", "username")),
+			app.UserService.CreateAPIKey)
+		users.GET("/:username/api-keys", app.Policy.Require(middleware.ActionManageAPIKeys, middleware.UserInPath("api_keys", "username")),
+			app.UserService.ListAPIKeys)
+		users.DELETE("/:username/api-keys/:keyID", app.Policy.Require(middleware.ActionManageAPIKeys, middleware.UserInPath("api_keys", "username")),
+			app.UserService.DeleteAPIKey)
+		users.PUT("/:username/role", app.Policy.Require(middleware.ActionSetRole, middleware.UserInPath("user", "username")),
+			app.UserService.SetUserRole)
+		users.POST("/:username/delegates", app.Policy.Require(middleware.ActionManageDelegates, middleware.UserInPath("delegates", "username")),
+			app.UserService.AddDelegate)
+		users.GET("/:username/delegates", app.UserService.ListDelegates)
+		users.PUT("/:username/delegates/:delegate", app.Policy.Require(middleware.ActionManageDelegates, middleware.UserInPath("delegates", "username")),
+			app.UserService.SetDelegateScopes)
+		users.DELETE("/:username/delegates/:delegate", app.Policy.Require(middleware.ActionManageDelegates, middleware.UserInPath("delegates", "username")),
+			app.UserService.RemoveDelegate)
 	}
 
 	{
-		users := v1.Group("/users")
-		users.POST("", app.UserService.CreateUser)
+		events := v1.Group("/events", app.Auth.Authenticate)
+		events.POST("", app.Policy.Require(middleware.ActionCreateEvent, middleware.UserInBody("event", eventOwner)),
+			app.EventService.CreateEvent)
+		events.GET("/:username", eventOrUserEvents(
+			[]gin.HandlerFunc{app.Policy.Permit(middleware.ActionViewPrivate, middleware.EventInPath("eventID")), app.EventService.GetEvent},
+			[]gin.HandlerFunc{app.Policy.Permit(middleware.ActionViewPrivate, middleware.UserInPath("events", "username")), app.EventService.GetEventsForUser},
+		))
+		events.PATCH("/:eventID", app.Policy.Require(middleware.ActionUpdateEvent, middleware.EventInPath("eventID")),
+			app.EventService.UpdateEvent)
+		events.PUT("/:eventID", app.Policy.Require(middleware.ActionUpdateEvent, middleware.EventInPath("eventID")),
+			app.EventService.ReplaceEvent)
+		events.DELETE("/:eventID", app.Policy.Require(middleware.ActionDeleteEvent, middleware.EventInPath("eventID")),
+			app.EventService.DeleteEvent)
+		events.POST("/:eventID/restore", app.Policy.Require(middleware.ActionUpdateEvent, middleware.EventInPath("eventID")),
+			app.EventService.RestoreEvent)
+		events.PATCH("/:eventID/occurrences", app.Policy.Require(middleware.ActionUpdateEvent, middleware.EventInPath("eventID")),
+			app.EventService.UpdateOccurrence)
+		// participants answer for themselves, the handler takes them from the credentials
+		events.POST("/:eventID/rsvp", app.EventService.RespondToEvent)
+		// gin needs one wildcard name per segment across GET routes, so the event ID arrives as :username
+		events.GET("/:username/rsvp", func(ctx *gin.Context) {
+			ctx.AddParam("eventID", ctx.Param("username"))
+			app.EventService.GetEventResponses(ctx)
+		})
 	}
 
 	{
-		events := v1.Group("/events")
-		events.POST("", app.EventService.CreateEvent)
-		events.GET("/:username", app.EventService.GetEventsForUser)
-		// events.GET("/{eventID}", app.EventService.GetEvent)
-		events.DELETE("/:eventID", app.EventService.DeleteEvent)
+		groups := v1.Group("/groups", app.Auth.Authenticate)
+		groups.POST("", app.Policy.Require(middleware.ActionManageGroups, middleware.Caller("group")), app.GroupService.CreateGroup)
+		groups.GET("", app.GroupService.ListGroups)
+		groups.GET("/:name", app.GroupService.GetGroup)
+		groups.PUT("/:name/members", app.Policy.Require(middleware.ActionManageGroups, middleware.GroupInPath("name")),
+			app.GroupService.SetGroupMembers)
+		groups.DELETE("/:name", app.Policy.Require(middleware.ActionManageGroups, middleware.GroupInPath("name")),
+			app.GroupService.DeleteGroup)
+	}
+
+	{
+		// webhooks receive the events of the whole organization, so only admins manage them
+		webhooks := v1.Group("/webhooks", app.Auth.Authenticate,
+			app.Policy.Require(middleware.ActionManageWebhooks, middleware.NoResource("webhook")))
+		webhooks.POST("", app.WebhookService.CreateWebhook)
+		webhooks.GET("", app.WebhookService.ListWebhooks)
+		webhooks.DELETE("/:webhookID", app.WebhookService.DeleteWebhook)
+		webhooks.GET("/:webhookID/deliveries", app.WebhookService.ListWebhookDeliveries)
+		webhooks.POST("/:webhookID/deliveries/:deliveryID/retry", app.WebhookService.RetryWebhookDelivery)
+	}
+
+	{
+		audit := v1.Group("/audit", app.Auth.Authenticate)
+		audit.GET("", app.Policy.Require(middleware.ActionReadAudit, middleware.NoResource("audit_log")), app.AuditService.ListAudit)
+	}
+
+	// single sign-on is how users without an API key get one
+	{
+		sso := v1.Group("/auth/oidc")
+		sso.GET("/login", app.SSOService.Login)
+		sso.GET("/callback", app.SSOService.Callback)
+	}
+
+	// booking pages are public, invitees don't have an account
+	{
+		booking := v1.Group("/booking")
+		booking.GET("/:username", app.BookingService.GetBookingPage)
+		booking.GET("/:username/:slug/times", app.BookingService.GetBookableTimes)
+		booking.POST("/:username/:slug", app.BookingService.Book)
+	}
+
+	// CalDAV sits outside the JSON API, clients are pointed at /caldav/<username>/ with their calendar token as password
+	{
+		caldav := r.Group("/caldav", app.Tenancy.ResolveOrg)
+		caldav.OPTIONS("/:username/", app.CalendarService.CalDAVOptions)
+		caldav.Handle("PROPFIND", "/:username/", app.CalendarService.PropfindCalDAV)
+		caldav.Handle("PROPFIND", "/:username/:resource", app.CalendarService.PropfindCalDAV)
+		caldav.Handle("REPORT", "/:username/", app.CalendarService.ReportCalDAV)
+		caldav.GET("/:username/:resource", app.CalendarService.GetCalDAVObject)
+		caldav.PUT("/:username/:resource", app.CalendarService.PutCalDAVObject)
+		caldav.DELETE("/:username/:resource", app.CalendarService.DeleteCalDAVObject)
 	}
 
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	return r
 }
+
+// userIDParam hands the :username segment of a users route to the handler as :id
+func userIDParam(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.AddParam("id", ctx.Param("username"))
+		handler(ctx)
+	}
+}
+
+// eventOrUserEvents serves GET on the :username segment of an events route, gin allows only one wildcard name there.
+// A segment that is a UUID names an event and runs the event handlers with it as :eventID, any other segment names
+// the user whose events the user handlers list.
+func eventOrUserEvents(event, userEvents []gin.HandlerFunc) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		handlers := userEvents
+		if _, err := uuid.FromString(ctx.Param("username")); err == nil {
+			ctx.AddParam("eventID", ctx.Param("username"))
+			handlers = event
+		}
+		for _, handler := range handlers {
+			if ctx.IsAborted() {
+				return
+			}
+			handler(ctx)
+		}
+	}
+}
+
+// timeSlotsOwner names the user a time slot request publishes availability for
+func timeSlotsOwner(req models.UserTimeSlotRequest) string {
+	return req.UserName
+}
+
+// eventOwner names the user an event request books the event for
+func eventOwner(req models.EventRequest) string {
+	return req.EventOwner
+}
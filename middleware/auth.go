@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+	"timeslot-app/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+// identityKey is where the authenticated caller is kept in the gin context
+const identityKey = "identity"
+
+// firstUserKey marks the sign-up of the first user of an organization in the gin context
+const firstUserKey = "first_user"
+
+// Authenticator identifies the caller of a request by an API key, sent as a bearer token or in X-API-Key,
+// or by a JWT bearer token when JWT is configured
+type Authenticator struct {
+	APIKeyRepo repository.APIKeyRepo
+	UserRepo   repository.UserRepo
+	// JWT verifies bearer tokens, they are refused when it is nil
+	JWT *utils.JWTVerifier
+}
+
+func NewAuthenticator(db *pgx.ConnPool, jwt *utils.JWTVerifier) *Authenticator {
+	return &Authenticator{
+		APIKeyRepo: repository.NewAPIKeyRepository(db),
+		UserRepo:   repository.NewUserRepo(db),
+		JWT:        jwt,
+	}
+}
+
+// NewJWTVerifier builds the verifier for the configured secret or JWKS file, nil when neither is set
+func NewJWTVerifier(cfg models.JWTConfig) (*utils.JWTVerifier, error) {
+	if cfg.Secret == "" && cfg.JWKSFile == "" {
+		return nil, nil
+	}
+
+	verifier := &utils.JWTVerifier{Secret: []byte(cfg.Secret), Issuer: cfg.Issuer, Audience: cfg.Audience}
+	if cfg.JWKSFile != "" {
+		keys, err := utils.LoadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		verifier.Keys = keys
+	}
+	return verifier, nil
+}
+
+// Authenticate rejects requests without valid credentials with a 401 and attaches the caller's identity otherwise.
+// Callers are only recognised in their own organization, credentials of another organization are refused.
+func (a *Authenticator) Authenticate(c *gin.Context) {
+	credential := c.GetHeader("X-API-Key")
+	if credential == "" {
+		scheme, token, found := strings.Cut(c.GetHeader("Authorization"), " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			credential = strings.TrimSpace(token)
+		}
+	}
+	if credential == "" {
+		unauthorized(c, "authentication required, send an API key or a bearer token")
+		return
+	}
+
+	org, _ := CurrentOrg(c)
+	var identity models.Identity
+	var err error
+	if utils.IsAPIKey(credential) {
+		identity, err = a.identifyAPIKey(org.ID, credential)
+	} else {
+		identity, err = a.identifyJWT(org.ID, credential)
+	}
+	if err != nil {
+		unauthorized(c, err.Error())
+		return
+	}
+
+	c.Set(identityKey, identity)
+	c.Next()
+}
+
+// identifyAPIKey finds the user of an API key, keys of users of other organizations are refused
+func (a *Authenticator) identifyAPIKey(orgID uuid.UUID, key string) (models.Identity, error) {
+	apiKey, user, err := a.APIKeyRepo.GetAPIKeyByHash(utils.HashAPIKey(key))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Identity{}, errors.New("invalid API key")
+	}
+	if err != nil {
+		log.Printf("error looking up API key:: %s", err)
+		return models.Identity{}, errors.New("API key could not be checked")
+	}
+	if user.OrgID != orgID {
+		return models.Identity{}, errors.New("API key isn't valid for this organization")
+	}
+
+	if err := a.APIKeyRepo.TouchAPIKey(apiKey.ID, time.Now()); err != nil {
+		log.Printf("error recording API key use:: %s", err)
+	}
+	return models.Identity{
+		UserID:   user.ID,
+		OrgID:    user.OrgID,
+		UserName: user.Name,
+		Role:     user.Role,
+		Method:   models.AuthMethodAPIKey,
+		APIKeyID: uuid.NullUUID{UUID: apiKey.ID, Valid: true},
+	}, nil
+}
+
+// identifyJWT verifies a bearer token, its subject is the sub claim of a single sign-on account or else the ID of a
+// user of the organization. Names are free text anyone can sign up under, so they never identify a token
+func (a *Authenticator) identifyJWT(orgID uuid.UUID, token string) (models.Identity, error) {
+	if a.JWT == nil {
+		return models.Identity{}, errors.New("bearer tokens aren't accepted, use an API key")
+	}
+	claims, err := a.JWT.Verify(token, time.Now())
+	if err != nil {
+		return models.Identity{}, err
+	}
+
+	user, err := a.UserRepo.GetBySubject(orgID, claims.Subject)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if userID, parseErr := uuid.FromString(claims.Subject); parseErr == nil {
+			user, err = a.UserRepo.GetByID(orgID, userID)
+		}
+	}
+	if err != nil {
+		return models.Identity{}, errors.New("token subject is not a user")
+	}
+	return models.Identity{UserID: user.ID, OrgID: user.OrgID, UserName: user.Name, Role: user.Role, Method: models.AuthMethodJWT}, nil
+}
+
+// FirstUser answers the sign-up of the first user of an organization with signUp without asking for credentials,
+// so a new installation can be set up. Once the organization has a user the request goes on to the handlers
+// after FirstUser, which authenticate and authorize it.
+func (a *Authenticator) FirstUser(signUp gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		org, _ := CurrentOrg(c)
+		_, total, err := a.UserRepo.List(org.ID, "", 1, 0)
+		if err != nil {
+			log.Printf("error counting users:: %s", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "users could not be checked"})
+			return
+		}
+		if total > 0 {
+			c.Next()
+			return
+		}
+
+		c.Set(firstUserKey, true)
+		signUp(c)
+		c.Abort()
+	}
+}
+
+// IsFirstUser reports whether the request signs up the first user of its organization
+func IsFirstUser(c *gin.Context) bool {
+	return c.GetBool(firstUserKey)
+}
+
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="timeslot"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message})
+}
+
+// CurrentIdentity returns the caller Authenticate identified, false on routes it doesn't guard
+func CurrentIdentity(c *gin.Context) (models.Identity, bool) {
+	value, found := c.Get(identityKey)
+	if !found {
+		return models.Identity{}, false
+	}
+	identity, ok := value.(models.Identity)
+	return identity, ok
+}
+
+// SetIdentity attaches a caller to the context, for handlers and tests that authenticate by other means
+func SetIdentity(c *gin.Context, identity models.Identity) {
+	c.Set(identityKey, identity)
+}
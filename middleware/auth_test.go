@@ -0,0 +1,328 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockAPIKeyRepo struct {
+	mock.Mock
+}
+
+func (m *mockAPIKeyRepo) CreateAPIKey(key models.APIKey, keyHash string) error {
+	return m.Called(key, keyHash).Error(0)
+}
+
+func (m *mockAPIKeyRepo) ListAPIKeys(userID uuid.UUID) ([]models.APIKey, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]models.APIKey), args.Error(1)
+}
+
+func (m *mockAPIKeyRepo) DeleteAPIKey(userID, keyID uuid.UUID) error {
+	return m.Called(userID, keyID).Error(0)
+}
+
+func (m *mockAPIKeyRepo) GetAPIKeyByHash(keyHash string) (models.APIKey, models.User, error) {
+	args := m.Called(keyHash)
+	return args.Get(0).(models.APIKey), args.Get(1).(models.User), args.Error(2)
+}
+
+func (m *mockAPIKeyRepo) TouchAPIKey(keyID uuid.UUID, usedAt time.Time) error {
+	return m.Called(keyID, usedAt).Error(0)
+}
+
+func (m *mockAPIKeyRepo) PurgeExpiredAPIKeys(userID uuid.UUID, now time.Time) error {
+	return m.Called(userID, now).Error(0)
+}
+
+type mockUserRepo struct {
+	mock.Mock
+}
+
+func (m *mockUserRepo) Create(user models.User) error {
+	return m.Called(user).Error(0)
+}
+
+func (m *mockUserRepo) UserExists(orgID uuid.UUID, userName string) (bool, error) {
+	args := m.Called(orgID, userName)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockUserRepo) Get(orgID uuid.UUID, userName string) (models.User, error) {
+	args := m.Called(orgID, userName)
+	return args.Get(0).(models.User), args.Error(1)
+}
+
+func (m *mockUserRepo) GetByID(orgID, userID uuid.UUID) (models.User, error) {
+	args := m.Called(orgID, userID)
+	return args.Get(0).(models.User), args.Error(1)
+}
+
+func (m *mockUserRepo) GetUsersByNames(orgID uuid.UUID, userNames []string) ([]models.User, error) {
+	args := m.Called(orgID, userNames)
+	return args.Get(0).([]models.User), args.Error(1)
+}
+
+func (m *mockUserRepo) List(orgID uuid.UUID, search string, limit, offset int) ([]models.User, int, error) {
+	args := m.Called(orgID, search, limit, offset)
+	return args.Get(0).([]models.User), args.Int(1), args.Error(2)
+}
+
+func (m *mockUserRepo) Rename(orgID, userID uuid.UUID, name string) error {
+	return m.Called(orgID, userID, name).Error(0)
+}
+
+func (m *mockUserRepo) Delete(userID uuid.UUID, reassignTo uuid.NullUUID) error {
+	return m.Called(userID, reassignTo).Error(0)
+}
+
+func (m *mockUserRepo) SetRole(userID uuid.UUID, role string) error {
+	return m.Called(userID, role).Error(0)
+}
+
+func (m *mockUserRepo) PromoteAdmins(orgID uuid.UUID, userNames []string) error {
+	return m.Called(orgID, userNames).Error(0)
+}
+
+func (m *mockUserRepo) GetBySubject(orgID uuid.UUID, subject string) (models.User, error) {
+	args := m.Called(orgID, subject)
+	return args.Get(0).(models.User), args.Error(1)
+}
+
+func encodeJWTPart(v any) string {
+	data, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signHS256(secret string, header, claims map[string]any) string {
+	signed := encodeJWTPart(header) + "." + encodeJWTPart(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signES256(key *ecdsa.PrivateKey, header, claims map[string]any) string {
+	signed := encodeJWTPart(header) + "." + encodeJWTPart(claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, _ := ecdsa.Sign(rand.Reader, key, digest[:])
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// serve runs a request in testOrg with the header through Authenticate and reports the identity the handler saw
+func serve(auth *Authenticator, header, value string) (*httptest.ResponseRecorder, models.Identity) {
+	var seen models.Identity
+	router := gin.New()
+	router.GET("/private", withOrg(testOrg), auth.Authenticate, func(c *gin.Context) {
+		seen, _ = CurrentIdentity(c)
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/private", nil)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder, seen
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	user := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "kevin"}
+	key, prefix, err := utils.GenerateAPIKey()
+	assert.NoError(t, err)
+	apiKey := models.APIKey{ID: uuid.Must(uuid.NewV4()), UserID: user.ID, Prefix: prefix}
+
+	keys := new(mockAPIKeyRepo)
+	keys.On("GetAPIKeyByHash", utils.HashAPIKey(key)).Return(apiKey, user, nil)
+	keys.On("GetAPIKeyByHash", mock.Anything).Return(models.APIKey{}, models.User{}, pgx.ErrNoRows)
+	keys.On("TouchAPIKey", apiKey.ID, mock.Anything).Return(nil)
+	auth := &Authenticator{APIKeyRepo: keys, UserRepo: new(mockUserRepo)}
+
+	t.Run("Bearer", func(t *testing.T) {
+		recorder, identity := serve(auth, "Authorization", "Bearer "+key)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, models.Identity{UserID: user.ID, OrgID: testOrg.ID, UserName: "kevin", Method: models.AuthMethodAPIKey,
+			APIKeyID: uuid.NullUUID{UUID: apiKey.ID, Valid: true}}, identity)
+	})
+
+	t.Run("Header", func(t *testing.T) {
+		recorder, identity := serve(auth, "X-API-Key", key)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "kevin", identity.UserName)
+	})
+
+	t.Run("Unknown Key", func(t *testing.T) {
+		recorder, _ := serve(auth, "X-API-Key", utils.APIKeyPrefix+"0000")
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+
+	t.Run("No Credentials", func(t *testing.T) {
+		recorder, _ := serve(auth, "", "")
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Contains(t, recorder.Header().Get("WWW-Authenticate"), "Bearer")
+	})
+
+	t.Run("Basic Auth", func(t *testing.T) {
+		recorder, _ := serve(auth, "Authorization", "Basic a2V2aW46c2VjcmV0")
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+}
+
+func TestAuthenticateJWT(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	user := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "kevin"}
+	users := new(mockUserRepo)
+	users.On("GetByID", testOrg.ID, user.ID).Return(user, nil)
+	users.On("Get", testOrg.ID, "kevin").Return(user, nil)
+	users.On("Get", mock.Anything, mock.Anything).Return(models.User{}, pgx.ErrNoRows)
+	users.On("GetBySubject", testOrg.ID, "248289761001").Return(user, nil)
+	// an identity provider may use UUIDs as sub claims, one of them the ID of another user
+	anna := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "anna"}
+	users.On("GetBySubject", testOrg.ID, user.ID.String()).Return(models.User{}, pgx.ErrNoRows)
+	users.On("GetBySubject", testOrg.ID, anna.ID.String()).Return(user, nil)
+	users.On("GetByID", testOrg.ID, anna.ID).Return(anna, nil)
+	users.On("GetByID", mock.Anything, mock.Anything).Return(models.User{}, pgx.ErrNoRows)
+	users.On("GetBySubject", mock.Anything, mock.Anything).Return(models.User{}, pgx.ErrNoRows)
+
+	now := time.Now().Unix()
+	claims := func(sub string) map[string]any {
+		return map[string]any{"sub": sub, "iss": "https://idp.example.com", "aud": []string{"timeslot"}, "exp": now + 300}
+	}
+
+	t.Run("Secret", func(t *testing.T) {
+		verifier, err := NewJWTVerifier(models.JWTConfig{Secret: "s3cret", Issuer: "https://idp.example.com", Audience: "timeslot"})
+		assert.NoError(t, err)
+		auth := &Authenticator{APIKeyRepo: new(mockAPIKeyRepo), UserRepo: users, JWT: verifier}
+		header := map[string]any{"alg": "HS256", "typ": "JWT"}
+
+		recorder, identity := serve(auth, "Authorization", "Bearer "+signHS256("s3cret", header, claims(user.ID.String())))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, models.Identity{UserID: user.ID, OrgID: testOrg.ID, UserName: "kevin", Method: models.AuthMethodJWT}, identity)
+
+		recorder, _ = serve(auth, "Authorization", "Bearer "+signHS256("s3cret", header, claims("kevin")))
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code, "anyone can sign up under a name, so it doesn't identify a token")
+
+		recorder, identity = serve(auth, "Authorization", "Bearer "+signHS256("s3cret", header, claims("248289761001")))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, user.ID, identity.UserID, "single sign-on users are found by their sub claim")
+
+		recorder, identity = serve(auth, "Authorization", "Bearer "+signHS256("s3cret", header, claims(anna.ID.String())))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, user.ID, identity.UserID, "the sub claim is looked up before user IDs")
+
+		for name, token := range map[string]string{
+			"wrong secret":  signHS256("guess", header, claims(user.ID.String())),
+			"unknown user":  signHS256("s3cret", header, claims("nobody")),
+			"unknown id":    signHS256("s3cret", header, claims(uuid.Must(uuid.NewV4()).String())),
+			"none":          encodeJWTPart(map[string]any{"alg": "none"}) + "." + encodeJWTPart(claims(user.ID.String())) + ".",
+			"expired":       signHS256("s3cret", header, map[string]any{"sub": user.ID.String(), "iss": "https://idp.example.com", "aud": "timeslot", "exp": now - 3600}),
+			"other issuer":  signHS256("s3cret", header, map[string]any{"sub": user.ID.String(), "iss": "https://evil.example.com", "aud": "timeslot", "exp": now + 300}),
+			"no expiry":     signHS256("s3cret", header, map[string]any{"sub": user.ID.String(), "iss": "https://idp.example.com", "aud": "timeslot"}),
+			"not yet valid": signHS256("s3cret", header, map[string]any{"sub": user.ID.String(), "iss": "https://idp.example.com", "aud": "timeslot", "exp": now + 7200, "nbf": now + 3600}),
+		} {
+			recorder, _ := serve(auth, "Authorization", "Bearer "+token)
+			assert.Equal(t, http.StatusUnauthorized, recorder.Code, name)
+		}
+	})
+
+	t.Run("JWKS", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		jwks := fmt.Sprintf(`{"keys":[{"kty":"EC","kid":"k1","use":"sig","crv":"P-256","x":%q,"y":%q}]}`,
+			base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))))
+		path := filepath.Join(t.TempDir(), "jwks.json")
+		assert.NoError(t, os.WriteFile(path, []byte(jwks), 0o600))
+
+		verifier, err := NewJWTVerifier(models.JWTConfig{JWKSFile: path})
+		assert.NoError(t, err)
+		auth := &Authenticator{APIKeyRepo: new(mockAPIKeyRepo), UserRepo: users, JWT: verifier}
+
+		token := signES256(key, map[string]any{"alg": "ES256", "kid": "k1"}, claims(user.ID.String()))
+		recorder, identity := serve(auth, "Authorization", "Bearer "+token)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "kevin", identity.UserName)
+
+		// a token signed with a secret must not pass when only the JWKS is configured
+		forged := signHS256("", map[string]any{"alg": "HS256", "kid": "k1"}, claims(user.ID.String()))
+		recorder, _ = serve(auth, "Authorization", "Bearer "+forged)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+		other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		recorder, _ = serve(auth, "Authorization", "Bearer "+signES256(other, map[string]any{"alg": "ES256", "kid": "k1"}, claims(user.ID.String())))
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+
+	t.Run("Not Configured", func(t *testing.T) {
+		verifier, err := NewJWTVerifier(models.JWTConfig{})
+		assert.NoError(t, err)
+		assert.Nil(t, verifier)
+
+		auth := &Authenticator{APIKeyRepo: new(mockAPIKeyRepo), UserRepo: users}
+		token := signHS256("s3cret", map[string]any{"alg": "HS256"}, claims(user.ID.String()))
+		recorder, _ := serve(auth, "Authorization", "Bearer "+token)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+}
+
+func TestFirstUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	signUp := func(users *mockUserRepo) (*httptest.ResponseRecorder, bool) {
+		auth := &Authenticator{APIKeyRepo: new(mockAPIKeyRepo), UserRepo: users}
+		var firstUser bool
+		handler := func(c *gin.Context) {
+			firstUser = IsFirstUser(c)
+			c.Status(http.StatusCreated)
+		}
+		router := gin.New()
+		router.POST("/users", withOrg(testOrg), auth.FirstUser(handler), auth.Authenticate, handler)
+
+		req, _ := http.NewRequest(http.MethodPost, "/users", nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder, firstUser
+	}
+
+	t.Run("Empty Organization", func(t *testing.T) {
+		users := new(mockUserRepo)
+		users.On("List", testOrg.ID, "", 1, 0).Return([]models.User{}, 0, nil)
+
+		recorder, firstUser := signUp(users)
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		assert.True(t, firstUser)
+	})
+
+	t.Run("Organization With Users", func(t *testing.T) {
+		users := new(mockUserRepo)
+		users.On("List", testOrg.ID, "", 1, 0).Return([]models.User{{Name: "kevin"}}, 1, nil)
+
+		recorder, firstUser := signUp(users)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.False(t, firstUser)
+	})
+}
@@ -0,0 +1,391 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+// Actions the policy decides on
+const (
+	ActionCreateTimeSlots    = "timeslots.create"
+	ActionDeleteTimeSlots    = "timeslots.delete"
+	ActionCreateEvent        = "events.create"
+	ActionUpdateEvent        = "events.update"
+	ActionDeleteEvent        = "events.delete"
+	ActionViewPrivate        = "events.view_private"
+	ActionManageEventTypes   = "event_types.manage"
+	ActionImportCalendar     = "calendar.import"
+	ActionIssueCalendarToken = "calendar.issue_token"
+	ActionCreateUser         = "users.create"
+	ActionUpdateUser         = "users.update"
+	ActionDeleteUser         = "users.delete"
+	ActionManageDelegates    = "delegates.manage"
+	ActionSetRole            = "users.set_role"
+	ActionReadAudit          = "audit.read"
+	ActionManageGroups       = "groups.manage"
+	ActionManageWebhooks     = "webhooks.manage"
+	ActionManageAPIKeys      = "api_keys.manage"
+)
+
+// adminActions are only ever allowed to admins
+var adminActions = map[string]bool{
+	ActionCreateUser:     true,
+	ActionSetRole:        true,
+	ActionReadAudit:      true,
+	ActionManageWebhooks: true,
+}
+
+// ownerActions are only allowed to the owner of the resource, neither admins nor delegates take them on their behalf
+var ownerActions = map[string]bool{
+	ActionManageAPIKeys: true,
+}
+
+// readActions change nothing, so viewers may take them as well
+var readActions = map[string]bool{
+	ActionViewPrivate: true,
+}
+
+// delegableActions are allowed to the delegates of the resource owner whose grant has the scope as well as the owner
+var delegableActions = map[string]string{
+	ActionCreateTimeSlots:  models.DelegateScopeAvailability,
+	ActionDeleteTimeSlots:  models.DelegateScopeAvailability,
+	ActionImportCalendar:   models.DelegateScopeAvailability,
+	ActionCreateEvent:      models.DelegateScopeEvents,
+	ActionUpdateEvent:      models.DelegateScopeEvents,
+	ActionDeleteEvent:      models.DelegateScopeEvents,
+	ActionManageEventTypes: models.DelegateScopeEvents,
+	ActionViewPrivate:      models.DelegateScopePrivateDetails,
+}
+
+// permittedKey prefixes where Permit keeps its decisions in the gin context
+const permittedKey = "permitted:"
+
+// Resource is what a request acts on, Owner is the zero user for resources nobody owns
+type Resource struct {
+	Type  string
+	ID    string
+	Owner models.User
+}
+
+// ResourceResolver finds the resource of a request, found is false when it doesn't exist
+// and the handler is left to answer the request as it would otherwise
+type ResourceResolver func(p *Policy, c *gin.Context) (resource Resource, found bool, err error)
+
+// Policy decides which callers may take which actions on which resources. Routes declare the action they take with
+// Require, so the rules live here rather than in the handlers. Every refusal is written to the audit log.
+type Policy struct {
+	UserRepo     repository.UserRepo
+	EventRepo    repository.EventRepo
+	DelegateRepo repository.DelegateRepo
+	AuditRepo    repository.AuditRepo
+	GroupRepo    repository.GroupRepo
+}
+
+func NewPolicy(db *pgx.ConnPool) *Policy {
+	return &Policy{
+		UserRepo:     repository.NewUserRepo(db),
+		EventRepo:    repository.NewEventRepository(db),
+		DelegateRepo: repository.NewDelegateRepository(db),
+		AuditRepo:    repository.NewAuditRepository(db),
+		GroupRepo:    repository.NewGroupRepository(db),
+	}
+}
+
+// Decide reports whether the caller may take the action on the resource, and why not when they may not.
+// Nobody, admins included, acts on the data of another organization.
+func (p *Policy) Decide(identity models.Identity, action string, resource Resource) (bool, string, error) {
+	if resource.Owner.ID != uuid.Nil && resource.Owner.OrgID != identity.OrgID {
+		return false, "the resource belongs to another organization", nil
+	}
+	if ownerActions[action] {
+		if resource.Owner.ID != uuid.Nil && resource.Owner.ID == identity.UserID {
+			return true, "", nil
+		}
+		return false, fmt.Sprintf("only %s may do this", resource.Owner.Name), nil
+	}
+	if identity.Role == models.RoleAdmin {
+		return true, "", nil
+	}
+	if adminActions[action] {
+		return false, "only admins may do this", nil
+	}
+	if identity.Role == models.RoleViewer && !readActions[action] {
+		return false, "viewers can't make changes", nil
+	}
+	if resource.Owner.ID == identity.UserID {
+		return true, "", nil
+	}
+	if resource.Owner.ID == uuid.Nil {
+		return false, "the resource has no owner, only admins may do this", nil
+	}
+	if scope, ok := delegableActions[action]; ok {
+		delegate, err := p.DelegateRepo.IsDelegate(resource.Owner.ID, identity.UserID, scope)
+		if err != nil {
+			return false, "", err
+		}
+		if delegate {
+			return true, "", nil
+		}
+		return false, fmt.Sprintf("only %s, their delegates with the %s scope and admins may do this", resource.Owner.Name, scope), nil
+	}
+	return false, fmt.Sprintf("only %s and admins may do this", resource.Owner.Name), nil
+}
+
+// Require lets the request through to the handler only when the caller may take the action on the resource
+func (p *Policy) Require(action string, resolve ResourceResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, found := CurrentIdentity(c)
+		if !found {
+			unauthorized(c, "authentication required, send an API key or a bearer token")
+			return
+		}
+
+		resource, found, err := resolve(p, c)
+		if err != nil {
+			resolveFailed(c, action, err)
+			return
+		}
+		if !found {
+			c.Next()
+			return
+		}
+
+		allowed, reason, err := p.Decide(identity, action, resource)
+		if err != nil {
+			log.Printf("error deciding %s:: %s", action, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "permission could not be checked"})
+			return
+		}
+		if !allowed {
+			p.audit(identity, action, resource, reason)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": reason})
+			return
+		}
+		c.Next()
+	}
+}
+
+// rejection turns away a request whose resource can't be resolved from what the caller sent
+type rejection struct {
+	status  int
+	message string
+}
+
+func (r rejection) Error() string {
+	return r.message
+}
+
+// resolveFailed answers a request whose resource couldn't be resolved, with the status of a rejection and
+// as an internal error otherwise
+func resolveFailed(c *gin.Context, action string, err error) {
+	var rejected rejection
+	if errors.As(err, &rejected) {
+		c.AbortWithStatusJSON(rejected.status, gin.H{"error": rejected.message})
+		return
+	}
+	log.Printf("error resolving %s resource:: %s", action, err)
+	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "permission could not be checked"})
+}
+
+// Permit decides like Require but lets every request through to the handler, which asks Permitted whether the caller
+// may take the action and leaves out what they may not see rather than refusing the request. Nothing is audited.
+func (p *Policy) Permit(action string, resolve ResourceResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, found := CurrentIdentity(c)
+		if !found {
+			c.Next()
+			return
+		}
+
+		resource, found, err := resolve(p, c)
+		if err != nil {
+			resolveFailed(c, action, err)
+			return
+		}
+		if !found {
+			c.Next()
+			return
+		}
+
+		allowed, _, err := p.Decide(identity, action, resource)
+		if err != nil {
+			log.Printf("error deciding %s:: %s", action, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "permission could not be checked"})
+			return
+		}
+		c.Set(permittedKey+action, allowed)
+		c.Next()
+	}
+}
+
+// Permitted reports whether Permit found the caller may take the action, it is false when Permit didn't run
+func Permitted(c *gin.Context, action string) bool {
+	return c.GetBool(permittedKey + action)
+}
+
+// audit records a refusal, a failure to record it is logged rather than failing the request
+func (p *Policy) audit(identity models.Identity, action string, resource Resource, reason string) {
+	entry := models.AuditEntry{
+		OrgID:        identity.OrgID,
+		OccurredAt:   time.Now().UTC(),
+		UserID:       identity.UserID,
+		UserName:     identity.UserName,
+		Role:         identity.Role,
+		Action:       action,
+		ResourceType: resource.Type,
+		ResourceID:   resource.ID,
+		Owner:        resource.Owner.Name,
+		Reason:       reason,
+	}
+	log.Printf("denied %s to %s on %s %s:: %s", action, identity.UserName, resource.Type, resource.ID, reason)
+
+	id, err := uuid.NewV4()
+	if err == nil {
+		entry.ID = id
+		err = p.AuditRepo.RecordAudit(entry)
+	}
+	if err != nil {
+		log.Printf("error recording audit entry:: %s", err)
+	}
+}
+
+// userResource returns the user of the request's organization with the name as a resource they own
+func (p *Policy) userResource(c *gin.Context, resourceType, userName string) (Resource, bool, error) {
+	org, _ := CurrentOrg(c)
+	user, err := p.UserRepo.Get(org.ID, userName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Resource{}, false, nil
+	}
+	if err != nil {
+		return Resource{}, false, err
+	}
+	return Resource{Type: resourceType, ID: user.ID.String(), Owner: user}, true, nil
+}
+
+// UserInPath resolves the data of the user named by a path parameter
+func UserInPath(resourceType, param string) ResourceResolver {
+	return func(p *Policy, c *gin.Context) (Resource, bool, error) {
+		return p.userResource(c, resourceType, c.Param(param))
+	}
+}
+
+// UserIDInPath resolves the data of the user whose ID is a path parameter
+func UserIDInPath(resourceType, param string) ResourceResolver {
+	return func(p *Policy, c *gin.Context) (Resource, bool, error) {
+		userID, err := uuid.FromString(c.Param(param))
+		if err != nil {
+			return Resource{}, false, nil
+		}
+		org, _ := CurrentOrg(c)
+		user, err := p.UserRepo.GetByID(org.ID, userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Resource{}, false, nil
+		}
+		if err != nil {
+			return Resource{}, false, err
+		}
+		return Resource{Type: resourceType, ID: user.ID.String(), Owner: user}, true, nil
+	}
+}
+
+// UserInBody resolves the data of the user the JSON body names. The body is decoded into the request type the
+// handler binds, the way gin binds it, so the policy and the handler read the same owner. It is left for the handler
+// to read again. Bodies that can't be decoded or don't name a user of the organization are turned away.
+func UserInBody[T any](resourceType string, owner func(req T) string) ResourceResolver {
+	return func(p *Policy, c *gin.Context) (Resource, bool, error) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return Resource{}, false, err
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var req T
+		if err := json.NewDecoder(bytes.NewReader(body)).Decode(&req); err != nil {
+			return Resource{}, false, rejection{http.StatusBadRequest, "Invalid request body"}
+		}
+		userName := owner(req)
+		if userName == "" {
+			return Resource{}, false, rejection{http.StatusBadRequest, "the request doesn't name a user"}
+		}
+		resource, found, err := p.userResource(c, resourceType, userName)
+		if err == nil && !found {
+			return Resource{}, false, rejection{http.StatusBadRequest, "unknown user " + userName}
+		}
+		return resource, found, err
+	}
+}
+
+// EventInPath resolves the event with the ID in a path parameter, it is owned by the event owner
+func EventInPath(param string) ResourceResolver {
+	return func(p *Policy, c *gin.Context) (Resource, bool, error) {
+		eventID := c.Param(param)
+		if _, err := uuid.FromString(eventID); err != nil {
+			return Resource{}, false, nil
+		}
+		org, _ := CurrentOrg(c)
+		event, err := p.EventRepo.GetEvent(org.ID, eventID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Resource{}, false, nil
+		}
+		if err != nil {
+			return Resource{}, false, err
+		}
+		owner, err := p.UserRepo.GetByID(org.ID, event.EventOwner)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return Resource{}, false, err
+		}
+		return Resource{Type: "event", ID: eventID, Owner: owner}, true, nil
+	}
+}
+
+// GroupInPath resolves the group named by a path parameter, it is owned by the user who created it
+func GroupInPath(param string) ResourceResolver {
+	return func(p *Policy, c *gin.Context) (Resource, bool, error) {
+		org, _ := CurrentOrg(c)
+		group, err := p.GroupRepo.GetGroup(org.ID, strings.TrimPrefix(c.Param(param), models.GroupPrefix))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Resource{}, false, nil
+		}
+		if err != nil {
+			return Resource{}, false, err
+		}
+
+		var owner models.User
+		if group.CreatedBy.Valid {
+			owner, err = p.UserRepo.GetByID(org.ID, group.CreatedBy.UUID)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return Resource{}, false, err
+			}
+		}
+		return Resource{Type: "group", ID: group.ID.String(), Owner: owner}, true, nil
+	}
+}
+
+// Caller is for resources the caller is creating, they own them, so only viewers are turned away
+func Caller(resourceType string) ResourceResolver {
+	return func(p *Policy, c *gin.Context) (Resource, bool, error) {
+		identity, _ := CurrentIdentity(c)
+		owner := models.User{ID: identity.UserID, OrgID: identity.OrgID, Name: identity.UserName, Role: identity.Role}
+		return Resource{Type: resourceType, Owner: owner}, true, nil
+	}
+}
+
+// NoResource is for actions that aren't taken on anyone's data, such as reading the audit log
+func NoResource(resourceType string) ResourceResolver {
+	return func(p *Policy, c *gin.Context) (Resource, bool, error) {
+		return Resource{Type: resourceType}, true, nil
+	}
+}
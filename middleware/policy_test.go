@@ -0,0 +1,318 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// mockEventRepo only implements the lookup the policy makes, the rest of the interface is left nil
+type mockEventRepo struct {
+	repository.EventRepo
+	mock.Mock
+}
+
+func (m *mockEventRepo) GetEvent(orgID uuid.UUID, eventID string) (models.Event, error) {
+	args := m.Called(orgID, eventID)
+	return args.Get(0).(models.Event), args.Error(1)
+}
+
+type mockDelegateRepo struct {
+	mock.Mock
+}
+
+func (m *mockDelegateRepo) AddDelegate(principalID, delegateID uuid.UUID, scopes []string, createdAt time.Time) error {
+	return m.Called(principalID, delegateID, scopes, createdAt).Error(0)
+}
+
+func (m *mockDelegateRepo) ListDelegates(principalID uuid.UUID) ([]models.Delegate, error) {
+	args := m.Called(principalID)
+	return args.Get(0).([]models.Delegate), args.Error(1)
+}
+
+func (m *mockDelegateRepo) RemoveDelegate(principalID, delegateID uuid.UUID) error {
+	return m.Called(principalID, delegateID).Error(0)
+}
+
+func (m *mockDelegateRepo) SetDelegateScopes(principalID, delegateID uuid.UUID, scopes []string) (models.Delegate, error) {
+	args := m.Called(principalID, delegateID, scopes)
+	return args.Get(0).(models.Delegate), args.Error(1)
+}
+
+func (m *mockDelegateRepo) IsDelegate(principalID, delegateID uuid.UUID, scope string) (bool, error) {
+	args := m.Called(principalID, delegateID, scope)
+	return args.Bool(0), args.Error(1)
+}
+
+type mockAuditRepo struct {
+	mock.Mock
+}
+
+func (m *mockAuditRepo) RecordAudit(entry models.AuditEntry) error {
+	return m.Called(entry).Error(0)
+}
+
+func (m *mockAuditRepo) ListAudit(orgID uuid.UUID, limit, offset int) ([]models.AuditEntry, error) {
+	args := m.Called(orgID, limit, offset)
+	return args.Get(0).([]models.AuditEntry), args.Error(1)
+}
+
+func TestDecide(t *testing.T) {
+	kevin := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "kevin", Role: models.RoleMember}
+	anna := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "anna", Role: models.RoleMember}
+	assistant := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "assistant", Role: models.RoleMember}
+	root := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "root", Role: models.RoleAdmin}
+	guest := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "guest", Role: models.RoleViewer}
+	otherRoot := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: otherOrg.ID, Name: "root", Role: models.RoleAdmin}
+
+	delegates := new(mockDelegateRepo)
+	// the assistant manages kevin's calendar without the private_details scope
+	delegates.On("IsDelegate", kevin.ID, assistant.ID, models.DelegateScopeAvailability).Return(true, nil)
+	delegates.On("IsDelegate", kevin.ID, assistant.ID, models.DelegateScopeEvents).Return(true, nil)
+	delegates.On("IsDelegate", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	policy := &Policy{DelegateRepo: delegates}
+
+	identity := func(user models.User) models.Identity {
+		return models.Identity{UserID: user.ID, OrgID: user.OrgID, UserName: user.Name, Role: user.Role}
+	}
+	kevinsSlots := Resource{Type: "time_slots", ID: kevin.ID.String(), Owner: kevin}
+	kevinsEvent := Resource{Type: "event", ID: uuid.Must(uuid.NewV4()).String(), Owner: kevin}
+
+	for _, tc := range []struct {
+		name     string
+		caller   models.User
+		action   string
+		resource Resource
+		allowed  bool
+	}{
+		{"owner creates slots", kevin, ActionCreateTimeSlots, kevinsSlots, true},
+		{"owner cancels event", kevin, ActionDeleteEvent, kevinsEvent, true},
+		{"other member creates slots", anna, ActionCreateTimeSlots, kevinsSlots, false},
+		{"other member deletes slots", anna, ActionDeleteTimeSlots, kevinsSlots, false},
+		{"other member cancels event", anna, ActionDeleteEvent, kevinsEvent, false},
+		{"delegate deletes slots", assistant, ActionDeleteTimeSlots, kevinsSlots, true},
+		{"delegate cancels event", assistant, ActionDeleteEvent, kevinsEvent, true},
+		{"delegate books event", assistant, ActionCreateEvent, Resource{Type: "event", Owner: kevin}, true},
+		{"other member books event", anna, ActionCreateEvent, Resource{Type: "event", Owner: kevin}, false},
+		{"delegate without scope views private events", assistant, ActionViewPrivate, Resource{Type: "events", Owner: kevin}, false},
+		{"viewer views own private events", guest, ActionViewPrivate, Resource{Type: "events", Owner: guest}, true},
+		{"viewer views private events of others", guest, ActionViewPrivate, Resource{Type: "events", Owner: kevin}, false},
+		{"delegate adds delegates", assistant, ActionManageDelegates, Resource{Type: "delegates", Owner: kevin}, false},
+		{"admin deletes slots", root, ActionDeleteTimeSlots, kevinsSlots, true},
+		{"admin reads audit", root, ActionReadAudit, Resource{Type: "audit_log"}, true},
+		{"member reads audit", kevin, ActionReadAudit, Resource{Type: "audit_log"}, false},
+		{"owner manages API keys", kevin, ActionManageAPIKeys, Resource{Type: "api_keys", Owner: kevin}, true},
+		{"viewer manages own API keys", guest, ActionManageAPIKeys, Resource{Type: "api_keys", Owner: guest}, true},
+		{"admin manages someone's API keys", root, ActionManageAPIKeys, Resource{Type: "api_keys", Owner: kevin}, false},
+		{"delegate manages API keys", assistant, ActionManageAPIKeys, Resource{Type: "api_keys", Owner: kevin}, false},
+		{"admin adds user", root, ActionCreateUser, Resource{Type: "user"}, true},
+		{"member adds user", kevin, ActionCreateUser, Resource{Type: "user"}, false},
+		{"member sets own role", kevin, ActionSetRole, Resource{Type: "user", Owner: kevin}, false},
+		{"viewer creates own slots", guest, ActionCreateTimeSlots, Resource{Type: "time_slots", Owner: guest}, false},
+		{"admin of another organization deletes slots", otherRoot, ActionDeleteTimeSlots, kevinsSlots, false},
+		{"admin of another organization cancels event", otherRoot, ActionDeleteEvent, kevinsEvent, false},
+		{"member creates group", anna, ActionManageGroups, Resource{Type: "group", Owner: anna}, true},
+		{"viewer creates group", guest, ActionManageGroups, Resource{Type: "group", Owner: guest}, false},
+		{"other member changes group", anna, ActionManageGroups, Resource{Type: "group", Owner: kevin}, false},
+		{"delegate changes group", assistant, ActionManageGroups, Resource{Type: "group", Owner: kevin}, false},
+		{"member changes group of deleted user", anna, ActionManageGroups, Resource{Type: "group"}, false},
+		{"admin changes group of deleted user", root, ActionManageGroups, Resource{Type: "group"}, true},
+		{"delegate reschedules event", assistant, ActionUpdateEvent, kevinsEvent, true},
+		{"other member reschedules event", anna, ActionUpdateEvent, kevinsEvent, false},
+		{"member updates own profile", kevin, ActionUpdateUser, Resource{Type: "profile", Owner: kevin}, true},
+		{"viewer updates own profile", guest, ActionUpdateUser, Resource{Type: "profile", Owner: guest}, false},
+		{"delegate updates profile", assistant, ActionUpdateUser, Resource{Type: "profile", Owner: kevin}, false},
+		{"other member deletes user", anna, ActionDeleteUser, Resource{Type: "user", Owner: kevin}, false},
+		{"admin deletes user", root, ActionDeleteUser, Resource{Type: "user", Owner: kevin}, true},
+		{"member issues own calendar token", kevin, ActionIssueCalendarToken, Resource{Type: "calendar_token", Owner: kevin}, true},
+		{"other member issues calendar token", anna, ActionIssueCalendarToken, Resource{Type: "calendar_token", Owner: kevin}, false},
+		{"delegate issues calendar token", assistant, ActionIssueCalendarToken, Resource{Type: "calendar_token", Owner: kevin}, false},
+		{"admin issues calendar token", root, ActionIssueCalendarToken, Resource{Type: "calendar_token", Owner: kevin}, true},
+		{"member manages webhooks", kevin, ActionManageWebhooks, Resource{Type: "webhook"}, false},
+		{"admin manages webhooks", root, ActionManageWebhooks, Resource{Type: "webhook"}, true},
+	} {
+		allowed, reason, err := policy.Decide(identity(tc.caller), tc.action, tc.resource)
+		assert.NoError(t, err, tc.name)
+		assert.Equal(t, tc.allowed, allowed, tc.name)
+		assert.Equal(t, tc.allowed, reason == "", tc.name)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	kevin := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "kevin", Role: models.RoleMember}
+	anna := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "anna", Role: models.RoleMember}
+	caller := models.Identity{UserID: anna.ID, OrgID: testOrg.ID, UserName: "anna", Role: models.RoleMember}
+	eventID := uuid.Must(uuid.NewV4()).String()
+
+	newPolicy := func() (*Policy, *mockAuditRepo) {
+		users := new(mockUserRepo)
+		users.On("Get", testOrg.ID, "kevin").Return(kevin, nil)
+		users.On("Get", testOrg.ID, "anna").Return(anna, nil)
+		users.On("Get", mock.Anything, mock.Anything).Return(models.User{}, pgx.ErrNoRows)
+		users.On("GetByID", testOrg.ID, kevin.ID).Return(kevin, nil)
+		events := new(mockEventRepo)
+		events.On("GetEvent", testOrg.ID, eventID).Return(models.Event{EventOwner: kevin.ID}, nil)
+		events.On("GetEvent", mock.Anything, mock.Anything).Return(models.Event{}, pgx.ErrNoRows)
+		delegates := new(mockDelegateRepo)
+		delegates.On("IsDelegate", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+		audit := new(mockAuditRepo)
+		audit.On("RecordAudit", mock.Anything).Return(nil)
+		return &Policy{UserRepo: users, EventRepo: events, DelegateRepo: delegates, AuditRepo: audit}, audit
+	}
+
+	serve := func(policy *Policy, method, target, body string, resolve ResourceResolver, action string) (*httptest.ResponseRecorder, string) {
+		var handled string
+		router := gin.New()
+		router.Use(withOrg(testOrg), func(c *gin.Context) { SetIdentity(c, caller) })
+		handler := func(c *gin.Context) {
+			data, _ := io.ReadAll(c.Request.Body)
+			handled = "handled " + string(data)
+			c.Status(http.StatusOK)
+		}
+		router.Handle(method, "/timeslots", policy.Require(action, resolve), handler)
+		router.Handle(method, "/timeslots/:username", policy.Require(action, resolve), handler)
+		router.Handle(method, "/events/:eventID", policy.Require(action, resolve), handler)
+
+		req, _ := http.NewRequest(method, target, bytes.NewBufferString(body))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder, handled
+	}
+
+	slotsInBody := UserInBody("time_slots", func(req models.UserTimeSlotRequest) string { return req.UserName })
+
+	t.Run("Own Slots From Body", func(t *testing.T) {
+		policy, audit := newPolicy()
+		body := `{"user_name":"anna","time_slots":["2 Jan 2025 2 - 4 PM EST"]}`
+		recorder, handled := serve(policy, http.MethodPost, "/timeslots", body, slotsInBody, ActionCreateTimeSlots)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "handled "+body, handled, "the handler still reads the body")
+		audit.AssertNotCalled(t, "RecordAudit", mock.Anything)
+	})
+
+	t.Run("Someone Else's Slots From Body", func(t *testing.T) {
+		policy, audit := newPolicy()
+		body := `{"user_name":"kevin","time_slots":["2 Jan 2025 2 - 4 PM EST"]}`
+		recorder, handled := serve(policy, http.MethodPost, "/timeslots", body, slotsInBody, ActionCreateTimeSlots)
+
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		assert.Empty(t, handled)
+		audit.AssertCalled(t, "RecordAudit", mock.MatchedBy(func(entry models.AuditEntry) bool {
+			return entry.UserID == anna.ID && entry.OrgID == testOrg.ID && entry.Action == ActionCreateTimeSlots && entry.Owner == "kevin" &&
+				entry.ResourceType == "time_slots" && entry.Reason != ""
+		}))
+	})
+
+	t.Run("Unreadable Owner", func(t *testing.T) {
+		for _, body := range []string{"{invalid json}", `{"time_slots":["2 Jan 2025 2 - 4 PM EST"]}`, `{"user_name":"nobody"}`} {
+			policy, _ := newPolicy()
+			recorder, handled := serve(policy, http.MethodPost, "/timeslots", body, slotsInBody, ActionCreateTimeSlots)
+
+			assert.Equal(t, http.StatusBadRequest, recorder.Code, body)
+			assert.Empty(t, handled, body)
+		}
+	})
+
+	t.Run("Owner In Differently Cased Fields", func(t *testing.T) {
+		// gin binds field names case-insensitively and the last match wins, the policy has to read kevin too
+		policy, _ := newPolicy()
+		body := `{"user_name":"anna","USER_NAME":"kevin","time_slots":["2 Jan 2025 2 - 4 PM EST"]}`
+		recorder, handled := serve(policy, http.MethodPost, "/timeslots", body, slotsInBody, ActionCreateTimeSlots)
+
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		assert.Empty(t, handled)
+	})
+
+	t.Run("Someone Else's Slots From Path", func(t *testing.T) {
+		policy, audit := newPolicy()
+		recorder, _ := serve(policy, http.MethodDelete, "/timeslots/kevin", `{}`, UserInPath("time_slots", "username"), ActionDeleteTimeSlots)
+
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		audit.AssertNumberOfCalls(t, "RecordAudit", 1)
+	})
+
+	t.Run("Unknown User", func(t *testing.T) {
+		policy, audit := newPolicy()
+		recorder, handled := serve(policy, http.MethodDelete, "/timeslots/nobody", `{}`, UserInPath("time_slots", "username"), ActionDeleteTimeSlots)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.NotEmpty(t, handled)
+		audit.AssertNotCalled(t, "RecordAudit", mock.Anything)
+	})
+
+	t.Run("Someone Else's Event", func(t *testing.T) {
+		policy, audit := newPolicy()
+		recorder, _ := serve(policy, http.MethodDelete, "/events/"+eventID, "", EventInPath("eventID"), ActionDeleteEvent)
+
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		audit.AssertCalled(t, "RecordAudit", mock.MatchedBy(func(entry models.AuditEntry) bool {
+			return entry.ResourceType == "event" && entry.ResourceID == eventID && entry.Owner == "kevin"
+		}))
+	})
+
+	t.Run("Unknown Event", func(t *testing.T) {
+		policy, _ := newPolicy()
+		recorder, handled := serve(policy, http.MethodDelete, "/events/"+uuid.Must(uuid.NewV4()).String(), "", EventInPath("eventID"), ActionDeleteEvent)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.NotEmpty(t, handled)
+	})
+}
+
+func TestPermit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	kevin := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "kevin", Role: models.RoleMember}
+	anna := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "anna", Role: models.RoleMember}
+
+	users := new(mockUserRepo)
+	users.On("Get", testOrg.ID, "kevin").Return(kevin, nil)
+	users.On("Get", testOrg.ID, "anna").Return(anna, nil)
+	delegates := new(mockDelegateRepo)
+	delegates.On("IsDelegate", kevin.ID, anna.ID, models.DelegateScopePrivateDetails).Return(true, nil)
+	delegates.On("IsDelegate", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	audit := new(mockAuditRepo)
+	policy := &Policy{UserRepo: users, DelegateRepo: delegates, AuditRepo: audit}
+
+	for _, tc := range []struct {
+		caller    models.User
+		target    string
+		permitted bool
+	}{
+		{anna, "/events/anna", true},
+		{anna, "/events/kevin", true},
+		{kevin, "/events/anna", false},
+	} {
+		var permitted *bool
+		router := gin.New()
+		caller := models.Identity{UserID: tc.caller.ID, OrgID: testOrg.ID, UserName: tc.caller.Name, Role: models.RoleMember}
+		router.Use(withOrg(testOrg), func(c *gin.Context) { SetIdentity(c, caller) })
+		router.GET("/events/:username", policy.Permit(ActionViewPrivate, UserInPath("events", "username")), func(c *gin.Context) {
+			allowed := Permitted(c, ActionViewPrivate)
+			permitted = &allowed
+			c.Status(http.StatusOK)
+		})
+
+		req, _ := http.NewRequest(http.MethodGet, tc.target, nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code, "the request goes through either way")
+		if assert.NotNil(t, permitted, tc.target) {
+			assert.Equal(t, tc.permitted, *permitted, tc.caller.Name+" "+tc.target)
+		}
+	}
+	audit.AssertNotCalled(t, "RecordAudit", mock.Anything)
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx"
+)
+
+// orgKey is where the organization of the request is kept in the gin context
+const orgKey = "org"
+
+// OrgHeader names the organization of a request by its slug
+const OrgHeader = "X-Org"
+
+// Tenancy finds the organization a request is made in, by the X-Org header or the subdomain the request was sent to.
+// Requests that name neither are in the default organization. Everything the request reads or changes is looked up
+// within its organization, so data of the others can't be reached even by ID.
+type Tenancy struct {
+	OrgRepo repository.OrganizationRepo
+	// Domain is the domain organizations are subdomains of, the host of requests is ignored when it is empty
+	Domain string
+}
+
+func NewTenancy(db *pgx.ConnPool, domain string) *Tenancy {
+	return &Tenancy{
+		OrgRepo: repository.NewOrganizationRepository(db),
+		Domain:  domain,
+	}
+}
+
+// ResolveOrg attaches the organization of the request, requests naming an unknown organization are answered with a 404
+func (t *Tenancy) ResolveOrg(c *gin.Context) {
+	slug := strings.ToLower(strings.TrimSpace(c.GetHeader(OrgHeader)))
+	if subdomain := t.subdomain(c.Request.Host); subdomain != "" {
+		if slug != "" && slug != subdomain {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "the " + OrgHeader + " header and the subdomain name different organizations"})
+			return
+		}
+		slug = subdomain
+	}
+	if slug == "" {
+		slug = models.DefaultOrgSlug
+	}
+
+	org, err := t.OrgRepo.GetOrganizationBySlug(slug)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "organization does not exist"})
+		return
+	}
+	if err != nil {
+		log.Printf("error looking up organization:: %s", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "organization could not be looked up"})
+		return
+	}
+
+	c.Set(orgKey, org)
+	c.Next()
+}
+
+// subdomain returns the label of the host in front of the domain, empty when the host isn't a direct subdomain of it
+func (t *Tenancy) subdomain(host string) string {
+	if t.Domain == "" {
+		return ""
+	}
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	label, found := strings.CutSuffix(host, "."+strings.ToLower(strings.TrimPrefix(t.Domain, ".")))
+	if !found || label == "" || strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
+
+// CurrentOrg returns the organization ResolveOrg found for the request, false on routes it doesn't run on.
+// The zero organization it returns then owns no data, so lookups made with it find nothing.
+func CurrentOrg(c *gin.Context) (models.Organization, bool) {
+	value, found := c.Get(orgKey)
+	if !found {
+		return models.Organization{}, false
+	}
+	org, ok := value.(models.Organization)
+	return org, ok
+}
+
+// SetOrg attaches an organization to the context, for handlers and tests that pick it by other means
+func SetOrg(c *gin.Context, org models.Organization) {
+	c.Set(orgKey, org)
+}
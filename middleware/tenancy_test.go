@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"timeslot-app/models"
+	"timeslot-app/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	testOrg  = models.Organization{ID: uuid.Must(uuid.NewV4()), Slug: "acme", Name: "Acme"}
+	otherOrg = models.Organization{ID: uuid.Must(uuid.NewV4()), Slug: "globex", Name: "Globex"}
+)
+
+// withOrg stands in for ResolveOrg
+func withOrg(org models.Organization) gin.HandlerFunc {
+	return func(c *gin.Context) { SetOrg(c, org) }
+}
+
+type mockOrgRepo struct {
+	mock.Mock
+}
+
+func (m *mockOrgRepo) CreateOrganization(org models.Organization, admin models.User) error {
+	return m.Called(org, admin).Error(0)
+}
+
+func (m *mockOrgRepo) GetOrganizationBySlug(slug string) (models.Organization, error) {
+	args := m.Called(slug)
+	return args.Get(0).(models.Organization), args.Error(1)
+}
+
+func TestResolveOrg(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defaultOrg := models.Organization{ID: models.DefaultOrgID, Slug: models.DefaultOrgSlug, Name: "Default"}
+	orgs := new(mockOrgRepo)
+	orgs.On("GetOrganizationBySlug", "acme").Return(testOrg, nil)
+	orgs.On("GetOrganizationBySlug", "globex").Return(otherOrg, nil)
+	orgs.On("GetOrganizationBySlug", models.DefaultOrgSlug).Return(defaultOrg, nil)
+	orgs.On("GetOrganizationBySlug", mock.Anything).Return(models.Organization{}, pgx.ErrNoRows)
+	tenancy := &Tenancy{OrgRepo: orgs, Domain: "timeslot.example.com"}
+
+	resolve := func(host, header string) (*httptest.ResponseRecorder, models.Organization) {
+		var seen models.Organization
+		router := gin.New()
+		router.GET("/orgs/current", tenancy.ResolveOrg, func(c *gin.Context) {
+			seen, _ = CurrentOrg(c)
+			c.Status(http.StatusOK)
+		})
+
+		req, _ := http.NewRequest(http.MethodGet, "/orgs/current", nil)
+		req.Host = host
+		if header != "" {
+			req.Header.Set(OrgHeader, header)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder, seen
+	}
+
+	for _, tc := range []struct {
+		name   string
+		host   string
+		header string
+		status int
+		org    models.Organization
+	}{
+		{"header", "timeslot.example.com", "acme", http.StatusOK, testOrg},
+		{"header in capitals", "localhost:8000", "Globex", http.StatusOK, otherOrg},
+		{"subdomain", "acme.timeslot.example.com", "", http.StatusOK, testOrg},
+		{"subdomain with port", "globex.timeslot.example.com:8000", "", http.StatusOK, otherOrg},
+		{"subdomain and matching header", "acme.timeslot.example.com", "acme", http.StatusOK, testOrg},
+		{"subdomain and other header", "acme.timeslot.example.com", "globex", http.StatusBadRequest, models.Organization{}},
+		{"neither", "timeslot.example.com", "", http.StatusOK, defaultOrg},
+		{"nested subdomain", "www.acme.timeslot.example.com", "", http.StatusOK, defaultOrg},
+		{"other domain", "acme.example.org", "", http.StatusOK, defaultOrg},
+		{"unknown header", "timeslot.example.com", "initech", http.StatusNotFound, models.Organization{}},
+		{"unknown subdomain", "initech.timeslot.example.com", "", http.StatusNotFound, models.Organization{}},
+	} {
+		recorder, org := resolve(tc.host, tc.header)
+		assert.Equal(t, tc.status, recorder.Code, tc.name)
+		assert.Equal(t, tc.org, org, tc.name)
+	}
+
+	t.Run("No Domain", func(t *testing.T) {
+		tenancy.Domain = ""
+		defer func() { tenancy.Domain = "timeslot.example.com" }()
+
+		recorder, org := resolve("acme.timeslot.example.com", "")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, defaultOrg, org, "the host is ignored without an org_domain")
+	})
+}
+
+func TestAuthenticateOtherOrganization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	user := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: otherOrg.ID, Name: "kevin"}
+	key, prefix, err := utils.GenerateAPIKey()
+	assert.NoError(t, err)
+	apiKey := models.APIKey{ID: uuid.Must(uuid.NewV4()), UserID: user.ID, Prefix: prefix}
+
+	keys := new(mockAPIKeyRepo)
+	keys.On("GetAPIKeyByHash", utils.HashAPIKey(key)).Return(apiKey, user, nil)
+	keys.On("TouchAPIKey", apiKey.ID, mock.Anything).Return(nil)
+	auth := &Authenticator{APIKeyRepo: keys, UserRepo: new(mockUserRepo)}
+
+	// serve makes the request in testOrg, the key belongs to a user of otherOrg
+	recorder, identity := serve(auth, "X-API-Key", key)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, models.Identity{}, identity)
+	keys.AssertNotCalled(t, "TouchAPIKey", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// How a caller proved who they are
+const (
+	AuthMethodAPIKey = "api_key"
+	AuthMethodJWT    = "jwt"
+)
+
+// Roles a user can hold
+const (
+	// RoleAdmin acts on everyone's data
+	RoleAdmin = "admin"
+	// RoleMember acts on their own data and on the data of the users who made them a delegate
+	RoleMember = "member"
+	// RoleViewer reads but changes nothing
+	RoleViewer = "viewer"
+)
+
+// Identity is the authenticated caller of a request
+type Identity struct {
+	UserID uuid.UUID
+	// OrgID is the organization of the user, callers only ever act within it
+	OrgID    uuid.UUID
+	UserName string
+	Role     string
+	Method   string
+	// APIKeyID is the key the caller used, when they used one
+	APIKeyID uuid.NullUUID
+}
+
+// APIKey is a key a user calls the API with, only a hash of the key itself is stored
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Name       string     `json:"name" example:"deploy script"`
+	Prefix     string     `json:"prefix" example:"tsk_3f9c1e0b"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	// ExpiresAt is set on the keys handed out by single sign-on logins, other keys last until they are revoked
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APIKeyRequest issues a new API key
+type APIKeyRequest struct {
+	Name string `json:"name" example:"deploy script"`
+}
+
+// APIKeyResponse carries a newly issued API key, the key is only ever shown once
+type APIKeyResponse struct {
+	APIKey
+	Key string `json:"key" example:"tsk_3f9c1e0b7a5d4c2e8f6a1b3d5c7e9f0a3f9c1e0b7a5d4c2e8f6a1b3d5c7e9f0a"`
+}
+
+// UserCreatedResponse confirms a new user and hands out their first API key
+type UserCreatedResponse struct {
+	Message string         `json:"message" example:"User created successfully"`
+	User    User           `json:"user"`
+	APIKey  APIKeyResponse `json:"api_key"`
+}
+
+// UserRoleRequest changes the role of a user
+type UserRoleRequest struct {
+	Role string `json:"role" example:"member" enums:"admin,member,viewer"`
+}
+
+// Delegate is a user who may act for another user, the principal, within the scopes of their grant
+type Delegate struct {
+	PrincipalID  uuid.UUID `json:"principal_id"`
+	DelegateID   uuid.UUID `json:"delegate_id"`
+	DelegateName string    `json:"delegate_name" example:"anna"`
+	Scopes       []string  `json:"scopes" example:"availability,events"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Delegation scopes, each lets a delegate do part of what the principal may
+const (
+	// DelegateScopeAvailability lets the delegate create and delete the principal's time slots
+	DelegateScopeAvailability = "availability"
+	// DelegateScopeEvents lets the delegate book events owned by the principal and cancel them
+	DelegateScopeEvents = "events"
+	// DelegateScopePrivateDetails lets the delegate see the details of the principal's private events
+	DelegateScopePrivateDetails = "private_details"
+)
+
+// DefaultDelegateScopes are granted when a delegate is added without scopes, it is what delegates could always do
+var DefaultDelegateScopes = []string{DelegateScopeAvailability, DelegateScopeEvents}
+
+// DelegateRequest makes a user a delegate, without scopes they get DefaultDelegateScopes
+type DelegateRequest struct {
+	Delegate string   `json:"delegate" example:"anna"`
+	Scopes   []string `json:"scopes" example:"availability,events,private_details" enums:"availability,events,private_details"`
+}
+
+// DelegateScopesRequest replaces the scopes of a delegate
+type DelegateScopesRequest struct {
+	Scopes []string `json:"scopes" example:"availability,events" enums:"availability,events,private_details"`
+}
+
+// AuditEntry records a request the policy refused
+type AuditEntry struct {
+	ID           uuid.UUID `json:"id"`
+	OrgID        uuid.UUID `json:"org_id"`
+	OccurredAt   time.Time `json:"occurred_at"`
+	UserID       uuid.UUID `json:"user_id"`
+	UserName     string    `json:"user_name" example:"kevin"`
+	Role         string    `json:"role" example:"member"`
+	Action       string    `json:"action" example:"events.delete"`
+	ResourceType string    `json:"resource_type" example:"event"`
+	ResourceID   string    `json:"resource_id"`
+	Owner        string    `json:"owner" example:"anna"`
+	Reason       string    `json:"reason" example:"only anna, their delegates and admins may do this"`
+}
+
+// OIDCLogin is a single sign-on login waiting for the provider to send the user back
+type OIDCLogin struct {
+	// OrgID is the organization the user logs in to
+	OrgID        uuid.UUID
+	State        string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// SSOLoginResponse hands a user who logged in through single sign-on an API key for the session
+type SSOLoginResponse struct {
+	User   User           `json:"user"`
+	APIKey APIKeyResponse `json:"api_key"`
+	// Provisioned is true on the user's first login, when their account was created
+	Provisioned bool `json:"provisioned"`
+}
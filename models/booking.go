@@ -0,0 +1,106 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Scheduling modes of an event type
+const (
+	// SchedulingIndividual books the owner of the event type
+	SchedulingIndividual = "individual"
+	// SchedulingRoundRobin books the least loaded member who is free
+	SchedulingRoundRobin = "round_robin"
+	// SchedulingCollective books every member, all of them have to be free
+	SchedulingCollective = "collective"
+)
+
+// EventType is a kind of meeting a user lets others book on their public booking page
+type EventType struct {
+	ID          uuid.UUID `json:"id"`
+	UserID      uuid.UUID `json:"user_id"`
+	Slug        string    `json:"slug" example:"intro-30"`
+	Title       string    `json:"title" example:"30-minute intro"`
+	Description string    `json:"description,omitempty" example:"A first call to get to know each other"`
+	Location    string    `json:"location,omitempty" example:"https://meet.example.com/eshan"`
+	// DurationMinutes is how long a booked meeting lasts
+	DurationMinutes int `json:"duration_minutes" example:"30"`
+	// BufferBeforeMinutes and BufferAfterMinutes keep the time around a booking clear of other events
+	BufferBeforeMinutes int `json:"buffer_before_minutes" example:"0"`
+	BufferAfterMinutes  int `json:"buffer_after_minutes" example:"10"`
+	// MinNoticeMinutes is how far ahead of its start a meeting has to be booked at least
+	MinNoticeMinutes int `json:"min_notice_minutes" example:"240"`
+	// MaxAdvanceDays is how far ahead meetings can be booked at most
+	MaxAdvanceDays int `json:"max_advance_days" example:"60"`
+	// SchedulingMode is individual, round_robin or collective, team modes book the Members instead of the owner
+	SchedulingMode string      `json:"scheduling_mode" example:"round_robin"`
+	Members        []string    `json:"members,omitempty" example:"kevin,eshan"`
+	MemberIDs      []uuid.UUID `json:"-"`
+	CreatedAt      time.Time   `json:"created_at"`
+}
+
+// EventTypeRequest creates an event type, a missing maximum advance window defaults to 60 days and missing
+// buffers default to the ones in the profile of the owner
+type EventTypeRequest struct {
+	Slug                string `json:"slug" example:"intro-30"`
+	Title               string `json:"title" example:"30-minute intro"`
+	Description         string `json:"description,omitempty" example:"A first call to get to know each other"`
+	Location            string `json:"location,omitempty" example:"https://meet.example.com/eshan"`
+	DurationMinutes     int    `json:"duration_minutes" example:"30"`
+	BufferBeforeMinutes *int   `json:"buffer_before_minutes,omitempty" example:"0"`
+	BufferAfterMinutes  *int   `json:"buffer_after_minutes,omitempty" example:"10"`
+	MinNoticeMinutes    int    `json:"min_notice_minutes" example:"240"`
+	MaxAdvanceDays      int    `json:"max_advance_days" example:"60"`
+	// SchedulingMode defaults to individual, round_robin and collective need at least two Members
+	SchedulingMode string   `json:"scheduling_mode,omitempty" example:"round_robin"`
+	Members        []string `json:"members,omitempty" example:"kevin,eshan"`
+}
+
+// BookingPage is what the public booking page of a user shows
+type BookingPage struct {
+	UserName   string      `json:"user_name" example:"eshan"`
+	EventTypes []EventType `json:"event_types"`
+}
+
+// BookableTime is a start time an invitee can book
+type BookableTime struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// BookableTimesResponse lists the bookable times of an event type within the requested range
+type BookableTimesResponse struct {
+	EventType EventType      `json:"event_type"`
+	Times     []BookableTime `json:"times"`
+}
+
+// BookingRequest books one of the bookable times of an event type
+type BookingRequest struct {
+	Start time.Time `json:"start" example:"2025-01-02T14:00:00-07:00"`
+	Name  string    `json:"name" example:"Jane Doe"`
+	Email string    `json:"email" example:"jane@partner.com"`
+	Notes string    `json:"notes,omitempty" example:"Would like to talk about the integration"`
+}
+
+// BookingResponse is the event a booking created and the users hosting it
+type BookingResponse struct {
+	Message string   `json:"message" example:"Booking confirmed"`
+	Hosts   []string `json:"hosts" example:"kevin"`
+	Event   Event    `json:"event"`
+}
+
+// BookingAssignment records which member a round robin booking was assigned to
+type BookingAssignment struct {
+	EventID     uuid.UUID
+	EventTypeID uuid.UUID
+	UserID      uuid.UUID
+	AssignedAt  time.Time
+}
+
+// BookingLoad is how many bookings of an event type a member was assigned so far
+type BookingLoad struct {
+	UserID         uuid.UUID
+	Bookings       int
+	LastAssignedAt time.Time
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type DatabaseConfig struct {
 	Host     string `mapstructure:"host"` //"localhost"
 	Port     string `mapstructure:"port"` //= 5432
@@ -10,4 +12,43 @@ type DatabaseConfig struct {
 
 type Config struct {
 	DBConfig DatabaseConfig
+	// CancelledEventRetention is how long cancelled events can be restored before they are purged
+	CancelledEventRetention time.Duration
+	// JWT configures which bearer tokens are accepted, none are when neither a secret nor a JWKS file is set
+	JWT JWTConfig
+	// AdminUsers are the names of the users of the default organization who are given the admin role at startup.
+	// Only users who already exist are promoted, signing up later under one of the names doesn't make anyone an admin.
+	AdminUsers []string
+	// OrgDomain is the domain organizations are subdomains of, requests to <slug>.<OrgDomain> are in the
+	// organization with the slug. Without it organizations are only picked with the X-Org header.
+	OrgDomain string
+	// OIDC configures single sign-on, it is off when no issuer is set
+	OIDC OIDCConfig
+}
+
+type JWTConfig struct {
+	Secret   string
+	JWKSFile string
+	Issuer   string
+	Audience string
+}
+
+type OIDCConfig struct {
+	// Org is the slug of the organization single sign-on users belong to
+	Org          string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback registered with the provider, it must reach the SSO callback route
+	RedirectURL string
+	Scopes      []string
+	// GroupsClaim is the ID token claim listing the user's groups
+	GroupsClaim string
+	// members of these groups get the role, the highest one wins. New users in none of them are members and
+	// existing ones keep the role they have
+	AdminGroups  []string
+	MemberGroups []string
+	ViewerGroups []string
+	// SessionTTL is how long the API key handed out at login lasts
+	SessionTTL time.Duration
 }
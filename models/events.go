@@ -8,17 +8,233 @@ import (
 
 // Event models
 type Event struct {
-	ID             uuid.UUID `json:"id"`
+	ID             uuid.UUID          `json:"id"`
+	Title          string             `json:"title"`
+	EventOwner     uuid.UUID          `json:"event_owner"`
+	EventStartTime time.Time          `json:"event_start_time"`
+	EventEndTime   time.Time          `json:"event_end_time"`
+	Participants   []EventParticipant `json:"participants"`
+	Forced         bool               `json:"forced"`
+	Description    string             `json:"description,omitempty" example:"Agenda: roadmap review, hiring"`
+	Location       string             `json:"location,omitempty" example:"Room 4.01"`
+	ConferenceURL  string             `json:"conference_url,omitempty" example:"https://meet.example.com/abc-defg-hij"`
+	// Visibility is public or private, the title of a private event isn't shown to people it conflicts with
+	Visibility string `json:"visibility" example:"public"`
+	// Labels are free-form key/value pairs for tooling, events can be filtered by them
+	Labels map[string]string `json:"labels,omitempty"`
+	// Reminders are offsets before each occurrence at which attendees are reminded, null leaves it to
+	// every attendee's default reminders and an empty list turns reminders off
+	Reminders []string `json:"reminders" example:"24h,10m"`
+	// Recurrence is an RFC 5545 RRULE, empty for one-off events
+	Recurrence string `json:"recurrence,omitempty" example:"FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10"`
+	// RecurrenceID is the original start of an expanded occurrence of a recurring event
+	RecurrenceID *time.Time       `json:"recurrence_id,omitempty"`
+	Exceptions   []EventException `json:"exceptions,omitempty"`
+
+	RescheduleHistory []EventReschedule `json:"reschedule_history,omitempty"`
+
+	// Status is active or cancelled, a cancelled event keeps its details but no longer holds any bookings
+	Status       string             `json:"status" example:"active"`
+	Cancellation *EventCancellation `json:"cancellation,omitempty"`
+
+	// Role is how the user an event is listed for relates to it, owner or participant
+	Role string `json:"role,omitempty" example:"owner"`
+
+	// Version goes up with every change of the event, CalDAV ETags are derived from it
+	Version int `json:"version" example:"1"`
+	// ICalUID is the UID a calendar client gave the event, events created through the API have none
+	ICalUID string `json:"ical_uid,omitempty"`
+	// CalDAVName is the resource name a calendar client stored the event under
+	CalDAVName string `json:"-"`
+	// ActingDelegate is the user who booked the event on the owner's behalf, empty when the owner booked it
+	ActingDelegate string `json:"acting_delegate,omitempty" example:"anna"`
+}
+
+const (
+	EventVisibilityPublic  = "public"
+	EventVisibilityPrivate = "private"
+)
+
+const (
+	EventRoleOwner       = "owner"
+	EventRoleParticipant = "participant"
+)
+
+// EventListResponse is one page of the events listed for a user
+type EventListResponse struct {
+	Events []Event `json:"events"`
+	Total  int     `json:"total" example:"42"`
+	Limit  int     `json:"limit" example:"50"`
+	Offset int     `json:"offset" example:"0"`
+}
+
+// EventFilter narrows down the events listed for a user, empty fields don't filter
+type EventFilter struct {
+	From   *time.Time
+	To     *time.Time
+	Status string
+	Role   string
+	// Labels only keeps events carrying every one of these labels
+	Labels map[string]string
+}
+
+// EventPage is the part of a user's sorted events a listing shows
+type EventPage struct {
+	// Sort is the field the events are sorted by, start_time, end_time or title
+	Sort       string
+	Descending bool
+	Limit      int
+	Offset     int
+}
+
+const (
+	EventStatusActive    = "active"
+	EventStatusCancelled = "cancelled"
+)
+
+// EventCancellation records who cancelled an event, when and why
+type EventCancellation struct {
+	CancelledAt time.Time `json:"cancelled_at"`
+	CancelledBy string    `json:"cancelled_by,omitempty" example:"eshan"`
+	Reason      string    `json:"reason,omitempty" example:"project was called off"`
+}
+
+// EventException cancels or moves a single occurrence of a recurring event, identified by its original start
+type EventException struct {
+	OriginalStartTime time.Time  `json:"original_start_time"`
+	Cancelled         bool       `json:"cancelled"`
+	EventStartTime    *time.Time `json:"event_start_time,omitempty"`
+	EventEndTime      *time.Time `json:"event_end_time,omitempty"`
+}
+
+const (
+	OccurrenceScopeThis             = "this"
+	OccurrenceScopeThisAndFollowing = "this_and_following"
+)
+
+// OccurrenceUpdateRequest cancels or moves one occurrence of a recurring event, or the occurrence and every one after it
+type OccurrenceUpdateRequest struct {
+	OriginalStartTime time.Time `json:"original_start_time" example:"2025-01-06T14:00:00-05:00"`
+	Scope             string    `json:"scope" example:"this" enums:"this,this_and_following"`
+	Cancel            bool      `json:"cancel" example:"false"`
+	EventTimeSlot     string    `json:"event_time_slot,omitempty" example:"07 Jan 2025 2-3 PM EST"`
+	Force             bool      `json:"force" example:"false"`
+}
+
+const (
+	ParticipantRoleRequired = "required"
+	ParticipantRoleOptional = "optional"
+
+	ParticipantStatusNeedsAction     = "needs_action"
+	ParticipantStatusAccepted        = "accepted"
+	ParticipantStatusDeclined        = "declined"
+	ParticipantStatusTentative       = "tentative"
+	ParticipantStatusProposedNewTime = "proposed_new_time"
+)
+
+// EventParticipant is an attendee of an event, either a registered user or an external guest
+type EventParticipant struct {
+	ID       uuid.UUID     `json:"id"`
+	UserID   uuid.NullUUID `json:"user_id" swaggertype:"string"`
+	Name     string        `json:"name"`
+	Role     string        `json:"role"`
+	Status   string        `json:"status"`
+	External bool          `json:"external"`
+	// Group is the group the participant was invited through, as it was named in the request
+	Group string `json:"group,omitempty" example:"@platform-team"`
+
+	Comment           string     `json:"comment,omitempty"`
+	ProposedStartTime *time.Time `json:"proposed_start_time,omitempty"`
+	ProposedEndTime   *time.Time `json:"proposed_end_time,omitempty"`
+	RespondedAt       *time.Time `json:"responded_at,omitempty"`
+}
+
+// RSVPRequest is the caller's answer to an event invitation, a proposed time slot that names no zone is in the
+// home time zone of the participant
+type RSVPRequest struct {
+	Response         string `json:"response" example:"accepted" enums:"accepted,declined,tentative,proposed_new_time"`
+	ProposedTimeSlot string `json:"proposed_time_slot,omitempty" example:"03 Jan 2025 2-4 PM EST"`
+	Comment          string `json:"comment,omitempty" example:"running late from another meeting"`
+	// RecommendOnDecline asks for fresh slot recommendations when a required participant declines
+	RecommendOnDecline bool `json:"recommend_on_decline" example:"false"`
+}
+
+type RSVPResponse struct {
+	Message        string                  `json:"message"`
+	Participant    EventParticipant        `json:"participant"`
+	Recommendation *RecommendSlotsResponse `json:"recommendation,omitempty"`
+}
+
+// EventResponses is the organizer's view of how participants answered an event
+type EventResponses struct {
+	EventID      uuid.UUID          `json:"event_id"`
+	Title        string             `json:"title"`
+	Participants []EventParticipant `json:"participants"`
+	Counts       map[string]int     `json:"counts"`
+}
+
+// EventRequest creates an event, a time slot that names no zone is in the home time zone of the owner.
+// Participants and OptionalParticipants can name groups as @name, they are expanded to their members.
+// Recurrence may expand to at most 500 occurrences.
+type EventRequest struct {
+	Title                string            `json:"title" example:"Brainstorming meeting"`
+	EventOwner           string            `json:"event_owner" example:"uuid"`
+	EventTimeSlot        string            `json:"event_time_slot" example:"02 Jan 2025 2-4 PM EST"`
+	Participants         []string          `json:"participants" example:"kevin,marco"`
+	OptionalParticipants []string          `json:"optional_participants" example:"anna"`
+	ExternalGuests       []string          `json:"external_guests" example:"jane@partner.com"`
+	Recurrence           string            `json:"recurrence,omitempty" example:"FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10"`
+	Description          string            `json:"description,omitempty" example:"Agenda: roadmap review, hiring"`
+	Location             string            `json:"location,omitempty" example:"Room 4.01"`
+	ConferenceURL        string            `json:"conference_url,omitempty" example:"https://meet.example.com/abc-defg-hij"`
+	Visibility           string            `json:"visibility,omitempty" example:"public"`
+	Labels               map[string]string `json:"labels,omitempty"`
+	Reminders            []string          `json:"reminders,omitempty" example:"24h,10m"`
+	Force                bool              `json:"force" example:"false"`
+}
+
+// EventUpdateRequest carries the fields of an event to change, nil fields are left untouched on PATCH.
+// Participants, OptionalParticipants and ExternalGuests together replace the participant list when any of them is set,
+// groups named as @name are expanded to their members.
+type EventUpdateRequest struct {
+	Title                *string           `json:"title,omitempty" example:"Planning meeting"`
+	EventTimeSlot        *string           `json:"event_time_slot,omitempty" example:"03 Jan 2025 2-4 PM EST"`
+	Participants         []string          `json:"participants,omitempty" example:"kevin,marco"`
+	OptionalParticipants []string          `json:"optional_participants,omitempty" example:"anna"`
+	ExternalGuests       []string          `json:"external_guests,omitempty" example:"jane@partner.com"`
+	Recurrence           *string           `json:"recurrence,omitempty" example:"FREQ=WEEKLY;COUNT=5"`
+	Description          *string           `json:"description,omitempty" example:"Agenda: roadmap review, hiring"`
+	Location             *string           `json:"location,omitempty" example:"Room 4.01"`
+	ConferenceURL        *string           `json:"conference_url,omitempty" example:"https://meet.example.com/abc-defg-hij"`
+	Visibility           *string           `json:"visibility,omitempty" example:"private"`
+	Labels               map[string]string `json:"labels,omitempty"`
+	Reminders            []string          `json:"reminders,omitempty" example:"1h"`
+	Reason               string            `json:"reason,omitempty" example:"owner is travelling"`
+	Force                bool              `json:"force" example:"false"`
+}
+
+// EventReschedule records a single move of an event to a new time
+type EventReschedule struct {
+	ID                uuid.UUID `json:"id"`
+	EventID           uuid.UUID `json:"event_id"`
+	PreviousStartTime time.Time `json:"previous_start_time"`
+	PreviousEndTime   time.Time `json:"previous_end_time"`
+	NewStartTime      time.Time `json:"new_start_time"`
+	NewEndTime        time.Time `json:"new_end_time"`
+	Reason            string    `json:"reason"`
+	RescheduledAt     time.Time `json:"rescheduled_at"`
+}
+
+// EventConflict describes an existing booking that overlaps a requested event
+type EventConflict struct {
+	Attendee       string    `json:"attendee"`
+	EventID        uuid.UUID `json:"event_id"`
 	Title          string    `json:"title"`
-	EventOwner     uuid.UUID `json:"event_owner"`
 	EventStartTime time.Time `json:"event_start_time"`
 	EventEndTime   time.Time `json:"event_end_time"`
-	Participants   []string  `json:"participants"`
 }
 
-type EventRequest struct {
-	Title         string   `json:"title" example:"Brainstorming meeting"`
-	EventOwner    string   `json:"event_owner" example:"uuid"`
-	EventTimeSlot string   `json:"event_time_slot" example:"02 Jan 2025 2-4 PM EST"`
-	Participants  []string `json:"participants" example:"kevin,marco"`
+type EventConflictResponse struct {
+	Error     string          `json:"error"`
+	Conflicts []EventConflict `json:"conflicts"`
 }
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// GroupPrefix marks a participant name as a group, "@platform-team" stands for the members of platform-team
+const GroupPrefix = "@"
+
+// Group is a named set of users and other groups of an organization, it can be listed wherever participants are
+type Group struct {
+	ID    uuid.UUID `json:"id"`
+	OrgID uuid.UUID `json:"org_id"`
+	Name  string    `json:"name" example:"platform-team"`
+	// Members are user names and, prefixed with @, the groups nested in the group
+	Members []string `json:"members" example:"kevin,eshan,@sre"`
+	// Expanded lists every user the group stands for, nested groups included, it is only set when a single group is fetched
+	Expanded  []string      `json:"expanded,omitempty" example:"kevin,eshan,anna"`
+	CreatedBy uuid.NullUUID `json:"created_by" swaggertype:"string"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// GroupRequest creates a group
+type GroupRequest struct {
+	Name    string   `json:"name" example:"platform-team"`
+	Members []string `json:"members" example:"kevin,eshan,@sre"`
+}
+
+// GroupMembersRequest replaces the members of a group
+type GroupMembersRequest struct {
+	Members []string `json:"members" example:"kevin,eshan,@sre"`
+}
@@ -0,0 +1,29 @@
+package models
+
+const (
+	CalendarImportCreate    = "create"
+	CalendarImportUpdate    = "update"
+	CalendarImportUnchanged = "unchanged"
+	CalendarImportSkipped   = "skipped"
+)
+
+// CalendarImportItem is what one UID of an imported calendar turns into, its free time becomes time slots and
+// its busy time blocking events. Re-importing a UID replaces what it was imported as before.
+type CalendarImportItem struct {
+	UID     string `json:"uid" example:"040000008200E00074C5B7101A82E008@example.com"`
+	Action  string `json:"action" example:"create" enums:"create,update,unchanged,skipped"`
+	Summary string `json:"summary,omitempty" example:"Office hours"`
+	// Reason tells why an item was skipped
+	Reason    string   `json:"reason,omitempty"`
+	TimeSlots []string `json:"time_slots,omitempty" example:"06 Jan 2025 9-11 AM America/New_York"`
+	Events    []Event  `json:"events,omitempty"`
+	// Fingerprint identifies the imported content of the item, an unchanged fingerprint leaves the item alone
+	Fingerprint string `json:"-"`
+}
+
+// CalendarImportResponse lists what an import did, or would do when it is a preview
+type CalendarImportResponse struct {
+	Preview bool                 `json:"preview"`
+	Items   []CalendarImportItem `json:"items"`
+	Counts  map[string]int       `json:"counts"`
+}
@@ -22,6 +22,7 @@ type TimeSlotStartAndEnd struct {
 	EndTime   time.Time `json:"End Time"`
 }
 
+// RecommendSlotsRequest asks for slots that suit the organizer and participants, participants can name groups as @name
 type RecommendSlotsRequest struct {
 	Organizer     string   `json:"organizer" example:"eshan"`
 	Participants  []string `json:"participants" example:"kevin,marco"`
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// DefaultOrgSlug names the organization of requests that don't name one, the data from before
+// organizations existed belongs to it
+const DefaultOrgSlug = "default"
+
+// DefaultOrgID is the ID of the default organization
+var DefaultOrgID = uuid.Must(uuid.FromString("00000000-0000-0000-0000-000000000001"))
+
+// Organization is a tenant, its users, time slots, events and webhooks are never visible to other organizations
+type Organization struct {
+	ID uuid.UUID `json:"id"`
+	// Slug picks the organization in the X-Org header or as the subdomain of requests
+	Slug      string    `json:"slug" example:"platform"`
+	Name      string    `json:"name" example:"Platform Engineering"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrganizationCreateRequest creates an organization along with its first user, who is its admin
+type OrganizationCreateRequest struct {
+	Slug      string `json:"slug" example:"platform"`
+	Name      string `json:"name" example:"Platform Engineering"`
+	AdminName string `json:"admin_name" example:"alex"`
+}
+
+// OrganizationCreatedResponse confirms a new organization and hands its admin their first API key
+type OrganizationCreatedResponse struct {
+	Organization Organization   `json:"organization"`
+	Admin        User           `json:"admin"`
+	APIKey       APIKeyResponse `json:"api_key"`
+}
@@ -0,0 +1,49 @@
+package models
+
+// DayWindow is a window of local time within a day, in the home time zone of the user it belongs to
+type DayWindow struct {
+	Start string `json:"start" example:"09:00"`
+	End   string `json:"end" example:"17:00"`
+}
+
+// WorkingHours are the days and the hours of the day a user works
+type WorkingHours struct {
+	Days  []string `json:"days" example:"mon,tue,wed,thu,fri"`
+	Start string   `json:"start" example:"09:00"`
+	End   string   `json:"end" example:"17:00"`
+}
+
+// NotificationSettings turn the notifications a user gets on or off
+type NotificationSettings struct {
+	// Reminders sends the reminders of the user's events, their offsets are kept in the reminder settings
+	Reminders bool `json:"reminders" example:"true"`
+}
+
+// UserProfile holds the defaults used for a user. Slots the user gives without a zone are in TimeZone, event
+// times shown to the user are rendered in it, and recommendations favour slots in the working hours and
+// preferred times of the attendees.
+type UserProfile struct {
+	TimeZone     string       `json:"time_zone" example:"America/New_York"`
+	Locale       string       `json:"locale" example:"en-US"`
+	WorkingHours WorkingHours `json:"working_hours"`
+	// BufferBeforeMinutes and BufferAfterMinutes are used for the event types of the user that don't set their own
+	BufferBeforeMinutes int                  `json:"buffer_before_minutes" example:"0"`
+	BufferAfterMinutes  int                  `json:"buffer_after_minutes" example:"10"`
+	PreferredTimes      []DayWindow          `json:"preferred_times"`
+	Notifications       NotificationSettings `json:"notifications"`
+}
+
+// DefaultUserProfile is the profile of users who haven't set one
+func DefaultUserProfile() UserProfile {
+	return UserProfile{
+		TimeZone: "UTC",
+		Locale:   "en-US",
+		WorkingHours: WorkingHours{
+			Days:  []string{"mon", "tue", "wed", "thu", "fri"},
+			Start: "09:00",
+			End:   "17:00",
+		},
+		PreferredTimes: []DayWindow{},
+		Notifications:  NotificationSettings{Reminders: true},
+	}
+}
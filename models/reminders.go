@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	ReminderStatusPending    = "pending"
+	ReminderStatusProcessing = "processing"
+	ReminderStatusSent       = "sent"
+	ReminderStatusFailed     = "failed"
+	// ReminderStatusExpired marks reminders that only came due after their occurrence had started
+	ReminderStatusExpired = "expired"
+)
+
+// Reminder is a notice to one attendee that an occurrence of an event is coming up
+type Reminder struct {
+	ID              uuid.UUID `json:"id"`
+	EventID         uuid.UUID `json:"event_id"`
+	UserID          uuid.UUID `json:"user_id"`
+	UserName        string    `json:"user_name" example:"kevin"`
+	EventTitle      string    `json:"event_title" example:"Standup"`
+	Location        string    `json:"location,omitempty" example:"Room 4.01"`
+	ConferenceURL   string    `json:"conference_url,omitempty" example:"https://meet.example.com/abc-defg-hij"`
+	OccurrenceStart time.Time `json:"occurrence_start"`
+	// LocalStart is OccurrenceStart rendered in the home time zone and locale of the attendee
+	LocalStart string    `json:"local_start" example:"Thu, Jan 2, 2025 2:00 PM EST"`
+	TimeZone   string    `json:"time_zone" example:"America/New_York"`
+	Locale     string    `json:"locale" example:"en-US"`
+	Offset     string    `json:"offset" example:"10m"`
+	RemindAt   time.Time `json:"remind_at"`
+	Attempts   int       `json:"attempts"`
+}
+
+// ReminderSettings are a user's default reminder offsets, used for events that don't set their own
+type ReminderSettings struct {
+	Offsets []string `json:"offsets" example:"24h,10m"`
+}
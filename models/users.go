@@ -2,16 +2,48 @@ package models
 
 import "github.com/gofrs/uuid"
 
+// UserTimeSlotRequest adds time slots of a user, slots that name no zone are in the home time zone of the user
 type UserTimeSlotRequest struct {
 	UserName  string   `json:"user_name" example:"eshan"`
-	TimeSlots []string `json:"time_slots" example:"2 Jan 2025 2 - 4 PM EST,14 Jan 2025 6-9 PM EST"`
+	TimeSlots []string `json:"time_slots" example:"02 Jan 2025 2-4 PM EST,14 Jan 2025 11:30 AM-1 PM EST"`
 }
 
 type User struct {
-	ID   uuid.UUID `json:"id,omitempty"`
-	Name string    `json:"name" example:"eshan"`
+	ID    uuid.UUID `json:"id,omitempty"`
+	OrgID uuid.UUID `json:"org_id"`
+	Name  string    `json:"name" example:"eshan"`
+	Role  string    `json:"role,omitempty" example:"member"`
+	// Subject is the sub claim of the user's single sign-on account, users who signed up directly have none
+	Subject string `json:"oidc_subject,omitempty"`
 }
 
 type UserCreateRequest struct {
 	Name string `json:"name" example:"eshan"`
 }
+
+// UserUpdateRequest renames a user
+type UserUpdateRequest struct {
+	Name string `json:"name" example:"eshan"`
+}
+
+// UserListResponse is a page of users, Total counts every user matching the search
+type UserListResponse struct {
+	Users  []User `json:"users"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// What happens to the events a deleted user owns
+const (
+	// OwnedEventsDelete deletes them, handing the time they took back to the other attendees
+	OwnedEventsDelete = "delete"
+	// OwnedEventsReassign hands them over to another user
+	OwnedEventsReassign = "reassign"
+)
+
+// CalendarTokenResponse carries a newly issued calendar feed token, it is only ever shown once
+type CalendarTokenResponse struct {
+	Token   string `json:"token" example:"3f9c1e0b7a5d4c2e8f6a1b3d5c7e9f0a"`
+	FeedURL string `json:"feed_url" example:"/api/v1/users/kevin/calendar.ics?token=3f9c1e0b7a5d4c2e8f6a1b3d5c7e9f0a"`
+}
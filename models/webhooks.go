@@ -0,0 +1,104 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Lifecycle events webhooks can subscribe to
+const (
+	WebhookUserCreated     = "user.created"
+	WebhookUserUpdated     = "user.updated"
+	WebhookUserDeleted     = "user.deleted"
+	WebhookTimeslotCreated = "timeslot.created"
+	WebhookTimeslotDeleted = "timeslot.deleted"
+	WebhookEventCreated    = "event.created"
+	WebhookEventUpdated    = "event.updated"
+	WebhookEventCancelled  = "event.cancelled"
+	WebhookRSVPChanged     = "rsvp.changed"
+)
+
+// WebhookEventTypes lists every lifecycle event a webhook can subscribe to
+var WebhookEventTypes = []string{
+	WebhookUserCreated,
+	WebhookUserUpdated,
+	WebhookUserDeleted,
+	WebhookTimeslotCreated,
+	WebhookTimeslotDeleted,
+	WebhookEventCreated,
+	WebhookEventUpdated,
+	WebhookEventCancelled,
+	WebhookRSVPChanged,
+}
+
+const (
+	WebhookDeliveryPending    = "pending"
+	WebhookDeliveryDelivering = "delivering"
+	WebhookDeliveryDelivered  = "delivered"
+	// WebhookDeliveryDead marks deliveries given up on after repeated failures, they can be retried by hand
+	WebhookDeliveryDead = "dead"
+)
+
+// Webhook is a subscription of a URL to lifecycle events
+type Webhook struct {
+	ID     uuid.UUID `json:"id"`
+	URL    string    `json:"url" example:"https://hooks.example.com/timeslot"`
+	Events []string  `json:"events" example:"event.created,rsvp.changed"`
+	// Secret signs the deliveries, it is only returned when the webhook is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookRequest subscribes a URL to lifecycle events
+type WebhookRequest struct {
+	URL    string   `json:"url" example:"https://hooks.example.com/timeslot"`
+	Events []string `json:"events" example:"event.created,rsvp.changed"`
+}
+
+// WebhookPayload is the body posted to a webhook, Data holds the user, time slots, event or RSVP the event is about
+type WebhookPayload struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type" example:"event.created"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data" swaggertype:"object"`
+}
+
+// WebhookDelivery is one attempt series of posting a payload to a webhook
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	WebhookID      uuid.UUID       `json:"webhook_id"`
+	EventType      string          `json:"event_type" example:"event.created"`
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"`
+	Status         string          `json:"status" example:"delivered"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode int             `json:"last_status_code,omitempty" example:"200"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+
+	// URL and Secret are where and how a claimed delivery is sent
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// WebhookDeliveriesResponse is a page of a webhook's delivery log
+type WebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Limit      int               `json:"limit"`
+	Offset     int               `json:"offset"`
+}
+
+// TimeslotWebhookData is the data of timeslot.created and timeslot.deleted
+type TimeslotWebhookData struct {
+	UserName  string   `json:"user_name" example:"kevin"`
+	TimeSlots []string `json:"time_slots" example:"02 Jan 2025 2-4 PM MST"`
+}
+
+// RSVPWebhookData is the data of rsvp.changed
+type RSVPWebhookData struct {
+	EventID     uuid.UUID        `json:"event_id"`
+	Participant EventParticipant `json:"participant"`
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"time"
+	"timeslot-app/models"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+type APIKeyRepoImplementation struct {
+	db *pgx.ConnPool
+}
+
+func NewAPIKeyRepository(dbConn *pgx.ConnPool) APIKeyRepo {
+	return &APIKeyRepoImplementation{
+		db: dbConn,
+	}
+}
+
+type APIKeyRepo interface {
+	CreateAPIKey(key models.APIKey, keyHash string) error
+	ListAPIKeys(userID uuid.UUID) ([]models.APIKey, error)
+	DeleteAPIKey(userID, keyID uuid.UUID) error
+	GetAPIKeyByHash(keyHash string) (models.APIKey, models.User, error)
+	TouchAPIKey(keyID uuid.UUID, usedAt time.Time) error
+	PurgeExpiredAPIKeys(userID uuid.UUID, now time.Time) error
+}
+
+func (ar *APIKeyRepoImplementation) CreateAPIKey(key models.APIKey, keyHash string) error {
+	insertQuery := `INSERT INTO api_keys (id, user_id, name, prefix, key_hash, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := ar.db.Exec(insertQuery, key.ID, key.UserID, key.Name, key.Prefix, keyHash, key.CreatedAt, key.ExpiresAt)
+	return err
+}
+
+// ListAPIKeys returns the user's keys that haven't expired
+func (ar *APIKeyRepoImplementation) ListAPIKeys(userID uuid.UUID) ([]models.APIKey, error) {
+	rows, err := ar.db.Query(`SELECT id, user_id, name, prefix, created_at, last_used_at, expires_at FROM api_keys
+		WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > now()) ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.CreatedAt, &key.LastUsedAt, &key.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey revokes one of the user's keys, pgx.ErrNoRows is returned when they have no such key
+func (ar *APIKeyRepoImplementation) DeleteAPIKey(userID, keyID uuid.UUID) error {
+	tag, err := ar.db.Exec(`DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, keyID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// GetAPIKeyByHash returns the key with the hash and the user it belongs to, pgx.ErrNoRows when there is none
+// or it has expired
+func (ar *APIKeyRepoImplementation) GetAPIKeyByHash(keyHash string) (models.APIKey, models.User, error) {
+	var key models.APIKey
+	var user models.User
+	qry := `SELECT k.id, k.user_id, k.name, k.prefix, k.created_at, k.last_used_at, k.expires_at, u.id, u.org_id, u.name, u.role
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = $1 AND (k.expires_at IS NULL OR k.expires_at > now())`
+	err := ar.db.QueryRow(qry, keyHash).Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.CreatedAt, &key.LastUsedAt,
+		&key.ExpiresAt, &user.ID, &user.OrgID, &user.Name, &user.Role)
+	return key, user, err
+}
+
+// TouchAPIKey records that a key was used, at most once a minute so busy keys don't write on every request
+func (ar *APIKeyRepoImplementation) TouchAPIKey(keyID uuid.UUID, usedAt time.Time) error {
+	updateQuery := `UPDATE api_keys SET last_used_at = $2
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2 - interval '1 minute')`
+	_, err := ar.db.Exec(updateQuery, keyID, usedAt)
+	return err
+}
+
+// PurgeExpiredAPIKeys deletes the user's keys that have expired
+func (ar *APIKeyRepoImplementation) PurgeExpiredAPIKeys(userID uuid.UUID, now time.Time) error {
+	_, err := ar.db.Exec(`DELETE FROM api_keys WHERE user_id = $1 AND expires_at <= $2`, userID, now)
+	return err
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"timeslot-app/models"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+type AuditRepoImplementation struct {
+	db *pgx.ConnPool
+}
+
+func NewAuditRepository(dbConn *pgx.ConnPool) AuditRepo {
+	return &AuditRepoImplementation{
+		db: dbConn,
+	}
+}
+
+type AuditRepo interface {
+	RecordAudit(entry models.AuditEntry) error
+	ListAudit(orgID uuid.UUID, limit, offset int) ([]models.AuditEntry, error)
+}
+
+func (ar *AuditRepoImplementation) RecordAudit(entry models.AuditEntry) error {
+	insertQuery := `INSERT INTO audit_log (id, occurred_at, user_id, user_name, role, action, resource_type, resource_id, owner, reason, org_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	_, err := ar.db.Exec(insertQuery, entry.ID, entry.OccurredAt, entry.UserID, entry.UserName, entry.Role, entry.Action,
+		entry.ResourceType, entry.ResourceID, entry.Owner, entry.Reason, entry.OrgID)
+	return err
+}
+
+// ListAudit returns a page of the organization's audit log, newest first
+func (ar *AuditRepoImplementation) ListAudit(orgID uuid.UUID, limit, offset int) ([]models.AuditEntry, error) {
+	rows, err := ar.db.Query(`SELECT id, org_id, occurred_at, user_id, user_name, role, action, resource_type, resource_id, owner, reason
+		FROM audit_log WHERE org_id = $1 ORDER BY occurred_at DESC, id LIMIT $2 OFFSET $3`, orgID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		err := rows.Scan(&entry.ID, &entry.OrgID, &entry.OccurredAt, &entry.UserID, &entry.UserName, &entry.Role, &entry.Action,
+			&entry.ResourceType, &entry.ResourceID, &entry.Owner, &entry.Reason)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/utils"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+// consumeAvailability carves the bookings of an event out of the published time slots of everyone booked,
+// what is taken is recorded in event_consumed_slots so releaseAvailability can hand it back
+func consumeAvailability(tx *pgx.Tx, eventID uuid.UUID) error {
+	qry := `select ts.id, ts.user_id, ts.time_slot, lower(b.during), upper(b.during) from event_bookings b
+		join time_slots ts on ts.user_id = b.user_id
+		where b.event_id = $1
+		order by ts.id, 4`
+
+	rows, err := tx.Query(qry, eventID)
+	if err != nil {
+		return err
+	}
+
+	type publishedSlot struct {
+		id       uuid.UUID
+		userID   uuid.UUID
+		timeSlot string
+		bookings []models.TimeSlotStartAndEnd
+	}
+	var published []*publishedSlot
+	var lastID uuid.UUID
+	for rows.Next() {
+		var id, userID uuid.UUID
+		var timeSlot string
+		var booking models.TimeSlotStartAndEnd
+		err := rows.Scan(&id, &userID, &timeSlot, &booking.StartTime, &booking.EndTime)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if len(published) == 0 || id != lastID {
+			published = append(published, &publishedSlot{id: id, userID: userID, timeSlot: timeSlot})
+			lastID = id
+		}
+		last := published[len(published)-1]
+		last.bookings = append(last.bookings, booking)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, slot := range published {
+		start, end, valid := utils.ValidateAndFormatTimeStamp(slot.timeSlot)
+		if !valid {
+			continue
+		}
+
+		free := []models.TimeSlotStartAndEnd{{StartTime: start, EndTime: end}}
+		var taken []models.TimeSlotStartAndEnd
+		for _, booking := range slot.bookings {
+			overlap, ok := intersectSlot(models.TimeSlotStartAndEnd{StartTime: start, EndTime: end}, booking)
+			if !ok {
+				continue
+			}
+			taken = append(taken, overlap)
+			free = subtractSlot(free, booking)
+		}
+		if len(taken) == 0 {
+			continue
+		}
+
+		_, err = tx.Exec(`DELETE FROM time_slots WHERE id = $1`, slot.id)
+		if err != nil {
+			return err
+		}
+		var remainders []string
+		for _, f := range free {
+			remainders = append(remainders, utils.TimeSlotsWithin(f.StartTime.In(start.Location()), f.EndTime)...)
+		}
+		for _, remainder := range remainders {
+			err = insertTimeSlot(tx, slot.userID, remainder)
+			if err != nil {
+				return err
+			}
+		}
+
+		consumeQuery := `INSERT INTO event_consumed_slots (event_id, user_id, during, time_zone) VALUES ($1, $2, tstzrange($3, $4, '[)'), $5)
+			ON CONFLICT DO NOTHING`
+		for _, t := range taken {
+			_, err = tx.Exec(consumeQuery, eventID, slot.userID, t.StartTime, t.EndTime, start.Location().String())
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// releaseAvailability gives the time slots consumed by an event back to their users,
+// merging them with the published slots they border where the result can be written as one
+func releaseAvailability(tx *pgx.Tx, eventID uuid.UUID) error {
+	qry := `DELETE FROM event_consumed_slots WHERE event_id = $1 RETURNING user_id, lower(during), upper(during), time_zone`
+
+	rows, err := tx.Query(qry, eventID)
+	if err != nil {
+		return err
+	}
+
+	type consumedSlot struct {
+		userID   uuid.UUID
+		slot     models.TimeSlotStartAndEnd
+		timeZone string
+	}
+	var consumed []consumedSlot
+	for rows.Next() {
+		var c consumedSlot
+		err := rows.Scan(&c.userID, &c.slot.StartTime, &c.slot.EndTime, &c.timeZone)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		consumed = append(consumed, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, c := range consumed {
+		loc, err := time.LoadLocation(c.timeZone)
+		if err != nil {
+			return err
+		}
+		err = restoreTimeSlot(tx, c.userID, c.slot.StartTime.In(loc), c.slot.EndTime.In(loc))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreTimeSlot publishes [start, end) for the user again, joined with the slots directly before and after it
+func restoreTimeSlot(tx *pgx.Tx, userID uuid.UUID, start, end time.Time) error {
+	rows, err := tx.Query(`select id, time_slot from time_slots where user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	var before, after uuid.NullUUID
+	mergedStart, mergedEnd := start, end
+	for rows.Next() {
+		var id uuid.UUID
+		var timeSlot string
+		err := rows.Scan(&id, &timeSlot)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		ss, se, valid := utils.ValidateAndFormatTimeStamp(timeSlot)
+		if !valid || ss.Location().String() != start.Location().String() {
+			continue
+		}
+		if se.Equal(start) {
+			before, mergedStart = uuid.NullUUID{UUID: id, Valid: true}, ss
+		}
+		if ss.Equal(end) {
+			after, mergedEnd = uuid.NullUUID{UUID: id, Valid: true}, se
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// try both neighbours, then either one, and fall back to the slot on its own
+	candidates := []struct {
+		start, end time.Time
+		replaces   []uuid.NullUUID
+	}{
+		{mergedStart, mergedEnd, []uuid.NullUUID{before, after}},
+		{mergedStart, end, []uuid.NullUUID{before}},
+		{start, mergedEnd, []uuid.NullUUID{after}},
+	}
+	for _, c := range candidates {
+		timeSlot, ok := utils.FormatTimeSlot(c.start, c.end)
+		if !ok {
+			continue
+		}
+		for _, replaced := range c.replaces {
+			if !replaced.Valid {
+				continue
+			}
+			_, err = tx.Exec(`DELETE FROM time_slots WHERE id = $1`, replaced.UUID)
+			if err != nil {
+				return err
+			}
+		}
+		return insertTimeSlot(tx, userID, timeSlot)
+	}
+	for _, timeSlot := range utils.TimeSlotsWithin(start, end) {
+		err = insertTimeSlot(tx, userID, timeSlot)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertTimeSlot(tx *pgx.Tx, userID uuid.UUID, timeSlot string) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO time_slots (id, user_id, org_id, time_slot) SELECT $1, id, org_id, $3 FROM users WHERE id = $2`, id, userID, timeSlot)
+	return err
+}
+
+// intersectSlot returns the part of a that b covers, ok is false when they don't overlap
+func intersectSlot(a, b models.TimeSlotStartAndEnd) (overlap models.TimeSlotStartAndEnd, ok bool) {
+	overlap = a
+	if b.StartTime.After(overlap.StartTime) {
+		overlap.StartTime = b.StartTime
+	}
+	if b.EndTime.Before(overlap.EndTime) {
+		overlap.EndTime = b.EndTime
+	}
+	return overlap, overlap.StartTime.Before(overlap.EndTime)
+}
+
+// subtractSlot removes the booking from each free slot, splitting a slot in two when the booking sits in its middle
+func subtractSlot(free []models.TimeSlotStartAndEnd, booking models.TimeSlotStartAndEnd) []models.TimeSlotStartAndEnd {
+	remaining := []models.TimeSlotStartAndEnd{}
+	for _, f := range free {
+		if !booking.StartTime.Before(f.EndTime) || !booking.EndTime.After(f.StartTime) {
+			remaining = append(remaining, f)
+			continue
+		}
+		if f.StartTime.Before(booking.StartTime) {
+			remaining = append(remaining, models.TimeSlotStartAndEnd{StartTime: f.StartTime, EndTime: booking.StartTime})
+		}
+		if booking.EndTime.Before(f.EndTime) {
+			remaining = append(remaining, models.TimeSlotStartAndEnd{StartTime: booking.EndTime, EndTime: f.EndTime})
+		}
+	}
+	return remaining
+}
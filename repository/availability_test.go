@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"testing"
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubtractSlot(t *testing.T) {
+	mst, _ := time.LoadLocation("MST")
+	at := func(hour int) time.Time { return time.Date(2025, 1, 2, hour, 0, 0, 0, mst) }
+	free := []models.TimeSlotStartAndEnd{{StartTime: at(13), EndTime: at(17)}}
+
+	t.Run("Middle", func(t *testing.T) {
+		remaining := subtractSlot(free, models.TimeSlotStartAndEnd{StartTime: at(14), EndTime: at(15)})
+
+		assert.Len(t, remaining, 2)
+		first, _ := utils.FormatTimeSlot(remaining[0].StartTime, remaining[0].EndTime)
+		second, _ := utils.FormatTimeSlot(remaining[1].StartTime, remaining[1].EndTime)
+		assert.Equal(t, "02 Jan 2025 1-2 PM MST", first)
+		assert.Equal(t, "02 Jan 2025 3-5 PM MST", second)
+	})
+
+	t.Run("Whole", func(t *testing.T) {
+		remaining := subtractSlot(free, models.TimeSlotStartAndEnd{StartTime: at(12), EndTime: at(18)})
+		assert.Empty(t, remaining)
+	})
+
+	t.Run("Outside", func(t *testing.T) {
+		remaining := subtractSlot(free, models.TimeSlotStartAndEnd{StartTime: at(17), EndTime: at(18)})
+		assert.Equal(t, free, remaining)
+	})
+
+	t.Run("Intersect", func(t *testing.T) {
+		overlap, ok := intersectSlot(free[0], models.TimeSlotStartAndEnd{StartTime: at(16), EndTime: at(18)})
+		assert.True(t, ok)
+		assert.Equal(t, at(16), overlap.StartTime)
+		assert.Equal(t, at(17), overlap.EndTime)
+	})
+
+	t.Run("Across Noon", func(t *testing.T) {
+		timeSlot, ok := utils.FormatTimeSlot(at(11), at(13))
+		assert.True(t, ok)
+		assert.Equal(t, "02 Jan 2025 11 AM-1 PM MST", timeSlot)
+	})
+
+	t.Run("Minutes", func(t *testing.T) {
+		remaining := subtractSlot(free, models.TimeSlotStartAndEnd{StartTime: at(13).Add(30 * time.Minute), EndTime: at(14).Add(45 * time.Minute)})
+
+		assert.Len(t, remaining, 2)
+		first, _ := utils.FormatTimeSlot(remaining[0].StartTime, remaining[0].EndTime)
+		second, _ := utils.FormatTimeSlot(remaining[1].StartTime, remaining[1].EndTime)
+		assert.Equal(t, "02 Jan 2025 1-1:30 PM MST", first)
+		assert.Equal(t, "02 Jan 2025 2:45-5 PM MST", second)
+
+		start, end, valid := utils.ValidateAndFormatTimeStamp(second)
+		assert.True(t, valid)
+		assert.Equal(t, remaining[1], models.TimeSlotStartAndEnd{StartTime: start, EndTime: end})
+	})
+
+	t.Run("Until Midnight", func(t *testing.T) {
+		// the parts of a minute are left out and a slot ends at midnight at the latest
+		timeSlots := utils.TimeSlotsWithin(at(22).Add(30*time.Second), at(25).Add(15*time.Minute))
+		assert.Equal(t, []string{"02 Jan 2025 10:01 PM-12 AM MST", "03 Jan 2025 12-1:15 AM MST"}, timeSlots)
+
+		start, end, valid := utils.ValidateAndFormatTimeStamp(timeSlots[0])
+		assert.True(t, valid)
+		assert.Equal(t, at(22).Add(time.Minute), start)
+		assert.Equal(t, at(24), end)
+	})
+}
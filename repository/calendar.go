@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+type CalendarRepoImplementation struct {
+	db *pgx.ConnPool
+}
+
+func NewCalendarRepository(dbConn *pgx.ConnPool) CalendarRepo {
+	return &CalendarRepoImplementation{
+		db: dbConn,
+	}
+}
+
+type CalendarRepo interface {
+	SetCalendarTokenHash(userID uuid.UUID, tokenHash string, createdAt time.Time) error
+	GetCalendarTokenHash(userID uuid.UUID) (string, error)
+}
+
+// SetCalendarTokenHash stores the hash of a user's calendar feed token, replacing the previous one
+func (cr *CalendarRepoImplementation) SetCalendarTokenHash(userID uuid.UUID, tokenHash string, createdAt time.Time) error {
+	upsertQuery := `INSERT INTO user_calendar_tokens (user_id, token_hash, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET token_hash = excluded.token_hash, created_at = excluded.created_at`
+	_, err := cr.db.Exec(upsertQuery, userID, tokenHash, createdAt)
+	return err
+}
+
+// GetCalendarTokenHash returns the hash of a user's calendar feed token, pgx.ErrNoRows when none was issued
+func (cr *CalendarRepoImplementation) GetCalendarTokenHash(userID uuid.UUID) (string, error) {
+	var tokenHash string
+	err := cr.db.QueryRow(`SELECT token_hash FROM user_calendar_tokens WHERE user_id = $1`, userID).Scan(&tokenHash)
+	return tokenHash, err
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"errors"
+	"time"
+	"timeslot-app/models"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+var ErrDelegateExists = errors.New("user is already a delegate")
+
+type DelegateRepoImplementation struct {
+	db *pgx.ConnPool
+}
+
+func NewDelegateRepository(dbConn *pgx.ConnPool) DelegateRepo {
+	return &DelegateRepoImplementation{
+		db: dbConn,
+	}
+}
+
+type DelegateRepo interface {
+	AddDelegate(principalID, delegateID uuid.UUID, scopes []string, createdAt time.Time) error
+	ListDelegates(principalID uuid.UUID) ([]models.Delegate, error)
+	SetDelegateScopes(principalID, delegateID uuid.UUID, scopes []string) (models.Delegate, error)
+	RemoveDelegate(principalID, delegateID uuid.UUID) error
+	IsDelegate(principalID, delegateID uuid.UUID, scope string) (bool, error)
+}
+
+// AddDelegate lets delegateID act for principalID within the scopes, ErrDelegateExists is returned when it already
+// may and ErrOtherOrganization when the two users belong to different organizations
+func (dr *DelegateRepoImplementation) AddDelegate(principalID, delegateID uuid.UUID, scopes []string, createdAt time.Time) error {
+	insertQuery := `INSERT INTO user_delegates (principal_id, delegate_id, scopes, created_at)
+		SELECT p.id, d.id, $3, $4 FROM users p JOIN users d ON d.org_id = p.org_id WHERE p.id = $1 AND d.id = $2`
+	tag, err := dr.db.Exec(insertQuery, principalID, delegateID, scopes, createdAt)
+	var pgErr pgx.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrDelegateExists
+	}
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrOtherOrganization
+	}
+	return nil
+}
+
+func (dr *DelegateRepoImplementation) ListDelegates(principalID uuid.UUID) ([]models.Delegate, error) {
+	rows, err := dr.db.Query(`SELECT d.principal_id, d.delegate_id, u.name, d.scopes, d.created_at
+		FROM user_delegates d
+		JOIN users u ON u.id = d.delegate_id
+		WHERE d.principal_id = $1 ORDER BY u.name`, principalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	delegates := []models.Delegate{}
+	for rows.Next() {
+		var delegate models.Delegate
+		err := rows.Scan(&delegate.PrincipalID, &delegate.DelegateID, &delegate.DelegateName, &delegate.Scopes, &delegate.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		delegates = append(delegates, delegate)
+	}
+	return delegates, rows.Err()
+}
+
+// SetDelegateScopes replaces the scopes delegateID acts for principalID within, pgx.ErrNoRows is returned when
+// it isn't a delegate
+func (dr *DelegateRepoImplementation) SetDelegateScopes(principalID, delegateID uuid.UUID, scopes []string) (models.Delegate, error) {
+	var delegate models.Delegate
+	err := dr.db.QueryRow(`UPDATE user_delegates d SET scopes = $3
+		FROM users u WHERE u.id = d.delegate_id AND d.principal_id = $1 AND d.delegate_id = $2
+		RETURNING d.principal_id, d.delegate_id, u.name, d.scopes, d.created_at`, principalID, delegateID, scopes).
+		Scan(&delegate.PrincipalID, &delegate.DelegateID, &delegate.DelegateName, &delegate.Scopes, &delegate.CreatedAt)
+	return delegate, err
+}
+
+// RemoveDelegate stops delegateID acting for principalID, pgx.ErrNoRows is returned when it couldn't
+func (dr *DelegateRepoImplementation) RemoveDelegate(principalID, delegateID uuid.UUID) error {
+	tag, err := dr.db.Exec(`DELETE FROM user_delegates WHERE principal_id = $1 AND delegate_id = $2`, principalID, delegateID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// IsDelegate reports whether delegateID acts for principalID with the scope
+func (dr *DelegateRepoImplementation) IsDelegate(principalID, delegateID uuid.UUID, scope string) (bool, error) {
+	var exists bool
+	err := dr.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM user_delegates WHERE principal_id = $1 AND delegate_id = $2 AND $3 = ANY(scopes))`,
+		principalID, delegateID, scope).Scan(&exists)
+	return exists, err
+}
@@ -1,16 +1,27 @@
 package repository
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 	"timeslot-app/models"
+	"timeslot-app/utils"
 
+	"github.com/gofrs/uuid"
 	"github.com/jackc/pgx"
 )
 
+// exclusionViolation is the postgres error code raised when an insert breaks an EXCLUDE constraint
+const exclusionViolation = "23P01"
+
+var ErrEventConflict = errors.New("event overlaps an existing booking")
+
 type EventRepoImplementation struct {
-	db *pgx.Conn
+	db *pgx.ConnPool
 }
 
-func NewEventRepository(dbconn *pgx.Conn) EventRepo {
+func NewEventRepository(dbconn *pgx.ConnPool) EventRepo {
 	return &EventRepoImplementation{
 		db: dbconn,
 	}
@@ -18,60 +29,704 @@ func NewEventRepository(dbconn *pgx.Conn) EventRepo {
 
 type EventRepo interface {
 	CreateEvent(event models.Event) error
-	GetEvent(eventID string) (models.Event, error)
+	GetEvent(orgID uuid.UUID, eventID string) (models.Event, error)
 	DeleteEvent(eventID string) error
-	GetEventsForUser(username string) ([]models.Event, error)
+	GetEventsForUser(orgID uuid.UUID, username string, filter models.EventFilter) ([]models.Event, error)
+	GetEventPageForUser(orgID uuid.UUID, username string, filter models.EventFilter, page models.EventPage) ([]models.Event, int, error)
+	GetConflictingEvents(attendees []uuid.UUID, slots []models.TimeSlotStartAndEnd, excludeEventID uuid.UUID) ([]models.EventConflict, error)
+	UpdateEvent(event models.Event, reschedule *models.EventReschedule) error
+	GetRescheduleHistory(eventID string) ([]models.EventReschedule, error)
+	UpdateParticipantResponse(participant models.EventParticipant) error
+	SplitEvent(original models.Event, following *models.Event) error
+	CancelEvent(eventID string, cancellation models.EventCancellation) error
+	RestoreEvent(event models.Event) error
+	PurgeCancelledEvents(cancelledBefore time.Time) (int64, error)
 }
 
 func (er *EventRepoImplementation) CreateEvent(event models.Event) error {
 
-	insertQuery := `INSERT INTO events (id, title, event_owner, event_start_time, event_end_time, participants) VALUES ($1, $2, $3, $4, $5, $6)`
-	_, err := er.db.Exec(insertQuery, event.ID, event.Title, event.EventOwner, event.EventStartTime, event.EventEndTime, event.Participants)
+	tx, err := er.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = createEvent(tx, event)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// createEvent stores the event in the organization of its owner
+func createEvent(tx *pgx.Tx, event models.Event) error {
+	reminders, err := reminderSeconds(event.Reminders)
+	if err != nil {
+		return err
+	}
+
+	insertQuery := `INSERT INTO events (id, title, event_owner, event_start_time, event_end_time, forced, recurrence,
+		description, location, conference_url, visibility, labels, reminder_offsets, time_zone, ical_uid, caldav_name, org_id, acting_delegate)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12::jsonb, $13, $14, nullif($15, ''), nullif($16, ''),
+			(SELECT org_id FROM users WHERE id = $3),
+			(SELECT d.id FROM users d JOIN users o ON o.org_id = d.org_id WHERE o.id = $3 AND d.name = $17))`
+	_, err = tx.Exec(insertQuery, event.ID, event.Title, event.EventOwner, event.EventStartTime, event.EventEndTime, event.Forced, event.Recurrence,
+		event.Description, event.Location, event.ConferenceURL, event.Visibility, labelsJSON(event.Labels), reminders, eventTimeZone(event),
+		event.ICalUID, event.CalDAVName, event.ActingDelegate)
+	if err != nil {
+		return err
+	}
+
+	err = insertParticipants(tx, event)
 	if err != nil {
 		return err
 	}
+
+	err = insertExceptions(tx, event)
+	if err != nil {
+		return err
+	}
+
+	return insertBookings(tx, event)
+}
+
+// insertParticipants adds the participants of the event, ErrOtherOrganization is returned when a participant who is
+// a user belongs to another organization than the event
+func insertParticipants(tx *pgx.Tx, event models.Event) error {
+	insertQuery := `INSERT INTO event_participants (id, event_id, user_id, guest_name, role, status, response_comment, proposed_start_time, proposed_end_time, responded_at, via_group)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	for _, p := range event.Participants {
+		var guestName, viaGroup *string
+		if !p.UserID.Valid {
+			guestName = &p.Name
+		}
+		if p.Group != "" {
+			viaGroup = &p.Group
+		}
+		_, err := tx.Exec(insertQuery, p.ID, event.ID, p.UserID, guestName, p.Role, p.Status, p.Comment, p.ProposedStartTime, p.ProposedEndTime, p.RespondedAt, viaGroup)
+		if err != nil {
+			return err
+		}
+	}
+
+	var outsiders int
+	err := tx.QueryRow(`SELECT count(*) FROM event_participants p
+		JOIN events e ON e.id = p.event_id
+		JOIN users u ON u.id = p.user_id
+		WHERE p.event_id = $1 AND u.org_id <> e.org_id`, event.ID).Scan(&outsiders)
+	if err != nil {
+		return err
+	}
+	if outsiders > 0 {
+		return ErrOtherOrganization
+	}
 	return nil
 }
 
-func (er *EventRepoImplementation) GetEvent(eventID string) (models.Event, error) {
+func insertExceptions(tx *pgx.Tx, event models.Event) error {
+	insertQuery := `INSERT INTO event_exceptions (event_id, original_start_time, cancelled, event_start_time, event_end_time) VALUES ($1, $2, $3, $4, $5)`
+	for _, e := range event.Exceptions {
+		_, err := tx.Exec(insertQuery, event.ID, e.OriginalStartTime, e.Cancelled, e.EventStartTime, e.EventEndTime)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertBookings books the owner and every registered participant for each occurrence of the event and takes
+// the booked time out of their availability, the exclusion constraint on event_bookings rejects overlaps that
+// slipped past the service check. The reminders of the bookings are scheduled along with them.
+func insertBookings(tx *pgx.Tx, event models.Event) error {
+	slots, err := utils.EventSlots(event)
+	if err != nil {
+		return err
+	}
+
+	bookingQuery := `INSERT INTO event_bookings (event_id, user_id, during, forced)
+		SELECT $1, $5::uuid, tstzrange($2, $3, '[)'), $4
+		UNION
+		SELECT $1, p.user_id, tstzrange($2, $3, '[)'), $4 FROM event_participants p
+		WHERE p.event_id = $1 AND p.user_id IS NOT NULL`
+	for _, slot := range slots {
+		_, err := tx.Exec(bookingQuery, event.ID, slot.StartTime, slot.EndTime, event.Forced, event.EventOwner)
+		if err != nil {
+			var pgErr pgx.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == exclusionViolation {
+				return ErrEventConflict
+			}
+			return err
+		}
+	}
+	err = consumeAvailability(tx, event.ID)
+	if err != nil {
+		return err
+	}
+
+	return scheduleReminders(tx, `b.event_id = $1`, event.ID)
+}
+
+// UpdateEvent overwrites the event and its bookings, recording the reschedule when one is given
+func (er *EventRepoImplementation) UpdateEvent(event models.Event, reschedule *models.EventReschedule) error {
+
+	tx, err := er.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = updateEvent(tx, event)
+	if err != nil {
+		return err
+	}
+
+	if reschedule != nil {
+		insertQuery := `INSERT INTO event_reschedules (id, event_id, previous_start_time, previous_end_time, new_start_time, new_end_time, reason, rescheduled_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+		_, err = tx.Exec(insertQuery, reschedule.ID, reschedule.EventID, reschedule.PreviousStartTime, reschedule.PreviousEndTime,
+			reschedule.NewStartTime, reschedule.NewEndTime, reschedule.Reason, reschedule.RescheduledAt)
+		if err != nil {
+			return err
+		}
+	}
 
+	return tx.Commit()
+}
+
+func updateEvent(tx *pgx.Tx, event models.Event) error {
+	reminders, err := reminderSeconds(event.Reminders)
+	if err != nil {
+		return err
+	}
+
+	updateQuery := `UPDATE events SET title = $2, event_start_time = $3, event_end_time = $4, forced = $5, recurrence = $6,
+		description = $7, location = $8, conference_url = $9, visibility = $10, labels = $11::jsonb, reminder_offsets = $12,
+		time_zone = $13, version = version + 1 WHERE id = $1`
+	_, err = tx.Exec(updateQuery, event.ID, event.Title, event.EventStartTime, event.EventEndTime, event.Forced, event.Recurrence,
+		event.Description, event.Location, event.ConferenceURL, event.Visibility, labelsJSON(event.Labels), reminders, eventTimeZone(event))
+	if err != nil {
+		return err
+	}
+
+	err = releaseAvailability(tx, event.ID)
+	if err != nil {
+		return err
+	}
+
+	err = unscheduleReminders(tx, event.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"event_bookings", "event_participants", "event_exceptions"} {
+		_, err = tx.Exec(`DELETE FROM `+table+` WHERE event_id = $1`, event.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = insertParticipants(tx, event)
+	if err != nil {
+		return err
+	}
+
+	err = insertExceptions(tx, event)
+	if err != nil {
+		return err
+	}
+
+	return insertBookings(tx, event)
+}
+
+// SplitEvent ends a recurring series with the updated original and continues it as the following event,
+// both are written in a single transaction. A nil following drops the rest of the series.
+func (er *EventRepoImplementation) SplitEvent(original models.Event, following *models.Event) error {
+
+	tx, err := er.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = updateEvent(tx, original)
+	if err != nil {
+		return err
+	}
+
+	if following != nil {
+		err = createEvent(tx, *following)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UpdateParticipantResponse stores a participant's RSVP, the answer is part of the event so its version goes up
+func (er *EventRepoImplementation) UpdateParticipantResponse(participant models.EventParticipant) error {
+
+	tx, err := er.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	updateQuery := `UPDATE event_participants SET status = $2, response_comment = $3, proposed_start_time = $4, proposed_end_time = $5, responded_at = $6 WHERE id = $1`
+	_, err = tx.Exec(updateQuery, participant.ID, participant.Status, participant.Comment, participant.ProposedStartTime, participant.ProposedEndTime, participant.RespondedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE events SET version = version + 1 WHERE id = (SELECT event_id FROM event_participants WHERE id = $1)`, participant.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetRescheduleHistory returns every recorded move of the event, oldest first
+func (er *EventRepoImplementation) GetRescheduleHistory(eventID string) ([]models.EventReschedule, error) {
+	qry := `select id, event_id, previous_start_time, previous_end_time, new_start_time, new_end_time, reason, rescheduled_at
+		from event_reschedules where event_id = $1 order by rescheduled_at`
+
+	rows, err := er.db.Query(qry, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []models.EventReschedule
+	for rows.Next() {
+		var r models.EventReschedule
+		err := rows.Scan(&r.ID, &r.EventID, &r.PreviousStartTime, &r.PreviousEndTime, &r.NewStartTime, &r.NewEndTime, &r.Reason, &r.RescheduledAt)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, r)
+	}
+	return history, rows.Err()
+}
+
+// GetEvent returns the event with the ID, pgx.ErrNoRows when there is none or it belongs to another organization
+func (er *EventRepoImplementation) GetEvent(orgID uuid.UUID, eventID string) (models.Event, error) {
+
+	qry := `SELECT e.id, e.event_owner, e.title, e.event_start_time, e.event_end_time, e.forced, e.recurrence,
+		e.status, e.cancelled_at, coalesce(cu.name, ''), e.cancel_reason,
+		e.description, e.location, e.conference_url, e.visibility, e.labels::text, e.reminder_offsets, e.time_zone,
+		e.version, coalesce(e.ical_uid, ''), coalesce(e.caldav_name, ''), coalesce(du.name, '') FROM events e
+		left join users cu on cu.id = e.cancelled_by
+		left join users du on du.id = e.acting_delegate
+		WHERE e.org_id = $1 AND e.id = $2`
+	event, err := scanEvent(er.db.QueryRow(qry, orgID, eventID))
+	if err != nil {
+		return models.Event{}, err
+	}
+
+	err = er.loadEventDetails(&event)
+	if err != nil {
+		return models.Event{}, err
+	}
+	return event, nil
+}
+
+// loadEventDetails fills in the participants and recurrence exceptions of an event
+func (er *EventRepoImplementation) loadEventDetails(event *models.Event) error {
+	var err error
+	event.Participants, err = er.getParticipants(event.ID)
+	if err != nil {
+		return err
+	}
+
+	if event.Recurrence != "" {
+		event.Exceptions, err = er.getExceptions(event.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	loc := event.EventStartTime.Location()
+	for i, e := range event.Exceptions {
+		event.Exceptions[i].OriginalStartTime = e.OriginalStartTime.In(loc)
+		if e.EventStartTime != nil && e.EventEndTime != nil {
+			start, end := e.EventStartTime.In(loc), e.EventEndTime.In(loc)
+			event.Exceptions[i].EventStartTime, event.Exceptions[i].EventEndTime = &start, &end
+		}
+	}
+	return nil
+}
+
+func (er *EventRepoImplementation) getExceptions(eventID uuid.UUID) ([]models.EventException, error) {
+	qry := `select original_start_time, cancelled, event_start_time, event_end_time from event_exceptions
+		where event_id = $1 order by original_start_time`
+
+	rows, err := er.db.Query(qry, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exceptions []models.EventException
+	for rows.Next() {
+		var e models.EventException
+		err := rows.Scan(&e.OriginalStartTime, &e.Cancelled, &e.EventStartTime, &e.EventEndTime)
+		if err != nil {
+			return nil, err
+		}
+		exceptions = append(exceptions, e)
+	}
+	return exceptions, rows.Err()
+}
+
+// getParticipants returns the participants of an event, users are named by their current user name
+func (er *EventRepoImplementation) getParticipants(eventID uuid.UUID) ([]models.EventParticipant, error) {
+	qry := `select p.id, p.user_id, coalesce(u.name, p.guest_name), p.role, p.status,
+		p.response_comment, p.proposed_start_time, p.proposed_end_time, p.responded_at, coalesce(p.via_group, '') from event_participants p
+		left join users u on u.id = p.user_id
+		where p.event_id = $1
+		order by p.role desc, 3`
+
+	rows, err := er.db.Query(qry, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	participants := []models.EventParticipant{}
+	for rows.Next() {
+		var p models.EventParticipant
+		err := rows.Scan(&p.ID, &p.UserID, &p.Name, &p.Role, &p.Status, &p.Comment, &p.ProposedStartTime, &p.ProposedEndTime, &p.RespondedAt, &p.Group)
+		if err != nil {
+			return nil, err
+		}
+		p.External = !p.UserID.Valid
+		participants = append(participants, p)
+	}
+	return participants, rows.Err()
+}
+
+// eventTimeZone names the location of the event start for the time_zone column, empty when it has no name to load it by
+func eventTimeZone(event models.Event) string {
+	name := event.EventStartTime.Location().String()
+	if name == "Local" {
+		return ""
+	}
+	return name
+}
+
+// labelsJSON encodes labels for the jsonb labels column, no labels is an empty object
+func labelsJSON(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+	encoded, _ := json.Marshal(labels)
+	return string(encoded)
+}
+
+// eventScanner is satisfied by both *pgx.Row and *pgx.Rows
+type eventScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanEvent reads the event columns selected by GetEvent and GetEventsForUser, followed by any extra columns
+func scanEvent(row eventScanner, extra ...interface{}) (models.Event, error) {
 	var event models.Event
-	err := er.db.QueryRow("SELECT * FROM events WHERE id = $1", eventID).Scan(&event.ID, &event.Title, &event.EventOwner, &event.EventStartTime, &event.EventEndTime, &event.Participants)
+	var cancelledAt *time.Time
+	var cancellation models.EventCancellation
+	var labels string
+	var reminders []int64
+	var timeZone string
+	dest := []interface{}{&event.ID, &event.EventOwner, &event.Title, &event.EventStartTime, &event.EventEndTime, &event.Forced, &event.Recurrence,
+		&event.Status, &cancelledAt, &cancellation.CancelledBy, &cancellation.Reason,
+		&event.Description, &event.Location, &event.ConferenceURL, &event.Visibility, &labels, &reminders, &timeZone,
+		&event.Version, &event.ICalUID, &event.CalDAVName, &event.ActingDelegate}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return models.Event{}, err
+	}
+
+	err = json.Unmarshal([]byte(labels), &event.Labels)
 	if err != nil {
 		return models.Event{}, err
 	}
+	if len(event.Labels) == 0 {
+		event.Labels = nil
+	}
+	event.Reminders = reminderOffsets(reminders)
+
+	// events read back in the time zone they were booked in, so recurrences keep their wall clock time
+	if loc, err := time.LoadLocation(timeZone); timeZone != "" && err == nil {
+		event.EventStartTime = event.EventStartTime.In(loc)
+		event.EventEndTime = event.EventEndTime.In(loc)
+	}
+
+	if event.Status == models.EventStatusCancelled && cancelledAt != nil {
+		cancellation.CancelledAt = *cancelledAt
+		event.Cancellation = &cancellation
+	}
 	return event, nil
 }
 
+// CancelEvent marks an active event cancelled and drops its bookings and pending reminders, giving the consumed
+// availability back.
+// pgx.ErrNoRows is returned when there is no active event with the ID.
+func (er *EventRepoImplementation) CancelEvent(eventID string, cancellation models.EventCancellation) error {
+
+	tx, err := er.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	updateQuery := `UPDATE events SET status = $2, cancelled_at = $3, cancelled_by = (SELECT u.id FROM users u WHERE u.org_id = events.org_id AND u.name = $4), cancel_reason = $5,
+		version = version + 1 WHERE id = $1 AND status = $6`
+	tag, err := tx.Exec(updateQuery, eventID, models.EventStatusCancelled, cancellation.CancelledAt, cancellation.CancelledBy, cancellation.Reason, models.EventStatusActive)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	id, err := uuid.FromString(eventID)
+	if err != nil {
+		return err
+	}
+	err = releaseAvailability(tx, id)
+	if err != nil {
+		return err
+	}
+
+	err = unscheduleReminders(tx, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM event_bookings WHERE event_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RestoreEvent makes a cancelled event active again and books it anew, ErrEventConflict is returned
+// when the time has been taken in the meantime and pgx.ErrNoRows when the event isn't cancelled
+func (er *EventRepoImplementation) RestoreEvent(event models.Event) error {
+
+	tx, err := er.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	updateQuery := `UPDATE events SET status = $2, cancelled_at = NULL, cancelled_by = NULL, cancel_reason = '', forced = $3,
+		version = version + 1 WHERE id = $1 AND status = $4`
+	tag, err := tx.Exec(updateQuery, event.ID, models.EventStatusActive, event.Forced, models.EventStatusCancelled)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	err = insertBookings(tx, event)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PurgeCancelledEvents permanently deletes the events cancelled before the given time and returns how many were removed
+func (er *EventRepoImplementation) PurgeCancelledEvents(cancelledBefore time.Time) (int64, error) {
+
+	deleteQuery := `DELETE FROM events WHERE status = $1 AND cancelled_at < $2`
+	tag, err := er.db.Exec(deleteQuery, models.EventStatusCancelled, cancelledBefore)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// DeleteEvent removes the event and hands the availability its bookings consumed back to the attendees
 func (er *EventRepoImplementation) DeleteEvent(eventID string) error {
 
+	id, err := uuid.FromString(eventID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := er.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = releaseAvailability(tx, id)
+	if err != nil {
+		return err
+	}
+
 	deleteQuery := `DELETE FROM events WHERE id = $1`
-	_, err := er.db.Exec(deleteQuery, eventID)
+	_, err = tx.Exec(deleteQuery, id)
 	if err != nil {
 		return err
 	}
-	return nil
+	return tx.Commit()
+}
+
+// eventsForUserQuery selects the events of the user $1 of the organization $7 matching the filter $2 to $6, with the
+// columns scanEvent reads and the user's role on each
+const eventsForUserQuery = `select e.id, e.event_owner, e.title, e.event_start_time, e.event_end_time, e.forced, e.recurrence,
+		e.status, e.cancelled_at, coalesce(cu.name, ''), e.cancel_reason,
+		e.description, e.location, e.conference_url, e.visibility, e.labels::text, e.reminder_offsets, e.time_zone,
+		e.version, coalesce(e.ical_uid, ''), coalesce(e.caldav_name, ''), coalesce(du.name, ''),
+		case when e.event_owner = u.id then 'owner' else 'participant' end as role
+		from users u
+		join events e on e.org_id = u.org_id and (e.event_owner = u.id
+			or exists (select 1 from event_participants p where p.event_id = e.id and p.user_id = u.id))
+		left join users cu on cu.id = e.cancelled_by
+		left join users du on du.id = e.acting_delegate
+		where u.org_id = $7 and u.name = $1
+			and ($2 = '' or e.status = $2)
+			and ($3 = '' or (case when e.event_owner = u.id then 'owner' else 'participant' end) = $3)
+			and ($4::timestamptz is null or e.recurrence <> '' or e.event_end_time > $4)
+			and ($5::timestamptz is null or e.event_start_time < $5)
+			and e.labels @> $6::jsonb`
+
+// eventSortColumns are the columns events can be sorted by, titles compare byte by byte whatever the database collation
+var eventSortColumns = map[string]string{
+	"start_time": "e.event_start_time",
+	"end_time":   "e.event_end_time",
+	"title":      `e.title collate "C"`,
 }
 
-func (er *EventRepoImplementation) GetEventsForUser(username string) ([]models.Event, error) {
-	qry := `select e.id, e.event_owner, e.title, e.event_start_time, e.event_end_time, e.participants from events e
-		join users u on e.event_owner=u.id 
-		where u.name = $1`
+// eventPageOrder is the order by clause of a page, ties keep the order of start time and ID in either direction
+func eventPageOrder(page models.EventPage) (string, error) {
+	column, ok := eventSortColumns[page.Sort]
+	if !ok {
+		return "", fmt.Errorf("events can't be sorted by %q", page.Sort)
+	}
+	direction := "asc"
+	if page.Descending {
+		direction = "desc"
+	}
+	return fmt.Sprintf("order by %s %s, e.event_start_time, e.id", column, direction), nil
+}
+
+// GetEventsForUser returns the events the organization's user owns or takes part in, with the user's role on each.
+// The time range of the filter is applied to one-off events only, recurring events starting before its end are all
+// returned so their occurrences can be expanded.
+func (er *EventRepoImplementation) GetEventsForUser(orgID uuid.UUID, username string, filter models.EventFilter) ([]models.Event, error) {
+	qry := eventsForUserQuery + `
+		order by e.event_start_time, e.id`
+
+	return er.queryEventsForUser(qry, username, filter.Status, filter.Role, filter.From, filter.To, labelsJSON(filter.Labels), orgID)
+}
 
-	rows, err := er.db.Query(qry, username)
+// GetEventPageForUser returns a page of the events GetEventsForUser finds, sorted and paged in the query, and how
+// many there are in all. A recurring event is a single row, so the page is only what the user sees when their
+// events aren't expanded into occurrences.
+func (er *EventRepoImplementation) GetEventPageForUser(orgID uuid.UUID, username string, filter models.EventFilter, page models.EventPage) ([]models.Event, int, error) {
+	order, err := eventPageOrder(page)
+	if err != nil {
+		return nil, 0, err
+	}
+	args := []interface{}{username, filter.Status, filter.Role, filter.From, filter.To, labelsJSON(filter.Labels), orgID}
+
+	var total int
+	err = er.db.QueryRow(`select count(*) from (`+eventsForUserQuery+`) listed`, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	if page.Offset >= total {
+		return []models.Event{}, total, nil
+	}
+
+	qry := eventsForUserQuery + `
+		` + order + `
+		limit $8 offset $9`
+	events, err := er.queryEventsForUser(qry, append(args, page.Limit, page.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// queryEventsForUser runs a query selecting the columns of eventsForUserQuery and loads the details of the events
+func (er *EventRepoImplementation) queryEventsForUser(qry string, args ...interface{}) ([]models.Event, error) {
+	rows, err := er.db.Query(qry, args...)
 	if err != nil {
 		return []models.Event{}, err
 	}
+	defer rows.Close()
+
 	var events []models.Event
 	for rows.Next() {
 
-		var event models.Event
-		err := rows.Scan(&event.ID, &event.EventOwner, &event.Title, &event.EventStartTime, &event.EventEndTime, &event.Participants)
+		var role string
+		event, err := scanEvent(rows, &role)
 		if err != nil {
 			return nil, err
 		}
+		event.Role = role
 
 		events = append(events, event)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// details are loaded once the events query is drained, so a listing holds only one connection of the pool at a time
+	for i := range events {
+		err = er.loadEventDetails(&events[i])
+		if err != nil {
+			return nil, err
+		}
+	}
 	return events, nil
 }
+
+// GetConflictingEvents returns every booking of the given users that overlaps any of the slots,
+// ignoring the bookings of excludeEventID so an event never conflicts with itself when it is updated.
+// Private events are reported as Busy without their title.
+func (er *EventRepoImplementation) GetConflictingEvents(attendees []uuid.UUID, slots []models.TimeSlotStartAndEnd, excludeEventID uuid.UUID) ([]models.EventConflict, error) {
+	qry := `select distinct u.name, e.id, case when e.visibility = 'private' then 'Busy' else e.title end, lower(b.during), upper(b.during) from event_bookings b
+		join events e on e.id = b.event_id
+		join users u on u.id = b.user_id
+		join unnest($2::timestamptz[], $3::timestamptz[]) as s(start_time, end_time)
+			on b.during && tstzrange(s.start_time, s.end_time, '[)')
+		where b.user_id = any($1::uuid[]) and b.event_id <> $4
+		order by 4, 1`
+
+	attendeeIDs := make([]string, 0, len(attendees))
+	for _, id := range attendees {
+		attendeeIDs = append(attendeeIDs, id.String())
+	}
+	startTimes := make([]time.Time, 0, len(slots))
+	endTimes := make([]time.Time, 0, len(slots))
+	for _, slot := range slots {
+		startTimes = append(startTimes, slot.StartTime)
+		endTimes = append(endTimes, slot.EndTime)
+	}
+
+	rows, err := er.db.Query(qry, attendeeIDs, startTimes, endTimes, excludeEventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conflicts []models.EventConflict
+	for rows.Next() {
+		var conflict models.EventConflict
+		err := rows.Scan(&conflict.Attendee, &conflict.EventID, &conflict.Title, &conflict.EventStartTime, &conflict.EventEndTime)
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts, rows.Err()
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"testing"
+	"time"
 	"timeslot-app/models"
 
 	"github.com/gofrs/uuid"
@@ -18,8 +19,8 @@ func (m *MockEventRepo) CreateEvent(event models.Event) error {
 	return args.Error(0)
 }
 
-func (m *MockEventRepo) GetEvent(eventID string) (models.Event, error) {
-	args := m.Called(eventID)
+func (m *MockEventRepo) GetEvent(orgID uuid.UUID, eventID string) (models.Event, error) {
+	args := m.Called(orgID, eventID)
 	return args.Get(0).(models.Event), args.Error(1)
 }
 
@@ -28,13 +29,59 @@ func (m *MockEventRepo) DeleteEvent(eventID string) error {
 	return args.Error(0)
 }
 
-func (m *MockEventRepo) GetEventsForUser(username string) ([]models.Event, error) {
-	args := m.Called(username)
+func (m *MockEventRepo) GetEventsForUser(orgID uuid.UUID, username string, filter models.EventFilter) ([]models.Event, error) {
+	args := m.Called(orgID, username, filter)
 	return args.Get(0).([]models.Event), args.Error(1)
 }
 
+func (m *MockEventRepo) GetEventPageForUser(orgID uuid.UUID, username string, filter models.EventFilter, page models.EventPage) ([]models.Event, int, error) {
+	args := m.Called(orgID, username, filter, page)
+	return args.Get(0).([]models.Event), args.Int(1), args.Error(2)
+}
+
+func (m *MockEventRepo) GetConflictingEvents(attendees []uuid.UUID, slots []models.TimeSlotStartAndEnd, excludeEventID uuid.UUID) ([]models.EventConflict, error) {
+	args := m.Called(attendees, slots, excludeEventID)
+	return args.Get(0).([]models.EventConflict), args.Error(1)
+}
+
+func (m *MockEventRepo) UpdateEvent(event models.Event, reschedule *models.EventReschedule) error {
+	args := m.Called(event, reschedule)
+	return args.Error(0)
+}
+
+func (m *MockEventRepo) GetRescheduleHistory(eventID string) ([]models.EventReschedule, error) {
+	args := m.Called(eventID)
+	return args.Get(0).([]models.EventReschedule), args.Error(1)
+}
+
+func (m *MockEventRepo) UpdateParticipantResponse(participant models.EventParticipant) error {
+	args := m.Called(participant)
+	return args.Error(0)
+}
+
+func (m *MockEventRepo) SplitEvent(original models.Event, following *models.Event) error {
+	args := m.Called(original, following)
+	return args.Error(0)
+}
+
+func (m *MockEventRepo) CancelEvent(eventID string, cancellation models.EventCancellation) error {
+	args := m.Called(eventID, cancellation)
+	return args.Error(0)
+}
+
+func (m *MockEventRepo) RestoreEvent(event models.Event) error {
+	args := m.Called(event)
+	return args.Error(0)
+}
+
+func (m *MockEventRepo) PurgeCancelledEvents(cancelledBefore time.Time) (int64, error) {
+	args := m.Called(cancelledBefore)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 func TestEventRepo(t *testing.T) {
 	mockRepo := new(MockEventRepo)
+	orgID, _ := uuid.NewV4()
 	eventID, _ := uuid.NewV4()
 	event := models.Event{ID: eventID, Title: "Test Event"}
 
@@ -47,9 +94,9 @@ func TestEventRepo(t *testing.T) {
 	})
 
 	t.Run("GetEvent", func(t *testing.T) {
-		mockRepo.On("GetEvent", "1").Return(event, nil)
+		mockRepo.On("GetEvent", orgID, "1").Return(event, nil)
 
-		result, err := mockRepo.GetEvent("1")
+		result, err := mockRepo.GetEvent(orgID, "1")
 		assert.NoError(t, err)
 		assert.Equal(t, event, result)
 		mockRepo.AssertExpectations(t)
@@ -65,11 +112,37 @@ func TestEventRepo(t *testing.T) {
 
 	t.Run("GetEventsForUser", func(t *testing.T) {
 		events := []models.Event{event}
-		mockRepo.On("GetEventsForUser", "testuser").Return(events, nil)
+		filter := models.EventFilter{Role: models.EventRoleOwner}
+		mockRepo.On("GetEventsForUser", orgID, "testuser", filter).Return(events, nil)
+
+		result, err := mockRepo.GetEventsForUser(orgID, "testuser", filter)
+		assert.NoError(t, err)
+		assert.Equal(t, events, result)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("GetEventPageForUser", func(t *testing.T) {
+		events := []models.Event{event}
+		page := models.EventPage{Sort: "title", Limit: 10}
+		mockRepo.On("GetEventPageForUser", orgID, "testuser", models.EventFilter{}, page).Return(events, 12, nil)
 
-		result, err := mockRepo.GetEventsForUser("testuser")
+		result, total, err := mockRepo.GetEventPageForUser(orgID, "testuser", models.EventFilter{}, page)
 		assert.NoError(t, err)
 		assert.Equal(t, events, result)
+		assert.Equal(t, 12, total)
 		mockRepo.AssertExpectations(t)
 	})
 }
+
+func TestEventPageOrder(t *testing.T) {
+	order, err := eventPageOrder(models.EventPage{Sort: "start_time"})
+	assert.NoError(t, err)
+	assert.Equal(t, "order by e.event_start_time asc, e.event_start_time, e.id", order)
+
+	order, err = eventPageOrder(models.EventPage{Sort: "title", Descending: true})
+	assert.NoError(t, err)
+	assert.Equal(t, `order by e.title collate "C" desc, e.event_start_time, e.id`, order)
+
+	_, err = eventPageOrder(models.EventPage{Sort: "e.title; drop table events"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"errors"
+	"timeslot-app/models"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+// uniqueViolation is the postgres error code raised when an insert breaks a UNIQUE constraint
+const uniqueViolation = "23505"
+
+var ErrEventTypeExists = errors.New("an event type with this slug already exists")
+
+type EventTypeRepoImplementation struct {
+	db *pgx.ConnPool
+}
+
+func NewEventTypeRepository(dbConn *pgx.ConnPool) EventTypeRepo {
+	return &EventTypeRepoImplementation{
+		db: dbConn,
+	}
+}
+
+type EventTypeRepo interface {
+	CreateEventType(eventType models.EventType) error
+	ListEventTypes(userID uuid.UUID) ([]models.EventType, error)
+	GetEventTypeBySlug(userID uuid.UUID, slug string) (models.EventType, error)
+	DeleteEventType(userID uuid.UUID, slug string) error
+	GetBookingLoads(eventTypeID uuid.UUID) ([]models.BookingLoad, error)
+	BookEvent(event models.Event, assignment models.BookingAssignment) error
+}
+
+const eventTypeColumns = `id, user_id, slug, title, description, location, duration_minutes,
+	buffer_before_minutes, buffer_after_minutes, min_notice_minutes, max_advance_days, scheduling_mode, created_at`
+
+// eventTypeSelect reads the event types with the names of their members in the order they were listed
+const eventTypeSelect = `SELECT ` + eventTypeColumns + `,
+	coalesce((SELECT array_agg(u.name ORDER BY array_position(et.member_ids, u.id)) FROM users u WHERE u.id = any(et.member_ids)), '{}'),
+	member_ids::text[]
+	FROM event_types et`
+
+// CreateEventType stores a new event type, ErrEventTypeExists is returned when the user already has one with its slug
+func (etr *EventTypeRepoImplementation) CreateEventType(eventType models.EventType) error {
+	memberIDs := make([]string, 0, len(eventType.MemberIDs))
+	for _, id := range eventType.MemberIDs {
+		memberIDs = append(memberIDs, id.String())
+	}
+
+	insertQuery := `INSERT INTO event_types (` + eventTypeColumns + `, member_ids)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14::uuid[])`
+	_, err := etr.db.Exec(insertQuery, eventType.ID, eventType.UserID, eventType.Slug, eventType.Title,
+		eventType.Description, eventType.Location, eventType.DurationMinutes, eventType.BufferBeforeMinutes,
+		eventType.BufferAfterMinutes, eventType.MinNoticeMinutes, eventType.MaxAdvanceDays, eventType.SchedulingMode,
+		eventType.CreatedAt, memberIDs)
+	if err != nil {
+		var pgErr pgx.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrEventTypeExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (etr *EventTypeRepoImplementation) ListEventTypes(userID uuid.UUID) ([]models.EventType, error) {
+	rows, err := etr.db.Query(eventTypeSelect+` WHERE user_id = $1 ORDER BY created_at, slug`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	eventTypes := []models.EventType{}
+	for rows.Next() {
+		eventType, err := scanEventType(rows)
+		if err != nil {
+			return nil, err
+		}
+		eventTypes = append(eventTypes, eventType)
+	}
+	return eventTypes, rows.Err()
+}
+
+// GetEventTypeBySlug returns pgx.ErrNoRows when the user has no event type with the slug
+func (etr *EventTypeRepoImplementation) GetEventTypeBySlug(userID uuid.UUID, slug string) (models.EventType, error) {
+	row := etr.db.QueryRow(eventTypeSelect+` WHERE user_id = $1 AND slug = $2`, userID, slug)
+	return scanEventType(row)
+}
+
+// DeleteEventType returns pgx.ErrNoRows when the user has no event type with the slug,
+// events already booked through it are kept
+func (etr *EventTypeRepoImplementation) DeleteEventType(userID uuid.UUID, slug string) error {
+	tag, err := etr.db.Exec(`DELETE FROM event_types WHERE user_id = $1 AND slug = $2`, userID, slug)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// GetBookingLoads returns how many bookings of the event type each member was assigned, bookings whose event
+// was cancelled don't count while ones whose event was purged since still do
+func (etr *EventTypeRepoImplementation) GetBookingLoads(eventTypeID uuid.UUID) ([]models.BookingLoad, error) {
+	qry := `SELECT a.user_id, count(*), max(a.assigned_at)
+		FROM booking_assignments a
+		LEFT JOIN events e ON e.id = a.event_id
+		WHERE a.event_type_id = $1 AND e.status IS DISTINCT FROM $2
+		GROUP BY a.user_id`
+	rows, err := etr.db.Query(qry, eventTypeID, models.EventStatusCancelled)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loads := []models.BookingLoad{}
+	for rows.Next() {
+		var load models.BookingLoad
+		err := rows.Scan(&load.UserID, &load.Bookings, &load.LastAssignedAt)
+		if err != nil {
+			return nil, err
+		}
+		loads = append(loads, load)
+	}
+	return loads, rows.Err()
+}
+
+// BookEvent creates a round robin booking together with the assignment it counts towards
+func (etr *EventTypeRepoImplementation) BookEvent(event models.Event, assignment models.BookingAssignment) error {
+	tx, err := etr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = createEvent(tx, event)
+	if err != nil {
+		return err
+	}
+
+	insertQuery := `INSERT INTO booking_assignments (event_id, event_type_id, user_id, assigned_at) VALUES ($1, $2, $3, $4)`
+	_, err = tx.Exec(insertQuery, assignment.EventID, assignment.EventTypeID, assignment.UserID, assignment.AssignedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func scanEventType(row eventScanner) (models.EventType, error) {
+	var et models.EventType
+	var memberIDs []string
+	err := row.Scan(&et.ID, &et.UserID, &et.Slug, &et.Title, &et.Description, &et.Location, &et.DurationMinutes,
+		&et.BufferBeforeMinutes, &et.BufferAfterMinutes, &et.MinNoticeMinutes, &et.MaxAdvanceDays, &et.SchedulingMode,
+		&et.CreatedAt, &et.Members, &memberIDs)
+	if err != nil {
+		return et, err
+	}
+	for _, memberID := range memberIDs {
+		id, err := uuid.FromString(memberID)
+		if err != nil {
+			return et, err
+		}
+		et.MemberIDs = append(et.MemberIDs, id)
+	}
+	return et, nil
+}
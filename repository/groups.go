@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"errors"
+	"timeslot-app/models"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+var ErrGroupExists = errors.New("a group with this name already exists")
+
+type GroupRepoImplementation struct {
+	db *pgx.ConnPool
+}
+
+func NewGroupRepository(dbConn *pgx.ConnPool) GroupRepo {
+	return &GroupRepoImplementation{
+		db: dbConn,
+	}
+}
+
+type GroupRepo interface {
+	CreateGroup(group models.Group, userIDs, groupIDs []uuid.UUID) error
+	ListGroups(orgID uuid.UUID) ([]models.Group, error)
+	GetGroup(orgID uuid.UUID, name string) (models.Group, error)
+	SetGroupMembers(groupID uuid.UUID, userIDs, groupIDs []uuid.UUID) error
+	DeleteGroup(groupID uuid.UUID) error
+}
+
+// groupQuery selects groups with their members, users by name and nested groups by their name prefixed with @
+const groupQuery = `SELECT g.id, g.org_id, g.name, g.created_by, g.created_at,
+		coalesce(array_agg(coalesce(u.name, '` + models.GroupPrefix + `' || mg.name) ORDER BY mg.name NULLS FIRST, u.name)
+			FILTER (WHERE m.group_id IS NOT NULL), '{}')
+	FROM groups g
+	LEFT JOIN group_members m ON m.group_id = g.id
+	LEFT JOIN users u ON u.id = m.user_id
+	LEFT JOIN groups mg ON mg.id = m.member_group_id`
+
+// CreateGroup stores a new group with its members, ErrGroupExists is returned when the organization already has
+// a group with its name
+func (gr *GroupRepoImplementation) CreateGroup(group models.Group, userIDs, groupIDs []uuid.UUID) error {
+	tx, err := gr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO groups (id, org_id, name, created_by, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		group.ID, group.OrgID, group.Name, group.CreatedBy, group.CreatedAt)
+	if err != nil {
+		var pgErr pgx.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrGroupExists
+		}
+		return err
+	}
+
+	err = insertGroupMembers(tx, group.ID, userIDs, groupIDs)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListGroups returns every group of the organization ordered by name
+func (gr *GroupRepoImplementation) ListGroups(orgID uuid.UUID) ([]models.Group, error) {
+	rows, err := gr.db.Query(groupQuery+` WHERE g.org_id = $1 GROUP BY g.id ORDER BY g.name`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []models.Group{}
+	for rows.Next() {
+		var group models.Group
+		err := rows.Scan(&group.ID, &group.OrgID, &group.Name, &group.CreatedBy, &group.CreatedAt, &group.Members)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+// GetGroup returns the group of the organization with the name, pgx.ErrNoRows when there is none
+func (gr *GroupRepoImplementation) GetGroup(orgID uuid.UUID, name string) (models.Group, error) {
+	var group models.Group
+	err := gr.db.QueryRow(groupQuery+` WHERE g.org_id = $1 AND g.name = $2 GROUP BY g.id`, orgID, name).
+		Scan(&group.ID, &group.OrgID, &group.Name, &group.CreatedBy, &group.CreatedAt, &group.Members)
+	return group, err
+}
+
+// SetGroupMembers replaces the members of a group
+func (gr *GroupRepoImplementation) SetGroupMembers(groupID uuid.UUID, userIDs, groupIDs []uuid.UUID) error {
+	tx, err := gr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM group_members WHERE group_id = $1`, groupID)
+	if err != nil {
+		return err
+	}
+	err = insertGroupMembers(tx, groupID, userIDs, groupIDs)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteGroup deletes a group, it is taken out of the groups it was nested in. Events keep the participants
+// it was expanded to.
+func (gr *GroupRepoImplementation) DeleteGroup(groupID uuid.UUID) error {
+	_, err := gr.db.Exec(`DELETE FROM groups WHERE id = $1`, groupID)
+	return err
+}
+
+func insertGroupMembers(tx *pgx.Tx, groupID uuid.UUID, userIDs, groupIDs []uuid.UUID) error {
+	for _, userID := range userIDs {
+		_, err := tx.Exec(`INSERT INTO group_members (group_id, user_id) VALUES ($1, $2)`, groupID, userID)
+		if err != nil {
+			return err
+		}
+	}
+	for _, memberGroupID := range groupIDs {
+		_, err := tx.Exec(`INSERT INTO group_members (group_id, member_group_id) VALUES ($1, $2)`, groupID, memberGroupID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"time"
+	"timeslot-app/models"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+type CalendarImportRepoImplementation struct {
+	db *pgx.ConnPool
+}
+
+func NewCalendarImportRepository(dbConn *pgx.ConnPool) CalendarImportRepo {
+	return &CalendarImportRepoImplementation{
+		db: dbConn,
+	}
+}
+
+type CalendarImportRepo interface {
+	GetImportFingerprints(userID uuid.UUID) (map[string]string, error)
+	ApplyCalendarImport(userID uuid.UUID, items []models.CalendarImportItem) error
+}
+
+// GetImportFingerprints returns the fingerprint of every UID imported for the user so far
+func (ir *CalendarImportRepoImplementation) GetImportFingerprints(userID uuid.UUID) (map[string]string, error) {
+	rows, err := ir.db.Query(`SELECT uid, fingerprint FROM calendar_imports WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fingerprints := map[string]string{}
+	for rows.Next() {
+		var uid, fingerprint string
+		err := rows.Scan(&uid, &fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		fingerprints[uid] = fingerprint
+	}
+	return fingerprints, rows.Err()
+}
+
+// ApplyCalendarImport writes the items to be created or updated in a single transaction. What an updated item was
+// imported as before is removed first, then its time slots are published and its blocking events booked.
+func (ir *CalendarImportRepoImplementation) ApplyCalendarImport(userID uuid.UUID, items []models.CalendarImportItem) error {
+
+	tx, err := ir.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, item := range items {
+		if item.Action != models.CalendarImportCreate && item.Action != models.CalendarImportUpdate {
+			continue
+		}
+
+		err = removeImported(tx, userID, item.UID)
+		if err != nil {
+			return err
+		}
+
+		timeSlotIDs := make([]string, 0, len(item.TimeSlots))
+		for _, timeSlot := range item.TimeSlots {
+			id, err := uuid.NewV4()
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(`INSERT INTO time_slots (id, user_id, org_id, time_slot) SELECT $1, id, org_id, $3 FROM users WHERE id = $2`,
+				id, userID, timeSlot)
+			if err != nil {
+				return err
+			}
+			timeSlotIDs = append(timeSlotIDs, id.String())
+		}
+
+		eventIDs := make([]string, 0, len(item.Events))
+		for _, event := range item.Events {
+			err = createEvent(tx, event)
+			if err != nil {
+				return err
+			}
+			eventIDs = append(eventIDs, event.ID.String())
+		}
+
+		upsertQuery := `INSERT INTO calendar_imports (user_id, uid, fingerprint, event_ids, time_slot_ids, imported_at)
+			VALUES ($1, $2, $3, $4::uuid[], $5::uuid[], $6)
+			ON CONFLICT (user_id, uid) DO UPDATE SET fingerprint = excluded.fingerprint, event_ids = excluded.event_ids,
+				time_slot_ids = excluded.time_slot_ids, imported_at = excluded.imported_at`
+		_, err = tx.Exec(upsertQuery, userID, item.UID, item.Fingerprint, eventIDs, timeSlotIDs, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// removeImported deletes the events and time slots a UID was imported as, events give their availability back
+// first. Time slots split or merged since the import no longer carry their ID and are left alone.
+func removeImported(tx *pgx.Tx, userID uuid.UUID, uid string) error {
+	var eventIDs, timeSlotIDs []string
+	qry := `SELECT event_ids::text[], time_slot_ids::text[] FROM calendar_imports WHERE user_id = $1 AND uid = $2 FOR UPDATE`
+	err := tx.QueryRow(qry, userID, uid).Scan(&eventIDs, &timeSlotIDs)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, eventID := range eventIDs {
+		id, err := uuid.FromString(eventID)
+		if err != nil {
+			return err
+		}
+		err = releaseAvailability(tx, id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM events WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM time_slots WHERE user_id = $1 AND id = any($2::uuid[])`, userID, timeSlotIDs)
+	return err
+}
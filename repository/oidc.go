@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"time"
+	"timeslot-app/models"
+
+	"github.com/jackc/pgx"
+)
+
+type OIDCLoginRepoImplementation struct {
+	db *pgx.ConnPool
+}
+
+func NewOIDCLoginRepository(dbConn *pgx.ConnPool) OIDCLoginRepo {
+	return &OIDCLoginRepoImplementation{
+		db: dbConn,
+	}
+}
+
+type OIDCLoginRepo interface {
+	SaveLogin(login models.OIDCLogin) error
+	TakeLogin(state string, now time.Time) (models.OIDCLogin, error)
+}
+
+// SaveLogin stores a login that was started, logins that were abandoned are cleared out on the way
+func (lr *OIDCLoginRepoImplementation) SaveLogin(login models.OIDCLogin) error {
+	_, err := lr.db.Exec(`DELETE FROM oidc_logins WHERE expires_at <= now()`)
+	if err != nil {
+		return err
+	}
+	insertQuery := `INSERT INTO oidc_logins (state, nonce, code_verifier, expires_at, org_id) VALUES ($1, $2, $3, $4, $5)`
+	_, err = lr.db.Exec(insertQuery, login.State, login.Nonce, login.CodeVerifier, login.ExpiresAt, login.OrgID)
+	return err
+}
+
+// TakeLogin removes the login with the state and returns it so it can't be completed twice,
+// pgx.ErrNoRows is returned when there is no such login or it has expired
+func (lr *OIDCLoginRepoImplementation) TakeLogin(state string, now time.Time) (models.OIDCLogin, error) {
+	var login models.OIDCLogin
+	err := lr.db.QueryRow(`DELETE FROM oidc_logins WHERE state = $1 AND expires_at > $2
+		RETURNING org_id, state, nonce, code_verifier, expires_at`, state, now).
+		Scan(&login.OrgID, &login.State, &login.Nonce, &login.CodeVerifier, &login.ExpiresAt)
+	return login, err
+}
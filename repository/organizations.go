@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"errors"
+	"timeslot-app/models"
+
+	"github.com/jackc/pgx"
+)
+
+var ErrOrganizationExists = errors.New("an organization with this slug already exists")
+
+// ErrOtherOrganization is returned when a write would link users, time slots or events of different organizations
+var ErrOtherOrganization = errors.New("user belongs to another organization")
+
+type OrganizationRepoImplementation struct {
+	db *pgx.ConnPool
+}
+
+func NewOrganizationRepository(dbConn *pgx.ConnPool) OrganizationRepo {
+	return &OrganizationRepoImplementation{
+		db: dbConn,
+	}
+}
+
+type OrganizationRepo interface {
+	CreateOrganization(org models.Organization, admin models.User) error
+	GetOrganizationBySlug(slug string) (models.Organization, error)
+}
+
+// CreateOrganization stores a new organization together with its first user, ErrOrganizationExists is returned
+// when the slug is taken
+func (orgr *OrganizationRepoImplementation) CreateOrganization(org models.Organization, admin models.User) error {
+	tx, err := orgr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO organizations (id, slug, name, created_at) VALUES ($1, $2, $3, $4)`,
+		org.ID, org.Slug, org.Name, org.CreatedAt)
+	if err != nil {
+		var pgErr pgx.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrOrganizationExists
+		}
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO users (id, org_id, name, role) VALUES ($1, $2, $3, $4)`, admin.ID, org.ID, admin.Name, admin.Role)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetOrganizationBySlug returns the organization with the slug, pgx.ErrNoRows when there is none
+func (orgr *OrganizationRepoImplementation) GetOrganizationBySlug(slug string) (models.Organization, error) {
+	var org models.Organization
+	err := orgr.db.QueryRow(`SELECT id, slug, name, created_at FROM organizations WHERE slug = $1`, slug).
+		Scan(&org.ID, &org.Slug, &org.Name, &org.CreatedAt)
+	return org, err
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"strings"
+	"timeslot-app/models"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+type ProfileRepoImplementation struct {
+	db *pgx.ConnPool
+}
+
+func NewProfileRepository(dbConn *pgx.ConnPool) ProfileRepo {
+	return &ProfileRepoImplementation{
+		db: dbConn,
+	}
+}
+
+type ProfileRepo interface {
+	GetProfile(userID uuid.UUID) (models.UserProfile, error)
+	GetProfilesByNames(orgID uuid.UUID, userNames []string) (map[string]models.UserProfile, error)
+	SetProfile(userID uuid.UUID, profile models.UserProfile) error
+}
+
+const profileColumns = `p.time_zone, p.locale, p.work_days, p.work_start, p.work_end, p.buffer_before_minutes,
+	p.buffer_after_minutes, p.preferred_times, p.reminders`
+
+// GetProfile returns the profile of a user, the default profile when the user hasn't set one
+func (pr *ProfileRepoImplementation) GetProfile(userID uuid.UUID) (models.UserProfile, error) {
+	profile, err := scanProfile(pr.db.QueryRow(`SELECT `+profileColumns+` FROM user_profiles p WHERE p.user_id = $1`, userID))
+	if err == pgx.ErrNoRows {
+		return models.DefaultUserProfile(), nil
+	}
+	return profile, err
+}
+
+// GetProfilesByNames returns the profiles of the named users of the organization by name, users without a
+// profile get the default one and names of users that don't exist are left out
+func (pr *ProfileRepoImplementation) GetProfilesByNames(orgID uuid.UUID, userNames []string) (map[string]models.UserProfile, error) {
+	qry := `SELECT u.name, p.user_id IS NOT NULL, coalesce(p.time_zone, ''), coalesce(p.locale, ''),
+			coalesce(p.work_days, '{}'), coalesce(p.work_start, ''), coalesce(p.work_end, ''),
+			coalesce(p.buffer_before_minutes, 0), coalesce(p.buffer_after_minutes, 0),
+			coalesce(p.preferred_times, '{}'), coalesce(p.reminders, true)
+		FROM users u LEFT JOIN user_profiles p ON p.user_id = u.id
+		WHERE u.org_id = $1 AND u.name = any($2)`
+	rows, err := pr.db.Query(qry, orgID, userNames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := make(map[string]models.UserProfile)
+	for rows.Next() {
+		var name string
+		var found bool
+		var profile models.UserProfile
+		var preferred []string
+		err := rows.Scan(&name, &found, &profile.TimeZone, &profile.Locale, &profile.WorkingHours.Days,
+			&profile.WorkingHours.Start, &profile.WorkingHours.End, &profile.BufferBeforeMinutes,
+			&profile.BufferAfterMinutes, &preferred, &profile.Notifications.Reminders)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			profile = models.DefaultUserProfile()
+		} else {
+			profile.PreferredTimes = dayWindows(preferred)
+		}
+		profiles[name] = profile
+	}
+	return profiles, rows.Err()
+}
+
+// SetProfile stores the profile of a user. Turning reminders off drops the user's pending reminders, turning
+// them on schedules the reminders of the user's upcoming events again.
+func (pr *ProfileRepoImplementation) SetProfile(userID uuid.UUID, profile models.UserProfile) error {
+	preferred := make([]string, 0, len(profile.PreferredTimes))
+	for _, window := range profile.PreferredTimes {
+		preferred = append(preferred, window.Start+"-"+window.End)
+	}
+	days := profile.WorkingHours.Days
+	if days == nil {
+		days = []string{}
+	}
+
+	tx, err := pr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	upsertQuery := `INSERT INTO user_profiles (user_id, time_zone, locale, work_days, work_start, work_end,
+			buffer_before_minutes, buffer_after_minutes, preferred_times, reminders)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (user_id) DO UPDATE SET time_zone = excluded.time_zone, locale = excluded.locale,
+			work_days = excluded.work_days, work_start = excluded.work_start, work_end = excluded.work_end,
+			buffer_before_minutes = excluded.buffer_before_minutes, buffer_after_minutes = excluded.buffer_after_minutes,
+			preferred_times = excluded.preferred_times, reminders = excluded.reminders`
+	_, err = tx.Exec(upsertQuery, userID, profile.TimeZone, profile.Locale, days, profile.WorkingHours.Start,
+		profile.WorkingHours.End, profile.BufferBeforeMinutes, profile.BufferAfterMinutes, preferred,
+		profile.Notifications.Reminders)
+	if err != nil {
+		return err
+	}
+
+	if profile.Notifications.Reminders {
+		err = scheduleReminders(tx, `b.user_id = $1`, userID)
+	} else {
+		_, err = tx.Exec(`DELETE FROM event_reminders WHERE user_id = $1 AND status = $2`, userID, models.ReminderStatusPending)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func scanProfile(row *pgx.Row) (models.UserProfile, error) {
+	var profile models.UserProfile
+	var preferred []string
+	err := row.Scan(&profile.TimeZone, &profile.Locale, &profile.WorkingHours.Days, &profile.WorkingHours.Start,
+		&profile.WorkingHours.End, &profile.BufferBeforeMinutes, &profile.BufferAfterMinutes, &preferred,
+		&profile.Notifications.Reminders)
+	profile.PreferredTimes = dayWindows(preferred)
+	return profile, err
+}
+
+// dayWindows converts the stored "15:04-15:04" windows back to day windows
+func dayWindows(stored []string) []models.DayWindow {
+	windows := make([]models.DayWindow, 0, len(stored))
+	for _, window := range stored {
+		start, end, _ := strings.Cut(window, "-")
+		windows = append(windows, models.DayWindow{Start: start, End: end})
+	}
+	return windows
+}
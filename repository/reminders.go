@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/utils"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+type ReminderRepoImplementation struct {
+	db *pgx.ConnPool
+}
+
+func NewReminderRepository(dbConn *pgx.ConnPool) ReminderRepo {
+	return &ReminderRepoImplementation{
+		db: dbConn,
+	}
+}
+
+type ReminderRepo interface {
+	GetUserReminderOffsets(userID uuid.UUID) ([]string, error)
+	SetUserReminderOffsets(userID uuid.UUID, offsets []string) error
+	ClaimDueReminders(now time.Time, lease time.Duration, limit int) ([]models.Reminder, error)
+	MarkReminderSent(reminderID uuid.UUID, sentAt time.Time) error
+	MarkReminderFailed(reminderID uuid.UUID, lastError string, retryAt *time.Time) error
+	MarkReminderExpired(reminderID uuid.UUID) error
+}
+
+// GetUserReminderOffsets returns the default reminder offsets of a user, none when the user hasn't set any
+func (rr *ReminderRepoImplementation) GetUserReminderOffsets(userID uuid.UUID) ([]string, error) {
+	var seconds []int64
+	err := rr.db.QueryRow(`SELECT offsets FROM user_reminder_settings WHERE user_id = $1`, userID).Scan(&seconds)
+	if err == pgx.ErrNoRows {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := reminderOffsets(seconds)
+	if offsets == nil {
+		offsets = []string{}
+	}
+	return offsets, nil
+}
+
+// SetUserReminderOffsets stores the default reminder offsets of a user and reschedules the user's pending
+// reminders of events that don't set their own offsets
+func (rr *ReminderRepoImplementation) SetUserReminderOffsets(userID uuid.UUID, offsets []string) error {
+	seconds, err := reminderSeconds(offsets)
+	if err != nil {
+		return err
+	}
+	if seconds == nil {
+		seconds = []int64{}
+	}
+
+	tx, err := rr.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	upsertQuery := `INSERT INTO user_reminder_settings (user_id, offsets) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET offsets = excluded.offsets`
+	_, err = tx.Exec(upsertQuery, userID, seconds)
+	if err != nil {
+		return err
+	}
+
+	deleteQuery := `DELETE FROM event_reminders r USING events e
+		WHERE e.id = r.event_id AND r.user_id = $1 AND r.status = $2 AND e.reminder_offsets IS NULL`
+	_, err = tx.Exec(deleteQuery, userID, models.ReminderStatusPending)
+	if err != nil {
+		return err
+	}
+
+	err = scheduleReminders(tx, `b.user_id = $1 AND e.reminder_offsets IS NULL`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// scheduleReminders creates the pending reminders for the bookings matching the condition, which is given the
+// arg as $1. Events use their own offsets and fall back to each attendee's defaults. Reminders that would be
+// due already are skipped, as are the ones that exist, so a reminder sent before an update isn't sent again.
+// Attendees who turned reminders off in their profile get none.
+func scheduleReminders(tx *pgx.Tx, condition string, arg interface{}) error {
+	insertQuery := `INSERT INTO event_reminders (id, event_id, user_id, occurrence_start, offset_seconds, remind_at)
+		SELECT md5(b.event_id::text || b.user_id::text || extract(epoch from lower(b.during))::text || o.seconds::text)::uuid,
+			b.event_id, b.user_id, lower(b.during), o.seconds, lower(b.during) - o.seconds * interval '1 second'
+		FROM event_bookings b
+		JOIN events e ON e.id = b.event_id
+		LEFT JOIN user_reminder_settings s ON s.user_id = b.user_id
+		LEFT JOIN user_profiles p ON p.user_id = b.user_id
+		CROSS JOIN LATERAL unnest(coalesce(e.reminder_offsets, s.offsets, '{}')) AS o(seconds)
+		WHERE ` + condition + ` AND e.status = $2 AND coalesce(p.reminders, true)
+			AND lower(b.during) - o.seconds * interval '1 second' > $3
+		ON CONFLICT DO NOTHING`
+	_, err := tx.Exec(insertQuery, arg, models.EventStatusActive, time.Now())
+	return err
+}
+
+// unscheduleReminders drops the reminders of an event that haven't been sent yet
+func unscheduleReminders(tx *pgx.Tx, eventID interface{}) error {
+	_, err := tx.Exec(`DELETE FROM event_reminders WHERE event_id = $1 AND status = $2`, eventID, models.ReminderStatusPending)
+	return err
+}
+
+// ClaimDueReminders marks up to limit reminders that are due as processing and returns them. Reminders claimed
+// longer than the lease ago are claimed again, the sender that had them is assumed gone. Rows locked by another
+// scheduler are skipped so replicas never send the same reminder twice.
+func (rr *ReminderRepoImplementation) ClaimDueReminders(now time.Time, lease time.Duration, limit int) ([]models.Reminder, error) {
+	qry := `WITH due AS (
+			SELECT id FROM event_reminders
+			WHERE (status = $2 AND remind_at <= $1) OR (status = $3 AND claimed_at < $4)
+			ORDER BY remind_at
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE event_reminders r SET status = $3, claimed_at = $1, attempts = r.attempts + 1
+		FROM due, events e, users u LEFT JOIN user_profiles p ON p.user_id = u.id
+		WHERE r.id = due.id AND e.id = r.event_id AND u.id = r.user_id
+		RETURNING r.id, r.event_id, r.user_id, u.name, e.title, e.location, e.conference_url,
+			r.occurrence_start, r.offset_seconds, r.remind_at, r.attempts, coalesce(p.time_zone, 'UTC'),
+			coalesce(p.locale, 'en-US')`
+
+	rows, err := rr.db.Query(qry, now, models.ReminderStatusPending, models.ReminderStatusProcessing, now.Add(-lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []models.Reminder
+	for rows.Next() {
+		var r models.Reminder
+		var seconds int64
+		err := rows.Scan(&r.ID, &r.EventID, &r.UserID, &r.UserName, &r.EventTitle, &r.Location, &r.ConferenceURL,
+			&r.OccurrenceStart, &seconds, &r.RemindAt, &r.Attempts, &r.TimeZone, &r.Locale)
+		if err != nil {
+			return nil, err
+		}
+		r.Offset = utils.FormatReminderOffset(time.Duration(seconds) * time.Second)
+		r.LocalStart = utils.FormatLocalTime(r.OccurrenceStart, r.TimeZone, r.Locale)
+		reminders = append(reminders, r)
+	}
+	return reminders, rows.Err()
+}
+
+func (rr *ReminderRepoImplementation) MarkReminderSent(reminderID uuid.UUID, sentAt time.Time) error {
+	updateQuery := `UPDATE event_reminders SET status = $2, sent_at = $3, last_error = '' WHERE id = $1`
+	_, err := rr.db.Exec(updateQuery, reminderID, models.ReminderStatusSent, sentAt)
+	return err
+}
+
+// MarkReminderFailed records a failed delivery, the reminder is tried again at retryAt or given up on when it is nil
+func (rr *ReminderRepoImplementation) MarkReminderFailed(reminderID uuid.UUID, lastError string, retryAt *time.Time) error {
+	status := models.ReminderStatusFailed
+	if retryAt != nil {
+		status = models.ReminderStatusPending
+	}
+	updateQuery := `UPDATE event_reminders SET status = $2, last_error = $3, claimed_at = NULL, remind_at = coalesce($4, remind_at)
+		WHERE id = $1`
+	_, err := rr.db.Exec(updateQuery, reminderID, status, lastError, retryAt)
+	return err
+}
+
+func (rr *ReminderRepoImplementation) MarkReminderExpired(reminderID uuid.UUID) error {
+	_, err := rr.db.Exec(`UPDATE event_reminders SET status = $2, claimed_at = NULL WHERE id = $1`, reminderID, models.ReminderStatusExpired)
+	return err
+}
+
+// reminderSeconds converts reminder offsets to the seconds stored in the database, nil stays nil
+func reminderSeconds(offsets []string) ([]int64, error) {
+	durations, err := utils.ParseReminderOffsets(offsets)
+	if err != nil || durations == nil {
+		return nil, err
+	}
+	seconds := make([]int64, 0, len(durations))
+	for _, d := range durations {
+		seconds = append(seconds, int64(d/time.Second))
+	}
+	return seconds, nil
+}
+
+// reminderOffsets converts stored seconds back to reminder offsets, nil stays nil
+func reminderOffsets(seconds []int64) []string {
+	if seconds == nil {
+		return nil
+	}
+	offsets := make([]string, 0, len(seconds))
+	for _, s := range seconds {
+		offsets = append(offsets, utils.FormatReminderOffset(time.Duration(s)*time.Second))
+	}
+	return offsets
+}
@@ -4,14 +4,15 @@ import (
 	"fmt"
 	"timeslot-app/models"
 
+	"github.com/gofrs/uuid"
 	"github.com/jackc/pgx"
 )
 
 type TimeslotRepoImplementation struct {
-	db *pgx.Conn
+	db *pgx.ConnPool
 }
 
-func NewTimeslotRepository(dbconn *pgx.Conn) TimeslotRepo {
+func NewTimeslotRepository(dbconn *pgx.ConnPool) TimeslotRepo {
 	return &TimeslotRepoImplementation{
 		db: dbconn,
 	}
@@ -19,14 +20,15 @@ func NewTimeslotRepository(dbconn *pgx.Conn) TimeslotRepo {
 
 type TimeslotRepo interface {
 	Create(timeSlots []models.TimeSlot) error
-	DeleteTimeSlotsByUserName(userName, timeSlot string) error
-	GetTimeSlotsByUserName(userName string) ([]string, error)
+	DeleteTimeSlotsByUserName(orgID uuid.UUID, userName, timeSlot string) error
+	GetTimeSlotsByUserName(orgID uuid.UUID, userName string) ([]string, error)
 }
 
+// Create stores the time slots, each in the organization of its user
 func (ts *TimeslotRepoImplementation) Create(timeSlots []models.TimeSlot) error {
 
 	for _, slot := range timeSlots {
-		insertQuery := `INSERT INTO time_slots (id, user_id, time_slot) VALUES ($1, $2, $3)`
+		insertQuery := `INSERT INTO time_slots (id, user_id, org_id, time_slot) SELECT $1, id, org_id, $3 FROM users WHERE id = $2`
 		_, err := ts.db.Exec(insertQuery, slot.ID, slot.UserID, slot.TimeSlot)
 		if err != nil {
 			return err
@@ -35,12 +37,12 @@ func (ts *TimeslotRepoImplementation) Create(timeSlots []models.TimeSlot) error
 	return nil
 }
 
-func (ts *TimeslotRepoImplementation) GetTimeSlotsByUserName(userName string) ([]string, error) {
+func (ts *TimeslotRepoImplementation) GetTimeSlotsByUserName(orgID uuid.UUID, userName string) ([]string, error) {
 	qry := `select ts.time_slot from users u 
-	join time_slots ts on u.id=ts.user_id
-	where u.name = $1`
+	join time_slots ts on u.id=ts.user_id and ts.org_id=u.org_id
+	where u.org_id = $1 and u.name = $2`
 
-	rows, err := ts.db.Query(qry, userName)
+	rows, err := ts.db.Query(qry, orgID, userName)
 	if err != nil {
 		return []string{}, err
 	}
@@ -60,10 +62,10 @@ func (ts *TimeslotRepoImplementation) GetTimeSlotsByUserName(userName string) ([
 	return timeSlots, nil
 }
 
-func (ts *TimeslotRepoImplementation) DeleteTimeSlotsByUserName(userName, timeSlot string) error {
+func (ts *TimeslotRepoImplementation) DeleteTimeSlotsByUserName(orgID uuid.UUID, userName, timeSlot string) error {
 
-	deleteQuery := `delete from time_slots where user_id in (select id from users where name=$1) and time_slot=$2`
-	_, err := ts.db.Exec(deleteQuery, userName, timeSlot)
+	deleteQuery := `delete from time_slots where org_id=$1 and user_id in (select id from users where org_id=$1 and name=$2) and time_slot=$3`
+	_, err := ts.db.Exec(deleteQuery, orgID, userName, timeSlot)
 	if err != nil {
 		return err
 	}
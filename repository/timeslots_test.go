@@ -18,13 +18,14 @@ func (m *MockTimeslotRepo) Create(timeSlots []models.TimeSlot) error {
 	return args.Error(0)
 }
 
-func (m *MockTimeslotRepo) GetTimeSlotsByUserName(userName string) ([]string, error) {
-	args := m.Called(userName)
+func (m *MockTimeslotRepo) GetTimeSlotsByUserName(orgID uuid.UUID, userName string) ([]string, error) {
+	args := m.Called(orgID, userName)
 	return args.Get(0).([]string), args.Error(1)
 }
 
 func TestTimeslotRepo(t *testing.T) {
 	mockRepo := new(MockTimeslotRepo)
+	orgID, _ := uuid.NewV4()
 	tID, _ := uuid.NewV4()
 	ts := "02 Jan 2025 2-4 PM MST"
 	timeSlot := models.TimeSlot{ID: tID, TimeSlot: ts}
@@ -39,9 +40,9 @@ func TestTimeslotRepo(t *testing.T) {
 
 	t.Run("GetTimeSlotsByUserName", func(t *testing.T) {
 		timeSlots := []string{"10:00 AM"}
-		mockRepo.On("GetTimeSlotsByUserName", "testuser").Return(timeSlots, nil)
+		mockRepo.On("GetTimeSlotsByUserName", orgID, "testuser").Return(timeSlots, nil)
 
-		result, err := mockRepo.GetTimeSlotsByUserName("testuser")
+		result, err := mockRepo.GetTimeSlotsByUserName(orgID, "testuser")
 		assert.NoError(t, err)
 		assert.Equal(t, timeSlots, result)
 		mockRepo.AssertExpectations(t)
@@ -9,11 +9,13 @@ import (
 	"github.com/jackc/pgx"
 )
 
+var ErrUserExists = errors.New("user with the given name already exists")
+
 type UserRepoImplementation struct {
-	db *pgx.Conn
+	db *pgx.ConnPool
 }
 
-func NewUserRepo(dbConn *pgx.Conn) UserRepo {
+func NewUserRepo(dbConn *pgx.ConnPool) UserRepo {
 	return &UserRepoImplementation{
 		db: dbConn,
 	}
@@ -21,24 +23,37 @@ func NewUserRepo(dbConn *pgx.Conn) UserRepo {
 
 type UserRepo interface {
 	Create(user models.User) error
-	UserExists(userName string) (bool, error)
-	Get(userName string) (models.User, error)
+	UserExists(orgID uuid.UUID, userName string) (bool, error)
+	Get(orgID uuid.UUID, userName string) (models.User, error)
+	GetByID(orgID, userID uuid.UUID) (models.User, error)
+	GetUsersByNames(orgID uuid.UUID, userNames []string) ([]models.User, error)
+	List(orgID uuid.UUID, search string, limit, offset int) ([]models.User, int, error)
+	Rename(orgID, userID uuid.UUID, name string) error
+	Delete(userID uuid.UUID, reassignTo uuid.NullUUID) error
+	SetRole(userID uuid.UUID, role string) error
+	PromoteAdmins(orgID uuid.UUID, userNames []string) error
+	GetBySubject(orgID uuid.UUID, subject string) (models.User, error)
 }
 
+// Create adds the user to their organization, ErrUserExists is returned when the organization has a user of the name
 func (ur *UserRepoImplementation) Create(user models.User) error {
 
 	//check if user with the same name already exists
-	exists, err := ur.UserExists(user.Name)
+	exists, err := ur.UserExists(user.OrgID, user.Name)
 	if err != nil && !strings.Contains(err.Error(), "does not exist") {
 		return err
 	}
 
 	if exists {
-		return errors.New("user with the given name already exists")
+		return ErrUserExists
 	}
 
-	insertQuery := `INSERT INTO users (id, name) VALUES ($1, $2)`
-	_, err = ur.db.Exec(insertQuery, user.ID, user.Name)
+	role := user.Role
+	if role == "" {
+		role = models.RoleMember
+	}
+	insertQuery := `INSERT INTO users (id, org_id, name, role, oidc_subject) VALUES ($1, $2, $3, $4, NULLIF($5, ''))`
+	_, err = ur.db.Exec(insertQuery, user.ID, user.OrgID, user.Name, role, user.Subject)
 	if err != nil {
 		return err
 	}
@@ -46,10 +61,10 @@ func (ur *UserRepoImplementation) Create(user models.User) error {
 	return nil
 }
 
-func (ur *UserRepoImplementation) UserExists(userName string) (bool, error) {
+func (ur *UserRepoImplementation) UserExists(orgID uuid.UUID, userName string) (bool, error) {
 
 	var count int
-	err := ur.db.QueryRow("SELECT count(*) FROM users WHERE name = $1", userName).Scan(&count)
+	err := ur.db.QueryRow("SELECT count(*) FROM users WHERE org_id = $1 AND name = $2", orgID, userName).Scan(&count)
 	if err != nil {
 		return false, err
 	}
@@ -59,16 +74,249 @@ func (ur *UserRepoImplementation) UserExists(userName string) (bool, error) {
 	return true, nil
 }
 
-func (ur *UserRepoImplementation) Get(userName string) (models.User, error) {
+// Get returns the user of the organization with the name, pgx.ErrNoRows when the organization has none
+func (ur *UserRepoImplementation) Get(orgID uuid.UUID, userName string) (models.User, error) {
 
-	var name string
-	var id uuid.UUID
-	err := ur.db.QueryRow("SELECT * FROM users WHERE name = $1", userName).Scan(&id, &name)
+	var user models.User
+	err := ur.db.QueryRow("SELECT id, org_id, name, role, coalesce(oidc_subject, '') FROM users WHERE org_id = $1 AND name = $2", orgID, userName).
+		Scan(&user.ID, &user.OrgID, &user.Name, &user.Role, &user.Subject)
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// GetByID returns the user with the ID, pgx.ErrNoRows when there is none or they belong to another organization
+func (ur *UserRepoImplementation) GetByID(orgID, userID uuid.UUID) (models.User, error) {
+
+	var user models.User
+	err := ur.db.QueryRow("SELECT id, org_id, name, role, coalesce(oidc_subject, '') FROM users WHERE org_id = $1 AND id = $2", orgID, userID).
+		Scan(&user.ID, &user.OrgID, &user.Name, &user.Role, &user.Subject)
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// GetUsersByNames returns the users of the organization matching the given names, names without a user are left out
+func (ur *UserRepoImplementation) GetUsersByNames(orgID uuid.UUID, userNames []string) ([]models.User, error) {
+
+	rows, err := ur.db.Query("SELECT id, org_id, name, role FROM users WHERE org_id = $1 AND name = any($2)", orgID, userNames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		err := rows.Scan(&user.ID, &user.OrgID, &user.Name, &user.Role)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// List returns a page of the organization's users whose name contains the search, ordered by name, and how many
+// match in total
+func (ur *UserRepoImplementation) List(orgID uuid.UUID, search string, limit, offset int) ([]models.User, int, error) {
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(search) + "%"
+
+	var total int
+	err := ur.db.QueryRow(`SELECT count(*) FROM users WHERE org_id = $1 AND name ILIKE $2`, orgID, pattern).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := ur.db.Query(`SELECT id, org_id, name, role FROM users WHERE org_id = $1 AND name ILIKE $2 ORDER BY name LIMIT $3 OFFSET $4`,
+		orgID, pattern, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		err := rows.Scan(&user.ID, &user.OrgID, &user.Name, &user.Role)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+// Rename changes a user's name, pgx.ErrNoRows is returned when the organization has no such user and ErrUserExists
+// when the name is taken in it
+func (ur *UserRepoImplementation) Rename(orgID, userID uuid.UUID, name string) error {
+	tag, err := ur.db.Exec(`UPDATE users SET name = $3 WHERE org_id = $1 AND id = $2`, orgID, userID, name)
+	if err != nil {
+		var pgErr pgx.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrUserExists
+		}
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// GetBySubject returns the single sign-on user of the organization with the sub claim, pgx.ErrNoRows when they
+// haven't logged in to it before
+func (ur *UserRepoImplementation) GetBySubject(orgID uuid.UUID, subject string) (models.User, error) {
+	var user models.User
+	err := ur.db.QueryRow("SELECT id, org_id, name, role, oidc_subject FROM users WHERE org_id = $1 AND oidc_subject = $2", orgID, subject).
+		Scan(&user.ID, &user.OrgID, &user.Name, &user.Role, &user.Subject)
 	if err != nil {
 		return models.User{}, err
 	}
-	return models.User{
-		ID:   id,
-		Name: name,
-	}, nil
+	return user, nil
+}
+
+// SetRole changes the role of a user, pgx.ErrNoRows is returned when there is no such user
+func (ur *UserRepoImplementation) SetRole(userID uuid.UUID, role string) error {
+	tag, err := ur.db.Exec(`UPDATE users SET role = $2 WHERE id = $1`, userID, role)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// PromoteAdmins gives the admin role to the named users of the organization, names without a user are left out
+func (ur *UserRepoImplementation) PromoteAdmins(orgID uuid.UUID, userNames []string) error {
+	_, err := ur.db.Exec(`UPDATE users SET role = 'admin' WHERE org_id = $1 AND name = any($2) AND role <> 'admin'`, orgID, userNames)
+	return err
+}
+
+// Delete removes a user with their time slots and settings, and takes them off the events they were invited to.
+// The events they own are handed over to reassignTo when it is given and deleted otherwise, in which case the time
+// they took is given back to the other attendees. Handing them over fails with ErrEventConflict when the new owner
+// is booked at the same time. pgx.ErrNoRows is returned when there is no such user.
+func (ur *UserRepoImplementation) Delete(userID uuid.UUID, reassignTo uuid.NullUUID) error {
+	tx, err := ur.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id uuid.UUID
+	err = tx.QueryRow(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	if reassignTo.Valid {
+		err = reassignOwnedEvents(tx, userID, reassignTo.UUID)
+	} else {
+		err = deleteOwnedEvents(tx, userID)
+	}
+	if err != nil {
+		return err
+	}
+
+	// calendar clients have to notice the attendee list changed
+	_, err = tx.Exec(`UPDATE events SET version = version + 1
+		WHERE id IN (SELECT event_id FROM event_participants WHERE user_id = $1)`, userID)
+	if err != nil {
+		return err
+	}
+
+	cleanupQueries := []string{
+		`DELETE FROM event_participants WHERE user_id = $1`,
+		`DELETE FROM event_bookings WHERE user_id = $1`,
+		`DELETE FROM event_consumed_slots WHERE user_id = $1`,
+		`DELETE FROM time_slots WHERE user_id = $1`,
+		`UPDATE events SET cancelled_by = NULL WHERE cancelled_by = $1`,
+		`UPDATE event_types SET member_ids = array_remove(member_ids, $1) WHERE $1 = any(member_ids)`,
+		`DELETE FROM users WHERE id = $1`,
+	}
+	for _, qry := range cleanupQueries {
+		_, err = tx.Exec(qry, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// deleteOwnedEvents deletes the events the user owns, giving the availability they consumed back to the attendees
+func deleteOwnedEvents(tx *pgx.Tx, userID uuid.UUID) error {
+	rows, err := tx.Query(`SELECT id FROM events WHERE event_owner = $1`, userID)
+	if err != nil {
+		return err
+	}
+	var eventIDs []uuid.UUID
+	for rows.Next() {
+		var eventID uuid.UUID
+		if err := rows.Scan(&eventID); err != nil {
+			rows.Close()
+			return err
+		}
+		eventIDs = append(eventIDs, eventID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, eventID := range eventIDs {
+		err = releaseAvailability(tx, eventID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM events WHERE event_owner = $1`, userID)
+	return err
+}
+
+// reassignOwnedEvents makes newOwner the owner of the user's events, the new owner stops being a participant of
+// them and takes over the user's bookings and reminders. ErrOtherOrganization is returned when the new owner
+// belongs to another organization.
+func reassignOwnedEvents(tx *pgx.Tx, userID, newOwner uuid.UUID) error {
+	var sameOrg bool
+	err := tx.QueryRow(`SELECT n.org_id = u.org_id FROM users n, users u WHERE n.id = $1 AND u.id = $2`, newOwner, userID).Scan(&sameOrg)
+	if err != nil {
+		return err
+	}
+	if !sameOrg {
+		return ErrOtherOrganization
+	}
+
+	_, err = tx.Exec(`DELETE FROM event_participants
+		WHERE user_id = $2 AND event_id IN (SELECT id FROM events WHERE event_owner = $1)`, userID, newOwner)
+	if err != nil {
+		return err
+	}
+
+	bookingQuery := `INSERT INTO event_bookings (event_id, user_id, during, forced)
+		SELECT b.event_id, $2, b.during, b.forced
+		FROM event_bookings b
+		JOIN events e ON e.id = b.event_id
+		WHERE e.event_owner = $1 AND b.user_id = $1
+		ON CONFLICT DO NOTHING`
+	_, err = tx.Exec(bookingQuery, userID, newOwner)
+	if err != nil {
+		var pgErr pgx.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == exclusionViolation {
+			return ErrEventConflict
+		}
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE events SET event_owner = $2, version = version + 1 WHERE event_owner = $1`, userID, newOwner)
+	if err != nil {
+		return err
+	}
+
+	return scheduleReminders(tx, `b.user_id = $1`, newOwner)
 }
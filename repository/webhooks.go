@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"encoding/json"
+	"time"
+	"timeslot-app/models"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+type WebhookRepoImplementation struct {
+	db *pgx.ConnPool
+}
+
+func NewWebhookRepository(dbConn *pgx.ConnPool) WebhookRepo {
+	return &WebhookRepoImplementation{
+		db: dbConn,
+	}
+}
+
+type WebhookRepo interface {
+	CreateWebhook(orgID uuid.UUID, webhook models.Webhook) error
+	ListWebhooks(orgID uuid.UUID) ([]models.Webhook, error)
+	DeleteWebhook(orgID uuid.UUID, webhookID string) error
+	EnqueueWebhookPayload(orgID uuid.UUID, payload models.WebhookPayload) error
+	ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+	MarkDeliveryDelivered(deliveryID uuid.UUID, statusCode int, deliveredAt time.Time) error
+	MarkDeliveryFailed(deliveryID uuid.UUID, statusCode int, lastError string, retryAt *time.Time) error
+	ListDeliveries(orgID uuid.UUID, webhookID string, status string, limit, offset int) ([]models.WebhookDelivery, error)
+	RetryDelivery(orgID uuid.UUID, webhookID, deliveryID string, at time.Time) error
+}
+
+// CreateWebhook subscribes the webhook to the lifecycle events of the organization
+func (wr *WebhookRepoImplementation) CreateWebhook(orgID uuid.UUID, webhook models.Webhook) error {
+	insertQuery := `INSERT INTO webhooks (id, org_id, url, events, secret, created_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := wr.db.Exec(insertQuery, webhook.ID, orgID, webhook.URL, webhook.Events, webhook.Secret, webhook.CreatedAt)
+	return err
+}
+
+// ListWebhooks returns every subscription of the organization without its secret
+func (wr *WebhookRepoImplementation) ListWebhooks(orgID uuid.UUID) ([]models.Webhook, error) {
+	rows, err := wr.db.Query(`SELECT id, url, events::text[], created_at FROM webhooks WHERE org_id = $1 ORDER BY created_at`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var w models.Webhook
+		err := rows.Scan(&w.ID, &w.URL, &w.Events, &w.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook removes a subscription along with its delivery log, pgx.ErrNoRows is returned when the organization
+// has none
+func (wr *WebhookRepoImplementation) DeleteWebhook(orgID uuid.UUID, webhookID string) error {
+	tag, err := wr.db.Exec(`DELETE FROM webhooks WHERE org_id = $1 AND id = $2`, orgID, webhookID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// EnqueueWebhookPayload queues a delivery of the payload to every webhook of the organization subscribed to its type
+func (wr *WebhookRepoImplementation) EnqueueWebhookPayload(orgID uuid.UUID, payload models.WebhookPayload) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	insertQuery := `INSERT INTO webhook_deliveries (id, webhook_id, event_type, payload, next_attempt_at, created_at)
+		SELECT md5($1::text || w.id::text)::uuid, w.id, $2, $3::jsonb, $4, $4
+		FROM webhooks w
+		WHERE w.org_id = $5 AND $2 = any(w.events)
+		ON CONFLICT DO NOTHING`
+	_, err = wr.db.Exec(insertQuery, payload.ID, payload.Type, string(encoded), payload.CreatedAt, orgID)
+	return err
+}
+
+// ClaimDueDeliveries marks up to limit deliveries that are due as delivering and returns them with the URL and
+// secret of their webhook. Deliveries claimed longer than the lease ago are claimed again, like reminders.
+func (wr *WebhookRepoImplementation) ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	qry := `WITH due AS (
+			SELECT id FROM webhook_deliveries
+			WHERE (status = $2 AND next_attempt_at <= $1) OR (status = $3 AND claimed_at < $4)
+			ORDER BY next_attempt_at
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d SET status = $3, claimed_at = $1, attempts = d.attempts + 1
+		FROM due, webhooks w
+		WHERE d.id = due.id AND w.id = d.webhook_id
+		RETURNING d.id, d.webhook_id, d.event_type, d.payload::text, d.status, d.attempts, d.next_attempt_at,
+			d.last_status_code, d.last_error, d.created_at, d.delivered_at, w.url, w.secret`
+
+	rows, err := wr.db.Query(qry, now, models.WebhookDeliveryPending, models.WebhookDeliveryDelivering, now.Add(-lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var payload string
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, err
+		}
+		d.Payload = json.RawMessage(payload)
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (wr *WebhookRepoImplementation) MarkDeliveryDelivered(deliveryID uuid.UUID, statusCode int, deliveredAt time.Time) error {
+	updateQuery := `UPDATE webhook_deliveries SET status = $2, last_status_code = $3, last_error = '', claimed_at = NULL, delivered_at = $4
+		WHERE id = $1`
+	_, err := wr.db.Exec(updateQuery, deliveryID, models.WebhookDeliveryDelivered, statusCode, deliveredAt)
+	return err
+}
+
+// MarkDeliveryFailed records a failed attempt, the delivery is tried again at retryAt or dead-lettered when it is nil
+func (wr *WebhookRepoImplementation) MarkDeliveryFailed(deliveryID uuid.UUID, statusCode int, lastError string, retryAt *time.Time) error {
+	status := models.WebhookDeliveryDead
+	if retryAt != nil {
+		status = models.WebhookDeliveryPending
+	}
+	updateQuery := `UPDATE webhook_deliveries SET status = $2, last_status_code = $3, last_error = $4, claimed_at = NULL,
+		next_attempt_at = coalesce($5, next_attempt_at) WHERE id = $1`
+	_, err := wr.db.Exec(updateQuery, deliveryID, status, statusCode, lastError, retryAt)
+	return err
+}
+
+// ListDeliveries returns a page of a webhook's delivery log, newest first, optionally only the ones with a status
+func (wr *WebhookRepoImplementation) ListDeliveries(orgID uuid.UUID, webhookID string, status string, limit, offset int) ([]models.WebhookDelivery, error) {
+	qry := `SELECT id, webhook_id, event_type, payload::text, status, attempts, next_attempt_at,
+			last_status_code, last_error, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE webhook_id = (SELECT id FROM webhooks WHERE org_id = $5 AND id = $1) AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC, id
+		LIMIT $3 OFFSET $4`
+	rows, err := wr.db.Query(qry, webhookID, status, limit, offset, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var payload string
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		d.Payload = json.RawMessage(payload)
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RetryDelivery puts a dead-lettered delivery back in the queue with a fresh set of attempts,
+// pgx.ErrNoRows is returned when the organization's webhook has no such dead delivery
+func (wr *WebhookRepoImplementation) RetryDelivery(orgID uuid.UUID, webhookID, deliveryID string, at time.Time) error {
+	updateQuery := `UPDATE webhook_deliveries SET status = $3, attempts = 0, next_attempt_at = $4
+		WHERE id = $1 AND webhook_id = (SELECT id FROM webhooks WHERE org_id = $6 AND id = $2) AND status = $5`
+	tag, err := wr.db.Exec(updateQuery, deliveryID, webhookID, models.WebhookDeliveryPending, at, models.WebhookDeliveryDead, orgID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+	"timeslot-app/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+// maxAPIKeyNameLength matches the api_keys.name column
+const maxAPIKeyNameLength = 100
+
+// issueAPIKey creates a key for the user, the returned response is the only place the key itself appears.
+// The key lasts until it is revoked when expiresAt is nil.
+func issueAPIKey(repo repository.APIKeyRepo, userID uuid.UUID, name string, expiresAt *time.Time) (models.APIKeyResponse, error) {
+	key, prefix, err := utils.GenerateAPIKey()
+	if err != nil {
+		return models.APIKeyResponse{}, err
+	}
+	keyID, err := uuid.NewV4()
+	if err != nil {
+		return models.APIKeyResponse{}, err
+	}
+
+	apiKey := models.APIKey{
+		ID:        keyID,
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+	if err := repo.CreateAPIKey(apiKey, utils.HashAPIKey(key)); err != nil {
+		return models.APIKeyResponse{}, err
+	}
+	return models.APIKeyResponse{APIKey: apiKey, Key: key}, nil
+}
+
+// apiKeyUser finds the user named in the path, it answers the request when there is no such user
+func (us *UserService) apiKeyUser(ctx *gin.Context) (models.User, bool) {
+	user, err := us.userRepo.Get(requestOrgID(ctx), ctx.Param("username"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return user, false
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+		return user, false
+	}
+	return user, true
+}
+
+// ShowAccount godoc
+// @Summary      Issue an API key
+// @Description  Issue a new API key for the calling user, the key is only shown in this response
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        username   path   string   true  "Username"
+// @Param        body   body   	models.APIKeyRequest   true "API key request body"
+// @Success      201  {object}  models.APIKeyResponse
+// @Failure      400  {object}  models.ServiceError
+// @Failure      401  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{username}/api-keys [post]
+func (us *UserService) CreateAPIKey(ctx *gin.Context) {
+	user, ok := us.apiKeyUser(ctx)
+	if !ok {
+		return
+	}
+
+	var req models.APIKeyRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxAPIKeyNameLength {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "name must be between 1 and 100 characters"})
+		return
+	}
+
+	key, err := issueAPIKey(us.apiKeyRepo, user.ID, req.Name, nil)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error issuing API key"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, key)
+}
+
+// ShowAccount godoc
+// @Summary      List API keys
+// @Description  List the API keys of the calling user, the keys themselves are never shown again
+// @Tags         Users
+// @Produce      json
+// @Param        username   path   string   true  "Username"
+// @Success      200  {array}  models.APIKey
+// @Failure      401  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{username}/api-keys [get]
+func (us *UserService) ListAPIKeys(ctx *gin.Context) {
+	user, ok := us.apiKeyUser(ctx)
+	if !ok {
+		return
+	}
+
+	keys, err := us.apiKeyRepo.ListAPIKeys(user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching API keys"})
+		return
+	}
+	ctx.JSON(http.StatusOK, keys)
+}
+
+// ShowAccount godoc
+// @Summary      Revoke an API key
+// @Description  Revoke one of the calling user's API keys, requests made with it are refused from then on
+// @Tags         Users
+// @Param        username   path   string   true  "Username"
+// @Param        keyID   path   string   true  "API key ID"
+// @Success      204
+// @Failure      400  {object}  models.ServiceError
+// @Failure      401  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{username}/api-keys/{keyID} [delete]
+func (us *UserService) DeleteAPIKey(ctx *gin.Context) {
+	user, ok := us.apiKeyUser(ctx)
+	if !ok {
+		return
+	}
+	keyID, err := uuid.FromString(ctx.Param("keyID"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	err = us.apiKeyRepo.DeleteAPIKey(user.ID, keyID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "API key does not exist"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking API key"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
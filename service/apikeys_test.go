@@ -0,0 +1,170 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"timeslot-app/middleware"
+	"timeslot-app/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAPIKeyRepo struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyRepo) CreateAPIKey(key models.APIKey, keyHash string) error {
+	args := m.Called(key, keyHash)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepo) ListAPIKeys(userID uuid.UUID) ([]models.APIKey, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]models.APIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyRepo) DeleteAPIKey(userID, keyID uuid.UUID) error {
+	args := m.Called(userID, keyID)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepo) GetAPIKeyByHash(keyHash string) (models.APIKey, models.User, error) {
+	args := m.Called(keyHash)
+	return args.Get(0).(models.APIKey), args.Get(1).(models.User), args.Error(2)
+}
+
+func (m *MockAPIKeyRepo) TouchAPIKey(keyID uuid.UUID, usedAt time.Time) error {
+	args := m.Called(keyID, usedAt)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyRepo) PurgeExpiredAPIKeys(userID uuid.UUID, now time.Time) error {
+	args := m.Called(userID, now)
+	return args.Error(0)
+}
+
+type MockAuditRepo struct {
+	mock.Mock
+}
+
+func (m *MockAuditRepo) RecordAudit(entry models.AuditEntry) error {
+	args := m.Called(entry)
+	return args.Error(0)
+}
+
+func (m *MockAuditRepo) ListAudit(orgID uuid.UUID, limit, offset int) ([]models.AuditEntry, error) {
+	args := m.Called(orgID, limit, offset)
+	return args.Get(0).([]models.AuditEntry), args.Error(1)
+}
+
+// withIdentity stands in for the authentication middleware
+func withIdentity(identity models.Identity) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		middleware.SetIdentity(ctx, identity)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	kevin := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "kevin", Role: models.RoleMember}
+	anna := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "anna", Role: models.RoleMember}
+	caller := models.Identity{UserID: kevin.ID, OrgID: testOrg.ID, UserName: "kevin", Role: models.RoleMember, Method: models.AuthMethodAPIKey}
+
+	mockUserRepo := new(MockUserRepo)
+	mockUserRepo.On("Get", testOrg.ID, "kevin").Return(kevin, nil)
+	mockUserRepo.On("Get", testOrg.ID, "anna").Return(anna, nil)
+	mockAuditRepo := new(MockAuditRepo)
+	mockAuditRepo.On("RecordAudit", mock.Anything).Return(nil)
+	policy := &middleware.Policy{UserRepo: mockUserRepo, AuditRepo: mockAuditRepo}
+	manage := policy.Require(middleware.ActionManageAPIKeys, middleware.UserInPath("api_keys", "username"))
+
+	newRouter := func(repo *MockAPIKeyRepo) *gin.Engine {
+		userService := &UserService{userRepo: mockUserRepo, apiKeyRepo: repo}
+		router := gin.New()
+		router.Use(withOrg(testOrg))
+		router.Use(withIdentity(caller))
+		router.POST("/users/:username/api-keys", manage, userService.CreateAPIKey)
+		router.GET("/users/:username/api-keys", manage, userService.ListAPIKeys)
+		router.DELETE("/users/:username/api-keys/:keyID", manage, userService.DeleteAPIKey)
+		return router
+	}
+
+	t.Run("Issue", func(t *testing.T) {
+		repo := new(MockAPIKeyRepo)
+		repo.On("CreateAPIKey", mock.Anything, mock.Anything).Return(nil)
+
+		recorder := httptest.NewRecorder()
+		newRouter(repo).ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/users/kevin/api-keys", models.APIKeyRequest{Name: "deploy script"}))
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		var response models.APIKeyResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, "deploy script", response.Name)
+		assert.Equal(t, caller.UserID, response.UserID)
+		repo.AssertCalled(t, "CreateAPIKey", mock.Anything, mock.MatchedBy(func(hash string) bool {
+			return hash != response.Key
+		}))
+	})
+
+	t.Run("Missing Name", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		newRouter(new(MockAPIKeyRepo)).ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/users/kevin/api-keys", models.APIKeyRequest{Name: "  "}))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("Someone Else's Keys", func(t *testing.T) {
+		repo := new(MockAPIKeyRepo)
+		router := newRouter(repo)
+
+		for _, req := range []*http.Request{
+			newJSONRequest(http.MethodPost, "/users/anna/api-keys", models.APIKeyRequest{Name: "mine now"}),
+			newJSONRequest(http.MethodGet, "/users/anna/api-keys", nil),
+			newJSONRequest(http.MethodDelete, "/users/anna/api-keys/"+uuid.Must(uuid.NewV4()).String(), nil),
+		} {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusForbidden, recorder.Code)
+		}
+		repo.AssertNotCalled(t, "CreateAPIKey", mock.Anything, mock.Anything)
+		repo.AssertNotCalled(t, "ListAPIKeys", mock.Anything)
+		repo.AssertNotCalled(t, "DeleteAPIKey", mock.Anything, mock.Anything)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		repo := new(MockAPIKeyRepo)
+		keys := []models.APIKey{{ID: uuid.Must(uuid.NewV4()), UserID: caller.UserID, Name: "default", Prefix: "tsk_3f9c1e0b"}}
+		repo.On("ListAPIKeys", caller.UserID).Return(keys, nil)
+
+		recorder := httptest.NewRecorder()
+		newRouter(repo).ServeHTTP(recorder, newJSONRequest(http.MethodGet, "/users/kevin/api-keys", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), `"key"`)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		repo := new(MockAPIKeyRepo)
+		keyID := uuid.Must(uuid.NewV4())
+		missingID := uuid.Must(uuid.NewV4())
+		repo.On("DeleteAPIKey", caller.UserID, keyID).Return(nil)
+		repo.On("DeleteAPIKey", caller.UserID, missingID).Return(pgx.ErrNoRows)
+		router := newRouter(repo)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodDelete, "/users/kevin/api-keys/"+keyID.String(), nil))
+		assert.Equal(t, http.StatusNoContent, recorder.Code)
+
+		recorder = httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodDelete, "/users/kevin/api-keys/"+missingID.String(), nil))
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+		repo.AssertExpectations(t)
+	})
+}
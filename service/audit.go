@@ -0,0 +1,58 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"timeslot-app/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+type AuditService struct {
+	AuditRepo repository.AuditRepo
+}
+
+func NewAuditService(db *pgx.ConnPool) *AuditService {
+	return &AuditService{AuditRepo: repository.NewAuditRepository(db)}
+}
+
+// ShowAccount godoc
+// @Summary      List audit entries
+// @Description  List the requests the access policy refused in the organization, newest first. Only admins may read the audit log.
+// @Tags         Audit
+// @Produce      json
+// @Param        limit   query   int   false  "Page size, 50 by default and 500 at most"
+// @Param        offset   query   int   false  "Number of entries to skip"
+// @Success      200  {array}  models.AuditEntry
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /audit [get]
+func (as *AuditService) ListAudit(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(defaultAuditPageSize)))
+	if err != nil || limit < 1 || limit > maxAuditPageSize {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxAuditPageSize)})
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "offset must be zero or more"})
+		return
+	}
+
+	entries, err := as.AuditRepo.ListAudit(requestOrgID(ctx), limit, offset)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching audit log"})
+		return
+	}
+	ctx.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,681 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+	"timeslot-app/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+const (
+	minEventTypeDuration  = 5
+	maxEventTypeDuration  = 12 * 60
+	maxEventTypeBuffer    = 4 * 60
+	defaultMaxAdvanceDays = 60
+	maxAdvanceDays        = 365
+	maxEventTypeMembers   = 50
+	// maxBookingRange is the longest range of bookable times returned at once
+	maxBookingRange     = 31 * 24 * time.Hour
+	defaultBookingRange = 7 * 24 * time.Hour
+)
+
+var eventTypeSlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// TeamAvailability prepares the time slots of a set of users, the same way slot recommendations do
+type TeamAvailability interface {
+	PrepareParticipantsDataForRecommendation(orgID uuid.UUID, organizer string, participants []string) (models.Participant, []models.Participant, error)
+}
+
+type BookingService struct {
+	EventTypeRepo repository.EventTypeRepo
+	UserRepo      repository.UserRepo
+	EventRepo     repository.EventRepo
+	ProfileRepo   repository.ProfileRepo
+	Availability  TeamAvailability
+	Webhooks      WebhookPublisher
+}
+
+func NewBookingService(db *pgx.ConnPool) *BookingService {
+	return &BookingService{
+		EventTypeRepo: repository.NewEventTypeRepository(db),
+		UserRepo:      repository.NewUserRepo(db),
+		EventRepo:     repository.NewEventRepository(db),
+		ProfileRepo:   repository.NewProfileRepository(db),
+		Availability:  Init(db),
+		Webhooks:      NewWebhookOutbox(db),
+	}
+}
+
+// bookableSlot is a bookable time and the members free to host it
+type bookableSlot struct {
+	models.TimeSlotStartAndEnd
+	Hosts []string
+}
+
+// validateEventTypeRequest checks the request and fills in the defaults
+func validateEventTypeRequest(req *models.EventTypeRequest) error {
+	if !eventTypeSlugPattern.MatchString(req.Slug) {
+		return errors.New("slug must be lowercase letters and digits separated by single dashes")
+	}
+	if strings.TrimSpace(req.Title) == "" {
+		return errors.New("title is required")
+	}
+	if req.DurationMinutes < minEventTypeDuration || req.DurationMinutes > maxEventTypeDuration {
+		return fmt.Errorf("duration_minutes must be between %d and %d", minEventTypeDuration, maxEventTypeDuration)
+	}
+	for _, buffer := range []*int{req.BufferBeforeMinutes, req.BufferAfterMinutes} {
+		if buffer != nil && (*buffer < 0 || *buffer > maxEventTypeBuffer) {
+			return fmt.Errorf("buffers must be between 0 and %d minutes", maxEventTypeBuffer)
+		}
+	}
+	if req.MinNoticeMinutes < 0 {
+		return errors.New("min_notice_minutes can't be negative")
+	}
+	if req.MaxAdvanceDays == 0 {
+		req.MaxAdvanceDays = defaultMaxAdvanceDays
+	}
+	if req.MaxAdvanceDays < 1 || req.MaxAdvanceDays > maxAdvanceDays {
+		return fmt.Errorf("max_advance_days must be between 1 and %d", maxAdvanceDays)
+	}
+
+	switch req.SchedulingMode {
+	case "", models.SchedulingIndividual:
+		req.SchedulingMode = models.SchedulingIndividual
+		if len(req.Members) > 0 {
+			return errors.New("members are only used by round_robin and collective event types")
+		}
+	case models.SchedulingRoundRobin, models.SchedulingCollective:
+		if len(req.Members) < 2 || len(req.Members) > maxEventTypeMembers {
+			return fmt.Errorf("%s event types need between 2 and %d members", req.SchedulingMode, maxEventTypeMembers)
+		}
+		for i, member := range req.Members {
+			if slices.Contains(req.Members[:i], member) {
+				return fmt.Errorf("%s is listed as a member twice", member)
+			}
+		}
+	default:
+		return errors.New("scheduling_mode must be individual, round_robin or collective")
+	}
+	return nil
+}
+
+// ShowAccount godoc
+// @Summary      Create an event type
+// @Description  Create a kind of meeting others can book on the user's public booking page. Round robin event types
+// @Description  assign each booking to the free member with the fewest bookings so far, collective ones need every member free.
+// @Tags         Booking
+// @Accept       json
+// @Produce      json
+// @Param        username   path   string   true  "User Name"
+// @Param        body   body   	models.EventTypeRequest   true "Event type"
+// @Success      201  {object}  models.EventType
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      409  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{username}/event-types [post]
+func (bs *BookingService) CreateEventType(ctx *gin.Context) {
+	var req models.EventTypeRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateEventTypeRequest(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := bs.UserRepo.Get(requestOrgID(ctx), ctx.Param("username"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return
+	}
+
+	memberIDs, ok := bs.resolveMembers(ctx, req.Members)
+	if !ok {
+		return
+	}
+
+	profile, err := profileOf(bs.ProfileRepo, requestOrgID(ctx), user.Name)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching profile"})
+		return
+	}
+	if req.BufferBeforeMinutes == nil {
+		req.BufferBeforeMinutes = &profile.BufferBeforeMinutes
+	}
+	if req.BufferAfterMinutes == nil {
+		req.BufferAfterMinutes = &profile.BufferAfterMinutes
+	}
+
+	eventType := models.EventType{
+		UserID:              user.ID,
+		Slug:                req.Slug,
+		Title:               strings.TrimSpace(req.Title),
+		Description:         req.Description,
+		Location:            req.Location,
+		DurationMinutes:     req.DurationMinutes,
+		BufferBeforeMinutes: *req.BufferBeforeMinutes,
+		BufferAfterMinutes:  *req.BufferAfterMinutes,
+		MinNoticeMinutes:    req.MinNoticeMinutes,
+		MaxAdvanceDays:      req.MaxAdvanceDays,
+		SchedulingMode:      req.SchedulingMode,
+		Members:             req.Members,
+		MemberIDs:           memberIDs,
+		CreatedAt:           time.Now().UTC(),
+	}
+	eventType.ID, _ = uuid.NewV4()
+
+	err = bs.EventTypeRepo.CreateEventType(eventType)
+	if errors.Is(err, repository.ErrEventTypeExists) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating event type"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, eventType)
+}
+
+// ShowAccount godoc
+// @Summary      List event types
+// @Description  List the event types of a user
+// @Tags         Booking
+// @Produce      json
+// @Param        username   path   string   true  "User Name"
+// @Success      200  {array}   models.EventType
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{username}/event-types [get]
+func (bs *BookingService) ListEventTypes(ctx *gin.Context) {
+	user, err := bs.UserRepo.Get(requestOrgID(ctx), ctx.Param("username"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return
+	}
+
+	eventTypes, err := bs.EventTypeRepo.ListEventTypes(user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching event types"})
+		return
+	}
+	ctx.JSON(http.StatusOK, eventTypes)
+}
+
+// ShowAccount godoc
+// @Summary      Delete an event type
+// @Description  Delete an event type, meetings already booked through it are kept
+// @Tags         Booking
+// @Produce      json
+// @Param        username   path   string   true  "User Name"
+// @Param        slug   path   string   true  "Event type slug"
+// @Success      204
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{username}/event-types/{slug} [delete]
+func (bs *BookingService) DeleteEventType(ctx *gin.Context) {
+	user, err := bs.UserRepo.Get(requestOrgID(ctx), ctx.Param("username"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return
+	}
+
+	err = bs.EventTypeRepo.DeleteEventType(user.ID, ctx.Param("slug"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Event type does not exist"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting event type"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// ShowAccount godoc
+// @Summary      Get a booking page
+// @Description  List the event types anyone can book with the user, no authentication is needed
+// @Tags         Booking
+// @Produce      json
+// @Param        username   path   string   true  "User Name"
+// @Success      200  {object}  models.BookingPage
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Router       /booking/{username} [get]
+func (bs *BookingService) GetBookingPage(ctx *gin.Context) {
+	user, err := bs.UserRepo.Get(requestOrgID(ctx), ctx.Param("username"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Booking page does not exist"})
+		return
+	}
+
+	eventTypes, err := bs.EventTypeRepo.ListEventTypes(user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching event types"})
+		return
+	}
+	ctx.JSON(http.StatusOK, models.BookingPage{UserName: user.Name, EventTypes: eventTypes})
+}
+
+// ShowAccount godoc
+// @Summary      List bookable times
+// @Description  List the start times an event type can be booked at, computed from the user's time slots minus
+// @Description  their events and the buffers around them. The range defaults to the coming week and spans at most 31 days.
+// @Tags         Booking
+// @Produce      json
+// @Param        username   path   string   true  "User Name"
+// @Param        slug   path   string   true  "Event type slug"
+// @Param        from   query   string   false  "Start of the range, RFC 3339"
+// @Param        to   query   string   false  "End of the range, RFC 3339"
+// @Param        time_zone   query   string   false  "IANA time zone the times are shown in, UTC by default"
+// @Success      200  {object}  models.BookableTimesResponse
+// @Failure      400  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Router       /booking/{username}/{slug}/times [get]
+func (bs *BookingService) GetBookableTimes(ctx *gin.Context) {
+	loc, err := time.LoadLocation(ctx.DefaultQuery("time_zone", "UTC"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "time_zone must be an IANA time zone such as Europe/Berlin"})
+		return
+	}
+
+	from := time.Now()
+	if ctx.Query("from") != "" {
+		from, err = time.Parse(time.RFC3339, ctx.Query("from"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 time"})
+			return
+		}
+	}
+	to := from.Add(defaultBookingRange)
+	if ctx.Query("to") != "" {
+		to, err = time.Parse(time.RFC3339, ctx.Query("to"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 time"})
+			return
+		}
+	}
+	if !to.After(from) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+		return
+	}
+	if to.Sub(from) > maxBookingRange {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "the range can span at most 31 days"})
+		return
+	}
+
+	user, eventType, ok := bs.findEventType(ctx)
+	if !ok {
+		return
+	}
+
+	slots, err := bs.bookableTimes(user, eventType, from, to)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := models.BookableTimesResponse{EventType: eventType, Times: []models.BookableTime{}}
+	for _, slot := range slots {
+		resp.Times = append(resp.Times, models.BookableTime{Start: slot.StartTime.In(loc), End: slot.EndTime.In(loc)})
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// ShowAccount godoc
+// @Summary      Book a meeting
+// @Description  Book one of the bookable times of an event type, the invitee is added to the event as an external guest.
+// @Description  Round robin bookings go to the free member with the fewest bookings, collective ones invite every member.
+// @Tags         Booking
+// @Accept       json
+// @Produce      json
+// @Param        username   path   string   true  "User Name"
+// @Param        slug   path   string   true  "Event type slug"
+// @Param        body   body   	models.BookingRequest   true "Booking"
+// @Success      201  {object}  models.BookingResponse
+// @Failure      400  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      409  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Router       /booking/{username}/{slug} [post]
+func (bs *BookingService) Book(ctx *gin.Context) {
+	var req models.BookingRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	address, err := mail.ParseAddress(req.Email)
+	if err != nil || address.Name != "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "email must be an email address"})
+		return
+	}
+	if req.Start.IsZero() {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "start is required"})
+		return
+	}
+
+	user, eventType, ok := bs.findEventType(ctx)
+	if !ok {
+		return
+	}
+
+	// the start has to be one of the offered times, checked against the current calendar
+	duration := time.Duration(eventType.DurationMinutes) * time.Minute
+	slots, err := bs.bookableTimes(user, eventType, req.Start, req.Start.Add(duration))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(slots) == 0 || !slots[0].StartTime.Equal(req.Start) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "the requested time can't be booked, pick one of the bookable times"})
+		return
+	}
+
+	hosts, ok := bs.bookingHosts(ctx, eventType, user, slots[0].Hosts)
+	if !ok {
+		return
+	}
+
+	event := models.Event{
+		Title:          fmt.Sprintf("%s with %s", eventType.Title, req.Name),
+		EventOwner:     hosts[0].ID,
+		EventStartTime: slots[0].StartTime.UTC(),
+		EventEndTime:   slots[0].EndTime.UTC(),
+		Status:         models.EventStatusActive,
+		Description:    bookingDescription(eventType, req),
+		Location:       eventType.Location,
+		Visibility:     models.EventVisibilityPublic,
+		Labels:         map[string]string{"source": "booking", "event_type": eventType.Slug},
+	}
+	event.ID, _ = uuid.NewV4()
+	event.Participants = []models.EventParticipant{}
+	for _, host := range hosts[1:] {
+		participantID, _ := uuid.NewV4()
+		event.Participants = append(event.Participants, models.EventParticipant{
+			ID:     participantID,
+			UserID: uuid.NullUUID{UUID: host.ID, Valid: true},
+			Name:   host.Name,
+			Role:   models.ParticipantRoleRequired,
+			Status: models.ParticipantStatusNeedsAction,
+		})
+	}
+	guestID, _ := uuid.NewV4()
+	event.Participants = append(event.Participants, models.EventParticipant{
+		ID:       guestID,
+		Name:     address.Address,
+		Role:     models.ParticipantRoleRequired,
+		Status:   models.ParticipantStatusAccepted,
+		External: true,
+	})
+
+	// round robin bookings count towards the load of the member they were assigned to
+	if eventType.SchedulingMode == models.SchedulingRoundRobin {
+		err = bs.EventTypeRepo.BookEvent(event, models.BookingAssignment{
+			EventID:     event.ID,
+			EventTypeID: eventType.ID,
+			UserID:      hosts[0].ID,
+			AssignedAt:  time.Now().UTC(),
+		})
+	} else {
+		err = bs.EventRepo.CreateEvent(event)
+	}
+	if errors.Is(err, repository.ErrEventConflict) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "the requested time was booked in the meantime, pick another one"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating booking"})
+		return
+	}
+
+	hostNames := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		hostNames = append(hostNames, host.Name)
+	}
+
+	event.Version = 1
+	publishWebhook(bs.Webhooks, requestOrgID(ctx), models.WebhookEventCreated, event)
+	ctx.JSON(http.StatusCreated, models.BookingResponse{Message: "Booking confirmed", Hosts: hostNames, Event: event})
+}
+
+// resolveMembers returns the IDs of the members of a team event type, writing a 400 and returning false when
+// any of them isn't a registered user
+func (bs *BookingService) resolveMembers(ctx *gin.Context, members []string) ([]uuid.UUID, bool) {
+	if len(members) == 0 {
+		return nil, true
+	}
+
+	users, err := bs.UserRepo.GetUsersByNames(requestOrgID(ctx), members)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching members"})
+		return nil, false
+	}
+	idsByName := make(map[string]uuid.UUID, len(users))
+	for _, user := range users {
+		idsByName[user.Name] = user.ID
+	}
+
+	ids := make([]uuid.UUID, 0, len(members))
+	unknown := []string{}
+	for _, member := range members {
+		id, found := idsByName[member]
+		if !found {
+			unknown = append(unknown, member)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(unknown) > 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "unknown members: " + strings.Join(unknown, ", ")})
+		return nil, false
+	}
+	return ids, true
+}
+
+// bookingHosts returns who hosts a booking, the event owner first. Individual event types are hosted by their owner,
+// collective ones by every member and round robin ones by the free member with the fewest bookings so far.
+// An error response is written and false returned when the hosts can't be determined.
+func (bs *BookingService) bookingHosts(ctx *gin.Context, eventType models.EventType, owner models.User, free []string) ([]models.User, bool) {
+	if eventType.SchedulingMode != models.SchedulingRoundRobin && eventType.SchedulingMode != models.SchedulingCollective {
+		return []models.User{owner}, true
+	}
+
+	users, err := bs.UserRepo.GetUsersByNames(requestOrgID(ctx), free)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching members"})
+		return nil, false
+	}
+	usersByName := make(map[string]models.User, len(users))
+	for _, user := range users {
+		usersByName[user.Name] = user
+	}
+	hosts := []models.User{}
+	for _, name := range free {
+		if user, found := usersByName[name]; found {
+			hosts = append(hosts, user)
+		}
+	}
+	if len(hosts) == 0 || (eventType.SchedulingMode == models.SchedulingCollective && len(hosts) != len(free)) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "the requested time can't be booked, pick one of the bookable times"})
+		return nil, false
+	}
+	if eventType.SchedulingMode == models.SchedulingCollective {
+		return hosts, true
+	}
+
+	loads, err := bs.EventTypeRepo.GetBookingLoads(eventType.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching booking history"})
+		return nil, false
+	}
+	return []models.User{leastLoaded(hosts, loads)}, true
+}
+
+// leastLoaded picks the member with the fewest bookings, on a tie the one assigned longest ago and then the one
+// listed first
+func leastLoaded(members []models.User, loads []models.BookingLoad) models.User {
+	loadsByUser := make(map[uuid.UUID]models.BookingLoad, len(loads))
+	for _, load := range loads {
+		loadsByUser[load.UserID] = load
+	}
+
+	best := members[0]
+	for _, member := range members[1:] {
+		load, bestLoad := loadsByUser[member.ID], loadsByUser[best.ID]
+		if load.Bookings < bestLoad.Bookings ||
+			(load.Bookings == bestLoad.Bookings && load.LastAssignedAt.Before(bestLoad.LastAssignedAt)) {
+			best = member
+		}
+	}
+	return best
+}
+
+// findEventType looks up the user and event type named in the path, writing a 404 and returning false when either is missing
+func (bs *BookingService) findEventType(ctx *gin.Context) (models.User, models.EventType, bool) {
+	user, err := bs.UserRepo.Get(requestOrgID(ctx), ctx.Param("username"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Booking page does not exist"})
+		return user, models.EventType{}, false
+	}
+
+	eventType, err := bs.EventTypeRepo.GetEventTypeBySlug(user.ID, ctx.Param("slug"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Event type does not exist"})
+		return user, eventType, false
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching event type"})
+		return user, eventType, false
+	}
+	return user, eventType, true
+}
+
+// bookableTimes returns the meetings of the event type starting in [from, to) that fit into the hosts' time slots,
+// keep the buffers clear of their events and respect the minimum notice and maximum advance window. Round robin
+// times need one free member, collective times all of them.
+func (bs *BookingService) bookableTimes(user models.User, eventType models.EventType, from, to time.Time) ([]bookableSlot, error) {
+	now := time.Now()
+	earliest := now.Add(time.Duration(eventType.MinNoticeMinutes) * time.Minute)
+	if from.After(earliest) {
+		earliest = from
+	}
+	latest := now.AddDate(0, 0, eventType.MaxAdvanceDays)
+	if last := to.Add(-time.Nanosecond); last.Before(latest) {
+		latest = last
+	}
+	if latest.Before(earliest) {
+		return nil, nil
+	}
+
+	hosts := []string{user.Name}
+	if eventType.SchedulingMode == models.SchedulingRoundRobin || eventType.SchedulingMode == models.SchedulingCollective {
+		hosts = eventType.Members
+	}
+	if len(hosts) == 0 {
+		return nil, nil
+	}
+	first, others, err := bs.Availability.PrepareParticipantsDataForRecommendation(user.OrgID, hosts[0], hosts[1:])
+	if err != nil {
+		return nil, errors.New("error fetching user time slots")
+	}
+	participants := append([]models.Participant{first}, others...)
+
+	// events reaching into the range through a buffer count as well
+	bufferBefore := time.Duration(eventType.BufferBeforeMinutes) * time.Minute
+	bufferAfter := time.Duration(eventType.BufferAfterMinutes) * time.Minute
+	duration := time.Duration(eventType.DurationMinutes) * time.Minute
+	busyFrom := earliest.Add(-bufferBefore)
+	busyTo := latest.Add(duration + bufferAfter)
+	busy := make([][]models.TimeSlotStartAndEnd, len(participants))
+	for i, participant := range participants {
+		busy[i], err = bs.busyTimes(user.OrgID, participant.Name, busyFrom, busyTo)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	slots := []bookableSlot{}
+	if eventType.SchedulingMode == models.SchedulingCollective {
+		available := participants[0].TimeSlots
+		allBusy := []models.TimeSlotStartAndEnd{}
+		for i, participant := range participants {
+			if i > 0 {
+				available = utils.IntersectSlots(available, participant.TimeSlots)
+			}
+			allBusy = append(allBusy, busy[i]...)
+		}
+		for _, slot := range utils.BookableTimes(available, allBusy, duration, bufferBefore, bufferAfter, earliest, latest) {
+			slots = append(slots, bookableSlot{TimeSlotStartAndEnd: slot, Hosts: hosts})
+		}
+		return slots, nil
+	}
+
+	// every member offers their own times, a time any of them can host is bookable
+	for i, participant := range participants {
+		for _, slot := range utils.BookableTimes(participant.TimeSlots, busy[i], duration, bufferBefore, bufferAfter, earliest, latest) {
+			j := slices.IndexFunc(slots, func(s bookableSlot) bool { return s.StartTime.Equal(slot.StartTime) })
+			if j < 0 {
+				slots = append(slots, bookableSlot{TimeSlotStartAndEnd: slot})
+				j = len(slots) - 1
+			}
+			slots[j].Hosts = append(slots[j].Hosts, participant.Name)
+		}
+	}
+	slices.SortFunc(slots, func(a, b bookableSlot) int { return a.StartTime.Compare(b.StartTime) })
+	return slots, nil
+}
+
+// busyTimes returns when the user is booked between from and to, occurrences of recurring events included
+func (bs *BookingService) busyTimes(orgID uuid.UUID, userName string, from, to time.Time) ([]models.TimeSlotStartAndEnd, error) {
+	events, err := bs.EventRepo.GetEventsForUser(orgID, userName, models.EventFilter{From: &from, To: &to, Status: models.EventStatusActive})
+	if err != nil {
+		return nil, errors.New("error fetching user events")
+	}
+	events, err = expandEvents(events, from, to)
+	if err != nil {
+		return nil, err
+	}
+	busy := make([]models.TimeSlotStartAndEnd, 0, len(events))
+	for _, event := range events {
+		busy = append(busy, models.TimeSlotStartAndEnd{StartTime: event.EventStartTime, EndTime: event.EventEndTime})
+	}
+	return busy, nil
+}
+
+// bookingDescription tells the owner who booked the meeting and what they wrote
+func bookingDescription(eventType models.EventType, req models.BookingRequest) string {
+	description := fmt.Sprintf("Booked by %s <%s>", req.Name, req.Email)
+	if req.Notes != "" {
+		description += "\n\n" + req.Notes
+	}
+	if eventType.Description != "" {
+		description += "\n\n" + eventType.Description
+	}
+	return description
+}
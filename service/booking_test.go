@@ -0,0 +1,463 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockEventTypeRepo struct {
+	mock.Mock
+}
+
+func (m *MockEventTypeRepo) CreateEventType(eventType models.EventType) error {
+	args := m.Called(eventType)
+	return args.Error(0)
+}
+
+func (m *MockEventTypeRepo) ListEventTypes(userID uuid.UUID) ([]models.EventType, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]models.EventType), args.Error(1)
+}
+
+func (m *MockEventTypeRepo) GetEventTypeBySlug(userID uuid.UUID, slug string) (models.EventType, error) {
+	args := m.Called(userID, slug)
+	return args.Get(0).(models.EventType), args.Error(1)
+}
+
+func (m *MockEventTypeRepo) DeleteEventType(userID uuid.UUID, slug string) error {
+	args := m.Called(userID, slug)
+	return args.Error(0)
+}
+
+func (m *MockEventTypeRepo) GetBookingLoads(eventTypeID uuid.UUID) ([]models.BookingLoad, error) {
+	args := m.Called(eventTypeID)
+	return args.Get(0).([]models.BookingLoad), args.Error(1)
+}
+
+func (m *MockEventTypeRepo) BookEvent(event models.Event, assignment models.BookingAssignment) error {
+	args := m.Called(event, assignment)
+	return args.Error(0)
+}
+
+func newJSONRequest(method, target string, body any) *http.Request {
+	encoded, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, target, bytes.NewBuffer(encoded))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestCreateEventType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID, _ := uuid.NewV4()
+
+	mockUserRepo := new(MockUserRepo)
+	mockEventTypeRepo := new(MockEventTypeRepo)
+	bookingService := &BookingService{UserRepo: mockUserRepo, EventTypeRepo: mockEventTypeRepo}
+
+	router := gin.Default()
+	router.Use(withOrg(testOrg))
+
+	router.POST("/users/:username/event-types", bookingService.CreateEventType)
+
+	mockUserRepo.On("Get", testOrg.ID, "eshan").Return(models.User{ID: userID, OrgID: testOrg.ID, Name: "eshan"}, nil)
+
+	t.Run("Success", func(t *testing.T) {
+		mockEventTypeRepo.On("CreateEventType", mock.MatchedBy(func(et models.EventType) bool {
+			return et.Slug == "intro-30"
+		})).Return(nil).Once()
+
+		bufferAfter := 10
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/users/eshan/event-types", models.EventTypeRequest{
+			Slug: "intro-30", Title: "30-minute intro", DurationMinutes: 30, BufferAfterMinutes: &bufferAfter,
+		}))
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		var eventType models.EventType
+		json.Unmarshal(recorder.Body.Bytes(), &eventType)
+		assert.Equal(t, userID, eventType.UserID)
+		// the advance window defaults to 60 days
+		assert.Equal(t, 60, eventType.MaxAdvanceDays)
+	})
+
+	t.Run("Duplicate slug", func(t *testing.T) {
+		mockEventTypeRepo.On("CreateEventType", mock.MatchedBy(func(et models.EventType) bool {
+			return et.Slug == "interview"
+		})).Return(repository.ErrEventTypeExists).Once()
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/users/eshan/event-types", models.EventTypeRequest{
+			Slug: "interview", Title: "60-minute interview", DurationMinutes: 60,
+		}))
+
+		assert.Equal(t, http.StatusConflict, recorder.Code)
+	})
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		negative := -5
+		for _, req := range []models.EventTypeRequest{
+			{Slug: "Intro 30", Title: "Intro", DurationMinutes: 30},
+			{Slug: "intro", DurationMinutes: 30},
+			{Slug: "intro", Title: "Intro", DurationMinutes: 2},
+			{Slug: "intro", Title: "Intro", DurationMinutes: 30, BufferBeforeMinutes: &negative},
+			{Slug: "intro", Title: "Intro", DurationMinutes: 30, MaxAdvanceDays: 400},
+			{Slug: "intro", Title: "Intro", DurationMinutes: 30, SchedulingMode: models.SchedulingRoundRobin, Members: []string{"kevin"}},
+			{Slug: "intro", Title: "Intro", DurationMinutes: 30, SchedulingMode: "random"},
+		} {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/users/eshan/event-types", req))
+			assert.Equal(t, http.StatusBadRequest, recorder.Code, req)
+		}
+	})
+
+	mockEventTypeRepo.AssertExpectations(t)
+}
+
+func TestBooking(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID, _ := uuid.NewV4()
+
+	// 1-5 PM three days from now, with a meeting at 2 PM
+	day := time.Now().UTC().AddDate(0, 0, 3)
+	timeSlot := day.Format("02 Jan 2006") + " 1-5 PM UTC"
+	at := func(hour, minute int) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, time.UTC)
+	}
+	busy := models.Event{Title: "Standup", EventStartTime: at(14, 0), EventEndTime: at(14, 30)}
+
+	eventType := models.EventType{
+		UserID: userID, Slug: "intro-30", Title: "Intro", Location: "Zoom",
+		DurationMinutes: 30, BufferAfterMinutes: 15, MinNoticeMinutes: 60, MaxAdvanceDays: 60,
+	}
+
+	newBookingService := func() (*BookingService, *MockEventRepo, *MockWebhookPublisher) {
+		mockUserRepo := new(MockUserRepo)
+		mockEventTypeRepo := new(MockEventTypeRepo)
+		mockTimeslotRepo := new(MockTimeslotRepo)
+		mockEventRepo := new(MockEventRepo)
+		mockPublisher := new(MockWebhookPublisher)
+
+		mockUserRepo.On("Get", testOrg.ID, "eshan").Return(models.User{ID: userID, OrgID: testOrg.ID, Name: "eshan"}, nil)
+		mockEventTypeRepo.On("GetEventTypeBySlug", userID, "intro-30").Return(eventType, nil)
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "eshan").Return([]string{timeSlot}, nil)
+		mockEventRepo.On("GetEventsForUser", testOrg.ID, "eshan", mock.MatchedBy(func(filter models.EventFilter) bool {
+			return filter.Status == models.EventStatusActive && filter.From != nil && filter.To != nil
+		})).Return([]models.Event{busy}, nil)
+
+		return &BookingService{
+			UserRepo:      mockUserRepo,
+			EventTypeRepo: mockEventTypeRepo,
+			EventRepo:     mockEventRepo,
+			Availability:  &TimeslotServiceImplementaion{TimeslotRepo: mockTimeslotRepo},
+			Webhooks:      mockPublisher,
+		}, mockEventRepo, mockPublisher
+	}
+
+	t.Run("Bookable times", func(t *testing.T) {
+		bookingService, _, _ := newBookingService()
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+		router.GET("/booking/:username/:slug/times", bookingService.GetBookableTimes)
+
+		from := at(0, 0).Format(time.RFC3339)
+		to := at(23, 0).Format(time.RFC3339)
+		req, _ := http.NewRequest(http.MethodGet, "/booking/eshan/intro-30/times?time_zone=America/New_York&from="+from+"&to="+to, nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var resp models.BookableTimesResponse
+		json.Unmarshal(recorder.Body.Bytes(), &resp)
+
+		// 1:30 PM would run into the buffer before the meeting at 2 PM
+		newYork, _ := time.LoadLocation("America/New_York")
+		starts := []time.Time{}
+		for _, bookable := range resp.Times {
+			starts = append(starts, bookable.Start.UTC())
+			_, offset := bookable.Start.Zone()
+			_, newYorkOffset := bookable.Start.In(newYork).Zone()
+			assert.Equal(t, newYorkOffset, offset)
+		}
+		assert.Equal(t, []time.Time{at(13, 0), at(14, 30), at(15, 0), at(15, 30), at(16, 0), at(16, 30)}, starts)
+	})
+
+	t.Run("Range too long", func(t *testing.T) {
+		bookingService, _, _ := newBookingService()
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+		router.GET("/booking/:username/:slug/times", bookingService.GetBookableTimes)
+
+		from := at(0, 0)
+		req, _ := http.NewRequest(http.MethodGet, "/booking/eshan/intro-30/times?from="+from.Format(time.RFC3339)+"&to="+from.AddDate(0, 2, 0).Format(time.RFC3339), nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("Book", func(t *testing.T) {
+		bookingService, mockEventRepo, mockPublisher := newBookingService()
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+		router.POST("/booking/:username/:slug", bookingService.Book)
+
+		var created models.Event
+		mockEventRepo.On("CreateEvent", mock.Anything).Run(func(args mock.Arguments) {
+			created = args.Get(0).(models.Event)
+		}).Return(nil)
+		mockPublisher.On("Publish", testOrg.ID, models.WebhookEventCreated, mock.Anything).Return()
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/booking/eshan/intro-30", models.BookingRequest{
+			Start: at(15, 0), Name: "Jane Doe", Email: "jane@partner.com", Notes: "About the integration",
+		}))
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		assert.Equal(t, "Intro with Jane Doe", created.Title)
+		assert.Equal(t, userID, created.EventOwner)
+		assert.Equal(t, at(15, 0), created.EventStartTime)
+		assert.Equal(t, at(15, 30), created.EventEndTime)
+		assert.Equal(t, "Zoom", created.Location)
+		assert.Equal(t, "intro-30", created.Labels["event_type"])
+		assert.Contains(t, created.Description, "About the integration")
+		if assert.Len(t, created.Participants, 1) {
+			assert.True(t, created.Participants[0].External)
+			assert.Equal(t, "jane@partner.com", created.Participants[0].Name)
+		}
+		mockPublisher.AssertExpectations(t)
+	})
+
+	t.Run("Unavailable time", func(t *testing.T) {
+		bookingService, mockEventRepo, _ := newBookingService()
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+		router.POST("/booking/:username/:slug", bookingService.Book)
+
+		for _, start := range []time.Time{at(13, 30), at(14, 0), at(15, 10), at(17, 0)} {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/booking/eshan/intro-30", models.BookingRequest{
+				Start: start, Name: "Jane Doe", Email: "jane@partner.com",
+			}))
+			assert.Equal(t, http.StatusConflict, recorder.Code, start)
+		}
+		mockEventRepo.AssertNotCalled(t, "CreateEvent", mock.Anything)
+	})
+
+	t.Run("Booked in the meantime", func(t *testing.T) {
+		bookingService, mockEventRepo, _ := newBookingService()
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+		router.POST("/booking/:username/:slug", bookingService.Book)
+
+		mockEventRepo.On("CreateEvent", mock.Anything).Return(repository.ErrEventConflict)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/booking/eshan/intro-30", models.BookingRequest{
+			Start: at(16, 0), Name: "Jane Doe", Email: "jane@partner.com",
+		}))
+		assert.Equal(t, http.StatusConflict, recorder.Code)
+	})
+
+	t.Run("Invalid email", func(t *testing.T) {
+		bookingService, _, _ := newBookingService()
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+		router.POST("/booking/:username/:slug", bookingService.Book)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/booking/eshan/intro-30", models.BookingRequest{
+			Start: at(16, 0), Name: "Jane Doe", Email: "jane",
+		}))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+}
+
+func TestTeamBooking(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ownerID, _ := uuid.NewV4()
+	kevinID, _ := uuid.NewV4()
+	eshanID, _ := uuid.NewV4()
+	kevin := models.User{ID: kevinID, OrgID: testOrg.ID, Name: "kevin"}
+	eshan := models.User{ID: eshanID, OrgID: testOrg.ID, Name: "eshan"}
+
+	// kevin is free 1-3 PM and eshan 2-4 PM three days from now
+	day := time.Now().UTC().AddDate(0, 0, 3)
+	at := func(hour int) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), hour, 0, 0, 0, time.UTC)
+	}
+
+	newBookingService := func(mode string) (*BookingService, *MockEventTypeRepo, *MockEventRepo, models.EventType) {
+		eventType := models.EventType{
+			Slug: "interview", Title: "Interview", UserID: ownerID, DurationMinutes: 60, MaxAdvanceDays: 60,
+			SchedulingMode: mode, Members: []string{"kevin", "eshan"}, MemberIDs: []uuid.UUID{kevinID, eshanID},
+		}
+		eventType.ID, _ = uuid.NewV4()
+
+		mockUserRepo := new(MockUserRepo)
+		mockEventTypeRepo := new(MockEventTypeRepo)
+		mockTimeslotRepo := new(MockTimeslotRepo)
+		mockEventRepo := new(MockEventRepo)
+		mockPublisher := new(MockWebhookPublisher)
+
+		mockUserRepo.On("Get", testOrg.ID, "lead").Return(models.User{ID: ownerID, OrgID: testOrg.ID, Name: "lead"}, nil)
+		mockUserRepo.On("GetUsersByNames", testOrg.ID, mock.Anything).Return([]models.User{kevin, eshan}, nil)
+		mockEventTypeRepo.On("GetEventTypeBySlug", ownerID, "interview").Return(eventType, nil)
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "kevin").Return([]string{day.Format("02 Jan 2006") + " 1-3 PM UTC"}, nil)
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "eshan").Return([]string{day.Format("02 Jan 2006") + " 2-4 PM UTC"}, nil)
+		mockEventRepo.On("GetEventsForUser", testOrg.ID, mock.Anything, mock.Anything).Return([]models.Event{}, nil)
+		mockPublisher.On("Publish", testOrg.ID, models.WebhookEventCreated, mock.Anything).Return()
+
+		return &BookingService{
+			UserRepo:      mockUserRepo,
+			EventTypeRepo: mockEventTypeRepo,
+			EventRepo:     mockEventRepo,
+			Availability:  &TimeslotServiceImplementaion{TimeslotRepo: mockTimeslotRepo},
+			Webhooks:      mockPublisher,
+		}, mockEventTypeRepo, mockEventRepo, eventType
+	}
+
+	bookableStarts := func(bookingService *BookingService) []time.Time {
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+		router.GET("/booking/:username/:slug/times", bookingService.GetBookableTimes)
+
+		req, _ := http.NewRequest(http.MethodGet, "/booking/lead/interview/times?from="+at(0).Format(time.RFC3339)+"&to="+at(23).Format(time.RFC3339), nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		var resp models.BookableTimesResponse
+		json.Unmarshal(recorder.Body.Bytes(), &resp)
+		starts := []time.Time{}
+		for _, bookable := range resp.Times {
+			starts = append(starts, bookable.Start.UTC())
+		}
+		return starts
+	}
+
+	book := func(bookingService *BookingService, start time.Time) *httptest.ResponseRecorder {
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+		router.POST("/booking/:username/:slug", bookingService.Book)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/booking/lead/interview", models.BookingRequest{
+			Start: start, Name: "Jane Doe", Email: "jane@partner.com",
+		}))
+		return recorder
+	}
+
+	t.Run("Round robin times need one free member", func(t *testing.T) {
+		bookingService, _, _, _ := newBookingService(models.SchedulingRoundRobin)
+		assert.Equal(t, []time.Time{at(13), at(14), at(15)}, bookableStarts(bookingService))
+	})
+
+	t.Run("Round robin goes to the least loaded member", func(t *testing.T) {
+		bookingService, mockEventTypeRepo, _, eventType := newBookingService(models.SchedulingRoundRobin)
+		mockEventTypeRepo.On("GetBookingLoads", eventType.ID).Return([]models.BookingLoad{
+			{UserID: kevinID, Bookings: 1, LastAssignedAt: time.Now().Add(-time.Hour)},
+			{UserID: eshanID, Bookings: 3, LastAssignedAt: time.Now().Add(-2 * time.Hour)},
+		}, nil)
+		var booked models.Event
+		mockEventTypeRepo.On("BookEvent", mock.Anything, mock.MatchedBy(func(a models.BookingAssignment) bool {
+			return a.UserID == kevinID && a.EventTypeID == eventType.ID
+		})).Run(func(args mock.Arguments) {
+			booked = args.Get(0).(models.Event)
+		}).Return(nil)
+
+		recorder := book(bookingService, at(14))
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		assert.Equal(t, kevinID, booked.EventOwner)
+		var resp models.BookingResponse
+		json.Unmarshal(recorder.Body.Bytes(), &resp)
+		assert.Equal(t, []string{"kevin"}, resp.Hosts)
+		mockEventTypeRepo.AssertExpectations(t)
+	})
+
+	t.Run("Round robin only considers free members", func(t *testing.T) {
+		bookingService, mockEventTypeRepo, _, eventType := newBookingService(models.SchedulingRoundRobin)
+		mockEventTypeRepo.On("GetBookingLoads", eventType.ID).Return([]models.BookingLoad{}, nil)
+		mockEventTypeRepo.On("BookEvent", mock.Anything, mock.MatchedBy(func(a models.BookingAssignment) bool {
+			return a.UserID == eshanID
+		})).Return(nil)
+
+		// only eshan is free at 3 PM
+		recorder := book(bookingService, at(15))
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		mockEventTypeRepo.AssertExpectations(t)
+	})
+
+	t.Run("Collective times need every member", func(t *testing.T) {
+		bookingService, _, _, _ := newBookingService(models.SchedulingCollective)
+		assert.Equal(t, []time.Time{at(14)}, bookableStarts(bookingService))
+	})
+
+	t.Run("Collective booking invites every member", func(t *testing.T) {
+		bookingService, _, mockEventRepo, _ := newBookingService(models.SchedulingCollective)
+		var booked models.Event
+		mockEventRepo.On("CreateEvent", mock.Anything).Run(func(args mock.Arguments) {
+			booked = args.Get(0).(models.Event)
+		}).Return(nil)
+
+		assert.Equal(t, http.StatusConflict, book(bookingService, at(13)).Code)
+
+		recorder := book(bookingService, at(14))
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		assert.Equal(t, kevinID, booked.EventOwner)
+		if assert.Len(t, booked.Participants, 2) {
+			assert.Equal(t, eshanID, booked.Participants[0].UserID.UUID)
+			assert.True(t, booked.Participants[1].External)
+		}
+	})
+
+	t.Run("Create with unknown member", func(t *testing.T) {
+		mockUserRepo := new(MockUserRepo)
+		bookingService := &BookingService{UserRepo: mockUserRepo, EventTypeRepo: new(MockEventTypeRepo)}
+		mockUserRepo.On("Get", testOrg.ID, "lead").Return(models.User{ID: ownerID, OrgID: testOrg.ID, Name: "lead"}, nil)
+		mockUserRepo.On("GetUsersByNames", testOrg.ID, []string{"kevin", "nobody"}).Return([]models.User{kevin}, nil)
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
+		router.POST("/users/:username/event-types", bookingService.CreateEventType)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/users/lead/event-types", models.EventTypeRequest{
+			Slug: "interview", Title: "Interview", DurationMinutes: 60,
+			SchedulingMode: models.SchedulingRoundRobin, Members: []string{"kevin", "nobody"},
+		}))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "nobody")
+	})
+}
+
+func TestLeastLoaded(t *testing.T) {
+	kevin := models.User{Name: "kevin"}
+	kevin.ID, _ = uuid.NewV4()
+	eshan := models.User{Name: "eshan"}
+	eshan.ID, _ = uuid.NewV4()
+	now := time.Now()
+
+	// members without bookings come first, in the order they are listed
+	assert.Equal(t, kevin, leastLoaded([]models.User{kevin, eshan}, nil))
+	// equal loads go to the member assigned longest ago
+	assert.Equal(t, eshan, leastLoaded([]models.User{kevin, eshan}, []models.BookingLoad{
+		{UserID: kevin.ID, Bookings: 2, LastAssignedAt: now},
+		{UserID: eshan.ID, Bookings: 2, LastAssignedAt: now.Add(-time.Hour)},
+	}))
+	assert.Equal(t, kevin, leastLoaded([]models.User{kevin, eshan}, []models.BookingLoad{
+		{UserID: eshan.ID, Bookings: 1, LastAssignedAt: now.Add(-time.Hour)},
+	}))
+}
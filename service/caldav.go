@@ -0,0 +1,760 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+)
+
+const (
+	davNamespace       = "DAV:"
+	calDAVNamespace    = "urn:ietf:params:xml:ns:caldav"
+	calServerNamespace = "http://calendarserver.org/ns/"
+
+	calDAVTimeLayout = "20060102T150405Z"
+)
+
+// errCalDAVUnsupported marks calendar objects that parse but can't be stored as an event
+var errCalDAVUnsupported = errors.New("unsupported calendar object")
+
+// davRequest is the body of a PROPFIND or REPORT request, the root element tells which report is asked for
+type davRequest struct {
+	XMLName xml.Name
+	AllProp *struct{}         `xml:"DAV: allprop"`
+	Prop    *davPropNames     `xml:"DAV: prop"`
+	Hrefs   []string          `xml:"DAV: href"`
+	Filter  *calDAVCompFilter `xml:"urn:ietf:params:xml:ns:caldav filter>comp-filter"`
+}
+
+type davPropNames struct {
+	Names []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+type calDAVCompFilter struct {
+	Name        string             `xml:"name,attr"`
+	TimeRange   *calDAVTimeRange   `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	CompFilters []calDAVCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+type calDAVTimeRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
+
+// davProps are the properties of a resource, each rendered as an XML fragment on demand
+type davProps map[xml.Name]func() string
+
+// davResponse is one response of a multistatus, properties the resource doesn't have are listed as not found
+type davResponse struct {
+	href     string
+	notFound bool
+	found    []string
+	missing  []xml.Name
+}
+
+// calDAVObject is a calendar object resource a client stored, as the request it turns into
+type calDAVObject struct {
+	uid        string
+	request    models.EventRequest
+	start, end time.Time
+	exceptions []models.EventException
+}
+
+// CalDAVOptions advertises CalDAV support to clients probing the server
+func (cs *CalendarService) CalDAVOptions(ctx *gin.Context) {
+	ctx.Header("DAV", "1, 3, calendar-access")
+	ctx.Header("Allow", "OPTIONS, GET, PUT, DELETE, PROPFIND, REPORT")
+	ctx.Status(http.StatusOK)
+}
+
+// PropfindCalDAV answers PROPFIND on the user's calendar collection, with Depth 1 for its events as well, or on a single event
+func (cs *CalendarService) PropfindCalDAV(ctx *gin.Context) {
+	user, ok := cs.authorizeCalDAV(ctx)
+	if !ok {
+		return
+	}
+
+	req, err := readDAVRequest(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	events, err := cs.calDAVEvents(user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching events"})
+		return
+	}
+	organizers, err := cs.organizerNames(user, events)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching event organizers"})
+		return
+	}
+
+	if resource := ctx.Param("resource"); resource != "" {
+		event, found := findCalDAVEvent(events, resource)
+		if !found {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+			return
+		}
+		writeMultistatus(ctx, []davResponse{calDAVEventProps(user, event, organizers).response(calDAVHref(user, event), req, false)})
+		return
+	}
+
+	responses := []davResponse{calDAVCollectionProps(user, events).response(calDAVCollectionHref(user), req, false)}
+	if ctx.GetHeader("Depth") != "0" {
+		for _, event := range events {
+			responses = append(responses, calDAVEventProps(user, event, organizers).response(calDAVHref(user, event), req, false))
+		}
+	}
+	writeMultistatus(ctx, responses)
+}
+
+// ReportCalDAV answers the calendar-query and calendar-multiget reports on the user's calendar collection
+func (cs *CalendarService) ReportCalDAV(ctx *gin.Context) {
+	user, ok := cs.authorizeCalDAV(ctx)
+	if !ok {
+		return
+	}
+
+	req, err := readDAVRequest(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	events, err := cs.calDAVEvents(user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching events"})
+		return
+	}
+	organizers, err := cs.organizerNames(user, events)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching event organizers"})
+		return
+	}
+
+	responses := []davResponse{}
+	switch req.XMLName {
+	case xml.Name{Space: calDAVNamespace, Local: "calendar-query"}:
+		matching, err := queryCalDAVEvents(events, req.Filter)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for _, event := range matching {
+			responses = append(responses, calDAVEventProps(user, event, organizers).response(calDAVHref(user, event), req, true))
+		}
+	case xml.Name{Space: calDAVNamespace, Local: "calendar-multiget"}:
+		for _, href := range req.Hrefs {
+			name, _ := url.PathUnescape(path.Base(strings.TrimSpace(href)))
+			event, found := findCalDAVEvent(events, name)
+			if !found {
+				responses = append(responses, davResponse{href: strings.TrimSpace(href), notFound: true})
+				continue
+			}
+			responses = append(responses, calDAVEventProps(user, event, organizers).response(calDAVHref(user, event), req, true))
+		}
+	default:
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Unsupported report " + req.XMLName.Local})
+		return
+	}
+	writeMultistatus(ctx, responses)
+}
+
+// GetCalDAVObject returns a single event of the user's calendar collection
+func (cs *CalendarService) GetCalDAVObject(ctx *gin.Context) {
+	user, ok := cs.authorizeCalDAV(ctx)
+	if !ok {
+		return
+	}
+
+	events, err := cs.calDAVEvents(user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching events"})
+		return
+	}
+	event, found := findCalDAVEvent(events, ctx.Param("resource"))
+	if !found {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	organizers, err := cs.organizerNames(user, []models.Event{event})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching event organizers"})
+		return
+	}
+
+	ctx.Header("ETag", calDAVETag(event))
+	ctx.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(utils.RenderICSObject(event, organizers[event.EventOwner], time.Now())))
+}
+
+// PutCalDAVObject creates or replaces an event from a calendar object a client stores. New events go through the same
+// checks as events created through the API, with the user as owner. Changes to single occurrences aren't taken over
+// CalDAV, an object has to carry the occurrence changes the event already has.
+func (cs *CalendarService) PutCalDAVObject(ctx *gin.Context) {
+	user, ok := cs.authorizeCalDAV(ctx)
+	if !ok {
+		return
+	}
+
+	name := ctx.Param("resource")
+	if !strings.HasSuffix(name, ".ics") {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Calendar object names have to end in .ics"})
+		return
+	}
+
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxCalendarImportSize)
+	data, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "calendar object is too large or couldn't be read"})
+		return
+	}
+
+	events, err := cs.calDAVEvents(user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching events"})
+		return
+	}
+	existing, found := findCalDAVEvent(events, name)
+	if !checkCalDAVPreconditions(ctx, existing, found) {
+		return
+	}
+
+	object, err := cs.parseCalDAVObject(string(data), user)
+	if errors.Is(err, errCalDAVUnsupported) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid calendar object: " + err.Error()})
+		return
+	}
+
+	for _, event := range events {
+		if utils.ICSUID(event) == object.uid && (!found || event.ID != existing.ID) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Another calendar object already has UID " + object.uid})
+			return
+		}
+	}
+
+	if !found {
+		if len(object.exceptions) > 0 {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Changes to single occurrences can't be made over CalDAV"})
+			return
+		}
+		event, ok := cs.Events.createEvent(ctx, object.request, models.Event{ICalUID: object.uid, CalDAVName: name})
+		if !ok {
+			return
+		}
+		ctx.Header("ETag", calDAVETag(event))
+		ctx.Status(http.StatusCreated)
+		return
+	}
+
+	if existing.EventOwner != user.ID {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the event owner can change the event"})
+		return
+	}
+	if utils.ICSUID(existing) != object.uid {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "The UID of a calendar object can't change"})
+		return
+	}
+
+	// moving the series or changing its rule drops its occurrence changes, the client may leave them out then
+	seriesChanged := !object.start.Equal(existing.EventStartTime) || !object.end.Equal(existing.EventEndTime) ||
+		object.request.Recurrence != existing.Recurrence
+	if !sameExceptions(object.exceptions, existing.Exceptions) && !(seriesChanged && len(object.exceptions) == 0) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Changes to single occurrences can't be made over CalDAV"})
+		return
+	}
+
+	req := object.request
+	update := models.EventUpdateRequest{
+		Title:                &req.Title,
+		EventTimeSlot:        &req.EventTimeSlot,
+		Participants:         req.Participants,
+		OptionalParticipants: req.OptionalParticipants,
+		ExternalGuests:       req.ExternalGuests,
+		Recurrence:           &req.Recurrence,
+		Description:          &req.Description,
+		Location:             &req.Location,
+		ConferenceURL:        &req.ConferenceURL,
+		Visibility:           &req.Visibility,
+		// labels and reminders have no place in the object, they are kept as they are
+		Labels:    existing.Labels,
+		Reminders: existing.Reminders,
+	}
+	updated, ok := cs.Events.applyEventUpdate(ctx, existing.ID.String(), update, true)
+	if !ok {
+		return
+	}
+	ctx.Header("ETag", calDAVETag(updated))
+	ctx.Status(http.StatusNoContent)
+}
+
+// DeleteCalDAVObject cancels an event the user owns, it can be restored through the API like any cancelled event
+func (cs *CalendarService) DeleteCalDAVObject(ctx *gin.Context) {
+	user, ok := cs.authorizeCalDAV(ctx)
+	if !ok {
+		return
+	}
+
+	events, err := cs.calDAVEvents(user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching events"})
+		return
+	}
+	existing, found := findCalDAVEvent(events, ctx.Param("resource"))
+	if !found {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	if !checkCalDAVPreconditions(ctx, existing, found) {
+		return
+	}
+	if existing.EventOwner != user.ID {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the event owner can delete the event"})
+		return
+	}
+
+	cancellation := models.EventCancellation{
+		CancelledAt: time.Now().UTC(),
+		CancelledBy: user.Name,
+		Reason:      "deleted from a calendar client",
+	}
+	err = cs.EventRepo.CancelEvent(existing.ID.String(), cancellation)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing.Status = models.EventStatusCancelled
+	existing.Cancellation = &cancellation
+	publishWebhook(cs.Events.Webhooks, requestOrgID(ctx), models.WebhookEventCancelled, existing)
+	ctx.Status(http.StatusNoContent)
+}
+
+// authorizeCalDAV checks HTTP Basic credentials, the user name with the user's calendar token as password
+func (cs *CalendarService) authorizeCalDAV(ctx *gin.Context) (models.User, bool) {
+	username, token, ok := ctx.Request.BasicAuth()
+	if ok && username == ctx.Param("username") {
+		if user, ok := cs.authorizeToken(requestOrgID(ctx), username, token); ok {
+			return user, true
+		}
+	}
+	ctx.Header("WWW-Authenticate", `Basic realm="timeslot-app CalDAV"`)
+	ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	return models.User{}, false
+}
+
+// calDAVEvents are the events of the user's calendar collection, the active ones the user owns or takes part in
+func (cs *CalendarService) calDAVEvents(user models.User) ([]models.Event, error) {
+	return cs.EventRepo.GetEventsForUser(user.OrgID, user.Name, models.EventFilter{Status: models.EventStatusActive})
+}
+
+// checkCalDAVPreconditions evaluates If-Match and If-None-Match against the current ETag of a resource
+func checkCalDAVPreconditions(ctx *gin.Context, existing models.Event, found bool) bool {
+	ifMatch, ifNoneMatch := ctx.GetHeader("If-Match"), ctx.GetHeader("If-None-Match")
+	failed := (ifNoneMatch == "*" && found) ||
+		(ifMatch != "" && (!found || (ifMatch != "*" && ifMatch != calDAVETag(existing))))
+	if failed {
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"error": "The calendar object has changed"})
+		return false
+	}
+	return true
+}
+
+// calDAVName is the name an event is stored under in the collection, the client's own name or one made from its ID
+func calDAVName(event models.Event) string {
+	if event.CalDAVName != "" {
+		return event.CalDAVName
+	}
+	return event.ID.String() + ".ics"
+}
+
+func findCalDAVEvent(events []models.Event, name string) (models.Event, bool) {
+	idx := slices.IndexFunc(events, func(e models.Event) bool { return calDAVName(e) == name })
+	if idx < 0 {
+		return models.Event{}, false
+	}
+	return events[idx], true
+}
+
+// calDAVETag changes with every change of the event
+func calDAVETag(event models.Event) string {
+	return fmt.Sprintf(`"%s-%d"`, event.ID, event.Version)
+}
+
+// calDAVCTag changes whenever an event of the collection changes, is added or is removed
+func calDAVCTag(events []models.Event) string {
+	tags := make([]string, 0, len(events))
+	for _, event := range events {
+		tags = append(tags, calDAVETag(event))
+	}
+	slices.Sort(tags)
+	sum := sha256.Sum256([]byte(strings.Join(tags, ",")))
+	return hex.EncodeToString(sum[:16])
+}
+
+func calDAVCollectionHref(user models.User) string {
+	return "/caldav/" + url.PathEscape(user.Name) + "/"
+}
+
+func calDAVHref(user models.User, event models.Event) string {
+	return calDAVCollectionHref(user) + url.PathEscape(calDAVName(event))
+}
+
+func calDAVCollectionProps(user models.User, events []models.Event) davProps {
+	return davProps{
+		{Space: davNamespace, Local: "resourcetype"}: func() string {
+			return "<d:resourcetype><d:collection/><c:calendar/></d:resourcetype>"
+		},
+		{Space: davNamespace, Local: "displayname"}: func() string {
+			return "<d:displayname>" + xmlText(user.Name) + "</d:displayname>"
+		},
+		{Space: davNamespace, Local: "current-user-principal"}: func() string {
+			return "<d:current-user-principal><d:href>" + xmlText(calDAVCollectionHref(user)) + "</d:href></d:current-user-principal>"
+		},
+		{Space: calDAVNamespace, Local: "supported-calendar-component-set"}: func() string {
+			return `<c:supported-calendar-component-set><c:comp name="VEVENT"/></c:supported-calendar-component-set>`
+		},
+		{Space: calServerNamespace, Local: "getctag"}: func() string {
+			return "<cs:getctag>" + calDAVCTag(events) + "</cs:getctag>"
+		},
+	}
+}
+
+func calDAVEventProps(user models.User, event models.Event, organizers map[uuid.UUID]string) davProps {
+	return davProps{
+		{Space: davNamespace, Local: "resourcetype"}: func() string {
+			return "<d:resourcetype/>"
+		},
+		{Space: davNamespace, Local: "getetag"}: func() string {
+			return "<d:getetag>" + xmlText(calDAVETag(event)) + "</d:getetag>"
+		},
+		{Space: davNamespace, Local: "getcontenttype"}: func() string {
+			return "<d:getcontenttype>text/calendar; charset=utf-8; component=vevent</d:getcontenttype>"
+		},
+		{Space: calDAVNamespace, Local: "calendar-data"}: func() string {
+			return "<c:calendar-data>" + xmlText(utils.RenderICSObject(event, organizers[event.EventOwner], time.Now())) + "</c:calendar-data>"
+		},
+	}
+}
+
+// response renders the requested properties, or all of them without a prop element. Calendar data is left out of
+// PROPFIND unless asked for since it is the whole event, reports include it by default.
+func (props davProps) response(href string, req davRequest, report bool) davResponse {
+	resp := davResponse{href: href}
+	if req.Prop == nil {
+		for name, render := range props {
+			if name.Local != "calendar-data" || report {
+				resp.found = append(resp.found, render())
+			}
+		}
+		slices.Sort(resp.found)
+		return resp
+	}
+	for _, requested := range req.Prop.Names {
+		if render, ok := props[requested.XMLName]; ok {
+			resp.found = append(resp.found, render())
+		} else {
+			resp.missing = append(resp.missing, requested.XMLName)
+		}
+	}
+	return resp
+}
+
+func readDAVRequest(ctx *gin.Context) (davRequest, error) {
+	var req davRequest
+	data, err := io.ReadAll(io.LimitReader(ctx.Request.Body, 1<<20))
+	if err != nil {
+		return req, err
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return req, nil
+	}
+	if err := xml.Unmarshal(data, &req); err != nil {
+		return req, errors.New("invalid XML request body")
+	}
+	return req, nil
+}
+
+func writeMultistatus(ctx *gin.Context, responses []davResponse) {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="` + calDAVNamespace + `" xmlns:cs="` + calServerNamespace + `">`)
+	for _, resp := range responses {
+		b.WriteString("<d:response><d:href>" + xmlText(resp.href) + "</d:href>")
+		if resp.notFound {
+			b.WriteString("<d:status>HTTP/1.1 404 Not Found</d:status></d:response>")
+			continue
+		}
+		if len(resp.found) > 0 {
+			b.WriteString("<d:propstat><d:prop>" + strings.Join(resp.found, "") + "</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>")
+		}
+		if len(resp.missing) > 0 {
+			b.WriteString("<d:propstat><d:prop>")
+			for _, name := range resp.missing {
+				b.WriteString(`<x:` + name.Local + ` xmlns:x="` + xmlText(name.Space) + `"/>`)
+			}
+			b.WriteString("</d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat>")
+		}
+		b.WriteString("</d:response>")
+	}
+	b.WriteString("</d:multistatus>")
+	ctx.Data(http.StatusMultiStatus, "application/xml; charset=utf-8", []byte(b.String()))
+}
+
+func xmlText(value string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
+
+// queryCalDAVEvents applies the component filter of a calendar-query. Only VEVENTs are stored, a filter on any other
+// component matches nothing, and a time range keeps the events with an occurrence overlapping it.
+func queryCalDAVEvents(events []models.Event, filter *calDAVCompFilter) ([]models.Event, error) {
+	if filter == nil {
+		return events, nil
+	}
+	if filter.Name != "VCALENDAR" {
+		return []models.Event{}, nil
+	}
+
+	var from, to time.Time
+	for _, comp := range filter.CompFilters {
+		if comp.Name != "VEVENT" {
+			return []models.Event{}, nil
+		}
+		if comp.TimeRange != nil {
+			var err error
+			if from, err = parseCalDAVTime(comp.TimeRange.Start); err != nil {
+				return nil, err
+			}
+			if to, err = parseCalDAVTime(comp.TimeRange.End); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if from.IsZero() && to.IsZero() {
+		return events, nil
+	}
+
+	matching := []models.Event{}
+	for _, event := range events {
+		if event.Recurrence == "" {
+			if (to.IsZero() || event.EventStartTime.Before(to)) && (from.IsZero() || event.EventEndTime.After(from)) {
+				matching = append(matching, event)
+			}
+			continue
+		}
+		occurrences, err := utils.ExpandOccurrences(event, from, to)
+		if err != nil {
+			return nil, err
+		}
+		if len(occurrences) > 0 {
+			matching = append(matching, event)
+		}
+	}
+	return matching, nil
+}
+
+func parseCalDAVTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(calDAVTimeLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time-range %q", value)
+	}
+	return t, nil
+}
+
+// parseCalDAVObject turns a calendar object into an event request owned by the user. Attendees addressed by user ID
+// are participants, every other address is an external guest. Moved occurrences and EXDATEs are returned as
+// exceptions for the caller to compare with the event.
+func (cs *CalendarService) parseCalDAVObject(data string, user models.User) (calDAVObject, error) {
+	var object calDAVObject
+
+	calendars, err := utils.ParseICS(data)
+	if err != nil {
+		return object, err
+	}
+	if len(calendars) != 1 || calendars[0].Name != "VCALENDAR" {
+		return object, errors.New("a calendar object holds exactly one calendar")
+	}
+
+	var master *utils.ICSComponent
+	var overrides []utils.ICSComponent
+	for _, component := range calendars[0].Components {
+		switch component.Name {
+		case "VTIMEZONE":
+		case "VEVENT":
+			uid := component.PropertyValue("UID")
+			if uid == "" {
+				return object, errors.New("missing UID")
+			}
+			if object.uid != "" && uid != object.uid {
+				return object, errors.New("a calendar object holds a single event")
+			}
+			object.uid = uid
+			if _, ok := component.Property("RECURRENCE-ID"); ok {
+				overrides = append(overrides, component)
+			} else if master == nil {
+				master = &component
+			} else {
+				return object, errors.New("a calendar object holds a single event")
+			}
+		default:
+			return object, fmt.Errorf("%w: only VEVENT components are supported", errCalDAVUnsupported)
+		}
+	}
+	if master == nil {
+		return object, errors.New("missing VEVENT")
+	}
+
+	object.start, object.end, err = calDAVEventTimes(*master)
+	if err != nil {
+		return object, err
+	}
+	timeSlot, ok := utils.FormatTimeSlot(object.start, object.end)
+	if !ok {
+		return object, fmt.Errorf("%w: events have to start and end on whole minutes of a single day", errCalDAVUnsupported)
+	}
+
+	req := models.EventRequest{
+		Title:         utils.ICSUnescapeText(master.PropertyValue("SUMMARY")),
+		EventOwner:    user.Name,
+		EventTimeSlot: timeSlot,
+		Participants:  []string{},
+		Description:   utils.ICSUnescapeText(master.PropertyValue("DESCRIPTION")),
+		Location:      utils.ICSUnescapeText(master.PropertyValue("LOCATION")),
+		ConferenceURL: master.PropertyValue("URL"),
+		Visibility:    models.EventVisibilityPublic,
+	}
+	switch strings.ToUpper(master.PropertyValue("CLASS")) {
+	case "PRIVATE", "CONFIDENTIAL":
+		req.Visibility = models.EventVisibilityPrivate
+	}
+	if value := master.PropertyValue("RRULE"); value != "" {
+		rule, err := utils.ParseRRule(value)
+		if err != nil {
+			return object, err
+		}
+		req.Recurrence = rule.String()
+	}
+
+	for _, attendee := range master.PropertiesNamed("ATTENDEE") {
+		address := attendee.Value
+		var name string
+		switch {
+		case strings.HasPrefix(strings.ToLower(address), "urn:uuid:"):
+			userID, err := uuid.FromString(address[len("urn:uuid:"):])
+			if err != nil {
+				return object, fmt.Errorf("invalid attendee %q", address)
+			}
+			if userID == user.ID {
+				continue
+			}
+			participant, err := cs.UserRepo.GetByID(user.OrgID, userID)
+			if err != nil {
+				return object, fmt.Errorf("unknown attendee %q", address)
+			}
+			name = participant.Name
+		case strings.HasPrefix(strings.ToLower(address), "mailto:"):
+			req.ExternalGuests = append(req.ExternalGuests, address[len("mailto:"):])
+			continue
+		default:
+			return object, fmt.Errorf("unsupported attendee address %q", address)
+		}
+		if strings.EqualFold(attendee.Params["ROLE"], "OPT-PARTICIPANT") {
+			req.OptionalParticipants = append(req.OptionalParticipants, name)
+		} else {
+			req.Participants = append(req.Participants, name)
+		}
+	}
+	object.request = req
+
+	for _, prop := range master.PropertiesNamed("EXDATE") {
+		for _, value := range strings.Split(prop.Value, ",") {
+			prop.Value = value
+			exdate, err := utils.ParseICSTime(prop, object.start.Location())
+			if err != nil {
+				return object, err
+			}
+			object.exceptions = append(object.exceptions, models.EventException{OriginalStartTime: exdate, Cancelled: true})
+		}
+	}
+	for _, override := range overrides {
+		recurrenceID, _ := override.Property("RECURRENCE-ID")
+		original, err := utils.ParseICSTime(recurrenceID, object.start.Location())
+		if err != nil {
+			return object, err
+		}
+		start, end, err := calDAVEventTimes(override)
+		if err != nil {
+			return object, err
+		}
+		object.exceptions = append(object.exceptions, models.EventException{OriginalStartTime: original, EventStartTime: &start, EventEndTime: &end})
+	}
+	return object, nil
+}
+
+// calDAVEventTimes reads the start of a VEVENT and its end, given as DTEND or as a DURATION
+func calDAVEventTimes(component utils.ICSComponent) (time.Time, time.Time, error) {
+	dtstart, ok := component.Property("DTSTART")
+	if !ok {
+		return time.Time{}, time.Time{}, errors.New("missing DTSTART")
+	}
+	start, err := utils.ParseICSTime(dtstart, time.UTC)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	end := start
+	if dtend, ok := component.Property("DTEND"); ok {
+		end, err = utils.ParseICSTime(dtend, time.UTC)
+	} else if duration := component.PropertyValue("DURATION"); duration != "" {
+		var d time.Duration
+		d, err = utils.ParseICSDuration(duration)
+		end = start.Add(d)
+	}
+	return start, end, err
+}
+
+// sameExceptions compares occurrence changes regardless of order and time zone
+func sameExceptions(a, b []models.EventException) bool {
+	key := func(e models.EventException) string {
+		k := fmt.Sprintf("%d/%t", e.OriginalStartTime.Unix(), e.Cancelled)
+		if !e.Cancelled && e.EventStartTime != nil && e.EventEndTime != nil {
+			k += fmt.Sprintf("/%d/%d", e.EventStartTime.Unix(), e.EventEndTime.Unix())
+		}
+		return k
+	}
+	keys := func(exceptions []models.EventException) []string {
+		out := make([]string, 0, len(exceptions))
+		for _, e := range exceptions {
+			out = append(out, key(e))
+		}
+		slices.Sort(out)
+		return out
+	}
+	return slices.Equal(keys(a), keys(b))
+}
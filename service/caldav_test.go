@@ -0,0 +1,283 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"timeslot-app/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCalDAV(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ny, _ := time.LoadLocation("America/New_York")
+	kevinID, _ := uuid.NewV4()
+	kevin := models.User{ID: kevinID, OrgID: testOrg.ID, Name: "kevin"}
+	marcoID, _ := uuid.NewV4()
+	marco := models.User{ID: marcoID, OrgID: testOrg.ID, Name: "marco"}
+	eventID, _ := uuid.NewV4()
+	start := time.Date(2025, 1, 2, 14, 0, 0, 0, ny)
+	event := models.Event{
+		ID:             eventID,
+		Title:          "Standup",
+		EventOwner:     kevinID,
+		EventStartTime: start,
+		EventEndTime:   start.Add(2 * time.Hour),
+		Participants:   []models.EventParticipant{},
+		Visibility:     models.EventVisibilityPublic,
+		Status:         models.EventStatusActive,
+		Version:        3,
+		ICalUID:        "standup@client",
+		CalDAVName:     "standup.ics",
+	}
+	activeEvents := models.EventFilter{Status: models.EventStatusActive}
+
+	setup := func() (*MockEventRepo, *MockUserRepo, *MockTimeslotRepo, *gin.Engine) {
+		mockEventRepo := new(MockEventRepo)
+		mockUserRepo := new(MockUserRepo)
+		mockTimeslotRepo := new(MockTimeslotRepo)
+		mockCalendarRepo := new(MockCalendarRepo)
+		calendarService := &CalendarService{
+			EventRepo:    mockEventRepo,
+			UserRepo:     mockUserRepo,
+			CalendarRepo: mockCalendarRepo,
+			Events:       &EventService{EventRepo: mockEventRepo, UserRepo: mockUserRepo, TimeslotRepo: mockTimeslotRepo},
+		}
+
+		mockUserRepo.On("Get", testOrg.ID, "kevin").Return(kevin, nil)
+		mockUserRepo.On("GetByID", testOrg.ID, kevinID).Return(kevin, nil)
+		mockUserRepo.On("GetByID", testOrg.ID, marcoID).Return(marco, nil)
+		mockCalendarRepo.On("GetCalendarTokenHash", kevinID).Return(hashCalendarToken("secret"), nil)
+		mockEventRepo.On("GetEventsForUser", testOrg.ID, "kevin", activeEvents).Return([]models.Event{event}, nil)
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
+		caldav := router.Group("/caldav")
+		caldav.Handle("PROPFIND", "/:username/", calendarService.PropfindCalDAV)
+		caldav.Handle("PROPFIND", "/:username/:resource", calendarService.PropfindCalDAV)
+		caldav.Handle("REPORT", "/:username/", calendarService.ReportCalDAV)
+		caldav.GET("/:username/:resource", calendarService.GetCalDAVObject)
+		caldav.PUT("/:username/:resource", calendarService.PutCalDAVObject)
+		caldav.DELETE("/:username/:resource", calendarService.DeleteCalDAVObject)
+		return mockEventRepo, mockUserRepo, mockTimeslotRepo, router
+	}
+	davRequest := func(method, target, body string) *http.Request {
+		req, _ := http.NewRequest(method, target, strings.NewReader(body))
+		req.SetBasicAuth("kevin", "secret")
+		return req
+	}
+	calendarObject := func(uid, dtstart, dtend string) string {
+		return "BEGIN:VCALENDAR\r\n" +
+			"VERSION:2.0\r\n" +
+			"PRODID:-//Example//EN\r\n" +
+			"BEGIN:VEVENT\r\n" +
+			"UID:" + uid + "\r\n" +
+			"SUMMARY:Design review\r\n" +
+			"DTSTART;TZID=America/New_York:" + dtstart + "\r\n" +
+			"DTEND;TZID=America/New_York:" + dtend + "\r\n" +
+			"CLASS:PRIVATE\r\n" +
+			"ATTENDEE;CN=kevin:urn:uuid:" + kevinID.String() + "\r\n" +
+			"ATTENDEE;CN=marco;ROLE=OPT-PARTICIPANT:urn:uuid:" + marcoID.String() + "\r\n" +
+			"ATTENDEE:mailto:jane@partner.com\r\n" +
+			"END:VEVENT\r\n" +
+			"END:VCALENDAR\r\n"
+	}
+
+	t.Run("Propfind Collection", func(t *testing.T) {
+		_, _, _, router := setup()
+
+		req := davRequest("PROPFIND", "/caldav/kevin/", `<?xml version="1.0"?>
+			<d:propfind xmlns:d="DAV:" xmlns:cs="http://calendarserver.org/ns/">
+				<d:prop><d:resourcetype/><cs:getctag/><d:getetag/><d:quota-used-bytes/></d:prop>
+			</d:propfind>`)
+		req.Header.Set("Depth", "1")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusMultiStatus, resp.Code)
+		body := resp.Body.String()
+		assert.Contains(t, body, "<d:href>/caldav/kevin/</d:href>")
+		assert.Contains(t, body, "<c:calendar/>")
+		assert.Contains(t, body, "<cs:getctag>"+calDAVCTag([]models.Event{event})+"</cs:getctag>")
+		assert.Contains(t, body, "<d:href>/caldav/kevin/standup.ics</d:href>")
+		assert.Contains(t, body, "<d:getetag>&#34;"+eventID.String()+"-3&#34;</d:getetag>")
+		assert.Contains(t, body, `<x:quota-used-bytes xmlns:x="DAV:"/>`)
+	})
+
+	t.Run("Calendar Query", func(t *testing.T) {
+		_, _, _, router := setup()
+		query := func(from, to string) string {
+			req := davRequest("REPORT", "/caldav/kevin/", `<?xml version="1.0"?>
+				<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+					<d:prop><d:getetag/><c:calendar-data/></d:prop>
+					<c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT">
+						<c:time-range start="`+from+`" end="`+to+`"/>
+					</c:comp-filter></c:comp-filter></c:filter>
+				</c:calendar-query>`)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+			assert.Equal(t, http.StatusMultiStatus, resp.Code)
+			return resp.Body.String()
+		}
+
+		body := query("20250102T000000Z", "20250103T000000Z")
+		assert.Contains(t, body, "<d:href>/caldav/kevin/standup.ics</d:href>")
+		assert.Contains(t, body, "UID:standup@client")
+		assert.NotContains(t, body, "METHOD:")
+
+		assert.NotContains(t, query("20250201T000000Z", "20250202T000000Z"), "standup.ics")
+	})
+
+	t.Run("Get Object", func(t *testing.T) {
+		_, _, _, router := setup()
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, davRequest(http.MethodGet, "/caldav/kevin/standup.ics", ""))
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, `"`+eventID.String()+`-3"`, resp.Header().Get("ETag"))
+		assert.Contains(t, resp.Body.String(), "DTSTART;TZID=America/New_York:20250102T140000\r\n")
+	})
+
+	t.Run("Put Creates Event", func(t *testing.T) {
+		mockEventRepo, mockUserRepo, mockTimeslotRepo, router := setup()
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "kevin").Return([]string{"03 Jan 2025 2-4 PM America/New_York"}, nil)
+		mockUserRepo.On("GetUsersByNames", testOrg.ID, []string{"marco"}).Return([]models.User{marco}, nil)
+		mockEventRepo.On("GetConflictingEvents", []uuid.UUID{kevinID, marcoID}, mock.Anything, uuid.Nil).Return([]models.EventConflict(nil), nil)
+		var created models.Event
+		mockEventRepo.On("CreateEvent", mock.Anything).Run(func(args mock.Arguments) {
+			created = args.Get(0).(models.Event)
+		}).Return(nil)
+
+		req := davRequest(http.MethodPut, "/caldav/kevin/review.ics", calendarObject("review@client", "20250103T140000", "20250103T160000"))
+		req.Header.Set("If-None-Match", "*")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusCreated, resp.Code)
+		assert.Equal(t, `"`+created.ID.String()+`-1"`, resp.Header().Get("ETag"))
+		assert.Equal(t, "review@client", created.ICalUID)
+		assert.Equal(t, "review.ics", created.CalDAVName)
+		assert.Equal(t, "Design review", created.Title)
+		assert.Equal(t, kevinID, created.EventOwner)
+		assert.Equal(t, models.EventVisibilityPrivate, created.Visibility)
+		assert.Equal(t, time.Date(2025, 1, 3, 19, 0, 0, 0, time.UTC), created.EventStartTime.UTC())
+		assert.Len(t, created.Participants, 2)
+	})
+
+	t.Run("Put Minutes Across Noon", func(t *testing.T) {
+		mockEventRepo, mockUserRepo, mockTimeslotRepo, router := setup()
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "kevin").Return([]string{"03 Jan 2025 10 AM-2 PM America/New_York"}, nil)
+		mockUserRepo.On("GetUsersByNames", testOrg.ID, []string{"marco"}).Return([]models.User{marco}, nil)
+		mockEventRepo.On("GetConflictingEvents", []uuid.UUID{kevinID, marcoID}, mock.Anything, uuid.Nil).Return([]models.EventConflict(nil), nil)
+		var created models.Event
+		mockEventRepo.On("CreateEvent", mock.Anything).Run(func(args mock.Arguments) {
+			created = args.Get(0).(models.Event)
+		}).Return(nil)
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, davRequest(http.MethodPut, "/caldav/kevin/review.ics", calendarObject("review@client", "20250103T103000", "20250103T130000")))
+
+		assert.Equal(t, http.StatusCreated, resp.Code)
+		assert.Equal(t, time.Date(2025, 1, 3, 15, 30, 0, 0, time.UTC), created.EventStartTime.UTC())
+		assert.Equal(t, time.Date(2025, 1, 3, 18, 0, 0, 0, time.UTC), created.EventEndTime.UTC())
+	})
+
+	t.Run("Put Outside Availability", func(t *testing.T) {
+		mockEventRepo, _, mockTimeslotRepo, router := setup()
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "kevin").Return([]string{}, nil)
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, davRequest(http.MethodPut, "/caldav/kevin/review.ics", calendarObject("review@client", "20250103T140000", "20250103T160000")))
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		mockEventRepo.AssertNotCalled(t, "CreateEvent", mock.Anything)
+	})
+
+	t.Run("Put Unsupported Times", func(t *testing.T) {
+		mockEventRepo, _, _, router := setup()
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, davRequest(http.MethodPut, "/caldav/kevin/review.ics", calendarObject("review@client", "20250103T140000", "20250104T160000")))
+
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+		mockEventRepo.AssertNotCalled(t, "CreateEvent", mock.Anything)
+	})
+
+	t.Run("Put UID Conflict", func(t *testing.T) {
+		_, _, _, router := setup()
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, davRequest(http.MethodPut, "/caldav/kevin/other.ics", calendarObject("standup@client", "20250103T140000", "20250103T160000")))
+
+		assert.Equal(t, http.StatusConflict, resp.Code)
+	})
+
+	t.Run("Put Stale ETag", func(t *testing.T) {
+		mockEventRepo, _, _, router := setup()
+
+		req := davRequest(http.MethodPut, "/caldav/kevin/standup.ics", calendarObject("standup@client", "20250102T140000", "20250102T160000"))
+		req.Header.Set("If-Match", `"`+eventID.String()+`-2"`)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+		mockEventRepo.AssertNotCalled(t, "UpdateEvent", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Put Updates Event", func(t *testing.T) {
+		mockEventRepo, mockUserRepo, _, router := setup()
+		mockEventRepo.On("GetEvent", testOrg.ID, eventID.String()).Return(event, nil)
+		mockUserRepo.On("GetUsersByNames", testOrg.ID, []string{"marco"}).Return([]models.User{marco}, nil)
+		mockEventRepo.On("GetConflictingEvents", []uuid.UUID{kevinID, marcoID}, mock.Anything, eventID).Return([]models.EventConflict(nil), nil)
+		var updated models.Event
+		mockEventRepo.On("UpdateEvent", mock.Anything, (*models.EventReschedule)(nil)).Run(func(args mock.Arguments) {
+			updated = args.Get(0).(models.Event)
+		}).Return(nil)
+		mockEventRepo.On("GetRescheduleHistory", eventID.String()).Return([]models.EventReschedule{}, nil)
+
+		req := davRequest(http.MethodPut, "/caldav/kevin/standup.ics", calendarObject("standup@client", "20250102T140000", "20250102T160000"))
+		req.Header.Set("If-Match", `"`+eventID.String()+`-3"`)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusNoContent, resp.Code)
+		assert.Equal(t, `"`+eventID.String()+`-4"`, resp.Header().Get("ETag"))
+		assert.Equal(t, "Design review", updated.Title)
+		assert.Len(t, updated.Participants, 2)
+	})
+
+	t.Run("Delete Cancels Event", func(t *testing.T) {
+		mockEventRepo, _, _, router := setup()
+		mockEventRepo.On("CancelEvent", eventID.String(), mock.MatchedBy(func(c models.EventCancellation) bool {
+			return c.CancelledBy == "kevin"
+		})).Return(nil)
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, davRequest(http.MethodDelete, "/caldav/kevin/standup.ics", ""))
+
+		assert.Equal(t, http.StatusNoContent, resp.Code)
+		mockEventRepo.AssertExpectations(t)
+	})
+
+	t.Run("Wrong Password", func(t *testing.T) {
+		mockEventRepo, _, _, router := setup()
+
+		req, _ := http.NewRequest("PROPFIND", "/caldav/kevin/", nil)
+		req.SetBasicAuth("kevin", "guess")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+		assert.Contains(t, resp.Header().Get("WWW-Authenticate"), "Basic")
+		mockEventRepo.AssertNotCalled(t, "GetEventsForUser", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
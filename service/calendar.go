@@ -0,0 +1,155 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+	"timeslot-app/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+type CalendarService struct {
+	EventRepo    repository.EventRepo
+	UserRepo     repository.UserRepo
+	CalendarRepo repository.CalendarRepo
+	ImportRepo   repository.CalendarImportRepo
+	// Events creates and changes the events calendar clients store over CalDAV
+	Events *EventService
+}
+
+func NewCalendarService(db *pgx.ConnPool) *CalendarService {
+	return &CalendarService{
+		EventRepo:    repository.NewEventRepository(db),
+		UserRepo:     repository.NewUserRepo(db),
+		CalendarRepo: repository.NewCalendarRepository(db),
+		ImportRepo:   repository.NewCalendarImportRepository(db),
+		Events:       NewEventService(db),
+	}
+}
+
+// hashCalendarToken is what is stored for a calendar token, a leaked table doesn't give the feeds away
+func hashCalendarToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ShowAccount godoc
+// @Summary      Issue a calendar feed token
+// @Description  Issue a new secret token for the user's iCalendar feed and CalDAV calendar, the previous token stops working.
+// @Description  Only the user and admins may issue it.
+// @Tags         Calendar
+// @Accept       json
+// @Produce      json
+// @Param        username   path   string   true  "User Name"
+// @Success      201  {object}  models.CalendarTokenResponse
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{username}/calendar/token [post]
+func (cs *CalendarService) IssueCalendarToken(ctx *gin.Context) {
+	user, err := cs.UserRepo.Get(requestOrgID(ctx), ctx.Param("username"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating calendar token"})
+		return
+	}
+	token := hex.EncodeToString(secret)
+
+	err = cs.CalendarRepo.SetCalendarTokenHash(user.ID, hashCalendarToken(token), time.Now())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving calendar token"})
+		return
+	}
+
+	feedURL := "/api/v1/users/" + url.PathEscape(user.Name) + "/calendar.ics?token=" + token
+	ctx.JSON(http.StatusCreated, models.CalendarTokenResponse{Token: token, FeedURL: feedURL})
+}
+
+// ShowAccount godoc
+// @Summary      Calendar feed
+// @Description  The events the user owns or takes part in as an RFC 5545 iCalendar feed, for subscribing from calendar clients
+// @Tags         Calendar
+// @Produce      text/calendar
+// @Param        username   path   string   true  "User Name"
+// @Param        token   query   string   true  "Calendar feed token"
+// @Success      200  {string}  string "iCalendar data"
+// @Failure      401  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Router       /users/{username}/calendar.ics [get]
+func (cs *CalendarService) GetCalendarFeed(ctx *gin.Context) {
+	// unknown users and wrong tokens get the same answer so the feed doesn't tell which users exist
+	user, ok := cs.authorizeToken(requestOrgID(ctx), ctx.Param("username"), ctx.Query("token"))
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid calendar token"})
+		return
+	}
+
+	events, err := cs.EventRepo.GetEventsForUser(user.OrgID, user.Name, models.EventFilter{})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching events"})
+		return
+	}
+
+	organizers, err := cs.organizerNames(user, events)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching event organizers"})
+		return
+	}
+
+	feed := utils.RenderICS(user.Name, events, organizers, time.Now())
+	ctx.Header("Content-Disposition", `inline; filename="calendar.ics"`)
+	ctx.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(feed))
+}
+
+// authorizeToken checks a token against the stored hash of the user's calendar token
+func (cs *CalendarService) authorizeToken(orgID uuid.UUID, username, token string) (models.User, bool) {
+	if token == "" {
+		return models.User{}, false
+	}
+
+	user, err := cs.UserRepo.Get(orgID, username)
+	if err != nil {
+		return models.User{}, false
+	}
+
+	stored, err := cs.CalendarRepo.GetCalendarTokenHash(user.ID)
+	if err != nil {
+		return models.User{}, false
+	}
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(hashCalendarToken(token))) != 1 {
+		return models.User{}, false
+	}
+	return user, true
+}
+
+// organizerNames maps the owners of the events to their user names
+func (cs *CalendarService) organizerNames(user models.User, events []models.Event) (map[uuid.UUID]string, error) {
+	organizers := map[uuid.UUID]string{user.ID: user.Name}
+	for _, event := range events {
+		if _, ok := organizers[event.EventOwner]; ok {
+			continue
+		}
+		owner, err := cs.UserRepo.GetByID(user.OrgID, event.EventOwner)
+		if err != nil {
+			return nil, err
+		}
+		organizers[owner.ID] = owner.Name
+	}
+	return organizers, nil
+}
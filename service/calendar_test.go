@@ -0,0 +1,183 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"timeslot-app/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockCalendarRepo struct {
+	mock.Mock
+}
+
+func (m *MockCalendarRepo) SetCalendarTokenHash(userID uuid.UUID, tokenHash string, createdAt time.Time) error {
+	args := m.Called(userID, tokenHash, createdAt)
+	return args.Error(0)
+}
+
+func (m *MockCalendarRepo) GetCalendarTokenHash(userID uuid.UUID) (string, error) {
+	args := m.Called(userID)
+	return args.String(0), args.Error(1)
+}
+
+func TestIssueCalendarToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID, _ := uuid.NewV4()
+
+	mockUserRepo := new(MockUserRepo)
+	mockCalendarRepo := new(MockCalendarRepo)
+	calendarService := &CalendarService{UserRepo: mockUserRepo, CalendarRepo: mockCalendarRepo}
+
+	router := gin.Default()
+	router.Use(withOrg(testOrg))
+
+	router.POST("/users/:username/calendar/token", calendarService.IssueCalendarToken)
+
+	var storedHash string
+	mockUserRepo.On("Get", testOrg.ID, "kevin").Return(models.User{ID: userID, OrgID: testOrg.ID, Name: "kevin"}, nil)
+	mockCalendarRepo.On("SetCalendarTokenHash", userID, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		storedHash = args.String(1)
+	}).Return(nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/users/kevin/calendar/token", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	var body models.CalendarTokenResponse
+	json.Unmarshal(resp.Body.Bytes(), &body)
+	assert.Len(t, body.Token, 64)
+	assert.Equal(t, "/api/v1/users/kevin/calendar.ics?token="+body.Token, body.FeedURL)
+	// only the hash of the token is stored
+	assert.Equal(t, hashCalendarToken(body.Token), storedHash)
+	assert.NotEqual(t, body.Token, storedHash)
+}
+
+func TestGetCalendarFeed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ny, _ := time.LoadLocation("America/New_York")
+	ownerID, _ := uuid.NewV4()
+	kevinID, _ := uuid.NewV4()
+	eventID, _ := uuid.NewV4()
+	start := time.Date(2025, 3, 3, 14, 0, 0, 0, ny)
+	moved := time.Date(2025, 3, 11, 16, 0, 0, 0, ny)
+	movedEnd := moved.Add(time.Hour)
+	event := models.Event{
+		ID:             eventID,
+		Title:          "Standup, daily",
+		EventOwner:     ownerID,
+		EventStartTime: start,
+		EventEndTime:   start.Add(time.Hour),
+		Recurrence:     "FREQ=WEEKLY;BYDAY=MO;COUNT=4",
+		Description:    "Agenda: blockers; demos\nBring coffee. " + strings.Repeat("Long description ", 5),
+		Visibility:     models.EventVisibilityPublic,
+		Status:         models.EventStatusActive,
+		Participants: []models.EventParticipant{
+			{UserID: uuid.NullUUID{UUID: kevinID, Valid: true}, Name: "kevin", Role: models.ParticipantRoleRequired, Status: models.ParticipantStatusAccepted},
+			{Name: "jane@partner.com", Role: models.ParticipantRoleOptional, Status: models.ParticipantStatusNeedsAction, External: true},
+		},
+		Exceptions: []models.EventException{
+			{OriginalStartTime: start.AddDate(0, 0, 7), Cancelled: true},
+			{OriginalStartTime: start.AddDate(0, 0, 14), EventStartTime: &moved, EventEndTime: &movedEnd},
+		},
+	}
+
+	setup := func() (*MockUserRepo, *MockCalendarRepo, *MockEventRepo, *gin.Engine) {
+		mockUserRepo := new(MockUserRepo)
+		mockCalendarRepo := new(MockCalendarRepo)
+		mockEventRepo := new(MockEventRepo)
+		calendarService := &CalendarService{EventRepo: mockEventRepo, UserRepo: mockUserRepo, CalendarRepo: mockCalendarRepo}
+
+		mockUserRepo.On("Get", testOrg.ID, "kevin").Return(models.User{ID: kevinID, OrgID: testOrg.ID, Name: "kevin"}, nil)
+		mockCalendarRepo.On("GetCalendarTokenHash", kevinID).Return(hashCalendarToken("secret"), nil)
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
+		router.GET("/users/:username/calendar.ics", calendarService.GetCalendarFeed)
+		return mockUserRepo, mockCalendarRepo, mockEventRepo, router
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mockUserRepo, _, mockEventRepo, router := setup()
+		mockEventRepo.On("GetEventsForUser", testOrg.ID, "kevin", models.EventFilter{}).Return([]models.Event{event}, nil)
+		mockUserRepo.On("GetByID", testOrg.ID, ownerID).Return(models.User{ID: ownerID, OrgID: testOrg.ID, Name: "eshan"}, nil)
+
+		req, _ := http.NewRequest(http.MethodGet, "/users/kevin/calendar.ics?token=secret", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "text/calendar; charset=utf-8", resp.Header().Get("Content-Type"))
+
+		feed := resp.Body.String()
+		for _, line := range strings.Split(strings.TrimSuffix(feed, "\r\n"), "\r\n") {
+			assert.LessOrEqual(t, len(line), 75, line)
+		}
+		unfolded := strings.ReplaceAll(feed, "\r\n ", "")
+		for _, expected := range []string{
+			"BEGIN:VCALENDAR\r\n",
+			"BEGIN:VTIMEZONE\r\nTZID:America/New_York\r\n",
+			"BEGIN:DAYLIGHT\r\nDTSTART:20250309T020000\r\nRRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=2SU\r\nTZOFFSETFROM:-0500\r\nTZOFFSETTO:-0400\r\n",
+			"BEGIN:STANDARD\r\nDTSTART:20251102T020000\r\nRRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1SU\r\nTZOFFSETFROM:-0400\r\nTZOFFSETTO:-0500\r\n",
+			"UID:" + eventID.String() + "@timeslot-app\r\n",
+			"DTSTART;TZID=America/New_York:20250303T140000\r\n",
+			"DTEND;TZID=America/New_York:20250303T150000\r\n",
+			"RRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=4\r\n",
+			"EXDATE;TZID=America/New_York:20250310T140000\r\n",
+			"RECURRENCE-ID;TZID=America/New_York:20250317T140000\r\n",
+			"DTSTART;TZID=America/New_York:20250311T160000\r\n",
+			"SUMMARY:Standup\\, daily\r\n",
+			"DESCRIPTION:Agenda: blockers\\; demos\\nBring coffee.",
+			"ORGANIZER;CN=eshan:urn:uuid:" + ownerID.String() + "\r\n",
+			"ATTENDEE;CN=kevin;ROLE=REQ-PARTICIPANT;PARTSTAT=ACCEPTED:urn:uuid:" + kevinID.String() + "\r\n",
+			"ATTENDEE;CN=jane@partner.com;ROLE=OPT-PARTICIPANT;PARTSTAT=NEEDS-ACTION:mailto:jane@partner.com\r\n",
+			"END:VCALENDAR\r\n",
+		} {
+			assert.Contains(t, unfolded, expected)
+		}
+		assert.Equal(t, 2, strings.Count(unfolded, "BEGIN:VEVENT"))
+	})
+
+	t.Run("Wrong Token", func(t *testing.T) {
+		_, _, mockEventRepo, router := setup()
+
+		req, _ := http.NewRequest(http.MethodGet, "/users/kevin/calendar.ics?token=guess", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+		mockEventRepo.AssertNotCalled(t, "GetEventsForUser", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("No Token Issued", func(t *testing.T) {
+		mockUserRepo := new(MockUserRepo)
+		mockCalendarRepo := new(MockCalendarRepo)
+		calendarService := &CalendarService{EventRepo: new(MockEventRepo), UserRepo: mockUserRepo, CalendarRepo: mockCalendarRepo}
+
+		mockUserRepo.On("Get", testOrg.ID, "kevin").Return(models.User{ID: kevinID, OrgID: testOrg.ID, Name: "kevin"}, nil)
+		mockCalendarRepo.On("GetCalendarTokenHash", kevinID).Return("", pgx.ErrNoRows)
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
+		router.GET("/users/:username/calendar.ics", calendarService.GetCalendarFeed)
+
+		req, _ := http.NewRequest(http.MethodGet, "/users/kevin/calendar.ics?token=secret", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	})
+}
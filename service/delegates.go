@@ -0,0 +1,242 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx"
+)
+
+// ShowAccount godoc
+// @Summary      Add a delegate
+// @Description  Let another user act for the user within the scopes of the grant. availability lets them create and delete
+// @Description  the user's time slots, events lets them book and cancel events the user owns and private_details lets them
+// @Description  see the details of the user's private events. Without scopes they get availability and events.
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        username   path   string   true  "Username"
+// @Param        body   body   	models.DelegateRequest   true "Delegate request body"
+// @Success      201  {object}  models.Delegate
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      409  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{username}/delegates [post]
+func (us *UserService) AddDelegate(ctx *gin.Context) {
+	var req models.DelegateRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	principal, err := us.userRepo.Get(requestOrgID(ctx), ctx.Param("username"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+		return
+	}
+	delegate, err := us.userRepo.Get(requestOrgID(ctx), req.Delegate)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "unknown user " + req.Delegate})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+		return
+	}
+	if delegate.ID == principal.ID {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "users can't be their own delegate"})
+		return
+	}
+	if req.Scopes == nil {
+		req.Scopes = models.DefaultDelegateScopes
+	}
+	scopes, err := normalizeDelegateScopes(req.Scopes)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	grant := models.Delegate{
+		PrincipalID:  principal.ID,
+		DelegateID:   delegate.ID,
+		DelegateName: delegate.Name,
+		Scopes:       scopes,
+		CreatedAt:    time.Now().UTC(),
+	}
+	err = us.delegateRepo.AddDelegate(grant.PrincipalID, grant.DelegateID, grant.Scopes, grant.CreatedAt)
+	if errors.Is(err, repository.ErrDelegateExists) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding delegate"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, grant)
+}
+
+// ShowAccount godoc
+// @Summary      List delegates
+// @Description  List the users who may act for the user, with the scopes of their grants
+// @Tags         Users
+// @Produce      json
+// @Param        username   path   string   true  "Username"
+// @Success      200  {array}  models.Delegate
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{username}/delegates [get]
+func (us *UserService) ListDelegates(ctx *gin.Context) {
+	principal, err := us.userRepo.Get(requestOrgID(ctx), ctx.Param("username"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+		return
+	}
+
+	delegates, err := us.delegateRepo.ListDelegates(principal.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching delegates"})
+		return
+	}
+	ctx.JSON(http.StatusOK, delegates)
+}
+
+// ShowAccount godoc
+// @Summary      Remove a delegate
+// @Description  Stop another user acting on the user's time slots and events
+// @Tags         Users
+// @Param        username   path   string   true  "Username"
+// @Param        delegate   path   string   true  "Name of the delegate"
+// @Success      204
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{username}/delegates/{delegate} [delete]
+func (us *UserService) RemoveDelegate(ctx *gin.Context) {
+	principal, delegate, ok := us.grantUsers(ctx)
+	if !ok {
+		return
+	}
+
+	err := us.delegateRepo.RemoveDelegate(principal.ID, delegate.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Delegate does not exist"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing delegate"})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// ShowAccount godoc
+// @Summary      Change the scopes of a delegate
+// @Description  Replace what another user may do for the user, see adding a delegate for the scopes
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        username   path   string   true  "Username"
+// @Param        delegate   path   string   true  "Name of the delegate"
+// @Param        body   body   	models.DelegateScopesRequest   true "Delegate scopes request body"
+// @Success      200  {object}  models.Delegate
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{username}/delegates/{delegate} [put]
+func (us *UserService) SetDelegateScopes(ctx *gin.Context) {
+	var req models.DelegateScopesRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	scopes, err := normalizeDelegateScopes(req.Scopes)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	principal, delegate, ok := us.grantUsers(ctx)
+	if !ok {
+		return
+	}
+
+	grant, err := us.delegateRepo.SetDelegateScopes(principal.ID, delegate.ID, scopes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Delegate does not exist"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error changing delegate"})
+		return
+	}
+	ctx.JSON(http.StatusOK, grant)
+}
+
+// grantUsers returns the principal and delegate named by the path, writing an error response and returning false
+// when either doesn't exist
+func (us *UserService) grantUsers(ctx *gin.Context) (models.User, models.User, bool) {
+	users, err := us.userRepo.GetUsersByNames(requestOrgID(ctx), []string{ctx.Param("username"), ctx.Param("delegate")})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+		return models.User{}, models.User{}, false
+	}
+	var principal, delegate models.User
+	for _, user := range users {
+		switch user.Name {
+		case ctx.Param("username"):
+			principal = user
+		case ctx.Param("delegate"):
+			delegate = user
+		}
+	}
+	if principal.Name == "" || delegate.Name == "" {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Delegate does not exist"})
+		return models.User{}, models.User{}, false
+	}
+	return principal, delegate, true
+}
+
+// normalizeDelegateScopes checks the scopes of a grant and drops repeated ones, a grant needs at least one
+func normalizeDelegateScopes(scopes []string) ([]string, error) {
+	normalized := []string{}
+	for _, scope := range scopes {
+		switch scope {
+		case models.DelegateScopeAvailability, models.DelegateScopeEvents, models.DelegateScopePrivateDetails:
+		default:
+			return nil, fmt.Errorf("unknown scope %q, scopes are %s, %s and %s", scope,
+				models.DelegateScopeAvailability, models.DelegateScopeEvents, models.DelegateScopePrivateDetails)
+		}
+		if !slices.Contains(normalized, scope) {
+			normalized = append(normalized, scope)
+		}
+	}
+	if len(normalized) == 0 {
+		return nil, errors.New("a delegate needs at least one scope, remove the delegate instead")
+	}
+	return normalized, nil
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"timeslot-app/middleware"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockDelegateRepo struct {
+	mock.Mock
+}
+
+func (m *MockDelegateRepo) AddDelegate(principalID, delegateID uuid.UUID, scopes []string, createdAt time.Time) error {
+	args := m.Called(principalID, delegateID, scopes, createdAt)
+	return args.Error(0)
+}
+
+func (m *MockDelegateRepo) ListDelegates(principalID uuid.UUID) ([]models.Delegate, error) {
+	args := m.Called(principalID)
+	return args.Get(0).([]models.Delegate), args.Error(1)
+}
+
+func (m *MockDelegateRepo) RemoveDelegate(principalID, delegateID uuid.UUID) error {
+	args := m.Called(principalID, delegateID)
+	return args.Error(0)
+}
+
+func (m *MockDelegateRepo) SetDelegateScopes(principalID, delegateID uuid.UUID, scopes []string) (models.Delegate, error) {
+	args := m.Called(principalID, delegateID, scopes)
+	return args.Get(0).(models.Delegate), args.Error(1)
+}
+
+func (m *MockDelegateRepo) IsDelegate(principalID, delegateID uuid.UUID, scope string) (bool, error) {
+	args := m.Called(principalID, delegateID, scope)
+	return args.Bool(0), args.Error(1)
+}
+
+func TestDelegates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	kevin := models.User{ID: uuid.Must(uuid.NewV4()), Name: "kevin"}
+	anna := models.User{ID: uuid.Must(uuid.NewV4()), Name: "anna"}
+
+	newRouter := func() (*gin.Engine, *MockDelegateRepo) {
+		userRepo := new(MockUserRepo)
+		userRepo.On("Get", testOrg.ID, "kevin").Return(kevin, nil)
+		userRepo.On("Get", testOrg.ID, "anna").Return(anna, nil)
+		userRepo.On("Get", testOrg.ID, mock.Anything).Return(models.User{}, pgx.ErrNoRows)
+		userRepo.On("GetUsersByNames", testOrg.ID, []string{"kevin", "anna"}).Return([]models.User{anna, kevin}, nil)
+		userRepo.On("GetUsersByNames", testOrg.ID, mock.Anything).Return([]models.User{kevin}, nil)
+		delegateRepo := new(MockDelegateRepo)
+		userService := &UserService{userRepo: userRepo, delegateRepo: delegateRepo}
+
+		router := gin.New()
+		router.Use(withOrg(testOrg))
+
+		router.POST("/users/:username/delegates", userService.AddDelegate)
+		router.GET("/users/:username/delegates", userService.ListDelegates)
+		router.PUT("/users/:username/delegates/:delegate", userService.SetDelegateScopes)
+		router.DELETE("/users/:username/delegates/:delegate", userService.RemoveDelegate)
+		return router, delegateRepo
+	}
+
+	t.Run("Add", func(t *testing.T) {
+		router, delegateRepo := newRouter()
+		delegateRepo.On("AddDelegate", kevin.ID, anna.ID, models.DefaultDelegateScopes, mock.Anything).Return(nil)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/users/kevin/delegates", models.DelegateRequest{Delegate: "anna"}))
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `"delegate_name":"anna"`)
+		assert.Contains(t, recorder.Body.String(), `"scopes":["availability","events"]`)
+		delegateRepo.AssertExpectations(t)
+	})
+
+	t.Run("Add With Scopes", func(t *testing.T) {
+		router, delegateRepo := newRouter()
+		delegateRepo.On("AddDelegate", kevin.ID, anna.ID, []string{"events", "private_details"}, mock.Anything).Return(nil)
+
+		body := models.DelegateRequest{Delegate: "anna", Scopes: []string{"events", "private_details", "events"}}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/users/kevin/delegates", body))
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		delegateRepo.AssertExpectations(t)
+	})
+
+	t.Run("Invalid Scopes", func(t *testing.T) {
+		router, delegateRepo := newRouter()
+		for _, scopes := range [][]string{{}, {"calendar"}} {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/users/kevin/delegates", models.DelegateRequest{Delegate: "anna", Scopes: scopes}))
+			assert.Equal(t, http.StatusBadRequest, recorder.Code, scopes)
+
+			recorder = httptest.NewRecorder()
+			router.ServeHTTP(recorder, newJSONRequest(http.MethodPut, "/users/kevin/delegates/anna", models.DelegateScopesRequest{Scopes: scopes}))
+			assert.Equal(t, http.StatusBadRequest, recorder.Code, scopes)
+		}
+		delegateRepo.AssertNotCalled(t, "AddDelegate", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		delegateRepo.AssertNotCalled(t, "SetDelegateScopes", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Change Scopes", func(t *testing.T) {
+		router, delegateRepo := newRouter()
+		scopes := []string{models.DelegateScopePrivateDetails}
+		delegateRepo.On("SetDelegateScopes", kevin.ID, anna.ID, scopes).
+			Return(models.Delegate{PrincipalID: kevin.ID, DelegateID: anna.ID, DelegateName: "anna", Scopes: scopes}, nil)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPut, "/users/kevin/delegates/anna", models.DelegateScopesRequest{Scopes: scopes}))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `"scopes":["private_details"]`)
+
+		recorder = httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPut, "/users/kevin/delegates/nobody", models.DelegateScopesRequest{Scopes: scopes}))
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+		delegateRepo.AssertExpectations(t)
+	})
+
+	t.Run("Add Twice", func(t *testing.T) {
+		router, delegateRepo := newRouter()
+		delegateRepo.On("AddDelegate", kevin.ID, anna.ID, mock.Anything, mock.Anything).Return(repository.ErrDelegateExists)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/users/kevin/delegates", models.DelegateRequest{Delegate: "anna"}))
+		assert.Equal(t, http.StatusConflict, recorder.Code)
+	})
+
+	t.Run("Invalid Delegate", func(t *testing.T) {
+		router, delegateRepo := newRouter()
+		for _, name := range []string{"kevin", "nobody"} {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/users/kevin/delegates", models.DelegateRequest{Delegate: name}))
+			assert.Equal(t, http.StatusBadRequest, recorder.Code, name)
+		}
+		delegateRepo.AssertNotCalled(t, "AddDelegate", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		router, delegateRepo := newRouter()
+		delegateRepo.On("ListDelegates", kevin.ID).Return([]models.Delegate{{PrincipalID: kevin.ID, DelegateID: anna.ID, DelegateName: "anna"}}, nil)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodGet, "/users/kevin/delegates", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `"delegate_name":"anna"`)
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		router, delegateRepo := newRouter()
+		delegateRepo.On("RemoveDelegate", kevin.ID, anna.ID).Return(nil)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodDelete, "/users/kevin/delegates/anna", nil))
+		assert.Equal(t, http.StatusNoContent, recorder.Code)
+
+		recorder = httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodDelete, "/users/kevin/delegates/nobody", nil))
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+		delegateRepo.AssertExpectations(t)
+	})
+}
+
+func TestSetUserRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	kevin := models.User{ID: uuid.Must(uuid.NewV4()), Name: "kevin", Role: models.RoleMember}
+
+	userRepo := new(MockUserRepo)
+	userRepo.On("Get", testOrg.ID, "kevin").Return(kevin, nil)
+	userRepo.On("Get", testOrg.ID, mock.Anything).Return(models.User{}, pgx.ErrNoRows)
+	userRepo.On("SetRole", kevin.ID, models.RoleViewer).Return(nil)
+	userService := &UserService{userRepo: userRepo}
+
+	router := gin.New()
+	router.Use(withOrg(testOrg))
+
+	router.PUT("/users/:username/role", userService.SetUserRole)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, newJSONRequest(http.MethodPut, "/users/kevin/role", models.UserRoleRequest{Role: models.RoleViewer}))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"role":"viewer"`)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, newJSONRequest(http.MethodPut, "/users/kevin/role", models.UserRoleRequest{Role: "owner"}))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, newJSONRequest(http.MethodPut, "/users/nobody/role", models.UserRoleRequest{Role: models.RoleAdmin}))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	userRepo.AssertExpectations(t)
+}
+
+func TestDelegatedScheduling(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	timeSlot := "02 Jan 2025 2-4 PM MST"
+	kevin := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "kevin", Role: models.RoleMember}
+	anna := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "anna", Role: models.RoleMember}
+	marco := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "marco", Role: models.RoleMember}
+	as := func(user models.User) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			middleware.SetIdentity(c, models.Identity{UserID: user.ID, OrgID: user.OrgID, UserName: user.Name, Role: user.Role})
+		}
+	}
+
+	mockUserRepo := new(MockUserRepo)
+	mockUserRepo.On("Get", testOrg.ID, "kevin").Return(kevin, nil)
+	mockUserRepo.On("Get", testOrg.ID, "anna").Return(anna, nil)
+	mockUserRepo.On("GetUsersByNames", testOrg.ID, []string{"marco"}).Return([]models.User{marco}, nil)
+	// anna is kevin's assistant with every scope, private details included
+	mockDelegateRepo := new(MockDelegateRepo)
+	mockDelegateRepo.On("IsDelegate", kevin.ID, anna.ID, mock.Anything).Return(true, nil)
+	mockDelegateRepo.On("IsDelegate", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	policy := &middleware.Policy{UserRepo: mockUserRepo, DelegateRepo: mockDelegateRepo}
+
+	t.Run("Create Event", func(t *testing.T) {
+		mockEventRepo := new(MockEventRepo)
+		mockEventRepo.On("GetConflictingEvents", mock.Anything, mock.Anything, uuid.Nil).Return([]models.EventConflict(nil), nil)
+		mockEventRepo.On("CreateEvent", mock.Anything).Return(nil)
+		mockTimeslotRepo := new(MockTimeslotRepo)
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "kevin").Return([]string{timeSlot}, nil)
+		eventService := &EventService{EventRepo: mockEventRepo, TimeslotRepo: mockTimeslotRepo, UserRepo: mockUserRepo}
+
+		for _, caller := range []models.User{kevin, anna} {
+			router := gin.New()
+			router.Use(withOrg(testOrg), as(caller))
+			router.POST("/events", eventService.CreateEvent)
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, newEventRequest(models.EventRequest{
+				Title: "Board prep " + caller.Name, EventOwner: "kevin", EventTimeSlot: timeSlot, Participants: []string{"marco"},
+			}))
+			assert.Equal(t, http.StatusCreated, recorder.Code, caller.Name)
+		}
+
+		mockEventRepo.AssertCalled(t, "CreateEvent", mock.MatchedBy(func(event models.Event) bool {
+			return event.Title == "Board prep kevin" && event.EventOwner == kevin.ID && event.ActingDelegate == ""
+		}))
+		mockEventRepo.AssertCalled(t, "CreateEvent", mock.MatchedBy(func(event models.Event) bool {
+			return event.Title == "Board prep anna" && event.EventOwner == kevin.ID && event.ActingDelegate == "anna"
+		}))
+	})
+
+	t.Run("Cancel Event", func(t *testing.T) {
+		eventID := uuid.Must(uuid.NewV4()).String()
+		mockEventRepo := new(MockEventRepo)
+		mockEventRepo.On("GetEvent", testOrg.ID, eventID).Return(models.Event{EventOwner: kevin.ID, Status: models.EventStatusActive}, nil)
+		mockEventRepo.On("CancelEvent", eventID, mock.Anything).Return(nil)
+		eventService := &EventService{EventRepo: mockEventRepo, UserRepo: mockUserRepo}
+
+		router := gin.New()
+		router.Use(withOrg(testOrg), as(anna))
+		router.DELETE("/events/:eventID", eventService.DeleteEvent)
+		req, _ := http.NewRequest(http.MethodDelete, "/events/"+eventID, nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		mockEventRepo.AssertCalled(t, "CancelEvent", eventID, mock.MatchedBy(func(c models.EventCancellation) bool {
+			return c.CancelledBy == "anna"
+		}))
+	})
+
+	t.Run("Private Details", func(t *testing.T) {
+		start := time.Date(2025, 1, 6, 14, 0, 0, 0, time.UTC)
+		mockEventRepo := new(MockEventRepo)
+		mockEventRepo.On("GetEventPageForUser", testOrg.ID, "kevin", models.EventFilter{}, mock.Anything).Return([]models.Event{{
+			ID: uuid.Must(uuid.NewV4()), Title: "Doctor", Description: "annual checkup", EventOwner: kevin.ID,
+			Visibility: models.EventVisibilityPrivate, Status: models.EventStatusActive, EventStartTime: start, EventEndTime: start.Add(time.Hour),
+		}, {
+			ID: uuid.Must(uuid.NewV4()), Title: "Hiring sync", EventOwner: kevin.ID, Visibility: models.EventVisibilityPrivate,
+			Status: models.EventStatusActive, EventStartTime: start.Add(2 * time.Hour), EventEndTime: start.Add(3 * time.Hour),
+			Participants: []models.EventParticipant{{UserID: uuid.NullUUID{UUID: marco.ID, Valid: true}, Name: "marco"}},
+		}}, 2, nil)
+		eventService := &EventService{EventRepo: mockEventRepo, UserRepo: mockUserRepo}
+
+		list := func(caller models.User) string {
+			router := gin.New()
+			router.Use(withOrg(testOrg), as(caller))
+			router.GET("/events/:username", policy.Permit(middleware.ActionViewPrivate, middleware.UserInPath("events", "username")),
+				eventService.GetEventsForUser)
+			req, _ := http.NewRequest(http.MethodGet, "/events/kevin", nil)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusOK, recorder.Code, caller.Name)
+			return recorder.Body.String()
+		}
+
+		for _, caller := range []models.User{kevin, anna} {
+			body := list(caller)
+			assert.Contains(t, body, `"title":"Doctor"`, caller.Name)
+			assert.Contains(t, body, "annual checkup", caller.Name)
+		}
+
+		// marco only sees the details of the event they attend
+		body := list(marco)
+		assert.NotContains(t, body, "Doctor")
+		assert.NotContains(t, body, "annual checkup")
+		assert.Contains(t, body, `"title":"Busy"`)
+		assert.Contains(t, body, `"title":"Hiring sync"`)
+	})
+
+	t.Run("Private Event", func(t *testing.T) {
+		start := time.Date(2025, 1, 6, 14, 0, 0, 0, time.UTC)
+		eventID := uuid.Must(uuid.NewV4())
+		mockEventRepo := new(MockEventRepo)
+		mockEventRepo.On("GetEvent", testOrg.ID, eventID.String()).Return(models.Event{
+			ID: eventID, Title: "Doctor", Description: "annual checkup", EventOwner: kevin.ID,
+			Visibility: models.EventVisibilityPrivate, Status: models.EventStatusActive, EventStartTime: start, EventEndTime: start.Add(time.Hour),
+		}, nil)
+		mockEventRepo.On("GetRescheduleHistory", eventID.String()).Return([]models.EventReschedule{{
+			PreviousStartTime: start.Add(-time.Hour), PreviousEndTime: start, NewStartTime: start, NewEndTime: start.Add(time.Hour),
+		}}, nil)
+		mockUserRepo.On("GetByID", testOrg.ID, kevin.ID).Return(kevin, nil)
+		eventService := &EventService{EventRepo: mockEventRepo, UserRepo: mockUserRepo}
+		eventPolicy := &middleware.Policy{UserRepo: mockUserRepo, DelegateRepo: mockDelegateRepo, EventRepo: mockEventRepo}
+
+		get := func(caller models.User) string {
+			router := gin.New()
+			router.Use(withOrg(testOrg), as(caller))
+			router.GET("/events/:eventID", eventPolicy.Permit(middleware.ActionViewPrivate, middleware.EventInPath("eventID")),
+				eventService.GetEvent)
+			req, _ := http.NewRequest(http.MethodGet, "/events/"+eventID.String(), nil)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusOK, recorder.Code, caller.Name)
+			return recorder.Body.String()
+		}
+
+		for _, caller := range []models.User{kevin, anna} {
+			body := get(caller)
+			assert.Contains(t, body, `"title":"Doctor"`, caller.Name)
+			assert.Contains(t, body, "annual checkup", caller.Name)
+			assert.Contains(t, body, "reschedule_history", caller.Name)
+		}
+
+		// marco neither attends nor is kevin's delegate, they only see the time
+		body := get(marco)
+		assert.NotContains(t, body, "Doctor")
+		assert.NotContains(t, body, "annual checkup")
+		assert.NotContains(t, body, "reschedule_history")
+		assert.Contains(t, body, `"title":"Busy"`)
+	})
+}
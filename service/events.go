@@ -1,7 +1,16 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"timeslot-app/middleware"
 	"timeslot-app/models"
 	"timeslot-app/repository"
 	"timeslot-app/utils"
@@ -11,30 +20,49 @@ import (
 	"github.com/jackc/pgx"
 )
 
+// SlotRecommender finds time slots that suit an organizer and a set of participants
+type SlotRecommender interface {
+	RecommendSlotsReconciler(ctx *gin.Context, organizer string, participants []string, eventDuration time.Duration) ([]models.TimeSlotStartAndEnd, []models.MatchingEventSlots, error)
+}
+
 type EventService struct {
 	EventRepo    repository.EventRepo
 	TimeslotRepo repository.TimeslotRepo
 	UserRepo     repository.UserRepo
+	ProfileRepo  repository.ProfileRepo
+	GroupRepo    repository.GroupRepo
+	Recommender  SlotRecommender
+	Webhooks     WebhookPublisher
 }
 
-func NewEventService(db *pgx.Conn) *EventService {
+func NewEventService(db *pgx.ConnPool) *EventService {
 	return &EventService{
 		EventRepo:    repository.NewEventRepository(db),
 		UserRepo:     repository.NewUserRepo(db),
 		TimeslotRepo: repository.NewTimeslotRepository(db),
+		ProfileRepo:  repository.NewProfileRepository(db),
+		GroupRepo:    repository.NewGroupRepository(db),
+		Recommender:  Init(db),
+		Webhooks:     NewWebhookOutbox(db),
 	}
 }
 
 // ShowAccount godoc
 // @Summary      Create a Event
-// @Description  Create a new Event
+// @Description  Create a new Event, the time slot has to lie within the availability the owner has published. Delegates of the
+// @Description  owner with the events scope may create it for them, the event records who booked it as its acting delegate.
+// @Description  A recurrence may expand to at most 500 occurrences, a longer one is refused with a 400.
 // @Tags         Events
 // @Accept       json
 // @Produce      json
 // @Param        body   body   	models.EventRequest   true "Create Event request body"
 // @Success      200  {object}  string "Event created successfully"
 // @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      409  {object}  models.EventConflictResponse
 // @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /events [post]
 func (es *EventService) CreateEvent(ctx *gin.Context) {
 	var eventReq models.EventRequest
@@ -43,79 +71,350 @@ func (es *EventService) CreateEvent(ctx *gin.Context) {
 		return
 	}
 
-	event := models.Event{}
+	if _, ok := es.createEvent(ctx, eventReq, models.Event{}); !ok {
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"message": "Event created successfully"})
+}
+
+// createEvent validates a create request and stores the event, writing an error response and returning false when
+// it can't be created. Base carries what the request can't express, such as the UID a calendar client gave the event.
+func (es *EventService) createEvent(ctx *gin.Context, eventReq models.EventRequest, base models.Event) (models.Event, bool) {
+	event := base
 
-	eventID, _ := uuid.NewV4()
-	event.ID = eventID
+	if event.ID == uuid.Nil {
+		event.ID, _ = uuid.NewV4()
+	}
+	event.Status = models.EventStatusActive
 
 	if eventReq.EventOwner == "" {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Event created by is required"})
-		return
+		return event, false
 	}
 
-	user, err := es.UserRepo.Get(eventReq.EventOwner)
+	user, err := es.UserRepo.Get(requestOrgID(ctx), eventReq.EventOwner)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Event owner does not exist"})
-		return
+		return event, false
 	}
 	event.EventOwner = user.ID
+	if identity, found := middleware.CurrentIdentity(ctx); found && identity.UserID != user.ID {
+		event.ActingDelegate = identity.UserName
+	}
 
 	if eventReq.Title == "" {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Event title is required"})
-		return
+		return event, false
 	}
 
 	event.Title = eventReq.Title
 
 	if eventReq.Participants == nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Event participants are required"})
-		return
+		return event, false
 	}
 
 	if eventReq.EventTimeSlot == "" {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Event time slot is required"})
-		return
+		return event, false
 	}
-	startTime, endTime, valid := utils.ValidateAndFormatTimeStamp(eventReq.EventTimeSlot)
+	profile, err := profileOf(es.ProfileRepo, requestOrgID(ctx), user.Name)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching event owner profile"})
+		return event, false
+	}
+	startTime, endTime, valid := utils.ValidateAndFormatTimeStamp(utils.WithDefaultZone(eventReq.EventTimeSlot, profile.TimeZone))
 	if !valid {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time slot format"})
-		return
+		return event, false
 	}
+	event.EventStartTime = startTime
+	event.EventEndTime = endTime
 
-	// check if the user requesting the event time has a timeslot
+	if eventReq.Recurrence != "" {
+		rule, err := utils.ParseRRule(eventReq.Recurrence)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return event, false
+		}
+		event.Recurrence = rule.String()
+	}
 
-	userTimeSlots, err := es.TimeslotRepo.GetTimeSlotsByUserName(eventReq.EventOwner)
+	// check if the user requesting the event time has a timeslot for every occurrence
+	slots, err := utils.EventSlots(event)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching user time slots"})
-		return
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return event, false
 	}
-	if len(userTimeSlots) == 0 {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "user does not have any time slots"})
-		return
+	if !es.checkOwnerAvailability(ctx, eventReq.EventOwner, slots, nil) {
+		return event, false
 	}
 
-	if !utils.SearchString(userTimeSlots, eventReq.EventTimeSlot) {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "user does not have the requested time slot"})
-		return
+	participants, ok := es.resolveParticipants(ctx, user.Name, eventReq.Participants, eventReq.OptionalParticipants, eventReq.ExternalGuests, nil)
+	if !ok {
+		return event, false
 	}
 
-	event.EventStartTime = startTime
-	event.EventEndTime = endTime
-	event.Participants = eventReq.Participants
+	event.Participants = participants
+	event.Forced = eventReq.Force
+	event.Description = eventReq.Description
+	event.Location = eventReq.Location
+	event.ConferenceURL = eventReq.ConferenceURL
+	event.Visibility = eventReq.Visibility
+	event.Labels = eventReq.Labels
+	if event.Visibility == "" {
+		event.Visibility = models.EventVisibilityPublic
+	}
+	if err := validateEventDetails(event); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return event, false
+	}
+
+	// without reminders of its own the event uses each attendee's default reminders
+	event.Reminders, err = utils.NormalizeReminderOffsets(eventReq.Reminders)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return event, false
+	}
+
+	// make sure neither the owner nor any participant is already booked, unless the caller forces it
+	if !eventReq.Force {
+		if !es.checkConflicts(ctx, event, uuid.Nil) {
+			return event, false
+		}
+	}
 
 	err = es.EventRepo.CreateEvent(event)
+	if errors.Is(err, repository.ErrEventConflict) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return event, false
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return event, false
 	}
 
-	ctx.JSON(http.StatusCreated, gin.H{"message": "Event created successfully"})
+	event.Version = 1
+	publishWebhook(es.Webhooks, requestOrgID(ctx), models.WebhookEventCreated, event)
+	return event, true
+}
+
+// checkOwnerAvailability writes an error response and returns false when any of the event slots isn't covered by the
+// availability the owner has published. ownSlots are the current slots of an event being moved, the availability
+// they consumed counts as free again.
+func (es *EventService) checkOwnerAvailability(ctx *gin.Context, owner string, slots, ownSlots []models.TimeSlotStartAndEnd) bool {
+	userTimeSlots, err := es.TimeslotRepo.GetTimeSlotsByUserName(requestOrgID(ctx), owner)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching user time slots"})
+		return false
+	}
+	if len(userTimeSlots) == 0 && len(ownSlots) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "user does not have any time slots"})
+		return false
+	}
+
+	available := slices.Clone(ownSlots)
+	for _, timeSlot := range userTimeSlots {
+		ss, se, valid := utils.ValidateAndFormatTimeStamp(timeSlot)
+		if !valid {
+			continue
+		}
+		available = append(available, models.TimeSlotStartAndEnd{StartTime: ss, EndTime: se})
+	}
+
+	for _, slot := range slots {
+		if !utils.IsCoveredBy(slot, available) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("user is not available for the whole requested time slot on %s", slot.StartTime.Format(time.RFC3339))})
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	maxEventLabels      = 50
+	maxLabelKeyLength   = 64
+	maxLabelValueLength = 256
+)
+
+// validateEventDetails checks the descriptive fields of an event, the conference URL has to be an absolute http(s) URL
+func validateEventDetails(event models.Event) error {
+	if event.Visibility != models.EventVisibilityPublic && event.Visibility != models.EventVisibilityPrivate {
+		return errors.New("visibility must be public or private")
+	}
+
+	if event.ConferenceURL != "" {
+		u, err := url.Parse(event.ConferenceURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("conference_url must be an http or https URL")
+		}
+	}
+
+	if len(event.Labels) > maxEventLabels {
+		return fmt.Errorf("an event can have at most %d labels", maxEventLabels)
+	}
+	for key, value := range event.Labels {
+		if key == "" || len(key) > maxLabelKeyLength {
+			return fmt.Errorf("label keys must be between 1 and %d characters", maxLabelKeyLength)
+		}
+		if len(value) > maxLabelValueLength {
+			return fmt.Errorf("label %q is longer than %d characters", key, maxLabelValueLength)
+		}
+	}
+	return nil
+}
+
+// resolveParticipants turns participant names into event participants, every required and optional name has to
+// be a registered user or a group while guests are recorded as external. Groups are expanded to their members now,
+// each participant records the group they came from, and the owner isn't invited to their own event by a group.
+// Responses of participants already on the event are kept. An error response is written and false returned when
+// a name is unknown.
+func (es *EventService) resolveParticipants(ctx *gin.Context, owner string, required, optional, guests []string, existing []models.EventParticipant) ([]models.EventParticipant, bool) {
+	via := map[string]string{}
+	for _, list := range []*[]string{&required, &optional} {
+		expanded, groups, err := expandParticipants(es.GroupRepo, requestOrgID(ctx), *list)
+		if errors.Is(err, errUnknownGroup) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error expanding groups"})
+			return nil, false
+		}
+		*list = slices.DeleteFunc(expanded, func(name string) bool { return name == owner && groups[name] != "" })
+		for name, group := range groups {
+			if _, found := via[name]; !found {
+				via[name] = group
+			}
+		}
+	}
+
+	names := append(slices.Clone(required), optional...)
+	users, err := es.UserRepo.GetUsersByNames(requestOrgID(ctx), names)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching participants"})
+		return nil, false
+	}
+
+	usersByName := make(map[string]models.User, len(users))
+	for _, user := range users {
+		usersByName[user.Name] = user
+	}
+
+	unknown := []string{}
+	for _, name := range names {
+		if _, found := usersByName[name]; !found && !slices.Contains(unknown, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown participants: %s, list them as external_guests to invite them as guests", strings.Join(unknown, ", "))})
+		return nil, false
+	}
+
+	participants := []models.EventParticipant{}
+	seen := map[string]bool{}
+	add := func(participant models.EventParticipant) {
+		key := participantKey(participant)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+
+		participant.Status = models.ParticipantStatusNeedsAction
+		participant.ID, _ = uuid.NewV4()
+		for _, p := range existing {
+			if participantKey(p) == key {
+				role, group := participant.Role, participant.Group
+				participant = p
+				participant.Role, participant.Group = role, group
+			}
+		}
+		participants = append(participants, participant)
+	}
+
+	for _, name := range required {
+		add(models.EventParticipant{UserID: uuid.NullUUID{UUID: usersByName[name].ID, Valid: true}, Name: name, Role: models.ParticipantRoleRequired, Group: via[name]})
+	}
+	for _, name := range optional {
+		add(models.EventParticipant{UserID: uuid.NullUUID{UUID: usersByName[name].ID, Valid: true}, Name: name, Role: models.ParticipantRoleOptional, Group: via[name]})
+	}
+	for _, name := range guests {
+		add(models.EventParticipant{Name: name, Role: models.ParticipantRoleRequired, External: true})
+	}
+	return participants, true
+}
+
+// participantKey identifies a participant across updates, users by id and guests by name
+func participantKey(p models.EventParticipant) string {
+	if p.UserID.Valid {
+		return p.UserID.UUID.String()
+	}
+	return "guest:" + p.Name
+}
+
+// sameParticipants reports whether both lists invite the same people in the same roles
+func sameParticipants(a, b []models.EventParticipant) bool {
+	keys := func(participants []models.EventParticipant) []string {
+		k := make([]string, 0, len(participants))
+		for _, p := range participants {
+			k = append(k, participantKey(p)+"/"+p.Role)
+		}
+		slices.Sort(k)
+		return k
+	}
+	return slices.Equal(keys(a), keys(b))
+}
+
+// attendeeIDs returns the users whose calendars an event occupies, the owner and every registered participant
+func attendeeIDs(event models.Event) []uuid.UUID {
+	ids := []uuid.UUID{event.EventOwner}
+	for _, p := range event.Participants {
+		if p.UserID.Valid && !slices.Contains(ids, p.UserID.UUID) {
+			ids = append(ids, p.UserID.UUID)
+		}
+	}
+	return ids
+}
+
+// checkConflicts writes a 409 naming every conflict and returns false when any attendee is already
+// booked during the event, or during any of its occurrences when it recurs
+func (es *EventService) checkConflicts(ctx *gin.Context, event models.Event, excludeEventID uuid.UUID) bool {
+	slots, err := utils.EventSlots(event)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	conflicts, err := es.EventRepo.GetConflictingEvents(attendeeIDs(event), slots, excludeEventID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error checking event conflicts"})
+		return false
+	}
+	if len(conflicts) > 0 {
+		ctx.JSON(http.StatusConflict, models.EventConflictResponse{
+			Error:     describeConflicts(conflicts),
+			Conflicts: conflicts,
+		})
+		return false
+	}
+	return true
+}
+
+// describeConflicts names every conflicting booking in a single message
+func describeConflicts(conflicts []models.EventConflict) string {
+	descriptions := make([]string, 0, len(conflicts))
+	for _, c := range conflicts {
+		descriptions = append(descriptions, fmt.Sprintf("%s is already booked for %q from %s to %s",
+			c.Attendee, c.Title, c.EventStartTime.Format(time.RFC3339), c.EventEndTime.Format(time.RFC3339)))
+	}
+	return "event conflicts with existing bookings: " + strings.Join(descriptions, "; ")
 }
 
 // func (es *EventService) GetEvents(ctx *gin.Context) {
 
 // 	username := ctx.Query("username")
-// 	events, err := es.EventRepo.GetEventsForUser(username)
+// 	events, err := es.EventRepo.GetEventsForUser(requestOrgID(ctx), username)
 // 	if err != nil {
 // 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 // 		return
@@ -125,69 +424,484 @@ func (es *EventService) CreateEvent(ctx *gin.Context) {
 // }
 
 // ShowAccount godoc
-// @Summary      Delete a Event
-// @Description  Delete a Event
+// @Summary      Update a Event
+// @Description  Update the title, time or participants of an Event, fields left out of the body are kept
+// @Tags         Events
+// @Accept       json
+// @Produce      json
+// @Param        eventID   path   string   true  "Event ID"
+// @Param        body   body   	models.EventUpdateRequest   true "Update Event request body"
+// @Success      200  {object}  models.Event
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      409  {object}  models.EventConflictResponse
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /events/{eventID} [patch]
+func (es *EventService) UpdateEvent(ctx *gin.Context) {
+	es.updateEvent(ctx, false)
+}
+
+// ShowAccount godoc
+// @Summary      Replace a Event
+// @Description  Replace the title, time and participants of an Event
+// @Tags         Events
+// @Accept       json
+// @Produce      json
+// @Param        eventID   path   string   true  "Event ID"
+// @Param        body   body   	models.EventUpdateRequest   true "Replace Event request body"
+// @Success      200  {object}  models.Event
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      409  {object}  models.EventConflictResponse
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /events/{eventID} [put]
+func (es *EventService) ReplaceEvent(ctx *gin.Context) {
+	es.updateEvent(ctx, true)
+}
+
+// updateEvent applies an update request to an event, a replace requires every field to be present
+func (es *EventService) updateEvent(ctx *gin.Context, replace bool) {
+	eventID := ctx.Param("eventID")
+	if _, err := uuid.FromString(eventID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	var updateReq models.EventUpdateRequest
+	if err := ctx.BindJSON(&updateReq); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, ok := es.applyEventUpdate(ctx, eventID, updateReq, replace)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"event": updated})
+}
+
+// applyEventUpdate validates an update request against the stored event and saves the result, writing an error
+// response and returning false when the update is refused
+func (es *EventService) applyEventUpdate(ctx *gin.Context, eventID string, updateReq models.EventUpdateRequest, replace bool) (models.Event, bool) {
+	if replace && (updateReq.Title == nil || updateReq.EventTimeSlot == nil || updateReq.Participants == nil) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Event title, time slot and participants are required"})
+		return models.Event{}, false
+	}
+
+	existing, err := es.EventRepo.GetEvent(requestOrgID(ctx), eventID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return models.Event{}, false
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return models.Event{}, false
+	}
+	if existing.Status == models.EventStatusCancelled {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Event is cancelled, restore it before changing it"})
+		return models.Event{}, false
+	}
+
+	owner, err := es.UserRepo.GetByID(requestOrgID(ctx), existing.EventOwner)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching event owner"})
+		return models.Event{}, false
+	}
+
+	updated := existing
+	if updateReq.Title != nil {
+		if *updateReq.Title == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Event title is required"})
+			return models.Event{}, false
+		}
+		updated.Title = *updateReq.Title
+	}
+
+	// PUT replaces the descriptive fields as a whole, anything left out goes back to its default
+	if replace {
+		updated.Description, updated.Location, updated.ConferenceURL = "", "", ""
+		updated.Visibility = models.EventVisibilityPublic
+		updated.Labels = nil
+		updated.Reminders = nil
+	}
+	if updateReq.Description != nil {
+		updated.Description = *updateReq.Description
+	}
+	if updateReq.Location != nil {
+		updated.Location = *updateReq.Location
+	}
+	if updateReq.ConferenceURL != nil {
+		updated.ConferenceURL = *updateReq.ConferenceURL
+	}
+	if updateReq.Visibility != nil {
+		updated.Visibility = *updateReq.Visibility
+	}
+	if updateReq.Labels != nil {
+		updated.Labels = updateReq.Labels
+	}
+	if err := validateEventDetails(updated); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return models.Event{}, false
+	}
+	if updateReq.Reminders != nil {
+		reminders, err := utils.NormalizeReminderOffsets(updateReq.Reminders)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return models.Event{}, false
+		}
+		updated.Reminders = reminders
+	}
+
+	participantsChanged := false
+	if updateReq.Participants != nil || updateReq.OptionalParticipants != nil || updateReq.ExternalGuests != nil {
+		participants, ok := es.resolveParticipants(ctx, owner.Name, updateReq.Participants, updateReq.OptionalParticipants, updateReq.ExternalGuests, existing.Participants)
+		if !ok {
+			return models.Event{}, false
+		}
+		updated.Participants = participants
+		participantsChanged = !sameParticipants(existing.Participants, participants)
+	}
+
+	var reschedule *models.EventReschedule
+	if updateReq.EventTimeSlot != nil {
+		profile, err := profileOf(es.ProfileRepo, requestOrgID(ctx), owner.Name)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching event owner profile"})
+			return models.Event{}, false
+		}
+		startTime, endTime, valid := utils.ValidateAndFormatTimeStamp(utils.WithDefaultZone(*updateReq.EventTimeSlot, profile.TimeZone))
+		if !valid {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time slot format"})
+			return models.Event{}, false
+		}
+
+		if !startTime.Equal(existing.EventStartTime) || !endTime.Equal(existing.EventEndTime) {
+			rescheduleID, _ := uuid.NewV4()
+			reschedule = &models.EventReschedule{
+				ID:                rescheduleID,
+				EventID:           existing.ID,
+				PreviousStartTime: existing.EventStartTime,
+				PreviousEndTime:   existing.EventEndTime,
+				NewStartTime:      startTime,
+				NewEndTime:        endTime,
+				Reason:            updateReq.Reason,
+				RescheduledAt:     time.Now().UTC(),
+			}
+			updated.EventStartTime = startTime
+			updated.EventEndTime = endTime
+
+			// answers were given for the old time, everyone has to respond again
+			updated.Participants = slices.Clone(updated.Participants)
+			for i := range updated.Participants {
+				updated.Participants[i].Status = models.ParticipantStatusNeedsAction
+				updated.Participants[i].Comment = ""
+				updated.Participants[i].ProposedStartTime = nil
+				updated.Participants[i].ProposedEndTime = nil
+				updated.Participants[i].RespondedAt = nil
+			}
+		}
+	}
+
+	recurrenceChanged := false
+	if updateReq.Recurrence != nil {
+		updated.Recurrence = ""
+		if *updateReq.Recurrence != "" {
+			rule, err := utils.ParseRRule(*updateReq.Recurrence)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return models.Event{}, false
+			}
+			updated.Recurrence = rule.String()
+		}
+		recurrenceChanged = updated.Recurrence != existing.Recurrence
+	}
+
+	// exceptions point at occurrences of the old series, they no longer apply once it moves
+	if reschedule != nil || recurrenceChanged {
+		updated.Exceptions = nil
+
+		// the owner has to be available for every occurrence at its new time
+		ownSlots, err := utils.EventSlots(existing)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return models.Event{}, false
+		}
+		slots, err := utils.EventSlots(updated)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return models.Event{}, false
+		}
+		if !es.checkOwnerAvailability(ctx, owner.Name, slots, ownSlots) {
+			return models.Event{}, false
+		}
+	}
+
+	// only a change of time or attendees can introduce a new double booking
+	if reschedule != nil || participantsChanged || recurrenceChanged {
+		updated.Forced = updateReq.Force
+		if !updateReq.Force {
+			if !es.checkConflicts(ctx, updated, existing.ID) {
+				return models.Event{}, false
+			}
+		}
+	}
+
+	err = es.EventRepo.UpdateEvent(updated, reschedule)
+	if errors.Is(err, repository.ErrEventConflict) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return models.Event{}, false
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return models.Event{}, false
+	}
+
+	updated.RescheduleHistory, err = es.EventRepo.GetRescheduleHistory(eventID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return models.Event{}, false
+	}
+
+	updated.Version = existing.Version + 1
+	publishWebhook(es.Webhooks, requestOrgID(ctx), models.WebhookEventUpdated, updated)
+	return updated, true
+}
+
+// ShowAccount godoc
+// @Summary      Cancel a Event
+// @Description  Cancel a Event, it stays visible as cancelled and can be restored until the retention period has passed.
+// @Description  The cancellation is recorded as made by the caller.
 // @Tags         Events
 // @Accept       json
 // @Produce      json
 // @Param        eventID   path   string   true  "Event ID"
-// @Success      200  {object}  string "Event deleted successfully"
+// @Param        reason   query   string   false  "Why the event is cancelled"
+// @Success      200  {object}  string "Event cancelled successfully"
 // @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      409  {object}  models.ServiceError
 // @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /events/{eventID} [delete]
 func (es *EventService) DeleteEvent(ctx *gin.Context) {
 	eventID := ctx.Param("eventID")
-	if eventID == "" {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Event ID is required"})
+	if _, err := uuid.FromString(eventID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	// who cancelled is whoever called, it isn't something the request gets to say
+	cancellation := models.EventCancellation{CancelledAt: time.Now().UTC(), Reason: ctx.Query("reason")}
+	if identity, found := middleware.CurrentIdentity(ctx); found {
+		cancellation.CancelledBy = identity.UserName
+	}
+
+	event, err := es.EventRepo.GetEvent(requestOrgID(ctx), eventID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if event.Status == models.EventStatusCancelled {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Event is already cancelled"})
 		return
 	}
 
-	err := es.EventRepo.DeleteEvent(eventID)
+	err = es.EventRepo.CancelEvent(eventID, cancellation)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Event is already cancelled"})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "Event deleted successfully"})
+	event.Status = models.EventStatusCancelled
+	event.Cancellation = &cancellation
+	publishWebhook(es.Webhooks, requestOrgID(ctx), models.WebhookEventCancelled, event)
+	ctx.JSON(http.StatusOK, gin.H{"message": "Event cancelled successfully"})
+}
+
+// ShowAccount godoc
+// @Summary      Restore a cancelled Event
+// @Description  Restore a cancelled Event, its time is booked again for the owner and participants
+// @Tags         Events
+// @Accept       json
+// @Produce      json
+// @Param        eventID   path   string   true  "Event ID"
+// @Param        force   query   bool   false  "Restore even when the time now overlaps other events"
+// @Success      200  {object}  models.Event
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      409  {object}  models.EventConflictResponse
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /events/{eventID}/restore [post]
+func (es *EventService) RestoreEvent(ctx *gin.Context) {
+	eventID := ctx.Param("eventID")
+	if _, err := uuid.FromString(eventID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	event, err := es.EventRepo.GetEvent(requestOrgID(ctx), eventID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if event.Status != models.EventStatusCancelled {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Event is not cancelled"})
+		return
+	}
+
+	force := ctx.Query("force") == "true"
+	if force {
+		event.Forced = true
+	} else if !es.checkConflicts(ctx, event, event.ID) {
+		return
+	}
+
+	err = es.EventRepo.RestoreEvent(event)
+	if errors.Is(err, repository.ErrEventConflict) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Event is not cancelled"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	event.Status = models.EventStatusActive
+	event.Cancellation = nil
+	event.Version++
+	publishWebhook(es.Webhooks, requestOrgID(ctx), models.WebhookEventUpdated, event)
+	ctx.JSON(http.StatusOK, gin.H{"event": event})
+}
+
+// PurgeCancelledEvents permanently deletes the events cancelled longer ago than the retention period
+func (es *EventService) PurgeCancelledEvents(retention time.Duration) (int64, error) {
+	return es.EventRepo.PurgeCancelledEvents(time.Now().Add(-retention))
+}
+
+// RunPurgeJob purges expired cancelled events every interval, it blocks and is meant to run in its own goroutine
+func (es *EventService) RunPurgeJob(retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		purged, err := es.PurgeCancelledEvents(retention)
+		if err != nil {
+			log.Printf("error purging cancelled events:: %s", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("purged %d cancelled events", purged)
+		}
+	}
 }
 
 // ShowAccount godoc
 // @Summary      Get a Event
-// @Description  Get Event by ID
+// @Description  Get Event by ID with its reschedule history. A private event shows only its time to users who neither
+// @Description  attend it nor may see private details of its owner.
 // @Tags         Events
 // @Accept       json
 // @Produce      json
 // @Param        eventID   path   string   true  "Event ID"
 // @Success      200  {object}  models.Event
 // @Failure      400  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
 // @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /events/{eventID} [get]
 func (es *EventService) GetEvent(ctx *gin.Context) {
 	eventID := ctx.Param("eventID")
-	if eventID == "" {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Event ID is required"})
+	if _, err := uuid.FromString(eventID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
 		return
 	}
 
-	event, err := es.EventRepo.GetEvent(eventID)
+	event, err := es.EventRepo.GetEvent(requestOrgID(ctx), eventID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	event.RescheduleHistory, err = es.EventRepo.GetRescheduleHistory(eventID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !middleware.Permitted(ctx, middleware.ActionViewPrivate) {
+		identity, _ := middleware.CurrentIdentity(ctx)
+		event = hidePrivateDetails(event, identity.UserID)
+	}
 	ctx.JSON(http.StatusOK, gin.H{"event": event})
 }
 
+const (
+	defaultEventPageSize = 50
+	maxEventPageSize     = 200
+)
+
+var eventSortFields = map[string]func(a, b models.Event) int{
+	"start_time": func(a, b models.Event) int { return a.EventStartTime.Compare(b.EventStartTime) },
+	"end_time":   func(a, b models.Event) int { return a.EventEndTime.Compare(b.EventEndTime) },
+	"title":      func(a, b models.Event) int { return strings.Compare(a.Title, b.Title) },
+}
+
 // ShowAccount godoc
 // @Summary      Get Events for a user
-// @Description  Get Events for a user
+// @Description  Get the Events a user owns or is invited to, each with the user's role on it. When from and to are given
+// @Description  recurring events are expanded into their occurrences within that range. Times are given in the home time
+// @Description  zone of the user. Private events are only shown in full to their attendees, the user, admins and delegates of
+// @Description  the user with the private_details scope, everybody else sees them as Busy.
 // @Tags         Events
 // @Accept       json
 // @Produce      json
 // @Param        username   path   string   true  "Username"
-// @Success      200  {object}  []models.Event
+// @Param        from   query   string   false  "Range start (RFC 3339)"
+// @Param        to     query   string   false  "Range end (RFC 3339)"
+// @Param        status query   string   false  "Only events with this status" Enums(active, cancelled)
+// @Param        role   query   string   false  "Only events the user has this role on" Enums(owner, participant)
+// @Param        label  query   []string false  "Only events with this label, as key:value, repeat to require several" collectionFormat(multi)
+// @Param        sort   query   string   false  "Field to sort by, start_time by default" Enums(start_time, end_time, title)
+// @Param        order  query   string   false  "Sort order, asc by default" Enums(asc, desc)
+// @Param        limit  query   int      false  "Page size, 50 by default and at most 200"
+// @Param        offset query   int      false  "Number of events to skip"
+// @Success      200  {object}  models.EventListResponse
 // @Failure      400  {object}  models.ServiceError
 // @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /events/{username} [get]
 func (es *EventService) GetEventsForUser(ctx *gin.Context) {
 	username := ctx.Param("username")
@@ -196,11 +910,172 @@ func (es *EventService) GetEventsForUser(ctx *gin.Context) {
 		return
 	}
 
-	events, err := es.EventRepo.GetEventsForUser(username)
+	var filter models.EventFilter
+	if ctx.Query("from") != "" || ctx.Query("to") != "" {
+		from, err := time.Parse(time.RFC3339, ctx.Query("from"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 time"})
+			return
+		}
+		to, err := time.Parse(time.RFC3339, ctx.Query("to"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 time"})
+			return
+		}
+		if !to.After(from) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+			return
+		}
+		filter.From, filter.To = &from, &to
+	}
+
+	filter.Status = ctx.Query("status")
+	if filter.Status != "" && filter.Status != models.EventStatusActive && filter.Status != models.EventStatusCancelled {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "status must be active or cancelled"})
+		return
+	}
+	filter.Role = ctx.Query("role")
+	if filter.Role != "" && filter.Role != models.EventRoleOwner && filter.Role != models.EventRoleParticipant {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "role must be owner or participant"})
+		return
+	}
+
+	for _, label := range ctx.QueryArray("label") {
+		key, value, found := strings.Cut(label, ":")
+		if !found || key == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "label filters must look like key:value"})
+			return
+		}
+		if filter.Labels == nil {
+			filter.Labels = map[string]string{}
+		}
+		filter.Labels[key] = value
+	}
+
+	sortField := ctx.DefaultQuery("sort", "start_time")
+	compare, ok := eventSortFields[sortField]
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of start_time, end_time or title"})
+		return
+	}
+	order := ctx.DefaultQuery("order", "asc")
+	if order != "asc" && order != "desc" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "order must be asc or desc"})
+		return
+	}
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(defaultEventPageSize)))
+	if err != nil || limit < 1 || limit > maxEventPageSize {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxEventPageSize)})
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "offset must be zero or more"})
+		return
+	}
+
+	resp := models.EventListResponse{Events: []models.Event{}, Limit: limit, Offset: offset}
+	if filter.From == nil {
+		// nothing is expanded without a time range, every event is one row so the query sorts and pages them
+		page := models.EventPage{Sort: sortField, Descending: order == "desc", Limit: limit, Offset: offset}
+		events, total, err := es.EventRepo.GetEventPageForUser(requestOrgID(ctx), username, filter, page)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		resp.Total = total
+		if len(events) > 0 {
+			resp.Events = events
+		}
+	} else {
+		events, err := es.EventRepo.GetEventsForUser(requestOrgID(ctx), username, filter)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		events, err = expandEvents(events, *filter.From, *filter.To)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// occurrences only exist once expanded, so sorting and paging happen here rather than in the query
+		slices.SortStableFunc(events, func(a, b models.Event) int {
+			if order == "desc" {
+				return compare(b, a)
+			}
+			return compare(a, b)
+		})
+		resp.Total = len(events)
+		if offset < len(events) {
+			resp.Events = events[offset:min(offset+limit, len(events))]
+		}
+	}
+
+	profile, err := profileOf(es.ProfileRepo, requestOrgID(ctx), username)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	loc := utils.ProfileLocation(profile)
+	showPrivate := middleware.Permitted(ctx, middleware.ActionViewPrivate)
+	identity, _ := middleware.CurrentIdentity(ctx)
+	for i := range resp.Events {
+		resp.Events[i].EventStartTime = resp.Events[i].EventStartTime.In(loc)
+		resp.Events[i].EventEndTime = resp.Events[i].EventEndTime.In(loc)
+		if !showPrivate {
+			resp.Events[i] = hidePrivateDetails(resp.Events[i], identity.UserID)
+		}
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// hidePrivateDetails leaves only the time of a private event the user doesn't attend, like conflicts report it
+func hidePrivateDetails(event models.Event, userID uuid.UUID) models.Event {
+	if event.Visibility != models.EventVisibilityPrivate || event.EventOwner == userID {
+		return event
+	}
+	for _, p := range event.Participants {
+		if p.UserID.Valid && p.UserID.UUID == userID {
+			return event
+		}
+	}
+	return models.Event{
+		ID:             event.ID,
+		Title:          "Busy",
+		EventOwner:     event.EventOwner,
+		EventStartTime: event.EventStartTime,
+		EventEndTime:   event.EventEndTime,
+		Participants:   []models.EventParticipant{},
+		Visibility:     event.Visibility,
+		Recurrence:     event.Recurrence,
+		RecurrenceID:   event.RecurrenceID,
+		Exceptions:     event.Exceptions,
+		Status:         event.Status,
+		Role:           event.Role,
+		Version:        event.Version,
+	}
+}
+
+// expandEvents returns the events and occurrences of recurring events overlapping [from, to), ordered by start
+func expandEvents(events []models.Event, from, to time.Time) ([]models.Event, error) {
+	expanded := []models.Event{}
+	for _, event := range events {
+		if event.Recurrence == "" {
+			if event.EventEndTime.After(from) && event.EventStartTime.Before(to) {
+				expanded = append(expanded, event)
+			}
+			continue
+		}
+
+		occurrences, err := utils.ExpandOccurrences(event, from, to)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, occurrences...)
+	}
 
-	ctx.JSON(http.StatusOK, gin.H{"events": events})
+	slices.SortFunc(expanded, func(a, b models.Event) int { return a.EventStartTime.Compare(b.EventStartTime) })
+	return expanded, nil
 }
@@ -0,0 +1,703 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+	"timeslot-app/middleware"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+	"timeslot-app/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockEventRepo struct {
+	mock.Mock
+}
+
+func (m *MockEventRepo) CreateEvent(event models.Event) error {
+	args := m.Called(event)
+	return args.Error(0)
+}
+
+func (m *MockEventRepo) GetEvent(orgID uuid.UUID, eventID string) (models.Event, error) {
+	args := m.Called(orgID, eventID)
+	return args.Get(0).(models.Event), args.Error(1)
+}
+
+func (m *MockEventRepo) DeleteEvent(eventID string) error {
+	args := m.Called(eventID)
+	return args.Error(0)
+}
+
+func (m *MockEventRepo) GetEventsForUser(orgID uuid.UUID, username string, filter models.EventFilter) ([]models.Event, error) {
+	args := m.Called(orgID, username, filter)
+	return args.Get(0).([]models.Event), args.Error(1)
+}
+
+func (m *MockEventRepo) GetEventPageForUser(orgID uuid.UUID, username string, filter models.EventFilter, page models.EventPage) ([]models.Event, int, error) {
+	args := m.Called(orgID, username, filter, page)
+	return args.Get(0).([]models.Event), args.Int(1), args.Error(2)
+}
+
+func (m *MockEventRepo) GetConflictingEvents(attendees []uuid.UUID, slots []models.TimeSlotStartAndEnd, excludeEventID uuid.UUID) ([]models.EventConflict, error) {
+	args := m.Called(attendees, slots, excludeEventID)
+	return args.Get(0).([]models.EventConflict), args.Error(1)
+}
+
+func (m *MockEventRepo) UpdateEvent(event models.Event, reschedule *models.EventReschedule) error {
+	args := m.Called(event, reschedule)
+	return args.Error(0)
+}
+
+func (m *MockEventRepo) GetRescheduleHistory(eventID string) ([]models.EventReschedule, error) {
+	args := m.Called(eventID)
+	return args.Get(0).([]models.EventReschedule), args.Error(1)
+}
+
+func (m *MockEventRepo) UpdateParticipantResponse(participant models.EventParticipant) error {
+	args := m.Called(participant)
+	return args.Error(0)
+}
+
+func (m *MockEventRepo) SplitEvent(original models.Event, following *models.Event) error {
+	args := m.Called(original, following)
+	return args.Error(0)
+}
+
+func (m *MockEventRepo) CancelEvent(eventID string, cancellation models.EventCancellation) error {
+	args := m.Called(eventID, cancellation)
+	return args.Error(0)
+}
+
+func (m *MockEventRepo) RestoreEvent(event models.Event) error {
+	args := m.Called(event)
+	return args.Error(0)
+}
+
+func (m *MockEventRepo) PurgeCancelledEvents(cancelledBefore time.Time) (int64, error) {
+	args := m.Called(cancelledBefore)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func newEventRequest(eventReq models.EventRequest) *http.Request {
+	body, _ := json.Marshal(eventReq)
+	req, _ := http.NewRequest(http.MethodPost, "/events", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestCreateEvent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	timeSlot := "02 Jan 2025 2-4 PM MST"
+	userID, _ := uuid.NewV4()
+	owner := models.User{ID: userID, Name: "eshan"}
+	kevinID, _ := uuid.NewV4()
+	kevin := models.User{ID: kevinID, Name: "kevin"}
+
+	setup := func() (*MockEventRepo, *gin.Engine) {
+		mockEventRepo := new(MockEventRepo)
+		mockTimeslotRepo := new(MockTimeslotRepo)
+		mockUserRepo := new(MockUserRepo)
+		eventService := &EventService{
+			EventRepo:    mockEventRepo,
+			TimeslotRepo: mockTimeslotRepo,
+			UserRepo:     mockUserRepo,
+		}
+
+		mockUserRepo.On("Get", testOrg.ID, "eshan").Return(owner, nil)
+		mockUserRepo.On("GetUsersByNames", testOrg.ID, []string{"kevin"}).Return([]models.User{kevin}, nil)
+		mockUserRepo.On("GetUsersByNames", testOrg.ID, []string{"ghost"}).Return([]models.User(nil), nil)
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "eshan").Return([]string{timeSlot}, nil)
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
+		router.POST("/events", eventService.CreateEvent)
+		return mockEventRepo, router
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mockEventRepo, router := setup()
+		mockEventRepo.On("GetConflictingEvents", []uuid.UUID{userID, kevinID}, mock.Anything, uuid.Nil).Return([]models.EventConflict(nil), nil)
+		mockEventRepo.On("CreateEvent", mock.Anything).Return(nil)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newEventRequest(models.EventRequest{
+			Title:         "Standup",
+			EventOwner:    "eshan",
+			EventTimeSlot: timeSlot,
+			Participants:  []string{"kevin"},
+		}))
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		mockEventRepo.AssertExpectations(t)
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		mockEventRepo, router := setup()
+		eventID, _ := uuid.NewV4()
+		conflicts := []models.EventConflict{{
+			Attendee:       "kevin",
+			EventID:        eventID,
+			Title:          "Retro",
+			EventStartTime: time.Date(2025, 1, 2, 14, 0, 0, 0, time.UTC),
+			EventEndTime:   time.Date(2025, 1, 2, 15, 0, 0, 0, time.UTC),
+		}}
+		mockEventRepo.On("GetConflictingEvents", []uuid.UUID{userID, kevinID}, mock.Anything, uuid.Nil).Return(conflicts, nil)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newEventRequest(models.EventRequest{
+			Title:         "Standup",
+			EventOwner:    "eshan",
+			EventTimeSlot: timeSlot,
+			Participants:  []string{"kevin"},
+		}))
+
+		assert.Equal(t, http.StatusConflict, recorder.Code)
+		var resp models.EventConflictResponse
+		json.Unmarshal(recorder.Body.Bytes(), &resp)
+		assert.Contains(t, resp.Error, `kevin is already booked for "Retro"`)
+		assert.Equal(t, conflicts[0].EventID, resp.Conflicts[0].EventID)
+		mockEventRepo.AssertNotCalled(t, "CreateEvent", mock.Anything)
+	})
+
+	t.Run("Forced", func(t *testing.T) {
+		mockEventRepo, router := setup()
+		mockEventRepo.On("CreateEvent", mock.MatchedBy(func(e models.Event) bool { return e.Forced })).Return(nil)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newEventRequest(models.EventRequest{
+			Title:         "Standup",
+			EventOwner:    "eshan",
+			EventTimeSlot: timeSlot,
+			Participants:  []string{"kevin"},
+			Force:         true,
+		}))
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		mockEventRepo.AssertNotCalled(t, "GetConflictingEvents", mock.Anything, mock.Anything, mock.Anything)
+		mockEventRepo.AssertExpectations(t)
+	})
+
+	t.Run("Concurrent Booking", func(t *testing.T) {
+		mockEventRepo, router := setup()
+		mockEventRepo.On("GetConflictingEvents", mock.Anything, mock.Anything, mock.Anything).Return([]models.EventConflict(nil), nil)
+		mockEventRepo.On("CreateEvent", mock.Anything).Return(repository.ErrEventConflict)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newEventRequest(models.EventRequest{
+			Title:         "Standup",
+			EventOwner:    "eshan",
+			EventTimeSlot: timeSlot,
+			Participants:  []string{"kevin"},
+		}))
+
+		assert.Equal(t, http.StatusConflict, recorder.Code)
+		mockEventRepo.AssertExpectations(t)
+	})
+
+	t.Run("Details And Labels", func(t *testing.T) {
+		mockEventRepo, router := setup()
+		mockEventRepo.On("GetConflictingEvents", []uuid.UUID{userID, kevinID}, mock.Anything, uuid.Nil).Return([]models.EventConflict(nil), nil)
+		mockEventRepo.On("CreateEvent", mock.MatchedBy(func(e models.Event) bool {
+			return e.Location == "Room 4.01" && e.ConferenceURL == "https://meet.example.com/abc" &&
+				e.Visibility == models.EventVisibilityPrivate && e.Labels["team"] == "platform"
+		})).Return(nil)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newEventRequest(models.EventRequest{
+			Title:         "Standup",
+			EventOwner:    "eshan",
+			EventTimeSlot: timeSlot,
+			Participants:  []string{"kevin"},
+			Description:   "Agenda: roadmap review",
+			Location:      "Room 4.01",
+			ConferenceURL: "https://meet.example.com/abc",
+			Visibility:    models.EventVisibilityPrivate,
+			Labels:        map[string]string{"team": "platform"},
+		}))
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		mockEventRepo.AssertExpectations(t)
+	})
+
+	t.Run("Invalid Conference URL", func(t *testing.T) {
+		mockEventRepo, router := setup()
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newEventRequest(models.EventRequest{
+			Title:         "Standup",
+			EventOwner:    "eshan",
+			EventTimeSlot: timeSlot,
+			Participants:  []string{"kevin"},
+			ConferenceURL: "javascript:alert(1)",
+		}))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		mockEventRepo.AssertNotCalled(t, "CreateEvent", mock.Anything)
+	})
+
+	t.Run("Invalid Reminder", func(t *testing.T) {
+		mockEventRepo, router := setup()
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newEventRequest(models.EventRequest{
+			Title:         "Standup",
+			EventOwner:    "eshan",
+			EventTimeSlot: timeSlot,
+			Participants:  []string{"kevin"},
+			Reminders:     []string{"10 minutes"},
+		}))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "invalid reminder offset")
+		mockEventRepo.AssertNotCalled(t, "CreateEvent", mock.Anything)
+	})
+
+	t.Run("Recurrence Over The Cap", func(t *testing.T) {
+		mockEventRepo, router := setup()
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newEventRequest(models.EventRequest{
+			Title:         "Standup",
+			EventOwner:    "eshan",
+			EventTimeSlot: timeSlot,
+			Participants:  []string{"kevin"},
+			Recurrence:    "FREQ=DAILY;UNTIL=20270102",
+		}))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "more than 500 occurrences")
+		mockEventRepo.AssertNotCalled(t, "CreateEvent", mock.Anything)
+	})
+
+	t.Run("Unknown Participant", func(t *testing.T) {
+		mockEventRepo, router := setup()
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newEventRequest(models.EventRequest{
+			Title:         "Standup",
+			EventOwner:    "eshan",
+			EventTimeSlot: timeSlot,
+			Participants:  []string{"ghost"},
+		}))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "unknown participants: ghost")
+		mockEventRepo.AssertNotCalled(t, "CreateEvent", mock.Anything)
+	})
+
+	t.Run("External Guest", func(t *testing.T) {
+		mockEventRepo, router := setup()
+		mockEventRepo.On("GetConflictingEvents", []uuid.UUID{userID, kevinID}, mock.Anything, uuid.Nil).Return([]models.EventConflict(nil), nil)
+		mockEventRepo.On("CreateEvent", mock.MatchedBy(func(e models.Event) bool {
+			return len(e.Participants) == 2 && e.Participants[1].External && !e.Participants[1].UserID.Valid
+		})).Return(nil)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newEventRequest(models.EventRequest{
+			Title:          "Standup",
+			EventOwner:     "eshan",
+			EventTimeSlot:  timeSlot,
+			Participants:   []string{"kevin"},
+			ExternalGuests: []string{"jane@partner.com"},
+		}))
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		mockEventRepo.AssertExpectations(t)
+	})
+}
+
+func TestUpdateEvent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	userID, _ := uuid.NewV4()
+	owner := models.User{ID: userID, Name: "eshan"}
+	kevinID, _ := uuid.NewV4()
+	eventID, _ := uuid.NewV4()
+	mst, _ := time.LoadLocation("MST")
+	existing := models.Event{
+		ID:             eventID,
+		Title:          "Standup",
+		EventOwner:     userID,
+		EventStartTime: time.Date(2025, 1, 2, 14, 0, 0, 0, mst),
+		EventEndTime:   time.Date(2025, 1, 2, 16, 0, 0, 0, mst),
+		Visibility:     models.EventVisibilityPublic,
+		Status:         models.EventStatusActive,
+		Participants: []models.EventParticipant{{
+			UserID: uuid.NullUUID{UUID: kevinID, Valid: true},
+			Name:   "kevin",
+			Role:   models.ParticipantRoleRequired,
+			Status: models.ParticipantStatusNeedsAction,
+		}},
+	}
+
+	setup := func() (*MockEventRepo, *MockTimeslotRepo, *gin.Engine) {
+		mockEventRepo := new(MockEventRepo)
+		mockTimeslotRepo := new(MockTimeslotRepo)
+		mockUserRepo := new(MockUserRepo)
+		eventService := &EventService{
+			EventRepo:    mockEventRepo,
+			TimeslotRepo: mockTimeslotRepo,
+			UserRepo:     mockUserRepo,
+		}
+
+		mockUserRepo.On("GetByID", testOrg.ID, userID).Return(owner, nil)
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
+		router.PATCH("/events/:eventID", eventService.UpdateEvent)
+		router.PUT("/events/:eventID", eventService.ReplaceEvent)
+		return mockEventRepo, mockTimeslotRepo, router
+	}
+
+	newUpdateRequest := func(method, id string, updateReq models.EventUpdateRequest) *http.Request {
+		body, _ := json.Marshal(updateReq)
+		req, _ := http.NewRequest(method, "/events/"+id, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+
+	t.Run("Rename", func(t *testing.T) {
+		mockEventRepo, _, router := setup()
+		mockEventRepo.On("GetEvent", testOrg.ID, eventID.String()).Return(existing, nil)
+		mockEventRepo.On("UpdateEvent", mock.MatchedBy(func(e models.Event) bool { return e.Title == "Planning" }), (*models.EventReschedule)(nil)).Return(nil)
+		mockEventRepo.On("GetRescheduleHistory", eventID.String()).Return([]models.EventReschedule(nil), nil)
+
+		title := "Planning"
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newUpdateRequest(http.MethodPatch, eventID.String(), models.EventUpdateRequest{Title: &title}))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		mockEventRepo.AssertNotCalled(t, "GetConflictingEvents", mock.Anything, mock.Anything, mock.Anything)
+		mockEventRepo.AssertExpectations(t)
+	})
+
+	t.Run("Reschedule", func(t *testing.T) {
+		mockEventRepo, mockTimeslotRepo, router := setup()
+		newSlot := "03 Jan 2025 2-4 PM MST"
+		mockEventRepo.On("GetEvent", testOrg.ID, eventID.String()).Return(existing, nil)
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "eshan").Return([]string{newSlot}, nil)
+		mockEventRepo.On("GetConflictingEvents", []uuid.UUID{userID, kevinID}, mock.Anything, eventID).Return([]models.EventConflict(nil), nil)
+		mockEventRepo.On("UpdateEvent", mock.Anything, mock.MatchedBy(func(r *models.EventReschedule) bool {
+			return r != nil && r.PreviousStartTime.Equal(existing.EventStartTime) && r.Reason == "travelling"
+		})).Return(nil)
+		mockEventRepo.On("GetRescheduleHistory", eventID.String()).Return([]models.EventReschedule{{EventID: eventID}}, nil)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newUpdateRequest(http.MethodPatch, eventID.String(), models.EventUpdateRequest{EventTimeSlot: &newSlot, Reason: "travelling"}))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var resp struct {
+			Event models.Event `json:"event"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &resp)
+		assert.Len(t, resp.Event.RescheduleHistory, 1)
+		mockEventRepo.AssertExpectations(t)
+	})
+
+	t.Run("Replace Requires All Fields", func(t *testing.T) {
+		_, _, router := setup()
+		title := "Planning"
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newUpdateRequest(http.MethodPut, eventID.String(), models.EventUpdateRequest{Title: &title}))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		mockEventRepo, _, router := setup()
+		mockEventRepo.On("GetEvent", testOrg.ID, eventID.String()).Return(models.Event{}, pgx.ErrNoRows)
+		title := "Planning"
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newUpdateRequest(http.MethodPatch, eventID.String(), models.EventUpdateRequest{Title: &title}))
+
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+}
+
+func TestCheckOwnerAvailability(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockTimeslotRepo := new(MockTimeslotRepo)
+	eventService := &EventService{TimeslotRepo: mockTimeslotRepo}
+	// 5-6 PM EST is 3-4 PM MST, right after the first window
+	mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "eshan").Return([]string{"02 Jan 2025 1-3 PM MST", "02 Jan 2025 5-6 PM EST"}, nil)
+
+	tests := []struct {
+		name       string
+		timeSlot   string
+		recurrence string
+		available  bool
+	}{
+		{"Inside A Window", "02 Jan 2025 2-3 PM MST", "", true},
+		{"Across Adjacent Windows", "02 Jan 2025 2-4 PM MST", "", true},
+		{"Other Time Zone", "02 Jan 2025 4-6 PM EST", "", true},
+		{"Past The End", "02 Jan 2025 2-5 PM MST", "", false},
+		{"Later Occurrence Outside", "02 Jan 2025 2-3 PM MST", "FREQ=DAILY;COUNT=2", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			startTime, endTime, _ := utils.ValidateAndFormatTimeStamp(tt.timeSlot)
+			slots, err := utils.EventSlots(models.Event{EventStartTime: startTime, EventEndTime: endTime, Recurrence: tt.recurrence})
+			assert.NoError(t, err)
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			middleware.SetOrg(ctx, testOrg)
+
+			available := eventService.checkOwnerAvailability(ctx, "eshan", slots, nil)
+
+			assert.Equal(t, tt.available, available)
+			if !tt.available {
+				assert.Equal(t, http.StatusBadRequest, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestCancelAndRestoreEvent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	userID, _ := uuid.NewV4()
+	eventID, _ := uuid.NewV4()
+	active := models.Event{
+		ID:             eventID,
+		Title:          "Standup",
+		EventOwner:     userID,
+		EventStartTime: time.Date(2025, 1, 2, 14, 0, 0, 0, time.UTC),
+		EventEndTime:   time.Date(2025, 1, 2, 15, 0, 0, 0, time.UTC),
+		Participants:   []models.EventParticipant{},
+		Status:         models.EventStatusActive,
+	}
+	cancelled := active
+	cancelled.Status = models.EventStatusCancelled
+	cancelled.Cancellation = &models.EventCancellation{CancelledAt: time.Now(), CancelledBy: "eshan", Reason: "called off"}
+
+	setup := func() (*MockEventRepo, *MockUserRepo, *gin.Engine) {
+		mockEventRepo := new(MockEventRepo)
+		mockUserRepo := new(MockUserRepo)
+		eventService := &EventService{
+			EventRepo: mockEventRepo,
+			UserRepo:  mockUserRepo,
+		}
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg), withIdentity(models.Identity{UserID: userID, OrgID: testOrg.ID, UserName: "eshan"}))
+
+		router.DELETE("/events/:eventID", eventService.DeleteEvent)
+		router.POST("/events/:eventID/restore", eventService.RestoreEvent)
+		router.GET("/events/:eventID", eventService.GetEvent)
+		return mockEventRepo, mockUserRepo, router
+	}
+
+	t.Run("Cancel", func(t *testing.T) {
+		mockEventRepo, _, router := setup()
+		mockEventRepo.On("GetEvent", testOrg.ID, eventID.String()).Return(active, nil)
+		mockEventRepo.On("CancelEvent", eventID.String(), mock.MatchedBy(func(c models.EventCancellation) bool {
+			// the caller is recorded whoever the query names
+			return c.CancelledBy == "eshan" && c.Reason == "called off" && !c.CancelledAt.IsZero()
+		})).Return(nil)
+
+		req, _ := http.NewRequest(http.MethodDelete, "/events/"+eventID.String()+"?cancelled_by=kevin&reason=called+off", nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		mockEventRepo.AssertExpectations(t)
+	})
+
+	t.Run("Cancel Unknown Event", func(t *testing.T) {
+		mockEventRepo, _, router := setup()
+		mockEventRepo.On("GetEvent", testOrg.ID, eventID.String()).Return(models.Event{}, pgx.ErrNoRows)
+
+		req, _ := http.NewRequest(http.MethodDelete, "/events/"+eventID.String(), nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+		mockEventRepo.AssertNotCalled(t, "CancelEvent", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Cancel Twice", func(t *testing.T) {
+		mockEventRepo, _, router := setup()
+		mockEventRepo.On("GetEvent", testOrg.ID, eventID.String()).Return(cancelled, nil)
+
+		req, _ := http.NewRequest(http.MethodDelete, "/events/"+eventID.String(), nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusConflict, recorder.Code)
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		mockEventRepo, _, router := setup()
+		mockEventRepo.On("GetEvent", testOrg.ID, eventID.String()).Return(cancelled, nil)
+		mockEventRepo.On("GetConflictingEvents", []uuid.UUID{userID}, mock.Anything, eventID).Return([]models.EventConflict(nil), nil)
+		mockEventRepo.On("RestoreEvent", mock.MatchedBy(func(e models.Event) bool { return e.ID == eventID })).Return(nil)
+
+		req, _ := http.NewRequest(http.MethodPost, "/events/"+eventID.String()+"/restore", nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var resp struct {
+			Event models.Event `json:"event"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &resp)
+		assert.Equal(t, models.EventStatusActive, resp.Event.Status)
+		assert.Nil(t, resp.Event.Cancellation)
+		mockEventRepo.AssertExpectations(t)
+	})
+
+	t.Run("Get Unknown Event", func(t *testing.T) {
+		mockEventRepo, _, router := setup()
+		mockEventRepo.On("GetEvent", testOrg.ID, eventID.String()).Return(models.Event{}, pgx.ErrNoRows)
+
+		req, _ := http.NewRequest(http.MethodGet, "/events/"+eventID.String(), nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+		mockEventRepo.AssertNotCalled(t, "GetRescheduleHistory", mock.Anything)
+	})
+
+	t.Run("Restore Active Event", func(t *testing.T) {
+		mockEventRepo, _, router := setup()
+		mockEventRepo.On("GetEvent", testOrg.ID, eventID.String()).Return(active, nil)
+
+		req, _ := http.NewRequest(http.MethodPost, "/events/"+eventID.String()+"/restore", nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusConflict, recorder.Code)
+		mockEventRepo.AssertNotCalled(t, "RestoreEvent", mock.Anything)
+	})
+}
+
+func TestGetEventsForUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ownerID, _ := uuid.NewV4()
+	day := time.Date(2025, 1, 2, 14, 0, 0, 0, time.UTC)
+	var events []models.Event
+	for i, title := range []string{"Standup", "Planning", "Retro"} {
+		eventID, _ := uuid.NewV4()
+		events = append(events, models.Event{
+			ID:             eventID,
+			Title:          title,
+			EventOwner:     ownerID,
+			EventStartTime: day.AddDate(0, 0, i),
+			EventEndTime:   day.AddDate(0, 0, i).Add(time.Hour),
+			Status:         models.EventStatusActive,
+			Role:           models.EventRoleParticipant,
+		})
+	}
+
+	setup := func() (*MockEventRepo, *gin.Engine) {
+		mockEventRepo := new(MockEventRepo)
+		eventService := &EventService{EventRepo: mockEventRepo}
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
+		router.GET("/events/:username", eventService.GetEventsForUser)
+		return mockEventRepo, router
+	}
+
+	t.Run("Filtered Sorted Page", func(t *testing.T) {
+		mockEventRepo, router := setup()
+		filter := models.EventFilter{Status: models.EventStatusActive, Role: models.EventRoleParticipant}
+		page := models.EventPage{Sort: "start_time", Descending: true, Limit: 2, Offset: 1}
+		mockEventRepo.On("GetEventPageForUser", testOrg.ID, "kevin", filter, page).Return([]models.Event{events[1], events[0]}, 3, nil)
+
+		req, _ := http.NewRequest(http.MethodGet, "/events/kevin?status=active&role=participant&order=desc&limit=2&offset=1", nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var resp models.EventListResponse
+		json.Unmarshal(recorder.Body.Bytes(), &resp)
+		assert.Equal(t, 3, resp.Total)
+		if assert.Len(t, resp.Events, 2) {
+			assert.Equal(t, "Planning", resp.Events[0].Title)
+			assert.Equal(t, "Standup", resp.Events[1].Title)
+			assert.Equal(t, models.EventRoleParticipant, resp.Events[0].Role)
+		}
+		mockEventRepo.AssertExpectations(t)
+	})
+
+	t.Run("Time Range Sorted Page", func(t *testing.T) {
+		mockEventRepo, router := setup()
+		mockEventRepo.On("GetEventsForUser", testOrg.ID, "kevin", mock.MatchedBy(func(f models.EventFilter) bool {
+			return f.From != nil && f.To != nil
+		})).Return(slices.Clone(events), nil)
+
+		req, _ := http.NewRequest(http.MethodGet, "/events/kevin?from=2025-01-01T00:00:00Z&to=2025-02-01T00:00:00Z&sort=title&limit=2", nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var resp models.EventListResponse
+		json.Unmarshal(recorder.Body.Bytes(), &resp)
+		assert.Equal(t, 3, resp.Total)
+		if assert.Len(t, resp.Events, 2) {
+			assert.Equal(t, "Planning", resp.Events[0].Title)
+			assert.Equal(t, "Retro", resp.Events[1].Title)
+		}
+		mockEventRepo.AssertNotCalled(t, "GetEventPageForUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Offset Past The End", func(t *testing.T) {
+		mockEventRepo, router := setup()
+		mockEventRepo.On("GetEventPageForUser", testOrg.ID, "kevin", models.EventFilter{}, models.EventPage{Sort: "start_time", Limit: 50, Offset: 10}).
+			Return([]models.Event{}, 3, nil)
+
+		req, _ := http.NewRequest(http.MethodGet, "/events/kevin?offset=10", nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var resp models.EventListResponse
+		json.Unmarshal(recorder.Body.Bytes(), &resp)
+		assert.Empty(t, resp.Events)
+		assert.Equal(t, 3, resp.Total)
+	})
+
+	t.Run("Label Filter", func(t *testing.T) {
+		mockEventRepo, router := setup()
+		filter := models.EventFilter{Labels: map[string]string{"team": "platform", "kind": "sync"}}
+		mockEventRepo.On("GetEventPageForUser", testOrg.ID, "kevin", filter, mock.Anything).Return([]models.Event(nil), 0, nil)
+
+		req, _ := http.NewRequest(http.MethodGet, "/events/kevin?label=team:platform&label=kind:sync", nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		mockEventRepo.AssertExpectations(t)
+	})
+
+	t.Run("Invalid Role", func(t *testing.T) {
+		mockEventRepo, router := setup()
+
+		req, _ := http.NewRequest(http.MethodGet, "/events/kevin?role=admin", nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		mockEventRepo.AssertNotCalled(t, "GetEventPageForUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,379 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"timeslot-app/middleware"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+// groupNamePattern keeps group names easy to write after the @ in a participant list
+var groupNamePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+const (
+	maxGroupNameLength = 50
+	maxGroupMembers    = 200
+)
+
+// errUnknownGroup is returned when a participant list names a group the organization doesn't have
+var errUnknownGroup = errors.New("unknown groups")
+
+type GroupService struct {
+	GroupRepo repository.GroupRepo
+	UserRepo  repository.UserRepo
+}
+
+func NewGroupService(db *pgx.ConnPool) *GroupService {
+	return &GroupService{
+		GroupRepo: repository.NewGroupRepository(db),
+		UserRepo:  repository.NewUserRepo(db),
+	}
+}
+
+// groupName returns the name of the group a participant stands for, false for participants that are users
+func groupName(participant string) (string, bool) {
+	return strings.CutPrefix(participant, models.GroupPrefix)
+}
+
+// expandParticipants replaces the groups in a participant list, "@platform-team", by the users they stand for,
+// nested groups included. Users are listed once, where they first come up. via maps the users that came from a
+// group to the group as it was named in the list. Naming a group the organization doesn't have is an errUnknownGroup.
+func expandParticipants(repo repository.GroupRepo, orgID uuid.UUID, participants []string) (expanded []string, via map[string]string, err error) {
+	via = map[string]string{}
+	if !slices.ContainsFunc(participants, func(p string) bool { _, isGroup := groupName(p); return isGroup }) {
+		return participants, via, nil
+	}
+
+	groups := map[string]models.Group{}
+	if repo != nil {
+		list, err := repo.ListGroups(orgID)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, group := range list {
+			groups[group.Name] = group
+		}
+	}
+
+	unknown := []string{}
+	for _, participant := range participants {
+		name, isGroup := groupName(participant)
+		if !isGroup {
+			if !slices.Contains(expanded, participant) {
+				expanded = append(expanded, participant)
+			}
+			continue
+		}
+		if _, found := groups[name]; !found {
+			unknown = append(unknown, participant)
+			continue
+		}
+		for _, member := range groupMembers(groups, name) {
+			if !slices.Contains(expanded, member) {
+				expanded = append(expanded, member)
+				via[member] = participant
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, nil, fmt.Errorf("%w: %s", errUnknownGroup, strings.Join(unknown, ", "))
+	}
+	return expanded, via, nil
+}
+
+// groupMembers returns the users of a group and of the groups nested in it, each group is visited once so
+// nesting that loops back ends
+func groupMembers(groups map[string]models.Group, name string) []string {
+	members := []string{}
+	visited := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, member := range groups[name].Members {
+			if nested, isGroup := groupName(member); isGroup {
+				visit(nested)
+			} else if !slices.Contains(members, member) {
+				members = append(members, member)
+			}
+		}
+	}
+	visit(name)
+	return members
+}
+
+// resolveMembers checks a member list of a group and returns the IDs of its users and nested groups, writing an
+// error response and returning false when a member doesn't exist or nesting would make the group contain itself
+func (gs *GroupService) resolveMembers(ctx *gin.Context, group string, members []string) (userIDs, groupIDs []uuid.UUID, ok bool) {
+	if len(members) > maxGroupMembers {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("groups have at most %d members", maxGroupMembers)})
+		return nil, nil, false
+	}
+
+	groups, err := gs.GroupRepo.ListGroups(requestOrgID(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching groups"})
+		return nil, nil, false
+	}
+	groupsByName := make(map[string]models.Group, len(groups))
+	for _, g := range groups {
+		groupsByName[g.Name] = g
+	}
+
+	userNames := []string{}
+	unknown := []string{}
+	for i, member := range members {
+		if slices.Contains(members[:i], member) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is listed as a member twice", member)})
+			return nil, nil, false
+		}
+		name, isGroup := groupName(member)
+		if !isGroup {
+			userNames = append(userNames, member)
+			continue
+		}
+		nested, found := groupsByName[name]
+		if !found {
+			unknown = append(unknown, member)
+			continue
+		}
+		if name == group || slices.Contains(nestedGroups(groupsByName, name), group) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s contains %s%s, it can't be nested in it", member, models.GroupPrefix, group)})
+			return nil, nil, false
+		}
+		groupIDs = append(groupIDs, nested.ID)
+	}
+
+	users, err := gs.UserRepo.GetUsersByNames(requestOrgID(ctx), userNames)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching members"})
+		return nil, nil, false
+	}
+	for _, name := range userNames {
+		idx := slices.IndexFunc(users, func(u models.User) bool { return u.Name == name })
+		if idx < 0 {
+			unknown = append(unknown, name)
+			continue
+		}
+		userIDs = append(userIDs, users[idx].ID)
+	}
+	if len(unknown) > 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "unknown members: " + strings.Join(unknown, ", ")})
+		return nil, nil, false
+	}
+	return userIDs, groupIDs, true
+}
+
+// nestedGroups returns the names of every group nested in the group, at any depth
+func nestedGroups(groups map[string]models.Group, name string) []string {
+	nested := []string{}
+	var visit func(name string)
+	visit = func(name string) {
+		for _, member := range groups[name].Members {
+			if g, isGroup := groupName(member); isGroup && !slices.Contains(nested, g) {
+				nested = append(nested, g)
+				visit(g)
+			}
+		}
+	}
+	visit(name)
+	return nested
+}
+
+// ShowAccount godoc
+// @Summary      Create a group
+// @Description  Create a named group of users and other groups. Participant lists of events and recommendations
+// @Description  accept the group as @name, it is expanded to its members, nested groups included, when the request is made.
+// @Tags         Groups
+// @Accept       json
+// @Produce      json
+// @Param        body   body   	models.GroupRequest   true "Group"
+// @Success      201  {object}  models.Group
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      409  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /groups [post]
+func (gs *GroupService) CreateGroup(ctx *gin.Context) {
+	var req models.GroupRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Name = strings.TrimPrefix(req.Name, models.GroupPrefix)
+	if !groupNamePattern.MatchString(req.Name) || len(req.Name) > maxGroupNameLength {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name must be up to %d lowercase letters and digits separated by single dashes", maxGroupNameLength)})
+		return
+	}
+	if req.Members == nil {
+		req.Members = []string{}
+	}
+
+	userIDs, groupIDs, ok := gs.resolveMembers(ctx, req.Name, req.Members)
+	if !ok {
+		return
+	}
+
+	group := models.Group{OrgID: requestOrgID(ctx), Name: req.Name, Members: req.Members, CreatedAt: time.Now().UTC()}
+	group.ID, _ = uuid.NewV4()
+	if identity, found := middleware.CurrentIdentity(ctx); found {
+		group.CreatedBy = uuid.NullUUID{UUID: identity.UserID, Valid: true}
+	}
+
+	err := gs.GroupRepo.CreateGroup(group, userIDs, groupIDs)
+	if errors.Is(err, repository.ErrGroupExists) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating group"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, group)
+}
+
+// ShowAccount godoc
+// @Summary      List groups
+// @Description  List the groups of the organization with their direct members
+// @Tags         Groups
+// @Produce      json
+// @Success      200  {array}   models.Group
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /groups [get]
+func (gs *GroupService) ListGroups(ctx *gin.Context) {
+	groups, err := gs.GroupRepo.ListGroups(requestOrgID(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching groups"})
+		return
+	}
+	ctx.JSON(http.StatusOK, groups)
+}
+
+// ShowAccount godoc
+// @Summary      Get a group
+// @Description  Get a group with its direct members and every user it currently expands to
+// @Tags         Groups
+// @Produce      json
+// @Param        name   path   string   true  "Group Name"
+// @Success      200  {object}  models.Group
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /groups/{name} [get]
+func (gs *GroupService) GetGroup(ctx *gin.Context) {
+	group, ok := gs.fetchGroup(ctx)
+	if !ok {
+		return
+	}
+
+	expanded, _, err := expandParticipants(gs.GroupRepo, requestOrgID(ctx), []string{models.GroupPrefix + group.Name})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error expanding group"})
+		return
+	}
+	group.Expanded = expanded
+	if group.Expanded == nil {
+		group.Expanded = []string{}
+	}
+	ctx.JSON(http.StatusOK, group)
+}
+
+// ShowAccount godoc
+// @Summary      Set the members of a group
+// @Description  Replace the members of a group. Events the group was invited to keep the participants it was expanded to.
+// @Tags         Groups
+// @Accept       json
+// @Produce      json
+// @Param        name   path   string   true  "Group Name"
+// @Param        body   body   	models.GroupMembersRequest   true "Members"
+// @Success      200  {object}  models.Group
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /groups/{name}/members [put]
+func (gs *GroupService) SetGroupMembers(ctx *gin.Context) {
+	var req models.GroupMembersRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Members == nil {
+		req.Members = []string{}
+	}
+
+	group, ok := gs.fetchGroup(ctx)
+	if !ok {
+		return
+	}
+	userIDs, groupIDs, ok := gs.resolveMembers(ctx, group.Name, req.Members)
+	if !ok {
+		return
+	}
+
+	err := gs.GroupRepo.SetGroupMembers(group.ID, userIDs, groupIDs)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving members"})
+		return
+	}
+	group.Members = req.Members
+	ctx.JSON(http.StatusOK, group)
+}
+
+// ShowAccount godoc
+// @Summary      Delete a group
+// @Description  Delete a group, it is taken out of the groups it was nested in. Events keep the participants it was expanded to.
+// @Tags         Groups
+// @Produce      json
+// @Param        name   path   string   true  "Group Name"
+// @Success      200  {object}  models.ServiceMessage
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /groups/{name} [delete]
+func (gs *GroupService) DeleteGroup(ctx *gin.Context) {
+	group, ok := gs.fetchGroup(ctx)
+	if !ok {
+		return
+	}
+	if err := gs.GroupRepo.DeleteGroup(group.ID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting group"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Group deleted successfully"})
+}
+
+// fetchGroup returns the group named in the path, writing an error response and returning false when there is none
+func (gs *GroupService) fetchGroup(ctx *gin.Context) (models.Group, bool) {
+	group, err := gs.GroupRepo.GetGroup(requestOrgID(ctx), strings.TrimPrefix(ctx.Param("name"), models.GroupPrefix))
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Group does not exist"})
+		return models.Group{}, false
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching group"})
+		return models.Group{}, false
+	}
+	return group, true
+}
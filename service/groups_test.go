@@ -0,0 +1,235 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockGroupRepo struct {
+	mock.Mock
+}
+
+func (m *MockGroupRepo) CreateGroup(group models.Group, userIDs, groupIDs []uuid.UUID) error {
+	args := m.Called(group, userIDs, groupIDs)
+	return args.Error(0)
+}
+
+func (m *MockGroupRepo) ListGroups(orgID uuid.UUID) ([]models.Group, error) {
+	args := m.Called(orgID)
+	return args.Get(0).([]models.Group), args.Error(1)
+}
+
+func (m *MockGroupRepo) GetGroup(orgID uuid.UUID, name string) (models.Group, error) {
+	args := m.Called(orgID, name)
+	return args.Get(0).(models.Group), args.Error(1)
+}
+
+func (m *MockGroupRepo) SetGroupMembers(groupID uuid.UUID, userIDs, groupIDs []uuid.UUID) error {
+	args := m.Called(groupID, userIDs, groupIDs)
+	return args.Error(0)
+}
+
+func (m *MockGroupRepo) DeleteGroup(groupID uuid.UUID) error {
+	args := m.Called(groupID)
+	return args.Error(0)
+}
+
+// testGroups has platform-team nesting backend, which nests sre, and a loop between ping and pong
+var testGroups = []models.Group{
+	{ID: uuid.Must(uuid.NewV4()), Name: "platform-team", Members: []string{"eshan", "kevin", "@backend"}},
+	{ID: uuid.Must(uuid.NewV4()), Name: "backend", Members: []string{"kevin", "marco", "@sre"}},
+	{ID: uuid.Must(uuid.NewV4()), Name: "sre", Members: []string{"anna"}},
+	{ID: uuid.Must(uuid.NewV4()), Name: "ping", Members: []string{"marco", "@pong"}},
+	{ID: uuid.Must(uuid.NewV4()), Name: "pong", Members: []string{"anna", "@ping"}},
+}
+
+func TestExpandParticipants(t *testing.T) {
+	groups := new(MockGroupRepo)
+	groups.On("ListGroups", testOrg.ID).Return(testGroups, nil)
+
+	t.Run("Nested", func(t *testing.T) {
+		expanded, via, err := expandParticipants(groups, testOrg.ID, []string{"marco", "@platform-team", "jane"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"marco", "eshan", "kevin", "anna", "jane"}, expanded)
+		assert.Equal(t, map[string]string{"eshan": "@platform-team", "kevin": "@platform-team", "anna": "@platform-team"}, via,
+			"users listed before the group keep being listed for themselves")
+	})
+
+	t.Run("Loop", func(t *testing.T) {
+		expanded, _, err := expandParticipants(groups, testOrg.ID, []string{"@ping"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"marco", "anna"}, expanded)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		_, _, err := expandParticipants(groups, testOrg.ID, []string{"@platform-team", "@ghosts"})
+		assert.ErrorIs(t, err, errUnknownGroup)
+		assert.ErrorContains(t, err, "@ghosts")
+	})
+
+	t.Run("No Groups", func(t *testing.T) {
+		noLookups := new(MockGroupRepo)
+		expanded, via, err := expandParticipants(noLookups, testOrg.ID, []string{"kevin"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"kevin"}, expanded)
+		assert.Empty(t, via)
+		noLookups.AssertNotCalled(t, "ListGroups", mock.Anything)
+	})
+}
+
+func TestGroupMembers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	kevin := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "kevin"}
+
+	setup := func() (*MockGroupRepo, *gin.Engine) {
+		mockGroupRepo := new(MockGroupRepo)
+		mockGroupRepo.On("ListGroups", testOrg.ID).Return(testGroups, nil)
+		for _, group := range testGroups {
+			mockGroupRepo.On("GetGroup", testOrg.ID, group.Name).Return(group, nil)
+		}
+		mockGroupRepo.On("GetGroup", testOrg.ID, mock.Anything).Return(models.Group{}, errors.New("no rows in result set"))
+		mockUserRepo := new(MockUserRepo)
+		mockUserRepo.On("GetUsersByNames", testOrg.ID, []string{"kevin"}).Return([]models.User{kevin}, nil)
+		mockUserRepo.On("GetUsersByNames", testOrg.ID, mock.Anything).Return([]models.User{}, nil)
+		groupService := &GroupService{GroupRepo: mockGroupRepo, UserRepo: mockUserRepo}
+
+		router := gin.New()
+		router.Use(withOrg(testOrg))
+		router.POST("/groups", groupService.CreateGroup)
+		router.GET("/groups/:name", groupService.GetGroup)
+		router.PUT("/groups/:name/members", groupService.SetGroupMembers)
+		return mockGroupRepo, router
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		mockGroupRepo, router := setup()
+		mockGroupRepo.On("CreateGroup", mock.Anything, []uuid.UUID{kevin.ID}, []uuid.UUID{testGroups[2].ID}).Return(nil)
+
+		body := models.GroupRequest{Name: "@on-call", Members: []string{"kevin", "@sre"}}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/groups", body))
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		var group models.Group
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &group))
+		assert.Equal(t, "on-call", group.Name)
+		assert.Equal(t, testOrg.ID, group.OrgID)
+	})
+
+	t.Run("Name Taken", func(t *testing.T) {
+		mockGroupRepo, router := setup()
+		mockGroupRepo.On("CreateGroup", mock.Anything, mock.Anything, mock.Anything).Return(repository.ErrGroupExists)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/groups", models.GroupRequest{Name: "sre"}))
+		assert.Equal(t, http.StatusConflict, recorder.Code)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for name, body := range map[string]models.GroupRequest{
+			"name with a space": {Name: "on call"},
+			"unknown user":      {Name: "on-call", Members: []string{"ghost"}},
+			"unknown group":     {Name: "on-call", Members: []string{"@ghosts"}},
+			"member twice":      {Name: "on-call", Members: []string{"kevin", "kevin"}},
+		} {
+			mockGroupRepo, router := setup()
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/groups", body))
+
+			assert.Equal(t, http.StatusBadRequest, recorder.Code, name)
+			mockGroupRepo.AssertNotCalled(t, "CreateGroup", mock.Anything, mock.Anything, mock.Anything)
+		}
+	})
+
+	t.Run("Nesting Loops", func(t *testing.T) {
+		for _, members := range [][]string{{"@sre"}, {"@platform-team"}, {"@backend"}} {
+			mockGroupRepo, router := setup()
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, newJSONRequest(http.MethodPut, "/groups/sre/members", models.GroupMembersRequest{Members: members}))
+
+			assert.Equal(t, http.StatusBadRequest, recorder.Code, members)
+			mockGroupRepo.AssertNotCalled(t, "SetGroupMembers", mock.Anything, mock.Anything, mock.Anything)
+		}
+	})
+
+	t.Run("Expanded", func(t *testing.T) {
+		_, router := setup()
+		req, _ := http.NewRequest(http.MethodGet, "/groups/@platform-team", nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var group models.Group
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &group))
+		assert.Equal(t, []string{"eshan", "kevin", "@backend"}, group.Members)
+		assert.Equal(t, []string{"eshan", "kevin", "marco", "anna"}, group.Expanded)
+	})
+}
+
+func TestCreateEventWithGroup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	timeSlot := "02 Jan 2025 2-4 PM MST"
+	users := map[string]models.User{}
+	for _, name := range []string{"eshan", "kevin", "marco", "anna"} {
+		users[name] = models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: name}
+	}
+
+	mockEventRepo := new(MockEventRepo)
+	mockEventRepo.On("GetConflictingEvents", mock.Anything, mock.Anything, uuid.Nil).Return([]models.EventConflict(nil), nil)
+	mockEventRepo.On("CreateEvent", mock.Anything).Return(nil)
+	mockTimeslotRepo := new(MockTimeslotRepo)
+	mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "eshan").Return([]string{timeSlot}, nil)
+	mockUserRepo := new(MockUserRepo)
+	mockUserRepo.On("Get", testOrg.ID, "eshan").Return(users["eshan"], nil)
+	mockUserRepo.On("GetUsersByNames", testOrg.ID, []string{"kevin", "marco", "anna"}).
+		Return([]models.User{users["kevin"], users["marco"], users["anna"]}, nil)
+	mockGroupRepo := new(MockGroupRepo)
+	mockGroupRepo.On("ListGroups", testOrg.ID).Return(testGroups, nil)
+	eventService := &EventService{EventRepo: mockEventRepo, TimeslotRepo: mockTimeslotRepo, UserRepo: mockUserRepo, GroupRepo: mockGroupRepo}
+
+	router := gin.New()
+	router.Use(withOrg(testOrg))
+	router.POST("/events", eventService.CreateEvent)
+
+	t.Run("Expanded", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newEventRequest(models.EventRequest{
+			Title: "Planning", EventOwner: "eshan", EventTimeSlot: timeSlot, Participants: []string{"@platform-team"},
+		}))
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		mockEventRepo.AssertCalled(t, "CreateEvent", mock.MatchedBy(func(event models.Event) bool {
+			// the owner is in platform-team but isn't invited to their own event
+			if len(event.Participants) != 3 {
+				return false
+			}
+			for i, name := range []string{"kevin", "marco", "anna"} {
+				p := event.Participants[i]
+				if p.Name != name || p.UserID.UUID != users[name].ID || p.Group != "@platform-team" {
+					return false
+				}
+			}
+			return true
+		}))
+	})
+
+	t.Run("Unknown Group", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newEventRequest(models.EventRequest{
+			Title: "Planning", EventOwner: "eshan", EventTimeSlot: timeSlot, Participants: []string{"@ghosts"},
+		}))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "@ghosts")
+	})
+}
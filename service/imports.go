@@ -0,0 +1,323 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+)
+
+// maxCalendarImportSize caps the size of an uploaded calendar
+const maxCalendarImportSize = 5 << 20
+
+// importedEventLabels mark the blocking events created by an import
+var importedEventLabels = map[string]string{"source": "calendar_import"}
+
+// ShowAccount godoc
+// @Summary      Import a calendar
+// @Description  Import an iCalendar file or VFREEBUSY document for a user. Free time (transparent events, FREEBUSY;FBTYPE=FREE)
+// @Description  becomes time slots and busy time becomes private blocking events. Items are keyed on their UID, importing
+// @Description  a UID again replaces what it was imported as before and an unchanged UID is left alone. Moved occurrences
+// @Description  of recurring events aren't imported. With preview=true nothing is written and the would-be changes are returned.
+// @Tags         Calendar
+// @Accept       text/calendar
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        username   path   string   true  "User Name"
+// @Param        preview   query   bool   false  "Only show what would change"
+// @Param        file   formData   file   false  "Calendar file, the request body is read as the calendar when there is none"
+// @Success      200  {object}  models.CalendarImportResponse
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{username}/calendar/import [post]
+func (cs *CalendarService) ImportCalendar(ctx *gin.Context) {
+	preview := ctx.Query("preview") == "true"
+
+	user, err := cs.UserRepo.Get(requestOrgID(ctx), ctx.Param("username"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return
+	}
+
+	data, err := readCalendarUpload(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	calendars, err := utils.ParseICS(data)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid calendar: " + err.Error()})
+		return
+	}
+
+	fingerprints, err := cs.ImportRepo.GetImportFingerprints(user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching previous imports"})
+		return
+	}
+
+	items := buildImportItems(user, calendars)
+	counts := map[string]int{}
+	for i, item := range items {
+		if item.Action != models.CalendarImportSkipped {
+			previous, imported := fingerprints[item.UID]
+			switch {
+			case !imported:
+				items[i].Action = models.CalendarImportCreate
+			case previous != item.Fingerprint:
+				items[i].Action = models.CalendarImportUpdate
+			default:
+				items[i].Action = models.CalendarImportUnchanged
+			}
+		}
+		counts[items[i].Action]++
+	}
+
+	if !preview {
+		err = cs.ImportRepo.ApplyCalendarImport(user.ID, items)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error importing calendar"})
+			return
+		}
+	}
+	ctx.JSON(http.StatusOK, models.CalendarImportResponse{Preview: preview, Items: items, Counts: counts})
+}
+
+// readCalendarUpload returns the uploaded file of a multipart request, or else the request body
+func readCalendarUpload(ctx *gin.Context) (string, error) {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxCalendarImportSize)
+
+	var r io.Reader = ctx.Request.Body
+	if strings.HasPrefix(ctx.ContentType(), "multipart/form-data") {
+		file, err := ctx.FormFile("file")
+		if err != nil {
+			return "", errors.New("calendar file is required")
+		}
+		f, err := file.Open()
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", errors.New("calendar is too large or couldn't be read")
+	}
+	return string(data), nil
+}
+
+// buildImportItems turns the events and free/busy documents of the calendars into one import item per UID,
+// the action of an item is left empty unless it is skipped
+func buildImportItems(user models.User, calendars []utils.ICSComponent) []models.CalendarImportItem {
+	var items []models.CalendarImportItem
+	seen := map[string]bool{}
+	add := func(item models.CalendarImportItem) {
+		if item.UID != "" && seen[item.UID] {
+			item.Action, item.Reason = models.CalendarImportSkipped, "duplicate UID"
+		}
+		seen[item.UID] = true
+		if item.Action != models.CalendarImportSkipped {
+			item.Fingerprint = importFingerprint(item)
+			for i := range item.Events {
+				item.Events[i].ID, _ = uuid.NewV4()
+			}
+		}
+		items = append(items, item)
+	}
+
+	for _, calendar := range calendars {
+		for _, component := range calendar.Components {
+			switch component.Name {
+			case "VEVENT":
+				// moved occurrences of a series share its UID, the series is imported as its rule describes
+				if _, ok := component.Property("RECURRENCE-ID"); ok {
+					continue
+				}
+				add(importEvent(user, component))
+			case "VFREEBUSY":
+				add(importFreeBusy(user, component))
+			}
+		}
+	}
+	return items
+}
+
+// importEvent imports a VEVENT, transparent events are free time and all others busy time. A cancelled
+// event imports as nothing, so importing it again removes what it was imported as before.
+func importEvent(user models.User, component utils.ICSComponent) models.CalendarImportItem {
+	item := models.CalendarImportItem{UID: component.PropertyValue("UID"), Summary: utils.ICSUnescapeText(component.PropertyValue("SUMMARY"))}
+	skip := func(reason string) models.CalendarImportItem {
+		item.Action, item.Reason = models.CalendarImportSkipped, reason
+		return item
+	}
+	if item.UID == "" {
+		return skip("missing UID")
+	}
+	if strings.EqualFold(component.PropertyValue("STATUS"), "CANCELLED") {
+		return item
+	}
+
+	dtstart, ok := component.Property("DTSTART")
+	if !ok {
+		return skip("missing DTSTART")
+	}
+	start, err := utils.ParseICSTime(dtstart, time.UTC)
+	if err != nil {
+		return skip(err.Error())
+	}
+
+	var end time.Time
+	if dtend, ok := component.Property("DTEND"); ok {
+		end, err = utils.ParseICSTime(dtend, time.UTC)
+	} else if duration := component.PropertyValue("DURATION"); duration != "" {
+		var d time.Duration
+		d, err = utils.ParseICSDuration(duration)
+		end = start.Add(d)
+	} else if dtstart.Params["VALUE"] == "DATE" {
+		end = start.AddDate(0, 0, 1)
+	}
+	if err != nil {
+		return skip(err.Error())
+	}
+	if !start.Before(end) {
+		return skip("event has no duration")
+	}
+
+	var exdates []time.Time
+	for _, prop := range component.PropertiesNamed("EXDATE") {
+		for _, value := range strings.Split(prop.Value, ",") {
+			prop.Value = value
+			exdate, err := utils.ParseICSTime(prop, start.Location())
+			if err != nil {
+				return skip(err.Error())
+			}
+			exdates = append(exdates, exdate)
+		}
+	}
+
+	var rule *utils.RRule
+	if value := component.PropertyValue("RRULE"); value != "" {
+		parsed, err := utils.ParseRRule(value)
+		if err != nil {
+			return skip(err.Error())
+		}
+		rule = &parsed
+	}
+
+	if strings.EqualFold(component.PropertyValue("TRANSP"), "TRANSPARENT") {
+		starts := []time.Time{start}
+		if rule != nil {
+			starts, err = rule.Starts(start)
+			if err != nil {
+				return skip(err.Error())
+			}
+		}
+		for _, s := range starts {
+			if slices.ContainsFunc(exdates, s.Equal) {
+				continue
+			}
+			item.TimeSlots = append(item.TimeSlots, utils.TimeSlotsWithin(s, s.Add(end.Sub(start)))...)
+		}
+		return item
+	}
+
+	event := blockingEvent(user, item.Summary, start, end)
+	event.Description = utils.ICSUnescapeText(component.PropertyValue("DESCRIPTION"))
+	event.Location = utils.ICSUnescapeText(component.PropertyValue("LOCATION"))
+	if rule != nil {
+		event.Recurrence = rule.String()
+		for _, exdate := range exdates {
+			event.Exceptions = append(event.Exceptions, models.EventException{OriginalStartTime: exdate, Cancelled: true})
+		}
+	}
+	item.Events = []models.Event{event}
+	return item
+}
+
+// importFreeBusy imports a VFREEBUSY, FREE periods are free time and every other type busy time
+func importFreeBusy(user models.User, component utils.ICSComponent) models.CalendarImportItem {
+	item := models.CalendarImportItem{UID: component.PropertyValue("UID"), Summary: utils.ICSUnescapeText(component.PropertyValue("SUMMARY"))}
+	if item.UID == "" {
+		item.Action, item.Reason = models.CalendarImportSkipped, "missing UID"
+		return item
+	}
+
+	for _, prop := range component.PropertiesNamed("FREEBUSY") {
+		free := strings.EqualFold(prop.Params["FBTYPE"], "FREE")
+		for _, period := range strings.Split(prop.Value, ",") {
+			start, end, err := utils.ParseICSPeriod(period, time.UTC)
+			if err == nil && !start.Before(end) {
+				err = errors.New("free/busy period has no duration")
+			}
+			if err != nil {
+				item.Action, item.Reason = models.CalendarImportSkipped, err.Error()
+				item.TimeSlots, item.Events = nil, nil
+				return item
+			}
+
+			if free {
+				item.TimeSlots = append(item.TimeSlots, utils.TimeSlotsWithin(start, end)...)
+			} else {
+				item.Events = append(item.Events, blockingEvent(user, "", start, end))
+			}
+		}
+	}
+	return item
+}
+
+// blockingEvent is a private, forced event holding the user's busy time, it neither needs free time nor reminds anyone
+func blockingEvent(user models.User, title string, start, end time.Time) models.Event {
+	if title == "" {
+		title = "Busy"
+	}
+	return models.Event{
+		Title:          title,
+		EventOwner:     user.ID,
+		EventStartTime: start,
+		EventEndTime:   end,
+		Participants:   []models.EventParticipant{},
+		Forced:         true,
+		Visibility:     models.EventVisibilityPrivate,
+		Labels:         importedEventLabels,
+		Reminders:      []string{},
+		Status:         models.EventStatusActive,
+	}
+}
+
+// importFingerprint hashes what an item imports as, event IDs aside since they are new on every import
+func importFingerprint(item models.CalendarImportItem) string {
+	type fingerprintedEvent struct {
+		Title, Description, Location, Recurrence string
+		Start, End                               time.Time
+		Exceptions                               []models.EventException
+	}
+	content := struct {
+		TimeSlots []string
+		Events    []fingerprintedEvent
+	}{TimeSlots: item.TimeSlots}
+	for _, e := range item.Events {
+		content.Events = append(content.Events, fingerprintedEvent{e.Title, e.Description, e.Location, e.Recurrence,
+			e.EventStartTime.UTC(), e.EventEndTime.UTC(), e.Exceptions})
+	}
+
+	encoded, _ := json.Marshal(content)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"timeslot-app/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockCalendarImportRepo struct {
+	mock.Mock
+}
+
+func (m *MockCalendarImportRepo) GetImportFingerprints(userID uuid.UUID) (map[string]string, error) {
+	args := m.Called(userID)
+	return args.Get(0).(map[string]string), args.Error(1)
+}
+
+func (m *MockCalendarImportRepo) ApplyCalendarImport(userID uuid.UUID, items []models.CalendarImportItem) error {
+	args := m.Called(userID, items)
+	return args.Error(0)
+}
+
+const importCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Example//EN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:office-hours@example.com\r\n" +
+	"SUMMARY:Office hours\r\n" +
+	"DTSTART;TZID=America/New_York:20250106T090000\r\n" +
+	"DTEND;TZID=America/New_York:20250106T110000\r\n" +
+	"RRULE:FREQ=WEEKLY;COUNT=3\r\n" +
+	"EXDATE;TZID=America/New_York:20250113T090000\r\n" +
+	"TRANSP:TRANSPARENT\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:dentist@example.com\r\n" +
+	"SUMMARY:Dentist\\, downtown\r\n" +
+	"DTSTART:20250107T150000Z\r\n" +
+	"DURATION:PT1H30M\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:No UID\r\n" +
+	"DTSTART:20250108T150000Z\r\n" +
+	"DTEND:20250108T160000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VFREEBUSY\r\n" +
+	"UID:freebusy@example.com\r\n" +
+	"FREEBUSY;FBTYPE=FREE:20250109T133000Z/20250109T161500Z\r\n" +
+	"FREEBUSY;FBTYPE=BUSY:20250110T090000Z/PT2H,20250110T140000Z/20250110T150000Z\r\n" +
+	"END:VFREEBUSY\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestImportCalendar(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID, _ := uuid.NewV4()
+	user := models.User{ID: userID, Name: "kevin"}
+
+	setup := func(fingerprints map[string]string) (*MockCalendarImportRepo, *gin.Engine) {
+		mockUserRepo := new(MockUserRepo)
+		mockImportRepo := new(MockCalendarImportRepo)
+		calendarService := &CalendarService{UserRepo: mockUserRepo, ImportRepo: mockImportRepo}
+
+		mockUserRepo.On("Get", testOrg.ID, "kevin").Return(user, nil)
+		mockImportRepo.On("GetImportFingerprints", userID).Return(fingerprints, nil)
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
+		router.POST("/users/:username/calendar/import", calendarService.ImportCalendar)
+		return mockImportRepo, router
+	}
+	importRequest := func(query string) *http.Request {
+		req, _ := http.NewRequest(http.MethodPost, "/users/kevin/calendar/import"+query, strings.NewReader(importCalendar))
+		req.Header.Set("Content-Type", "text/calendar")
+		return req
+	}
+	decode := func(resp *httptest.ResponseRecorder) (models.CalendarImportResponse, map[string]models.CalendarImportItem) {
+		var body models.CalendarImportResponse
+		json.Unmarshal(resp.Body.Bytes(), &body)
+		items := map[string]models.CalendarImportItem{}
+		for _, item := range body.Items {
+			items[item.UID] = item
+		}
+		return body, items
+	}
+
+	t.Run("Preview", func(t *testing.T) {
+		mockImportRepo, router := setup(map[string]string{})
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, importRequest("?preview=true"))
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		body, items := decode(resp)
+		assert.True(t, body.Preview)
+		assert.Equal(t, map[string]int{models.CalendarImportCreate: 3, models.CalendarImportSkipped: 1}, body.Counts)
+
+		// the excluded week is left out
+		assert.Equal(t, []string{"06 Jan 2025 9-11 AM America/New_York", "20 Jan 2025 9-11 AM America/New_York"}, items["office-hours@example.com"].TimeSlots)
+
+		dentist := items["dentist@example.com"]
+		assert.Len(t, dentist.Events, 1)
+		assert.Equal(t, "Dentist, downtown", dentist.Events[0].Title)
+		assert.Equal(t, 90*time.Minute, dentist.Events[0].EventEndTime.Sub(dentist.Events[0].EventStartTime))
+		assert.True(t, dentist.Events[0].Forced)
+		assert.Equal(t, models.EventVisibilityPrivate, dentist.Events[0].Visibility)
+
+		freebusy := items["freebusy@example.com"]
+		assert.Equal(t, []string{"09 Jan 2025 1:30-4:15 PM UTC"}, freebusy.TimeSlots)
+		assert.Len(t, freebusy.Events, 2)
+		assert.Equal(t, "Busy", freebusy.Events[0].Title)
+
+		assert.Equal(t, "missing UID", items[""].Reason)
+		mockImportRepo.AssertNotCalled(t, "ApplyCalendarImport", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Reimport Is Idempotent", func(t *testing.T) {
+		mockImportRepo, router := setup(map[string]string{})
+		var applied []models.CalendarImportItem
+		mockImportRepo.On("ApplyCalendarImport", userID, mock.Anything).Run(func(args mock.Arguments) {
+			applied = args.Get(1).([]models.CalendarImportItem)
+		}).Return(nil)
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, importRequest(""))
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		fingerprints := map[string]string{}
+		for _, item := range applied {
+			if item.Action == models.CalendarImportCreate {
+				fingerprints[item.UID] = item.Fingerprint
+			}
+		}
+		fingerprints["dentist@example.com"] = "changed upstream"
+
+		mockImportRepo, router = setup(fingerprints)
+		mockImportRepo.On("ApplyCalendarImport", userID, mock.Anything).Return(nil)
+
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, importRequest(""))
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		body, items := decode(resp)
+		assert.False(t, body.Preview)
+		assert.Equal(t, models.CalendarImportUnchanged, items["office-hours@example.com"].Action)
+		assert.Equal(t, models.CalendarImportUnchanged, items["freebusy@example.com"].Action)
+		assert.Equal(t, models.CalendarImportUpdate, items["dentist@example.com"].Action)
+	})
+
+	t.Run("Multipart Upload", func(t *testing.T) {
+		mockImportRepo, router := setup(map[string]string{})
+
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		part, _ := writer.CreateFormFile("file", "calendar.ics")
+		part.Write([]byte(importCalendar))
+		writer.Close()
+
+		req, _ := http.NewRequest(http.MethodPost, "/users/kevin/calendar/import?preview=true", &buf)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		body, _ := decode(resp)
+		assert.Len(t, body.Items, 4)
+		mockImportRepo.AssertNotCalled(t, "ApplyCalendarImport", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Invalid Calendar", func(t *testing.T) {
+		_, router := setup(map[string]string{})
+
+		req, _ := http.NewRequest(http.MethodPost, "/users/kevin/calendar/import", strings.NewReader("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n"))
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+}
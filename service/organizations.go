@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"timeslot-app/middleware"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+// orgSlugPattern keeps slugs usable as a subdomain label
+var orgSlugPattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// maxOrgNameLength matches the organizations.name column
+const maxOrgNameLength = 100
+
+// requestOrgID is the organization the request is made in, every name or ID taken from the request is looked up within it
+func requestOrgID(ctx *gin.Context) uuid.UUID {
+	org, _ := middleware.CurrentOrg(ctx)
+	return org.ID
+}
+
+type OrgService struct {
+	OrgRepo    repository.OrganizationRepo
+	APIKeyRepo repository.APIKeyRepo
+}
+
+func NewOrgService(db *pgx.ConnPool) *OrgService {
+	return &OrgService{
+		OrgRepo:    repository.NewOrganizationRepository(db),
+		APIKeyRepo: repository.NewAPIKeyRepository(db),
+	}
+}
+
+// ShowAccount godoc
+// @Summary      Create an organization
+// @Description  Create an organization together with its first user, who is its admin. The response carries the
+// @Description  API key of the admin which is not shown again. Requests are made in the organization by sending its
+// @Description  slug in the X-Org header or by using it as the subdomain. Only users who are signed in create
+// @Description  organizations.
+// @Tags         Organizations
+// @Accept       json
+// @Produce      json
+// @Param        body   body   	models.OrganizationCreateRequest   true "Create Organization request body"
+// @Success      201  {object}  models.OrganizationCreatedResponse
+// @Failure      400  {object}  models.ServiceError
+// @Failure      401  {object}  models.ServiceError
+// @Failure      409  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /orgs [post]
+func (orgs *OrgService) CreateOrg(ctx *gin.Context) {
+	var orgReq models.OrganizationCreateRequest
+	if err := ctx.BindJSON(&orgReq); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	slug := strings.ToLower(strings.TrimSpace(orgReq.Slug))
+	if !orgSlugPattern.MatchString(slug) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "slug must be up to 63 lowercase letters, digits and dashes, not starting or ending with a dash"})
+		return
+	}
+	name := strings.TrimSpace(orgReq.Name)
+	if name == "" || len(name) > maxOrgNameLength {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name must be between 1 and %d characters", maxOrgNameLength)})
+		return
+	}
+	adminName := strings.TrimSpace(orgReq.AdminName)
+	if adminName == "" || len(adminName) > maxUserNameLength {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("admin_name must be between 1 and %d characters", maxUserNameLength)})
+		return
+	}
+
+	orgID, _ := uuid.NewV4()
+	adminID, _ := uuid.NewV4()
+	org := models.Organization{ID: orgID, Slug: slug, Name: name, CreatedAt: time.Now().UTC()}
+	admin := models.User{ID: adminID, OrgID: orgID, Name: adminName, Role: models.RoleAdmin}
+
+	err := orgs.OrgRepo.CreateOrganization(org, admin)
+	if errors.Is(err, repository.ErrOrganizationExists) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating organization"})
+		return
+	}
+
+	key, err := issueAPIKey(orgs.APIKeyRepo, admin.ID, "default", nil)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Organization created but the API key of its admin could not be issued"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, models.OrganizationCreatedResponse{Organization: org, Admin: admin, APIKey: key})
+}
+
+// ShowAccount godoc
+// @Summary      Current organization
+// @Description  Get the organization the request is made in
+// @Tags         Organizations
+// @Produce      json
+// @Success      200  {object}  models.Organization
+// @Failure      404  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /orgs/current [get]
+func (orgs *OrgService) GetCurrentOrg(ctx *gin.Context) {
+	org, found := middleware.CurrentOrg(ctx)
+	if !found {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "organization does not exist"})
+		return
+	}
+	ctx.JSON(http.StatusOK, org)
+}
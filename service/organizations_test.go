@@ -0,0 +1,202 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"timeslot-app/middleware"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// testOrg is the organization the requests of the service tests are made in
+var testOrg = models.Organization{ID: uuid.Must(uuid.NewV4()), Slug: "acme", Name: "Acme"}
+
+// withOrg stands in for the tenancy middleware
+func withOrg(org models.Organization) gin.HandlerFunc {
+	return func(ctx *gin.Context) { middleware.SetOrg(ctx, org) }
+}
+
+type MockOrgRepo struct {
+	mock.Mock
+}
+
+func (m *MockOrgRepo) CreateOrganization(org models.Organization, admin models.User) error {
+	args := m.Called(org, admin)
+	return args.Error(0)
+}
+
+func (m *MockOrgRepo) GetOrganizationBySlug(slug string) (models.Organization, error) {
+	args := m.Called(slug)
+	return args.Get(0).(models.Organization), args.Error(1)
+}
+
+func TestCreateOrg(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	setup := func() (*MockOrgRepo, *MockAPIKeyRepo, *gin.Engine) {
+		mockOrgRepo := new(MockOrgRepo)
+		mockAPIKeyRepo := new(MockAPIKeyRepo)
+		orgService := &OrgService{OrgRepo: mockOrgRepo, APIKeyRepo: mockAPIKeyRepo}
+
+		router := gin.Default()
+		router.POST("/orgs", orgService.CreateOrg)
+		return mockOrgRepo, mockAPIKeyRepo, router
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mockOrgRepo, mockAPIKeyRepo, router := setup()
+		mockOrgRepo.On("CreateOrganization", mock.MatchedBy(func(org models.Organization) bool {
+			return org.Slug == "platform" && org.Name == "Platform Engineering" && org.ID != uuid.Nil
+		}), mock.MatchedBy(func(admin models.User) bool {
+			return admin.Name == "alex" && admin.Role == models.RoleAdmin && admin.OrgID != uuid.Nil
+		})).Return(nil)
+		mockAPIKeyRepo.On("CreateAPIKey", mock.Anything, mock.Anything).Return(nil)
+
+		body := models.OrganizationCreateRequest{Slug: "Platform", Name: "Platform Engineering", AdminName: "alex"}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/orgs", body))
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		var response models.OrganizationCreatedResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, "platform", response.Organization.Slug)
+		assert.Equal(t, response.Organization.ID, response.Admin.OrgID)
+		assert.Equal(t, response.Admin.ID, response.APIKey.UserID)
+		assert.NotEmpty(t, response.APIKey.Key)
+	})
+
+	t.Run("Slug Taken", func(t *testing.T) {
+		mockOrgRepo, mockAPIKeyRepo, router := setup()
+		mockOrgRepo.On("CreateOrganization", mock.Anything, mock.Anything).Return(repository.ErrOrganizationExists)
+
+		body := models.OrganizationCreateRequest{Slug: "platform", Name: "Platform", AdminName: "alex"}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/orgs", body))
+
+		assert.Equal(t, http.StatusConflict, recorder.Code)
+		mockAPIKeyRepo.AssertNotCalled(t, "CreateAPIKey", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for name, body := range map[string]models.OrganizationCreateRequest{
+			"empty slug":        {Slug: "", Name: "Platform", AdminName: "alex"},
+			"slug with a dot":   {Slug: "platform.team", Name: "Platform", AdminName: "alex"},
+			"slug with a space": {Slug: "platform team", Name: "Platform", AdminName: "alex"},
+			"leading dash":      {Slug: "-platform", Name: "Platform", AdminName: "alex"},
+			"no name":           {Slug: "platform", Name: " ", AdminName: "alex"},
+			"no admin":          {Slug: "platform", Name: "Platform"},
+		} {
+			mockOrgRepo, _, router := setup()
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/orgs", body))
+
+			assert.Equal(t, http.StatusBadRequest, recorder.Code, name)
+			mockOrgRepo.AssertNotCalled(t, "CreateOrganization", mock.Anything, mock.Anything)
+		}
+	})
+}
+
+// TestCrossTenantIsolation makes requests in one organization for data of another that uses the same names,
+// every lookup must be made in the organization of the request
+func TestCrossTenantIsolation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	orgA := models.Organization{ID: uuid.Must(uuid.NewV4()), Slug: "acme", Name: "Acme"}
+	orgB := models.Organization{ID: uuid.Must(uuid.NewV4()), Slug: "globex", Name: "Globex"}
+	alexA := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: orgA.ID, Name: "alex", Role: models.RoleMember}
+	alexB := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: orgB.ID, Name: "alex", Role: models.RoleMember}
+	eventOfA := models.Event{ID: uuid.Must(uuid.NewV4()), EventOwner: alexA.ID, Status: models.EventStatusActive}
+
+	mockUserRepo := new(MockUserRepo)
+	mockUserRepo.On("Get", orgA.ID, "alex").Return(alexA, nil)
+	mockUserRepo.On("Get", orgB.ID, "alex").Return(alexB, nil)
+	mockUserRepo.On("GetByID", orgA.ID, alexA.ID).Return(alexA, nil)
+	mockUserRepo.On("GetByID", orgB.ID, alexB.ID).Return(alexB, nil)
+	mockUserRepo.On("GetByID", mock.Anything, mock.Anything).Return(models.User{}, pgx.ErrNoRows)
+	mockTimeslotRepo := new(MockTimeslotRepo)
+	mockTimeslotRepo.On("GetTimeSlotsByUserName", orgA.ID, "alex").Return([]string{"02 Jan 2025 1-3 PM UTC"}, nil)
+	mockTimeslotRepo.On("GetTimeSlotsByUserName", orgB.ID, "alex").Return([]string{"03 Jan 2025 9-11 AM UTC"}, nil)
+	mockEventRepo := new(MockEventRepo)
+	mockEventRepo.On("GetEvent", orgA.ID, eventOfA.ID.String()).Return(eventOfA, nil)
+	mockEventRepo.On("GetEvent", mock.Anything, mock.Anything).Return(models.Event{}, pgx.ErrNoRows)
+	mockEventRepo.On("GetEventPageForUser", orgB.ID, "alex", models.EventFilter{}, mock.Anything).Return([]models.Event{}, 0, nil)
+	mockWebhookRepo := new(MockWebhookRepo)
+	mockWebhookRepo.On("ListWebhooks", orgB.ID).Return([]models.Webhook{}, nil)
+
+	timeslotService := &TimeslotServiceImplementaion{TimeslotRepo: mockTimeslotRepo, UserRepo: mockUserRepo}
+	userService := &UserService{userRepo: mockUserRepo}
+	eventService := &EventService{EventRepo: mockEventRepo, UserRepo: mockUserRepo}
+	webhookService := &WebhookService{WebhookRepo: mockWebhookRepo}
+
+	router := gin.New()
+	router.Use(withOrg(orgB))
+	router.GET("/timeslots/:username", timeslotService.GetTimeSlotsByUserName)
+	router.GET("/users/:id", userService.GetUser)
+	router.GET("/events/:username", eventService.GetEventsForUser)
+	router.DELETE("/events/:eventID", eventService.DeleteEvent)
+	router.GET("/webhooks", webhookService.ListWebhooks)
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, target, nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("Same Name", func(t *testing.T) {
+		recorder := serve(http.MethodGet, "/timeslots/alex")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "03 Jan 2025")
+		assert.NotContains(t, recorder.Body.String(), "02 Jan 2025")
+
+		recorder = serve(http.MethodGet, "/events/alex")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		mockEventRepo.AssertNotCalled(t, "GetEventPageForUser", orgA.ID, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("User ID Of Another Organization", func(t *testing.T) {
+		recorder := serve(http.MethodGet, "/users/"+alexA.ID.String())
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+		recorder = serve(http.MethodGet, "/users/"+alexB.ID.String())
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+
+	t.Run("Event Of Another Organization", func(t *testing.T) {
+		recorder := serve(http.MethodDelete, "/events/"+eventOfA.ID.String())
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+		mockEventRepo.AssertNotCalled(t, "CancelEvent", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Webhooks", func(t *testing.T) {
+		recorder := serve(http.MethodGet, "/webhooks")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		mockWebhookRepo.AssertNotCalled(t, "ListWebhooks", orgA.ID)
+	})
+
+	t.Run("Sign Up", func(t *testing.T) {
+		mockUserRepo := new(MockUserRepo)
+		mockAPIKeyRepo := new(MockAPIKeyRepo)
+		userService := &UserService{userRepo: mockUserRepo, apiKeyRepo: mockAPIKeyRepo}
+		mockUserRepo.On("Create", mock.Anything).Return(nil)
+		mockAPIKeyRepo.On("CreateAPIKey", mock.Anything, mock.Anything).Return(nil)
+
+		router := gin.New()
+		router.Use(withOrg(orgB))
+		router.POST("/user", userService.CreateUser)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/user", models.UserCreateRequest{Name: "alex"}))
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		mockUserRepo.AssertCalled(t, "Create", mock.MatchedBy(func(user models.User) bool {
+			return user.OrgID == orgB.ID && user.Role == models.RoleMember
+		}))
+	})
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+	"timeslot-app/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+)
+
+// profilesOf returns the profiles of the named users, users without one get the default profile. Services that
+// aren't given a profile repository use the default profile for everybody.
+func profilesOf(repo repository.ProfileRepo, orgID uuid.UUID, userNames ...string) (map[string]models.UserProfile, error) {
+	profiles := map[string]models.UserProfile{}
+	if repo != nil && len(userNames) > 0 {
+		var err error
+		profiles, err = repo.GetProfilesByNames(orgID, userNames)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range userNames {
+		if _, found := profiles[name]; !found {
+			profiles[name] = models.DefaultUserProfile()
+		}
+	}
+	return profiles, nil
+}
+
+// profileOf returns the profile of a single user, see profilesOf
+func profileOf(repo repository.ProfileRepo, orgID uuid.UUID, userName string) (models.UserProfile, error) {
+	profiles, err := profilesOf(repo, orgID, userName)
+	return profiles[userName], err
+}
+
+// ShowAccount godoc
+// @Summary      Get a user's profile
+// @Description  Get the home time zone, locale, working hours, default buffers, preferred meeting times and
+// @Description  notification settings of a user. Users who haven't set a profile get the default one.
+// @Tags         Users
+// @Produce      json
+// @Param        username   path   string   true  "User Name"
+// @Success      200  {object}  models.UserProfile
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{username}/profile [get]
+func (us *UserService) GetProfile(ctx *gin.Context) {
+	user, err := us.userRepo.Get(requestOrgID(ctx), ctx.Param("username"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return
+	}
+
+	profile, err := us.profileRepo.GetProfile(user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching profile"})
+		return
+	}
+	ctx.JSON(http.StatusOK, profile)
+}
+
+// ShowAccount godoc
+// @Summary      Set a user's profile
+// @Description  Replace the profile of a user. Time slots the user gives without a zone are taken to be in the home
+// @Description  time zone, and event times shown to the user are rendered in it. Recommendations favour slots within
+// @Description  the working hours and preferred times of the attendees. Turning reminders off drops the pending ones.
+// @Description  Fields left out keep their default values.
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        username   path   string   true  "User Name"
+// @Param        body   body   	models.UserProfile   true "Profile"
+// @Success      200  {object}  models.UserProfile
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{username}/profile [put]
+func (us *UserService) SetProfile(ctx *gin.Context) {
+	// fields left out of the request keep their defaults
+	profile := models.DefaultUserProfile()
+	if err := ctx.BindJSON(&profile); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := utils.NormalizeProfile(&profile); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if profile.BufferBeforeMinutes > maxEventTypeBuffer || profile.BufferAfterMinutes > maxEventTypeBuffer {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("buffers must be between 0 and %d minutes", maxEventTypeBuffer)})
+		return
+	}
+
+	user, err := us.userRepo.Get(requestOrgID(ctx), ctx.Param("username"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return
+	}
+
+	err = us.profileRepo.SetProfile(user.ID, profile)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving profile"})
+		return
+	}
+	ctx.JSON(http.StatusOK, profile)
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"timeslot-app/middleware"
+	"timeslot-app/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockProfileRepo struct {
+	mock.Mock
+}
+
+func (m *MockProfileRepo) GetProfile(userID uuid.UUID) (models.UserProfile, error) {
+	args := m.Called(userID)
+	return args.Get(0).(models.UserProfile), args.Error(1)
+}
+
+func (m *MockProfileRepo) GetProfilesByNames(orgID uuid.UUID, userNames []string) (map[string]models.UserProfile, error) {
+	args := m.Called(orgID, userNames)
+	return args.Get(0).(map[string]models.UserProfile), args.Error(1)
+}
+
+func (m *MockProfileRepo) SetProfile(userID uuid.UUID, profile models.UserProfile) error {
+	args := m.Called(userID, profile)
+	return args.Error(0)
+}
+
+// berlinProfile is the profile of a user working 9 to 5 in Berlin who prefers meetings in the late morning
+func berlinProfile() models.UserProfile {
+	profile := models.DefaultUserProfile()
+	profile.TimeZone = "Europe/Berlin"
+	profile.Locale = "de-DE"
+	profile.PreferredTimes = []models.DayWindow{{Start: "10:00", End: "12:00"}}
+	profile.BufferBeforeMinutes = 5
+	profile.BufferAfterMinutes = 15
+	return profile
+}
+
+func TestProfileSettings(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	eshan := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "eshan"}
+
+	setup := func() (*MockProfileRepo, *gin.Engine) {
+		mockUserRepo := new(MockUserRepo)
+		mockUserRepo.On("Get", testOrg.ID, "eshan").Return(eshan, nil)
+		mockProfileRepo := new(MockProfileRepo)
+		userService := &UserService{userRepo: mockUserRepo, profileRepo: mockProfileRepo}
+
+		router := gin.New()
+		router.Use(withOrg(testOrg))
+		router.GET("/users/:username/profile", userService.GetProfile)
+		router.PUT("/users/:username/profile", userService.SetProfile)
+		return mockProfileRepo, router
+	}
+
+	t.Run("Get", func(t *testing.T) {
+		mockProfileRepo, router := setup()
+		mockProfileRepo.On("GetProfile", eshan.ID).Return(models.DefaultUserProfile(), nil)
+
+		req, _ := http.NewRequest(http.MethodGet, "/users/eshan/profile", nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var profile models.UserProfile
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &profile))
+		assert.Equal(t, "UTC", profile.TimeZone)
+		assert.True(t, profile.Notifications.Reminders)
+	})
+
+	t.Run("Set", func(t *testing.T) {
+		mockProfileRepo, router := setup()
+		mockProfileRepo.On("SetProfile", eshan.ID, mock.Anything).Return(nil)
+
+		body := map[string]any{
+			"time_zone":       "Europe/Berlin",
+			"locale":          "de-DE",
+			"working_hours":   map[string]any{"days": []string{"Mon", "tue", "mon"}, "start": "08:30", "end": "16:30"},
+			"preferred_times": []map[string]string{{"start": "10:00", "end": "12:00"}},
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPut, "/users/eshan/profile", body))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		mockProfileRepo.AssertCalled(t, "SetProfile", eshan.ID, mock.MatchedBy(func(profile models.UserProfile) bool {
+			// weekdays are lowercased and deduplicated, left out fields keep their defaults
+			return profile.TimeZone == "Europe/Berlin" && len(profile.WorkingHours.Days) == 2 &&
+				profile.WorkingHours.Days[0] == "mon" && profile.Notifications.Reminders
+		}))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for name, body := range map[string]map[string]any{
+			"unknown zone":        {"time_zone": "Mars/Olympus_Mons"},
+			"local zone":          {"time_zone": "Local"},
+			"locale":              {"locale": "en_US!"},
+			"weekday":             {"working_hours": map[string]any{"days": []string{"monday"}, "start": "09:00", "end": "17:00"}},
+			"working hours":       {"working_hours": map[string]any{"days": []string{"mon"}, "start": "17:00", "end": "09:00"}},
+			"clock":               {"preferred_times": []map[string]string{{"start": "9am", "end": "11:00"}}},
+			"negative buffer":     {"buffer_before_minutes": -5},
+			"buffer over maximum": {"buffer_after_minutes": maxEventTypeBuffer + 1},
+		} {
+			mockProfileRepo, router := setup()
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, newJSONRequest(http.MethodPut, "/users/eshan/profile", body))
+
+			assert.Equal(t, http.StatusBadRequest, recorder.Code, name)
+			mockProfileRepo.AssertNotCalled(t, "SetProfile", mock.Anything, mock.Anything)
+		}
+	})
+}
+
+func TestProfileDefaults(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	eshan := models.User{ID: uuid.Must(uuid.NewV4()), OrgID: testOrg.ID, Name: "eshan"}
+	mockUserRepo := new(MockUserRepo)
+	mockUserRepo.On("Get", testOrg.ID, "eshan").Return(eshan, nil)
+	mockProfileRepo := new(MockProfileRepo)
+	mockProfileRepo.On("GetProfilesByNames", testOrg.ID, []string{"eshan"}).Return(map[string]models.UserProfile{"eshan": berlinProfile()}, nil)
+	// kevin hasn't set a profile, so they work 9 to 5 in UTC
+	mockProfileRepo.On("GetProfilesByNames", testOrg.ID, []string{"eshan", "kevin"}).Return(map[string]models.UserProfile{"eshan": berlinProfile()}, nil)
+
+	t.Run("Time Slots Without A Zone", func(t *testing.T) {
+		mockTimeslotRepo := new(MockTimeslotRepo)
+		mockTimeslotRepo.On("Create", mock.Anything).Return(nil)
+		timeslotService := &TimeslotServiceImplementaion{TimeslotRepo: mockTimeslotRepo, UserRepo: mockUserRepo, ProfileRepo: mockProfileRepo}
+
+		router := gin.New()
+		router.Use(withOrg(testOrg))
+		router.POST("/timeslot", timeslotService.CreateTimeSlot)
+		body := models.UserTimeSlotRequest{UserName: "eshan", TimeSlots: []string{"06 Jan 2025 2-4 PM", "07 Jan 2025 9-10 AM UTC"}}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/timeslot", body))
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		mockTimeslotRepo.AssertCalled(t, "Create", mock.MatchedBy(func(slots []models.TimeSlot) bool {
+			return len(slots) == 2 && slots[0].TimeSlot == "06 Jan 2025 2-4 PM Europe/Berlin" &&
+				slots[1].TimeSlot == "07 Jan 2025 9-10 AM UTC"
+		}))
+	})
+
+	t.Run("Recommendations", func(t *testing.T) {
+		mockTimeslotRepo := new(MockTimeslotRepo)
+		// 6 AM UTC is before the working hours of both, 10 AM UTC is within both and preferred by eshan
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "eshan").Return([]string{
+			"06 Jan 2025 6-7 AM UTC", "06 Jan 2025 10-11 AM UTC", "06 Jan 2025 2-3 PM UTC",
+		}, nil)
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "kevin").Return([]string{"06 Jan 2025 6-11 AM UTC"}, nil)
+		timeslotService := &TimeslotServiceImplementaion{TimeslotRepo: mockTimeslotRepo, UserRepo: mockUserRepo, ProfileRepo: mockProfileRepo}
+
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		middleware.SetOrg(ctx, testOrg)
+		matched, partial, err := timeslotService.RecommendSlotsReconciler(ctx, "eshan", []string{"kevin"}, time.Hour)
+
+		assert.NoError(t, err)
+		assert.Len(t, matched, 2)
+		assert.Equal(t, time.Date(2025, 1, 6, 10, 0, 0, 0, time.UTC), matched[0].StartTime.UTC(), "the slot within everybody's working hours comes first")
+		assert.Equal(t, "Europe/Berlin", matched[0].StartTime.Location().String(), "slots are rendered in the organizer's home time zone")
+		assert.Len(t, partial, 1)
+	})
+
+	t.Run("Event Listing", func(t *testing.T) {
+		mockEventRepo := new(MockEventRepo)
+		mockEventRepo.On("GetEventPageForUser", testOrg.ID, "eshan", models.EventFilter{}, mock.Anything).Return([]models.Event{{
+			ID: uuid.Must(uuid.NewV4()), Title: "Planning", EventOwner: eshan.ID, Status: models.EventStatusActive,
+			EventStartTime: time.Date(2025, 1, 6, 14, 0, 0, 0, time.UTC), EventEndTime: time.Date(2025, 1, 6, 15, 0, 0, 0, time.UTC),
+		}}, 1, nil)
+		eventService := &EventService{EventRepo: mockEventRepo, UserRepo: mockUserRepo, ProfileRepo: mockProfileRepo}
+
+		router := gin.New()
+		router.Use(withOrg(testOrg))
+		router.GET("/events/:username", eventService.GetEventsForUser)
+		req, _ := http.NewRequest(http.MethodGet, "/events/eshan", nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `"2025-01-06T15:00:00+01:00"`)
+	})
+
+	t.Run("Event Type Buffers", func(t *testing.T) {
+		mockEventTypeRepo := new(MockEventTypeRepo)
+		mockEventTypeRepo.On("CreateEventType", mock.Anything).Return(nil)
+		bookingService := &BookingService{EventTypeRepo: mockEventTypeRepo, UserRepo: mockUserRepo, ProfileRepo: mockProfileRepo}
+
+		router := gin.New()
+		router.Use(withOrg(testOrg))
+		router.POST("/users/:username/event-types", bookingService.CreateEventType)
+		noBuffer := 0
+		for _, req := range []models.EventTypeRequest{
+			{Slug: "intro", Title: "Intro", DurationMinutes: 30},
+			{Slug: "quick", Title: "Quick", DurationMinutes: 15, BufferAfterMinutes: &noBuffer},
+		} {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/users/eshan/event-types", req))
+			assert.Equal(t, http.StatusCreated, recorder.Code)
+		}
+
+		mockEventTypeRepo.AssertCalled(t, "CreateEventType", mock.MatchedBy(func(et models.EventType) bool {
+			return et.Slug == "intro" && et.BufferBeforeMinutes == 5 && et.BufferAfterMinutes == 15
+		}))
+		mockEventTypeRepo.AssertCalled(t, "CreateEventType", mock.MatchedBy(func(et models.EventType) bool {
+			return et.Slug == "quick" && et.BufferBeforeMinutes == 5 && et.BufferAfterMinutes == 0
+		}))
+	})
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+	"timeslot-app/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+// ShowAccount godoc
+// @Summary      Update an occurrence of a recurring Event
+// @Description  Cancel or move a single occurrence of a recurring Event, or that occurrence and every following one.
+// @Description  A this_and_following change ends the series before the occurrence and continues it as a new Event.
+// @Tags         Events
+// @Accept       json
+// @Produce      json
+// @Param        eventID   path   string   true  "Event ID"
+// @Param        body   body   	models.OccurrenceUpdateRequest   true "Occurrence update request body"
+// @Success      200  {object}  models.Event
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      409  {object}  models.EventConflictResponse
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /events/{eventID}/occurrences [patch]
+func (es *EventService) UpdateOccurrence(ctx *gin.Context) {
+	eventID := ctx.Param("eventID")
+	if _, err := uuid.FromString(eventID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	var occurrenceReq models.OccurrenceUpdateRequest
+	if err := ctx.BindJSON(&occurrenceReq); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if occurrenceReq.Scope == "" {
+		occurrenceReq.Scope = models.OccurrenceScopeThis
+	}
+	if occurrenceReq.Scope != models.OccurrenceScopeThis && occurrenceReq.Scope != models.OccurrenceScopeThisAndFollowing {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Scope must be this or this_and_following"})
+		return
+	}
+	if !occurrenceReq.Cancel && occurrenceReq.EventTimeSlot == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Either cancel or a new event time slot is required"})
+		return
+	}
+
+	event, err := es.EventRepo.GetEvent(requestOrgID(ctx), eventID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if event.Status == models.EventStatusCancelled {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Event is cancelled, restore it before changing it"})
+		return
+	}
+	if event.Recurrence == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Event does not recur"})
+		return
+	}
+
+	rule, err := utils.ParseRRule(event.Recurrence)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	starts, err := rule.Starts(event.EventStartTime)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	idx := slices.IndexFunc(starts, func(t time.Time) bool { return t.Equal(occurrenceReq.OriginalStartTime) })
+	if idx < 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Occurrence not found"})
+		return
+	}
+	originalStart := starts[idx]
+
+	var newStart, newEnd time.Time
+	if !occurrenceReq.Cancel {
+		owner, err := es.UserRepo.GetByID(requestOrgID(ctx), event.EventOwner)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching event owner"})
+			return
+		}
+		profile, err := profileOf(es.ProfileRepo, requestOrgID(ctx), owner.Name)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching event owner profile"})
+			return
+		}
+
+		var valid bool
+		newStart, newEnd, valid = utils.ValidateAndFormatTimeStamp(utils.WithDefaultZone(occurrenceReq.EventTimeSlot, profile.TimeZone))
+		if !valid {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time slot format"})
+			return
+		}
+		ownSlots, err := utils.EventSlots(event)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// when the following occurrences move as well, the owner has to be available for each of them
+		slots := []models.TimeSlotStartAndEnd{{StartTime: newStart, EndTime: newEnd}}
+		if occurrenceReq.Scope == models.OccurrenceScopeThisAndFollowing {
+			slots, err = utils.EventSlots(models.Event{EventStartTime: newStart, EventEndTime: newEnd, Recurrence: remainingRule(rule, idx).String()})
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if !es.checkOwnerAvailability(ctx, owner.Name, slots, ownSlots) {
+			return
+		}
+	}
+
+	if occurrenceReq.Scope == models.OccurrenceScopeThis {
+		es.updateSingleOccurrence(ctx, event, originalStart, newStart, newEnd, occurrenceReq)
+		return
+	}
+
+	if idx == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "The first occurrence and all following ones are the whole series, update the event instead"})
+		return
+	}
+	es.splitSeries(ctx, event, rule, idx, originalStart, newStart, newEnd, occurrenceReq)
+}
+
+// updateSingleOccurrence records a cancellation or move of one occurrence as an exception on the series
+func (es *EventService) updateSingleOccurrence(ctx *gin.Context, event models.Event, originalStart, newStart, newEnd time.Time, occurrenceReq models.OccurrenceUpdateRequest) {
+	exception := models.EventException{OriginalStartTime: originalStart, Cancelled: occurrenceReq.Cancel}
+	if !occurrenceReq.Cancel {
+		exception.EventStartTime = &newStart
+		exception.EventEndTime = &newEnd
+
+		if !occurrenceReq.Force {
+			moved := event
+			moved.Recurrence = ""
+			moved.EventStartTime = newStart
+			moved.EventEndTime = newEnd
+			if !es.checkConflicts(ctx, moved, event.ID) {
+				return
+			}
+		}
+	}
+
+	updated := event
+	updated.Exceptions = slices.DeleteFunc(slices.Clone(event.Exceptions), func(e models.EventException) bool {
+		return e.OriginalStartTime.Equal(originalStart)
+	})
+	updated.Exceptions = append(updated.Exceptions, exception)
+
+	err := es.EventRepo.UpdateEvent(updated, nil)
+	if errors.Is(err, repository.ErrEventConflict) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated.Version++
+	publishWebhook(es.Webhooks, requestOrgID(ctx), models.WebhookEventUpdated, updated)
+	ctx.JSON(http.StatusOK, gin.H{"event": updated})
+}
+
+// remainingRule is the rule of the occurrences from the idx-th on
+func remainingRule(rule utils.RRule, idx int) utils.RRule {
+	if rule.Count > 0 {
+		rule.Count -= idx
+	}
+	return rule
+}
+
+// splitSeries ends the series just before the idx-th occurrence and, unless the rest is cancelled,
+// continues it as a new event starting at the new time with the remaining occurrences
+func (es *EventService) splitSeries(ctx *gin.Context, event models.Event, rule utils.RRule, idx int, originalStart, newStart, newEnd time.Time, occurrenceReq models.OccurrenceUpdateRequest) {
+	original := event
+	truncated := rule
+	truncated.Count = 0
+	truncated.Until, truncated.UntilDate = originalStart.Add(-time.Second).UTC(), false
+	original.Recurrence = truncated.String()
+	original.Exceptions = slices.DeleteFunc(slices.Clone(event.Exceptions), func(e models.EventException) bool {
+		return !e.OriginalStartTime.Before(originalStart)
+	})
+
+	var following *models.Event
+	if !occurrenceReq.Cancel {
+		remaining := remainingRule(rule, idx)
+
+		next := event
+		next.ID, _ = uuid.NewV4()
+		next.EventStartTime = newStart
+		next.EventEndTime = newEnd
+		next.Recurrence = remaining.String()
+		next.Forced = occurrenceReq.Force
+		next.RescheduleHistory = nil
+		// the new series is a separate calendar object, it doesn't take over the client identity of the original
+		next.ICalUID, next.CalDAVName = "", ""
+		next.Version = 1
+
+		timeChanged := !newStart.Equal(originalStart) || newEnd.Sub(newStart) != event.EventEndTime.Sub(event.EventStartTime)
+		next.Exceptions = nil
+		if !timeChanged {
+			next.Exceptions = slices.DeleteFunc(slices.Clone(event.Exceptions), func(e models.EventException) bool {
+				return e.OriginalStartTime.Before(originalStart)
+			})
+		}
+
+		// participants are invited afresh to the new series, answers only carry over when the time is unchanged
+		next.Participants = slices.Clone(event.Participants)
+		for i := range next.Participants {
+			next.Participants[i].ID, _ = uuid.NewV4()
+			if timeChanged {
+				next.Participants[i].Status = models.ParticipantStatusNeedsAction
+				next.Participants[i].Comment = ""
+				next.Participants[i].ProposedStartTime = nil
+				next.Participants[i].ProposedEndTime = nil
+				next.Participants[i].RespondedAt = nil
+			}
+		}
+
+		if !occurrenceReq.Force && !es.checkConflicts(ctx, next, event.ID) {
+			return
+		}
+		following = &next
+	}
+
+	err := es.EventRepo.SplitEvent(original, following)
+	if errors.Is(err, repository.ErrEventConflict) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	original.Version++
+	publishWebhook(es.Webhooks, requestOrgID(ctx), models.WebhookEventUpdated, original)
+	if following != nil {
+		publishWebhook(es.Webhooks, requestOrgID(ctx), models.WebhookEventCreated, *following)
+	}
+	ctx.JSON(http.StatusOK, gin.H{"event": original, "following": following})
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestUpdateOccurrence(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	userID, _ := uuid.NewV4()
+	owner := models.User{ID: userID, Name: "eshan"}
+	eventID, _ := uuid.NewV4()
+	mst, _ := time.LoadLocation("MST")
+	series := models.Event{
+		ID:             eventID,
+		Title:          "Standup",
+		EventOwner:     userID,
+		EventStartTime: time.Date(2025, 1, 2, 14, 0, 0, 0, mst),
+		EventEndTime:   time.Date(2025, 1, 2, 15, 0, 0, 0, mst),
+		Recurrence:     "FREQ=DAILY;COUNT=5",
+		Participants:   []models.EventParticipant{},
+	}
+	third := series.EventStartTime.AddDate(0, 0, 2)
+
+	setup := func() (*MockEventRepo, *MockTimeslotRepo, *gin.Engine) {
+		mockEventRepo := new(MockEventRepo)
+		mockTimeslotRepo := new(MockTimeslotRepo)
+		mockUserRepo := new(MockUserRepo)
+		eventService := &EventService{
+			EventRepo:    mockEventRepo,
+			TimeslotRepo: mockTimeslotRepo,
+			UserRepo:     mockUserRepo,
+		}
+
+		mockEventRepo.On("GetEvent", testOrg.ID, eventID.String()).Return(series, nil)
+		mockUserRepo.On("GetByID", testOrg.ID, userID).Return(owner, nil)
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
+		router.PATCH("/events/:eventID/occurrences", eventService.UpdateOccurrence)
+		router.GET("/events/:username", eventService.GetEventsForUser)
+		return mockEventRepo, mockTimeslotRepo, router
+	}
+
+	newOccurrenceRequest := func(occurrenceReq models.OccurrenceUpdateRequest) *http.Request {
+		body, _ := json.Marshal(occurrenceReq)
+		req, _ := http.NewRequest(http.MethodPatch, "/events/"+eventID.String()+"/occurrences", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+
+	t.Run("Cancel One", func(t *testing.T) {
+		mockEventRepo, _, router := setup()
+		mockEventRepo.On("UpdateEvent", mock.MatchedBy(func(e models.Event) bool {
+			return e.Recurrence == series.Recurrence && len(e.Exceptions) == 1 && e.Exceptions[0].Cancelled && e.Exceptions[0].OriginalStartTime.Equal(third)
+		}), (*models.EventReschedule)(nil)).Return(nil)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newOccurrenceRequest(models.OccurrenceUpdateRequest{OriginalStartTime: third, Cancel: true}))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		mockEventRepo.AssertExpectations(t)
+	})
+
+	t.Run("Move One", func(t *testing.T) {
+		mockEventRepo, mockTimeslotRepo, router := setup()
+		newSlot := "04 Jan 2025 4-5 PM MST"
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "eshan").Return([]string{newSlot}, nil)
+		mockEventRepo.On("GetConflictingEvents", []uuid.UUID{userID}, []models.TimeSlotStartAndEnd{{StartTime: third.Add(2 * time.Hour), EndTime: third.Add(3 * time.Hour)}}, eventID).Return([]models.EventConflict(nil), nil)
+		mockEventRepo.On("UpdateEvent", mock.MatchedBy(func(e models.Event) bool {
+			return len(e.Exceptions) == 1 && !e.Exceptions[0].Cancelled && e.Exceptions[0].EventStartTime.Equal(third.Add(2*time.Hour))
+		}), (*models.EventReschedule)(nil)).Return(nil)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newOccurrenceRequest(models.OccurrenceUpdateRequest{OriginalStartTime: third, EventTimeSlot: newSlot}))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		mockEventRepo.AssertExpectations(t)
+	})
+
+	t.Run("Cancel This And Following", func(t *testing.T) {
+		mockEventRepo, _, router := setup()
+		mockEventRepo.On("SplitEvent", mock.MatchedBy(func(e models.Event) bool {
+			return e.Recurrence == "FREQ=DAILY;UNTIL=20250104T205959Z"
+		}), (*models.Event)(nil)).Return(nil)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newOccurrenceRequest(models.OccurrenceUpdateRequest{OriginalStartTime: third, Scope: models.OccurrenceScopeThisAndFollowing, Cancel: true}))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		mockEventRepo.AssertExpectations(t)
+	})
+
+	t.Run("Unknown Occurrence", func(t *testing.T) {
+		mockEventRepo, _, router := setup()
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newOccurrenceRequest(models.OccurrenceUpdateRequest{OriginalStartTime: third.Add(time.Hour), Cancel: true}))
+
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+		mockEventRepo.AssertNotCalled(t, "UpdateEvent", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Expand In Range", func(t *testing.T) {
+		mockEventRepo, _, router := setup()
+		cancelled := series
+		cancelled.Exceptions = []models.EventException{{OriginalStartTime: third, Cancelled: true}}
+		mockEventRepo.On("GetEventsForUser", testOrg.ID, "eshan", mock.MatchedBy(func(f models.EventFilter) bool { return f.From != nil && f.To != nil })).Return([]models.Event{cancelled}, nil)
+
+		from := series.EventStartTime.AddDate(0, 0, 1).Format(time.RFC3339)
+		to := series.EventStartTime.AddDate(0, 0, 4).Format(time.RFC3339)
+		req, _ := http.NewRequest(http.MethodGet, "/events/eshan?from="+from+"&to="+to, nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var resp struct {
+			Events []models.Event `json:"events"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &resp)
+		// the 2nd and 4th occurrence, the 3rd is cancelled and the 5th starts at the end of the range
+		assert.Len(t, resp.Events, 2)
+	})
+}
+
+func TestRecurrenceStartAndUntil(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	userID, _ := uuid.NewV4()
+	eventID, _ := uuid.NewV4()
+	mst, _ := time.LoadLocation("MST")
+	// the series starts on a thursday although it recurs on mondays and wednesdays, the start still counts
+	series := models.Event{
+		ID:             eventID,
+		Title:          "Review",
+		EventOwner:     userID,
+		EventStartTime: time.Date(2025, 1, 2, 14, 0, 0, 0, mst),
+		EventEndTime:   time.Date(2025, 1, 2, 15, 0, 0, 0, mst),
+		Recurrence:     "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4",
+		Participants:   []models.EventParticipant{},
+	}
+
+	setup := func(event models.Event) (*MockEventRepo, *gin.Engine) {
+		mockEventRepo := new(MockEventRepo)
+		mockEventRepo.On("GetEvent", testOrg.ID, eventID.String()).Return(event, nil)
+		mockTimeslotRepo := new(MockTimeslotRepo)
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "eshan").Return([]string{"09 Jan 2025 2-3 PM MST"}, nil)
+		mockUserRepo := new(MockUserRepo)
+		mockUserRepo.On("GetByID", testOrg.ID, userID).Return(models.User{ID: userID, Name: "eshan"}, nil)
+		eventService := &EventService{EventRepo: mockEventRepo, TimeslotRepo: mockTimeslotRepo, UserRepo: mockUserRepo}
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+		router.PATCH("/events/:eventID/occurrences", eventService.UpdateOccurrence)
+		router.GET("/events/:username", eventService.GetEventsForUser)
+		return mockEventRepo, router
+	}
+	list := func(router *gin.Engine, from, to time.Time) []models.Event {
+		req, _ := http.NewRequest(http.MethodGet, "/events/eshan?from="+from.Format(time.RFC3339)+"&to="+to.Format(time.RFC3339), nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var resp models.EventListResponse
+		json.Unmarshal(recorder.Body.Bytes(), &resp)
+		return resp.Events
+	}
+
+	t.Run("Expanded", func(t *testing.T) {
+		mockEventRepo, router := setup(series)
+		mockEventRepo.On("GetEventsForUser", testOrg.ID, "eshan", mock.Anything).Return([]models.Event{series}, nil)
+
+		events := list(router, series.EventStartTime, series.EventStartTime.AddDate(0, 1, 0))
+		if assert.Len(t, events, 4) {
+			assert.True(t, events[0].EventStartTime.Equal(series.EventStartTime))
+			assert.True(t, events[3].EventStartTime.Equal(time.Date(2025, 1, 13, 14, 0, 0, 0, mst)), "the start is one of the four")
+		}
+	})
+
+	t.Run("Move This And Following", func(t *testing.T) {
+		mockEventRepo, router := setup(series)
+		var following *models.Event
+		mockEventRepo.On("SplitEvent", mock.MatchedBy(func(e models.Event) bool {
+			return e.Recurrence == "FREQ=WEEKLY;BYDAY=MO,WE;UNTIL=20250108T205959Z"
+		}), mock.Anything).Run(func(args mock.Arguments) {
+			following = args.Get(1).(*models.Event)
+		}).Return(nil)
+
+		body, _ := json.Marshal(models.OccurrenceUpdateRequest{
+			OriginalStartTime: time.Date(2025, 1, 8, 14, 0, 0, 0, mst),
+			Scope:             models.OccurrenceScopeThisAndFollowing,
+			EventTimeSlot:     "09 Jan 2025 2-3 PM MST",
+			Force:             true,
+		})
+		req, _ := http.NewRequest(http.MethodPatch, "/events/"+eventID.String()+"/occurrences", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		if assert.NotNil(t, following) {
+			// the thursday start and the monday after it are what is left of the four
+			assert.Equal(t, "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=2", following.Recurrence)
+			slots, err := utils.EventSlots(*following)
+			assert.NoError(t, err)
+			if assert.Len(t, slots, 2) {
+				assert.True(t, slots[0].StartTime.Equal(time.Date(2025, 1, 9, 14, 0, 0, 0, mst)))
+				assert.True(t, slots[1].StartTime.Equal(time.Date(2025, 1, 13, 14, 0, 0, 0, mst)))
+			}
+		}
+	})
+
+	t.Run("Until A Date", func(t *testing.T) {
+		daily := series
+		daily.Recurrence = "FREQ=DAILY;UNTIL=20250104"
+		mockEventRepo, router := setup(daily)
+		mockEventRepo.On("GetEventsForUser", testOrg.ID, "eshan", mock.Anything).Return([]models.Event{daily}, nil)
+
+		// 2 PM in MST is already the next day at UTC midnight, the 4th is included all the same
+		events := list(router, daily.EventStartTime, daily.EventStartTime.AddDate(0, 0, 7))
+		if assert.Len(t, events, 3) {
+			assert.True(t, events[2].EventStartTime.Equal(time.Date(2025, 1, 4, 14, 0, 0, 0, mst)))
+		}
+	})
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+	"timeslot-app/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx"
+)
+
+// Notifier delivers a reminder to its attendee
+type Notifier interface {
+	Notify(ctx context.Context, reminder models.Reminder) error
+}
+
+// LogNotifier writes reminders to the log, it is used when no other notifier is configured
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, reminder models.Reminder) error {
+	log.Printf("reminder for %s: %q starts at %s (%s before)", reminder.UserName, reminder.EventTitle,
+		reminder.LocalStart, reminder.Offset)
+	return nil
+}
+
+// WebhookNotifier posts each reminder as JSON to a URL, any response other than 2xx counts as a failed delivery
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:    url,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (wn *WebhookNotifier) Notify(ctx context.Context, reminder models.Reminder) error {
+	body, err := json.Marshal(reminder)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wn.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := wn.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("reminder webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// ReminderScheduler sends the reminders that have come due. Reminders are claimed in the database before they
+// are sent, so several instances of the app can run a scheduler against the same database.
+type ReminderScheduler struct {
+	ReminderRepo repository.ReminderRepo
+	Notifier     Notifier
+	// Interval is how often the scheduler looks for due reminders
+	Interval time.Duration
+	// BatchSize is the most reminders claimed at a time
+	BatchSize int
+	// Lease is how long a claimed reminder is left to its sender before another scheduler takes it over
+	Lease time.Duration
+	// MaxAttempts is how often a reminder is tried before it is marked failed
+	MaxAttempts int
+	// RetryBackoff is the wait after the first failed attempt, it doubles with every further attempt
+	RetryBackoff time.Duration
+}
+
+func NewReminderScheduler(db *pgx.ConnPool, notifier Notifier) *ReminderScheduler {
+	return &ReminderScheduler{
+		ReminderRepo: repository.NewReminderRepository(db),
+		Notifier:     notifier,
+		Interval:     30 * time.Second,
+		BatchSize:    100,
+		Lease:        5 * time.Minute,
+		MaxAttempts:  5,
+		RetryBackoff: time.Minute,
+	}
+}
+
+// Run sends due reminders every interval until the context is done, it blocks and is meant to run in its own goroutine
+func (rs *ReminderScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(rs.Interval)
+	defer ticker.Stop()
+
+	for {
+		sent, err := rs.RunOnce(ctx)
+		if err != nil {
+			log.Printf("error sending reminders:: %s", err)
+		} else if sent > 0 {
+			log.Printf("sent %d reminders", sent)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce claims the reminders that are due and sends them, returning how many were sent. Reminders whose
+// occurrence has already started are expired instead, failed ones are retried with backoff.
+func (rs *ReminderScheduler) RunOnce(ctx context.Context) (int, error) {
+	now := time.Now()
+	reminders, err := rs.ReminderRepo.ClaimDueReminders(now, rs.Lease, rs.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var errs []error
+	for _, reminder := range reminders {
+		if !reminder.OccurrenceStart.After(now) {
+			errs = append(errs, rs.ReminderRepo.MarkReminderExpired(reminder.ID))
+			continue
+		}
+
+		err := rs.Notifier.Notify(ctx, reminder)
+		if err == nil {
+			sent++
+			errs = append(errs, rs.ReminderRepo.MarkReminderSent(reminder.ID, time.Now()))
+			continue
+		}
+
+		var retryAt *time.Time
+		if reminder.Attempts < rs.MaxAttempts {
+			next := now.Add(rs.RetryBackoff << (reminder.Attempts - 1))
+			retryAt = &next
+		}
+		errs = append(errs, rs.ReminderRepo.MarkReminderFailed(reminder.ID, err.Error(), retryAt))
+	}
+	return sent, errors.Join(errs...)
+}
+
+// ShowAccount godoc
+// @Summary      Get reminder settings
+// @Description  Get the default reminder offsets of a user, they apply to the events that don't set their own
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        username   path   string   true  "User Name"
+// @Success      200  {object}  models.ReminderSettings
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{username}/reminders [get]
+func (us *UserService) GetReminderSettings(ctx *gin.Context) {
+	user, err := us.userRepo.Get(requestOrgID(ctx), ctx.Param("username"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return
+	}
+
+	offsets, err := us.reminderRepo.GetUserReminderOffsets(user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching reminder settings"})
+		return
+	}
+	ctx.JSON(http.StatusOK, models.ReminderSettings{Offsets: offsets})
+}
+
+// ShowAccount godoc
+// @Summary      Set reminder settings
+// @Description  Replace the default reminder offsets of a user, pending reminders of events without their own offsets are rescheduled
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        username   path   string   true  "User Name"
+// @Param        body   body   	models.ReminderSettings   true "Reminder settings"
+// @Success      200  {object}  models.ReminderSettings
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{username}/reminders [put]
+func (us *UserService) SetReminderSettings(ctx *gin.Context) {
+	var settings models.ReminderSettings
+	if err := ctx.BindJSON(&settings); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	offsets, err := utils.NormalizeReminderOffsets(settings.Offsets)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if offsets == nil {
+		offsets = []string{}
+	}
+
+	user, err := us.userRepo.Get(requestOrgID(ctx), ctx.Param("username"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return
+	}
+
+	err = us.reminderRepo.SetUserReminderOffsets(user.ID, offsets)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving reminder settings"})
+		return
+	}
+	ctx.JSON(http.StatusOK, models.ReminderSettings{Offsets: offsets})
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"timeslot-app/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockReminderRepo struct {
+	mock.Mock
+}
+
+func (m *MockReminderRepo) GetUserReminderOffsets(userID uuid.UUID) ([]string, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockReminderRepo) SetUserReminderOffsets(userID uuid.UUID, offsets []string) error {
+	args := m.Called(userID, offsets)
+	return args.Error(0)
+}
+
+func (m *MockReminderRepo) ClaimDueReminders(now time.Time, lease time.Duration, limit int) ([]models.Reminder, error) {
+	args := m.Called(now, lease, limit)
+	return args.Get(0).([]models.Reminder), args.Error(1)
+}
+
+func (m *MockReminderRepo) MarkReminderSent(reminderID uuid.UUID, sentAt time.Time) error {
+	args := m.Called(reminderID, sentAt)
+	return args.Error(0)
+}
+
+func (m *MockReminderRepo) MarkReminderFailed(reminderID uuid.UUID, lastError string, retryAt *time.Time) error {
+	args := m.Called(reminderID, lastError, retryAt)
+	return args.Error(0)
+}
+
+func (m *MockReminderRepo) MarkReminderExpired(reminderID uuid.UUID) error {
+	args := m.Called(reminderID)
+	return args.Error(0)
+}
+
+type MockNotifier struct {
+	mock.Mock
+}
+
+func (m *MockNotifier) Notify(ctx context.Context, reminder models.Reminder) error {
+	args := m.Called(reminder)
+	return args.Error(0)
+}
+
+func TestReminderSchedulerRunOnce(t *testing.T) {
+	newReminder := func(startsIn time.Duration, attempts int) models.Reminder {
+		id, _ := uuid.NewV4()
+		return models.Reminder{ID: id, UserName: "kevin", EventTitle: "Standup", OccurrenceStart: time.Now().Add(startsIn), Offset: "10m", Attempts: attempts}
+	}
+	newScheduler := func(repo *MockReminderRepo, notifier *MockNotifier) *ReminderScheduler {
+		return &ReminderScheduler{ReminderRepo: repo, Notifier: notifier, BatchSize: 10, Lease: time.Minute, MaxAttempts: 3, RetryBackoff: time.Minute}
+	}
+
+	t.Run("Sent", func(t *testing.T) {
+		mockRepo := new(MockReminderRepo)
+		mockNotifier := new(MockNotifier)
+		reminder := newReminder(10*time.Minute, 1)
+
+		mockRepo.On("ClaimDueReminders", mock.Anything, time.Minute, 10).Return([]models.Reminder{reminder}, nil)
+		mockNotifier.On("Notify", reminder).Return(nil)
+		mockRepo.On("MarkReminderSent", reminder.ID, mock.Anything).Return(nil)
+
+		sent, err := newScheduler(mockRepo, mockNotifier).RunOnce(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, sent)
+		mockRepo.AssertExpectations(t)
+		mockNotifier.AssertExpectations(t)
+	})
+
+	t.Run("Retried With Backoff", func(t *testing.T) {
+		mockRepo := new(MockReminderRepo)
+		mockNotifier := new(MockNotifier)
+		reminder := newReminder(time.Hour, 2)
+
+		mockRepo.On("ClaimDueReminders", mock.Anything, time.Minute, 10).Return([]models.Reminder{reminder}, nil)
+		mockNotifier.On("Notify", reminder).Return(errors.New("connection refused"))
+		mockRepo.On("MarkReminderFailed", reminder.ID, "connection refused", mock.MatchedBy(func(retryAt *time.Time) bool {
+			// the second attempt waits twice the backoff
+			return retryAt != nil && retryAt.Sub(time.Now()) > time.Minute+30*time.Second && retryAt.Sub(time.Now()) <= 2*time.Minute
+		})).Return(nil)
+
+		sent, err := newScheduler(mockRepo, mockNotifier).RunOnce(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 0, sent)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Failed After Max Attempts", func(t *testing.T) {
+		mockRepo := new(MockReminderRepo)
+		mockNotifier := new(MockNotifier)
+		reminder := newReminder(time.Hour, 3)
+
+		mockRepo.On("ClaimDueReminders", mock.Anything, time.Minute, 10).Return([]models.Reminder{reminder}, nil)
+		mockNotifier.On("Notify", reminder).Return(errors.New("connection refused"))
+		mockRepo.On("MarkReminderFailed", reminder.ID, "connection refused", (*time.Time)(nil)).Return(nil)
+
+		_, err := newScheduler(mockRepo, mockNotifier).RunOnce(context.Background())
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		mockRepo := new(MockReminderRepo)
+		mockNotifier := new(MockNotifier)
+		reminder := newReminder(-time.Minute, 1)
+
+		mockRepo.On("ClaimDueReminders", mock.Anything, time.Minute, 10).Return([]models.Reminder{reminder}, nil)
+		mockRepo.On("MarkReminderExpired", reminder.ID).Return(nil)
+
+		sent, err := newScheduler(mockRepo, mockNotifier).RunOnce(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 0, sent)
+		mockRepo.AssertExpectations(t)
+		mockNotifier.AssertNotCalled(t, "Notify", mock.Anything)
+	})
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	reminder := models.Reminder{UserName: "kevin", EventTitle: "Standup", Offset: "10m"}
+
+	t.Run("Delivered", func(t *testing.T) {
+		var received models.Reminder
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			json.NewDecoder(r.Body).Decode(&received)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		err := NewWebhookNotifier(server.URL).Notify(context.Background(), reminder)
+		assert.NoError(t, err)
+		assert.Equal(t, reminder, received)
+	})
+
+	t.Run("Error Status", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		err := NewWebhookNotifier(server.URL).Notify(context.Background(), reminder)
+		assert.Error(t, err)
+	})
+}
+
+func TestReminderSettings(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID, _ := uuid.NewV4()
+	user := models.User{ID: userID, Name: "kevin"}
+
+	t.Run("Get", func(t *testing.T) {
+		mockUserRepo := new(MockUserRepo)
+		mockReminderRepo := new(MockReminderRepo)
+		userService := &UserService{userRepo: mockUserRepo, reminderRepo: mockReminderRepo}
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
+		router.GET("/users/:username/reminders", userService.GetReminderSettings)
+
+		mockUserRepo.On("Get", testOrg.ID, "kevin").Return(user, nil)
+		mockReminderRepo.On("GetUserReminderOffsets", userID).Return([]string{"1h"}, nil)
+
+		req, _ := http.NewRequest(http.MethodGet, "/users/kevin/reminders", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{"offsets":["1h"]}`, resp.Body.String())
+	})
+
+	t.Run("Set Normalizes Offsets", func(t *testing.T) {
+		mockUserRepo := new(MockUserRepo)
+		mockReminderRepo := new(MockReminderRepo)
+		userService := &UserService{userRepo: mockUserRepo, reminderRepo: mockReminderRepo}
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
+		router.PUT("/users/:username/reminders", userService.SetReminderSettings)
+
+		mockUserRepo.On("Get", testOrg.ID, "kevin").Return(user, nil)
+		mockReminderRepo.On("SetUserReminderOffsets", userID, []string{"24h", "10m"}).Return(nil)
+
+		body, _ := json.Marshal(models.ReminderSettings{Offsets: []string{"600s", "24h", "10m"}})
+		req, _ := http.NewRequest(http.MethodPut, "/users/kevin/reminders", bytes.NewBuffer(body))
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{"offsets":["24h","10m"]}`, resp.Body.String())
+		mockReminderRepo.AssertExpectations(t)
+	})
+
+	t.Run("Invalid Offset", func(t *testing.T) {
+		userService := &UserService{userRepo: new(MockUserRepo), reminderRepo: new(MockReminderRepo)}
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
+		router.PUT("/users/:username/reminders", userService.SetReminderSettings)
+
+		body, _ := json.Marshal(models.ReminderSettings{Offsets: []string{"-5m"}})
+		req, _ := http.NewRequest(http.MethodPut, "/users/kevin/reminders", bytes.NewBuffer(body))
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("Unknown User", func(t *testing.T) {
+		mockUserRepo := new(MockUserRepo)
+		userService := &UserService{userRepo: mockUserRepo, reminderRepo: new(MockReminderRepo)}
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
+		router.GET("/users/:username/reminders", userService.GetReminderSettings)
+
+		mockUserRepo.On("Get", testOrg.ID, "nobody").Return(models.User{}, errors.New("no rows in result set"))
+
+		req, _ := http.NewRequest(http.MethodGet, "/users/nobody/reminders", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+	"timeslot-app/middleware"
+	"timeslot-app/models"
+	"timeslot-app/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+var rsvpResponses = []string{
+	models.ParticipantStatusAccepted,
+	models.ParticipantStatusDeclined,
+	models.ParticipantStatusTentative,
+	models.ParticipantStatusProposedNewTime,
+}
+
+// ShowAccount godoc
+// @Summary      Respond to a Event
+// @Description  Accept, decline, tentatively accept or propose a new time for an Event the caller is invited to
+// @Tags         Events
+// @Accept       json
+// @Produce      json
+// @Param        eventID   path   string   true  "Event ID"
+// @Param        body   body   	models.RSVPRequest   true "RSVP request body"
+// @Success      200  {object}  models.RSVPResponse
+// @Failure      400  {object}  models.ServiceError
+// @Failure      401  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      409  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /events/{eventID}/rsvp [post]
+func (es *EventService) RespondToEvent(ctx *gin.Context) {
+	identity, found := middleware.CurrentIdentity(ctx)
+	if !found {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+	eventID := ctx.Param("eventID")
+	if _, err := uuid.FromString(eventID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	var rsvpReq models.RSVPRequest
+	if err := ctx.BindJSON(&rsvpReq); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !slices.Contains(rsvpResponses, rsvpReq.Response) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Response must be one of accepted, declined, tentative or proposed_new_time"})
+		return
+	}
+
+	event, err := es.EventRepo.GetEvent(requestOrgID(ctx), eventID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if event.Status == models.EventStatusCancelled {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Event is cancelled"})
+		return
+	}
+
+	// callers only ever answer for themselves
+	idx := slices.IndexFunc(event.Participants, func(p models.EventParticipant) bool {
+		return p.UserID.Valid && p.UserID.UUID == identity.UserID
+	})
+	if idx < 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "You are not invited to the event"})
+		return
+	}
+	participant := event.Participants[idx]
+
+	participant.ProposedStartTime = nil
+	participant.ProposedEndTime = nil
+	if rsvpReq.Response == models.ParticipantStatusProposedNewTime {
+		profile, err := profileOf(es.ProfileRepo, requestOrgID(ctx), participant.Name)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching participant profile"})
+			return
+		}
+		startTime, endTime, valid := utils.ValidateAndFormatTimeStamp(utils.WithDefaultZone(rsvpReq.ProposedTimeSlot, profile.TimeZone))
+		if !valid {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "A valid proposed time slot is required when proposing a new time"})
+			return
+		}
+		participant.ProposedStartTime = &startTime
+		participant.ProposedEndTime = &endTime
+	}
+
+	respondedAt := time.Now().UTC()
+	participant.Status = rsvpReq.Response
+	participant.Comment = rsvpReq.Comment
+	participant.RespondedAt = &respondedAt
+
+	err = es.EventRepo.UpdateParticipantResponse(participant)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	event.Participants[idx] = participant
+	publishWebhook(es.Webhooks, requestOrgID(ctx), models.WebhookRSVPChanged, models.RSVPWebhookData{EventID: event.ID, Participant: participant})
+
+	resp := models.RSVPResponse{
+		Message:     "Response recorded successfully",
+		Participant: participant,
+	}
+
+	// a required participant dropping out may leave the event unworkable, offer the organizer new slots
+	if rsvpReq.RecommendOnDecline && participant.Status == models.ParticipantStatusDeclined && participant.Role == models.ParticipantRoleRequired {
+		owner, err := es.UserRepo.GetByID(requestOrgID(ctx), event.EventOwner)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching event owner"})
+			return
+		}
+
+		matched, partial, err := es.Recommender.RecommendSlotsReconciler(ctx, owner.Name, remainingRequiredParticipants(event), event.EventEndTime.Sub(event.EventStartTime))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error recommending slots"})
+			return
+		}
+		resp.Recommendation = &models.RecommendSlotsResponse{
+			MatchedSlots: matched,
+			PartialSlots: partial,
+		}
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// remainingRequiredParticipants names the registered required participants that haven't declined
+func remainingRequiredParticipants(event models.Event) []string {
+	remaining := []string{}
+	for _, p := range event.Participants {
+		if p.External || p.Role != models.ParticipantRoleRequired || p.Status == models.ParticipantStatusDeclined {
+			continue
+		}
+		remaining = append(remaining, p.Name)
+	}
+	return remaining
+}
+
+// ShowAccount godoc
+// @Summary      Get responses to a Event
+// @Description  Get every participant's response to an Event along with a count per status
+// @Tags         Events
+// @Accept       json
+// @Produce      json
+// @Param        eventID   path   string   true  "Event ID"
+// @Success      200  {object}  models.EventResponses
+// @Failure      400  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /events/{eventID}/rsvp [get]
+func (es *EventService) GetEventResponses(ctx *gin.Context) {
+	eventID := ctx.Param("eventID")
+	if _, err := uuid.FromString(eventID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	event, err := es.EventRepo.GetEvent(requestOrgID(ctx), eventID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	counts := map[string]int{models.ParticipantStatusNeedsAction: 0}
+	for _, status := range rsvpResponses {
+		counts[status] = 0
+	}
+	for _, p := range event.Participants {
+		counts[p.Status]++
+	}
+
+	ctx.JSON(http.StatusOK, models.EventResponses{
+		EventID:      event.ID,
+		Title:        event.Title,
+		Participants: event.Participants,
+		Counts:       counts,
+	})
+}
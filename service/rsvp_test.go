@@ -0,0 +1,162 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"timeslot-app/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockRecommender struct {
+	mock.Mock
+}
+
+func (m *MockRecommender) RecommendSlotsReconciler(ctx *gin.Context, organizer string, participants []string, eventDuration time.Duration) ([]models.TimeSlotStartAndEnd, []models.MatchingEventSlots, error) {
+	args := m.Called(organizer, participants, eventDuration)
+	return args.Get(0).([]models.TimeSlotStartAndEnd), args.Get(1).([]models.MatchingEventSlots), args.Error(2)
+}
+
+func TestRespondToEvent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ownerID, _ := uuid.NewV4()
+	kevinID, _ := uuid.NewV4()
+	marcoID, _ := uuid.NewV4()
+	eventID, _ := uuid.NewV4()
+	event := models.Event{
+		ID:             eventID,
+		Title:          "Standup",
+		EventOwner:     ownerID,
+		EventStartTime: time.Date(2025, 1, 2, 14, 0, 0, 0, time.UTC),
+		EventEndTime:   time.Date(2025, 1, 2, 15, 0, 0, 0, time.UTC),
+		Participants: []models.EventParticipant{
+			{UserID: uuid.NullUUID{UUID: kevinID, Valid: true}, Name: "kevin", Role: models.ParticipantRoleRequired, Status: models.ParticipantStatusNeedsAction},
+			{UserID: uuid.NullUUID{UUID: marcoID, Valid: true}, Name: "marco", Role: models.ParticipantRoleRequired, Status: models.ParticipantStatusAccepted},
+			{Name: "jane@partner.com", Role: models.ParticipantRoleRequired, Status: models.ParticipantStatusNeedsAction, External: true},
+		},
+	}
+
+	// setup answers requests as the caller
+	setup := func(caller models.EventParticipant) (*MockEventRepo, *MockUserRepo, *MockRecommender, *gin.Engine) {
+		mockEventRepo := new(MockEventRepo)
+		mockUserRepo := new(MockUserRepo)
+		mockRecommender := new(MockRecommender)
+		eventService := &EventService{
+			EventRepo:   mockEventRepo,
+			UserRepo:    mockUserRepo,
+			Recommender: mockRecommender,
+		}
+
+		// hand out a copy so a handler updating participants can't leak into the next case
+		e := event
+		e.Participants = append([]models.EventParticipant(nil), event.Participants...)
+		mockEventRepo.On("GetEvent", testOrg.ID, eventID.String()).Return(e, nil)
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg), withIdentity(models.Identity{UserID: caller.UserID.UUID, OrgID: testOrg.ID, UserName: caller.Name}))
+
+		router.POST("/events/:eventID/rsvp", eventService.RespondToEvent)
+		router.GET("/events/:eventID/rsvp", eventService.GetEventResponses)
+		return mockEventRepo, mockUserRepo, mockRecommender, router
+	}
+
+	kevin := event.Participants[0]
+	anna := models.EventParticipant{UserID: uuid.NullUUID{UUID: uuid.Must(uuid.NewV4()), Valid: true}, Name: "anna"}
+
+	newRSVPRequest := func(rsvpReq models.RSVPRequest) *http.Request {
+		body, _ := json.Marshal(rsvpReq)
+		req, _ := http.NewRequest(http.MethodPost, "/events/"+eventID.String()+"/rsvp", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+
+	t.Run("Accept", func(t *testing.T) {
+		mockEventRepo, _, mockRecommender, router := setup(kevin)
+		mockEventRepo.On("UpdateParticipantResponse", mock.MatchedBy(func(p models.EventParticipant) bool {
+			return p.Name == "kevin" && p.Status == models.ParticipantStatusAccepted && p.RespondedAt != nil
+		})).Return(nil)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newRSVPRequest(models.RSVPRequest{Response: models.ParticipantStatusAccepted}))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		mockEventRepo.AssertExpectations(t)
+		mockRecommender.AssertNotCalled(t, "RecommendSlotsReconciler", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Decline With Recommendation", func(t *testing.T) {
+		mockEventRepo, mockUserRepo, mockRecommender, router := setup(kevin)
+		mockEventRepo.On("UpdateParticipantResponse", mock.Anything).Return(nil)
+		mockUserRepo.On("GetByID", testOrg.ID, ownerID).Return(models.User{ID: ownerID, Name: "eshan"}, nil)
+		slots := []models.TimeSlotStartAndEnd{{StartTime: event.EventStartTime.Add(24 * time.Hour), EndTime: event.EventEndTime.Add(24 * time.Hour)}}
+		mockRecommender.On("RecommendSlotsReconciler", "eshan", []string{"marco"}, time.Hour).Return(slots, []models.MatchingEventSlots{}, nil)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newRSVPRequest(models.RSVPRequest{Response: models.ParticipantStatusDeclined, RecommendOnDecline: true}))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var resp models.RSVPResponse
+		json.Unmarshal(recorder.Body.Bytes(), &resp)
+		assert.NotNil(t, resp.Recommendation)
+		assert.Len(t, resp.Recommendation.MatchedSlots, 1)
+		mockRecommender.AssertExpectations(t)
+	})
+
+	t.Run("Propose New Time Without Slot", func(t *testing.T) {
+		mockEventRepo, _, _, router := setup(kevin)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newRSVPRequest(models.RSVPRequest{Response: models.ParticipantStatusProposedNewTime}))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		mockEventRepo.AssertNotCalled(t, "UpdateParticipantResponse", mock.Anything)
+	})
+
+	t.Run("Answers For The Caller", func(t *testing.T) {
+		mockEventRepo, _, _, router := setup(kevin)
+		mockEventRepo.On("UpdateParticipantResponse", mock.Anything).Return(nil)
+
+		body := `{"participant":"marco","response":"declined"}`
+		req, _ := http.NewRequest(http.MethodPost, "/events/"+eventID.String()+"/rsvp", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		mockEventRepo.AssertCalled(t, "UpdateParticipantResponse", mock.MatchedBy(func(p models.EventParticipant) bool {
+			return p.Name == "kevin" && p.Status == models.ParticipantStatusDeclined
+		}))
+	})
+
+	t.Run("Not Invited", func(t *testing.T) {
+		_, _, _, router := setup(anna)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newRSVPRequest(models.RSVPRequest{Response: models.ParticipantStatusAccepted}))
+
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("Organizer View", func(t *testing.T) {
+		_, _, _, router := setup(kevin)
+
+		req, _ := http.NewRequest(http.MethodGet, "/events/"+eventID.String()+"/rsvp", nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var resp models.EventResponses
+		json.Unmarshal(recorder.Body.Bytes(), &resp)
+		assert.Equal(t, 2, resp.Counts[models.ParticipantStatusNeedsAction])
+		assert.Equal(t, 1, resp.Counts[models.ParticipantStatusAccepted])
+		assert.Equal(t, 0, resp.Counts[models.ParticipantStatusDeclined])
+	})
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"timeslot-app/middleware"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+	"timeslot-app/utils"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+const (
+	// oidcLoginLifetime is how long a user has to finish logging in at the provider
+	oidcLoginLifetime = 10 * time.Minute
+	// maxProvisionAttempts bounds the suffixes tried when a new user's name is taken
+	maxProvisionAttempts = 20
+)
+
+// SSOService logs users in through an OpenID Connect provider with the authorization code flow and PKCE,
+// creating their account on their first login. The provider serves a single organization, the one named in the config.
+type SSOService struct {
+	Config     models.OIDCConfig
+	Client     *http.Client
+	UserRepo   repository.UserRepo
+	APIKeyRepo repository.APIKeyRepo
+	LoginRepo  repository.OIDCLoginRepo
+	Webhooks   WebhookPublisher
+}
+
+func NewSSOService(db *pgx.ConnPool, cfg models.OIDCConfig) *SSOService {
+	return &SSOService{
+		Config:     cfg,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		UserRepo:   repository.NewUserRepo(db),
+		APIKeyRepo: repository.NewAPIKeyRepository(db),
+		LoginRepo:  repository.NewOIDCLoginRepository(db),
+		Webhooks:   NewWebhookOutbox(db),
+	}
+}
+
+// ShowAccount godoc
+// @Summary      Log in with single sign-on
+// @Description  Send the user to the identity provider to log in, they come back to the callback
+// @Tags         Auth
+// @Success      302
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Failure      502  {object}  models.ServiceError
+// @Router       /auth/oidc/login [get]
+func (ss *SSOService) Login(ctx *gin.Context) {
+	if ss.Config.Issuer == "" {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "single sign-on isn't configured"})
+		return
+	}
+	org, _ := middleware.CurrentOrg(ctx)
+	if org.Slug != ss.orgSlug() {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "single sign-on isn't configured for this organization"})
+		return
+	}
+
+	// the provider is discovered on every login so rotated endpoints and keys are picked up
+	provider, err := utils.DiscoverOIDC(ss.Client, ss.Config.Issuer)
+	if err != nil {
+		log.Printf("error discovering identity provider:: %s", err)
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "identity provider is unavailable"})
+		return
+	}
+
+	var login models.OIDCLogin
+	for _, token := range []*string{&login.State, &login.Nonce, &login.CodeVerifier} {
+		if *token, err = utils.RandomURLToken(32); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting login"})
+			return
+		}
+	}
+	login.ExpiresAt = time.Now().Add(oidcLoginLifetime)
+	login.OrgID = org.ID
+	if err := ss.LoginRepo.SaveLogin(login); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting login"})
+		return
+	}
+
+	ctx.Redirect(http.StatusFound, provider.AuthorizationURL(ss.Config.ClientID, ss.Config.RedirectURL, ss.Config.Scopes,
+		login.State, login.Nonce, utils.PKCEChallenge(login.CodeVerifier)))
+}
+
+// ShowAccount godoc
+// @Summary      Finish a single sign-on login
+// @Description  The identity provider sends the user here after they logged in. Their account is created on their
+// @Description  first login and found by the sub claim after that, their role follows the groups that
+// @Description  map to a role. The response carries an API key that lasts for the session.
+// @Tags         Auth
+// @Produce      json
+// @Param        code   query   string   true  "Authorization code"
+// @Param        state   query   string   true  "State of the login"
+// @Success      200  {object}  models.SSOLoginResponse
+// @Failure      400  {object}  models.ServiceError
+// @Failure      401  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Failure      502  {object}  models.ServiceError
+// @Router       /auth/oidc/callback [get]
+func (ss *SSOService) Callback(ctx *gin.Context) {
+	if ss.Config.Issuer == "" {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "single sign-on isn't configured"})
+		return
+	}
+	if reason := ctx.Query("error"); reason != "" {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": strings.TrimSpace("login failed: " + reason + " " + ctx.Query("error_description"))})
+		return
+	}
+
+	now := time.Now()
+	login, err := ss.LoginRepo.TakeLogin(ctx.Query("state"), now)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "login is unknown or has expired, start it again"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error finishing login"})
+		return
+	}
+
+	provider, err := utils.DiscoverOIDC(ss.Client, ss.Config.Issuer)
+	if err != nil {
+		log.Printf("error discovering identity provider:: %s", err)
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "identity provider is unavailable"})
+		return
+	}
+	tokens, err := provider.ExchangeCode(ss.Client, ss.Config.ClientID, ss.Config.ClientSecret, ss.Config.RedirectURL,
+		ctx.Query("code"), login.CodeVerifier)
+	if err != nil {
+		log.Printf("error exchanging authorization code:: %s", err)
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "identity provider refused the login"})
+		return
+	}
+	verifier, err := provider.Verifier(ss.Client, ss.Config.ClientID)
+	if err != nil {
+		log.Printf("error fetching identity provider keys:: %s", err)
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "identity provider is unavailable"})
+		return
+	}
+	claims, err := verifier.Verify(tokens.IDToken, now)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid ID token: " + err.Error()})
+		return
+	}
+	if utils.ClaimString(claims, "nonce") != login.Nonce {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid ID token: nonce doesn't match the login"})
+		return
+	}
+
+	user, provisioned, err := ss.provision(login.OrgID, claims)
+	if err != nil {
+		log.Printf("error provisioning single sign-on user:: %s", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating user"})
+		return
+	}
+
+	if err := ss.APIKeyRepo.PurgeExpiredAPIKeys(user.ID, now); err != nil {
+		log.Printf("error purging expired API keys:: %s", err)
+	}
+	expiresAt := now.Add(ss.Config.SessionTTL).UTC()
+	key, err := issueAPIKey(ss.APIKeyRepo, user.ID, "single sign-on", &expiresAt)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error issuing API key"})
+		return
+	}
+	ctx.JSON(http.StatusOK, models.SSOLoginResponse{User: user, APIKey: key, Provisioned: provisioned})
+}
+
+// provision returns the user of the provider account in the organization, creating them on their first login,
+// and brings their role in line with their groups
+func (ss *SSOService) provision(orgID uuid.UUID, claims utils.JWTClaims) (models.User, bool, error) {
+	role, mapped := ss.roleFor(utils.ClaimStrings(claims, ss.Config.GroupsClaim))
+
+	user, err := ss.UserRepo.GetBySubject(orgID, claims.Subject)
+	if err == nil {
+		if mapped && user.Role != role {
+			if err := ss.UserRepo.SetRole(user.ID, role); err != nil {
+				return user, false, err
+			}
+			user.Role = role
+			publishWebhook(ss.Webhooks, orgID, models.WebhookUserUpdated, user)
+		}
+		return user, false, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return user, false, err
+	}
+
+	userID, err := uuid.NewV4()
+	if err != nil {
+		return user, false, err
+	}
+	user = models.User{ID: userID, OrgID: orgID, Role: role, Subject: claims.Subject}
+
+	// the name is only a starting point, an existing user with the same name is never taken over
+	base := ssoUserName(claims)
+	for attempt := 1; attempt <= maxProvisionAttempts; attempt++ {
+		user.Name = base
+		if attempt > 1 {
+			suffix := fmt.Sprintf("-%d", attempt)
+			user.Name = truncateName(base, maxUserNameLength-len(suffix)) + suffix
+		}
+		err = ss.UserRepo.Create(user)
+		if !errors.Is(err, repository.ErrUserExists) {
+			break
+		}
+	}
+	if err != nil {
+		return user, false, err
+	}
+	publishWebhook(ss.Webhooks, orgID, models.WebhookUserCreated, user)
+	return user, true, nil
+}
+
+// orgSlug is the organization single sign-on users belong to
+func (ss *SSOService) orgSlug() string {
+	if ss.Config.Org == "" {
+		return models.DefaultOrgSlug
+	}
+	return ss.Config.Org
+}
+
+// roleFor maps the user's groups to the highest role they grant, mapped is false when none of their groups grants
+// a role so the role an admin gave them is kept
+func (ss *SSOService) roleFor(groups []string) (string, bool) {
+	for _, grant := range []struct {
+		role   string
+		groups []string
+	}{
+		{models.RoleAdmin, ss.Config.AdminGroups},
+		{models.RoleMember, ss.Config.MemberGroups},
+		{models.RoleViewer, ss.Config.ViewerGroups},
+	} {
+		for _, group := range groups {
+			if slices.Contains(grant.groups, group) {
+				return grant.role, true
+			}
+		}
+	}
+	return models.RoleMember, false
+}
+
+// ssoUserName picks a name for a new single sign-on user from their profile claims
+func ssoUserName(claims utils.JWTClaims) string {
+	email, _, _ := strings.Cut(utils.ClaimString(claims, "email"), "@")
+	for _, name := range []string{utils.ClaimString(claims, "preferred_username"), email, utils.ClaimString(claims, "name")} {
+		if name = strings.TrimSpace(name); name != "" {
+			return truncateName(name, maxUserNameLength)
+		}
+	}
+	return "user"
+}
+
+// truncateName shortens a name to at most max bytes without splitting a character
+func truncateName(name string, max int) string {
+	for len(name) > max {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
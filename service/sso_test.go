@@ -0,0 +1,360 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+	"timeslot-app/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// fakeLoginRepo keeps started logins in memory
+type fakeLoginRepo struct {
+	logins map[string]models.OIDCLogin
+}
+
+func (f *fakeLoginRepo) SaveLogin(login models.OIDCLogin) error {
+	f.logins[login.State] = login
+	return nil
+}
+
+func (f *fakeLoginRepo) TakeLogin(state string, now time.Time) (models.OIDCLogin, error) {
+	login, found := f.logins[state]
+	delete(f.logins, state)
+	if !found || !login.ExpiresAt.After(now) {
+		return models.OIDCLogin{}, pgx.ErrNoRows
+	}
+	return login, nil
+}
+
+// mockIdP is a local OpenID Connect provider, it signs ID tokens with an ES256 key it publishes as a JWKS
+type mockIdP struct {
+	server       *httptest.Server
+	key          *ecdsa.PrivateKey
+	clientID     string
+	clientSecret string
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+// mockGrant is what the provider remembers about an authorization code it handed out
+type mockGrant struct {
+	challenge   string
+	redirectURI string
+	claims      map[string]any
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	idp := &mockIdP{key: key, clientID: "timeslot", clientSecret: "client-s3cret", codes: map[string]mockGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"keys":[{"kty":"EC","kid":"idp-1","use":"sig","crv":"P-256","x":%q,"y":%q}]}`,
+			base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))))
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize plays the user logging in at the authorization URL, it returns the code the provider redirects back with
+func (idp *mockIdP) authorize(t *testing.T, authorizationURL string, claims map[string]any) (code, state string) {
+	u, err := url.Parse(authorizationURL)
+	assert.NoError(t, err)
+	query := u.Query()
+	assert.Equal(t, idp.server.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, idp.clientID, query.Get("client_id"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+
+	claims["nonce"] = query.Get("nonce")
+	code, err = utils.RandomURLToken(16)
+	assert.NoError(t, err)
+	idp.mu.Lock()
+	idp.codes[code] = mockGrant{challenge: query.Get("code_challenge"), redirectURI: query.Get("redirect_uri"), claims: claims}
+	idp.mu.Unlock()
+	return code, query.Get("state")
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok || clientID != idp.clientID || secret != idp.clientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+	idp.mu.Lock()
+	grant, found := idp.codes[r.PostFormValue("code")]
+	delete(idp.codes, r.PostFormValue("code"))
+	idp.mu.Unlock()
+
+	verifierSum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !found || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != grant.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(verifierSum[:]) != grant.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := map[string]any{"iss": idp.server.URL, "aud": idp.clientID, "iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix()}
+	for name, value := range grant.claims {
+		claims[name] = value
+	}
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": idp.sign(claims)})
+}
+
+func (idp *mockIdP) sign(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "idp-1", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, _ := ecdsa.Sign(rand.Reader, idp.key, digest[:])
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestSSO(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	idp := newMockIdP(t)
+
+	newService := func() (*SSOService, *MockUserRepo, *MockAPIKeyRepo, *fakeLoginRepo) {
+		userRepo := new(MockUserRepo)
+		apiKeyRepo := new(MockAPIKeyRepo)
+		apiKeyRepo.On("PurgeExpiredAPIKeys", mock.Anything, mock.Anything).Return(nil)
+		apiKeyRepo.On("CreateAPIKey", mock.Anything, mock.Anything).Return(nil)
+		loginRepo := &fakeLoginRepo{logins: map[string]models.OIDCLogin{}}
+		return &SSOService{
+			Config: models.OIDCConfig{
+				Issuer:       idp.server.URL,
+				ClientID:     idp.clientID,
+				ClientSecret: idp.clientSecret,
+				RedirectURL:  "https://timeslot.example.com/api/v1/auth/oidc/callback",
+				Scopes:       []string{"openid", "profile", "email"},
+				GroupsClaim:  "groups",
+				AdminGroups:  []string{"timeslot-admins"},
+				ViewerGroups: []string{"contractors"},
+				SessionTTL:   12 * time.Hour,
+				Org:          testOrg.Slug,
+			},
+			Client:     idp.server.Client(),
+			UserRepo:   userRepo,
+			APIKeyRepo: apiKeyRepo,
+			LoginRepo:  loginRepo,
+		}, userRepo, apiKeyRepo, loginRepo
+	}
+	newRouter := func(ss *SSOService) *gin.Engine {
+		router := gin.New()
+		router.Use(withOrg(testOrg))
+		router.GET("/auth/oidc/login", ss.Login)
+		router.GET("/auth/oidc/callback", ss.Callback)
+		return router
+	}
+	get := func(router *gin.Engine, target string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, target, nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+	// login runs the whole flow for a user with the claims and returns the callback's response
+	login := func(t *testing.T, router *gin.Engine, claims map[string]any) *httptest.ResponseRecorder {
+		recorder := get(router, "/auth/oidc/login")
+		assert.Equal(t, http.StatusFound, recorder.Code)
+		code, state := idp.authorize(t, recorder.Header().Get("Location"), claims)
+		return get(router, "/auth/oidc/callback?"+url.Values{"code": {code}, "state": {state}}.Encode())
+	}
+
+	t.Run("Login Redirect", func(t *testing.T) {
+		ss, _, _, loginRepo := newService()
+		recorder := get(newRouter(ss), "/auth/oidc/login")
+
+		assert.Equal(t, http.StatusFound, recorder.Code)
+		location, _ := url.Parse(recorder.Header().Get("Location"))
+		query := location.Query()
+		assert.Equal(t, "openid profile email", query.Get("scope"))
+		assert.Equal(t, ss.Config.RedirectURL, query.Get("redirect_uri"))
+		started, found := loginRepo.logins[query.Get("state")]
+		assert.True(t, found)
+		assert.Equal(t, utils.PKCEChallenge(started.CodeVerifier), query.Get("code_challenge"))
+		assert.NotContains(t, location.RawQuery, started.CodeVerifier, "the verifier never leaves the server")
+		assert.Equal(t, started.Nonce, query.Get("nonce"))
+		assert.Equal(t, testOrg.ID, started.OrgID)
+	})
+
+	t.Run("First Login Provisions User", func(t *testing.T) {
+		ss, userRepo, apiKeyRepo, _ := newService()
+		userRepo.On("GetBySubject", testOrg.ID, "248289761001").Return(models.User{}, pgx.ErrNoRows)
+		// a local user already has the name, they must not be taken over
+		userRepo.On("Create", mock.MatchedBy(func(u models.User) bool { return u.Name == "kevin" })).Return(repository.ErrUserExists)
+		userRepo.On("Create", mock.MatchedBy(func(u models.User) bool { return u.Name == "kevin-2" })).Return(nil)
+
+		recorder := login(t, newRouter(ss), map[string]any{"sub": "248289761001", "preferred_username": "kevin",
+			"email": "kevin@example.com", "groups": []string{"engineering", "timeslot-admins"}})
+
+		assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		var response models.SSOLoginResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.True(t, response.Provisioned)
+		assert.Equal(t, "kevin-2", response.User.Name)
+		assert.Equal(t, "248289761001", response.User.Subject)
+		assert.Equal(t, models.RoleAdmin, response.User.Role)
+		assert.True(t, utils.IsAPIKey(response.APIKey.Key))
+		if assert.NotNil(t, response.APIKey.ExpiresAt) {
+			assert.WithinDuration(t, time.Now().Add(12*time.Hour), *response.APIKey.ExpiresAt, time.Minute)
+		}
+		userRepo.AssertCalled(t, "Create", mock.MatchedBy(func(u models.User) bool {
+			return u.Name == "kevin-2" && u.Subject == "248289761001" && u.Role == models.RoleAdmin
+		}))
+		apiKeyRepo.AssertCalled(t, "CreateAPIKey", mock.MatchedBy(func(key models.APIKey) bool {
+			return key.UserID == response.User.ID && key.ExpiresAt != nil
+		}), mock.Anything)
+	})
+
+	t.Run("Later Login Finds User By Subject", func(t *testing.T) {
+		ss, userRepo, _, _ := newService()
+		existing := models.User{ID: uuid.Must(uuid.NewV4()), Name: "kevin-2", Role: models.RoleAdmin, Subject: "248289761001"}
+		userRepo.On("GetBySubject", testOrg.ID, "248289761001").Return(existing, nil)
+		userRepo.On("SetRole", existing.ID, models.RoleViewer).Return(nil)
+
+		// the user was renamed at the provider and moved out of the admin group
+		recorder := login(t, newRouter(ss), map[string]any{"sub": "248289761001", "preferred_username": "kevin.b",
+			"groups": []string{"contractors"}})
+
+		assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		var response models.SSOLoginResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.False(t, response.Provisioned)
+		assert.Equal(t, existing.ID, response.User.ID)
+		assert.Equal(t, "kevin-2", response.User.Name)
+		assert.Equal(t, models.RoleViewer, response.User.Role)
+		userRepo.AssertNotCalled(t, "Create", mock.Anything)
+		userRepo.AssertExpectations(t)
+	})
+
+	t.Run("Groups Without Roles", func(t *testing.T) {
+		ss, userRepo, _, _ := newService()
+		ss.Config.AdminGroups, ss.Config.ViewerGroups = nil, nil
+		existing := models.User{ID: uuid.Must(uuid.NewV4()), Name: "anna", Role: models.RoleAdmin, Subject: "anna-sub"}
+		userRepo.On("GetBySubject", testOrg.ID, "anna-sub").Return(existing, nil)
+
+		recorder := login(t, newRouter(ss), map[string]any{"sub": "anna-sub", "groups": []string{"contractors"}})
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		userRepo.AssertNotCalled(t, "SetRole", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Unmapped Groups Keep Role", func(t *testing.T) {
+		ss, userRepo, _, _ := newService()
+		// an admin promoted anna by hand, none of their groups at the provider maps to a role
+		existing := models.User{ID: uuid.Must(uuid.NewV4()), Name: "anna", Role: models.RoleAdmin, Subject: "anna-sub"}
+		userRepo.On("GetBySubject", testOrg.ID, "anna-sub").Return(existing, nil)
+
+		recorder := login(t, newRouter(ss), map[string]any{"sub": "anna-sub", "groups": []string{"engineering"}})
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var response models.SSOLoginResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, models.RoleAdmin, response.User.Role)
+		userRepo.AssertNotCalled(t, "SetRole", mock.Anything, mock.Anything)
+	})
+
+	t.Run("State Is Used Once", func(t *testing.T) {
+		ss, userRepo, _, _ := newService()
+		userRepo.On("GetBySubject", testOrg.ID, "anna-sub").Return(models.User{ID: uuid.Must(uuid.NewV4()), Name: "anna", Role: models.RoleMember, Subject: "anna-sub"}, nil)
+		router := newRouter(ss)
+
+		recorder := get(router, "/auth/oidc/login")
+		code, state := idp.authorize(t, recorder.Header().Get("Location"), map[string]any{"sub": "anna-sub"})
+		callback := "/auth/oidc/callback?" + url.Values{"code": {code}, "state": {state}}.Encode()
+
+		assert.Equal(t, http.StatusOK, get(router, callback).Code)
+		assert.Equal(t, http.StatusBadRequest, get(router, callback).Code)
+		assert.Equal(t, http.StatusBadRequest, get(router, "/auth/oidc/callback?code=x&state=made-up").Code)
+	})
+
+	t.Run("Wrong Code Verifier", func(t *testing.T) {
+		ss, userRepo, _, loginRepo := newService()
+		router := newRouter(ss)
+
+		recorder := get(router, "/auth/oidc/login")
+		code, state := idp.authorize(t, recorder.Header().Get("Location"), map[string]any{"sub": "anna-sub"})
+		// an attacker who intercepted the code doesn't have the verifier
+		intercepted := loginRepo.logins[state]
+		intercepted.CodeVerifier = "guessed"
+		loginRepo.logins[state] = intercepted
+
+		recorder = get(router, "/auth/oidc/callback?"+url.Values{"code": {code}, "state": {state}}.Encode())
+		assert.Equal(t, http.StatusBadGateway, recorder.Code)
+		userRepo.AssertNotCalled(t, "GetBySubject", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Nonce Mismatch", func(t *testing.T) {
+		ss, userRepo, _, _ := newService()
+		router := newRouter(ss)
+
+		recorder := get(router, "/auth/oidc/login")
+		code, state := idp.authorize(t, recorder.Header().Get("Location"), map[string]any{"sub": "anna-sub"})
+		idp.mu.Lock()
+		grant := idp.codes[code]
+		grant.claims["nonce"] = "replayed"
+		idp.mu.Unlock()
+
+		recorder = get(router, "/auth/oidc/callback?"+url.Values{"code": {code}, "state": {state}}.Encode())
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		userRepo.AssertNotCalled(t, "GetBySubject", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Provider Error", func(t *testing.T) {
+		ss, _, _, _ := newService()
+		recorder := get(newRouter(ss), "/auth/oidc/callback?error=access_denied&error_description=user+cancelled")
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "access_denied")
+	})
+
+	t.Run("Not Configured", func(t *testing.T) {
+		ss, _, _, _ := newService()
+		ss.Config.Issuer = ""
+		router := newRouter(ss)
+		assert.Equal(t, http.StatusNotFound, get(router, "/auth/oidc/login").Code)
+		assert.Equal(t, http.StatusNotFound, get(router, "/auth/oidc/callback?code=x&state=y").Code)
+	})
+
+	t.Run("Other Organization", func(t *testing.T) {
+		ss, _, _, loginRepo := newService()
+		router := gin.New()
+		router.Use(withOrg(models.Organization{ID: uuid.Must(uuid.NewV4()), Slug: "globex"}))
+		router.GET("/auth/oidc/login", ss.Login)
+
+		assert.Equal(t, http.StatusNotFound, get(router, "/auth/oidc/login").Code)
+		assert.Empty(t, loginRepo.logins)
+	})
+}
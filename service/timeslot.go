@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"time"
 	"timeslot-app/models"
 	"timeslot-app/repository"
@@ -19,25 +20,34 @@ import (
 type TimeslotServiceImplementaion struct {
 	TimeslotRepo repository.TimeslotRepo
 	UserRepo     repository.UserRepo
+	ProfileRepo  repository.ProfileRepo
+	GroupRepo    repository.GroupRepo
+	Webhooks     WebhookPublisher
 }
 
-func Init(db *pgx.Conn) *TimeslotServiceImplementaion {
+func Init(db *pgx.ConnPool) *TimeslotServiceImplementaion {
 	service := new(TimeslotServiceImplementaion)
 	service.TimeslotRepo = repository.NewTimeslotRepository(db)
 	service.UserRepo = repository.NewUserRepo(db)
+	service.ProfileRepo = repository.NewProfileRepository(db)
+	service.GroupRepo = repository.NewGroupRepository(db)
+	service.Webhooks = NewWebhookOutbox(db)
 	return service
 }
 
 // ShowAccount godoc
 // @Summary      Create a time slot
-// @Description  Create time slot for a user
+// @Description  Create time slot for a user, slots without a zone are in the home time zone of the user
 // @Tags         Timeslots
 // @Accept       json
 // @Produce      json
 // @Param        body   body    models.UserTimeSlotRequest   true  "Timeslot request body"
 // @Success      200  {object}  models.ServiceMessage
 // @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
 // @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /timeslot [post]
 func (ts *TimeslotServiceImplementaion) CreateTimeSlot(ctx *gin.Context) {
 	// create time slot
@@ -50,7 +60,7 @@ func (ts *TimeslotServiceImplementaion) CreateTimeSlot(ctx *gin.Context) {
 
 	// check if the user with the given name exists
 
-	userFromDB, err := ts.UserRepo.Get(userTimeSlot.UserName)
+	userFromDB, err := ts.UserRepo.Get(requestOrgID(ctx), userTimeSlot.UserName)
 	if err != nil {
 		fmt.Println("error is ::", err)
 		ctx.JSON(http.StatusInternalServerError, utils.ErrorHelper("Error fetching user", err))
@@ -62,10 +72,19 @@ func (ts *TimeslotServiceImplementaion) CreateTimeSlot(ctx *gin.Context) {
 		return
 	}
 
+	profile, err := profileOf(ts.ProfileRepo, requestOrgID(ctx), userFromDB.Name)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorHelper("Error fetching profile", err))
+		return
+	}
+
 	// timeSlots := []string{}
 	userTimeSlots := make([]models.TimeSlot, 0)
 	// if yes validate the time slots
-	for _, timeSlot := range userTimeSlot.TimeSlots {
+	for i, timeSlot := range userTimeSlot.TimeSlots {
+		// slots are stored with their zone, so they keep meaning the same time when the home time zone changes
+		timeSlot = utils.WithDefaultZone(timeSlot, profile.TimeZone)
+		userTimeSlot.TimeSlots[i] = timeSlot
 		// validate the time slot
 		// if not valid return error
 		// if valid save the time slot
@@ -91,6 +110,7 @@ func (ts *TimeslotServiceImplementaion) CreateTimeSlot(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError, utils.ErrorHelper("Error creating time slots", err))
 		return
 	}
+	publishWebhook(ts.Webhooks, requestOrgID(ctx), models.WebhookTimeslotCreated, models.TimeslotWebhookData{UserName: userFromDB.Name, TimeSlots: userTimeSlot.TimeSlots})
 
 	ctx.JSON(http.StatusCreated, gin.H{"message": "Timeslot created successfully"})
 }
@@ -105,6 +125,8 @@ func (ts *TimeslotServiceImplementaion) CreateTimeSlot(ctx *gin.Context) {
 // @Success      200  {object}  models.TimeSlotResponse
 // @Failure      400  {object}  models.ServiceError
 // @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /:username [get]
 func (ts *TimeslotServiceImplementaion) GetTimeSlotsByUserName(ctx *gin.Context) {
 	userName := ctx.Param("username")
@@ -113,7 +135,7 @@ func (ts *TimeslotServiceImplementaion) GetTimeSlotsByUserName(ctx *gin.Context)
 		return
 	}
 
-	timeSlots, err := ts.TimeslotRepo.GetTimeSlotsByUserName(userName)
+	timeSlots, err := ts.TimeslotRepo.GetTimeSlotsByUserName(requestOrgID(ctx), userName)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, utils.ErrorHelper("Error fetching time slots", err))
 		return
@@ -132,7 +154,9 @@ func (ts *TimeslotServiceImplementaion) GetTimeSlotsByUserName(ctx *gin.Context)
 
 // ShowAccount godoc
 // @Summary      Recommend time slots
-// @Description  Recommend time slots for the given organizer and participants
+// @Description  Recommend time slots for the given organizer and participants. Slots are ordered best first by the
+// @Description  working hours and preferred times of the attendees and are given in the organizer's home time zone.
+// @Description  Participants can name groups as @name, they are expanded to their members.
 // @Tags         Timeslots
 // @Accept       json
 // @Produce      json
@@ -140,6 +164,8 @@ func (ts *TimeslotServiceImplementaion) GetTimeSlotsByUserName(ctx *gin.Context)
 // @Success      200  {object}  models.RecommendSlotsResponse
 // @Failure      400  {object}  models.ServiceError
 // @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /recommend [get]
 func (ts *TimeslotServiceImplementaion) RecommendSlots(ctx *gin.Context) {
 	var recommendSlotsRequest models.RecommendSlotsRequest
@@ -149,7 +175,17 @@ func (ts *TimeslotServiceImplementaion) RecommendSlots(ctx *gin.Context) {
 	}
 
 	organizer := recommendSlotsRequest.Organizer
-	participants := recommendSlotsRequest.Participants
+	participants, via, err := expandParticipants(ts.GroupRepo, requestOrgID(ctx), recommendSlotsRequest.Participants)
+	if errors.Is(err, errUnknownGroup) {
+		ctx.JSON(http.StatusBadRequest, utils.ErrorHelper("Invalid participants", err))
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, utils.ErrorHelper("Error expanding groups", err))
+		return
+	}
+	// the organizer isn't their own participant when a group they are in is invited
+	participants = slices.DeleteFunc(participants, func(name string) bool { return name == organizer && via[name] != "" })
 	eventDuration := time.Duration(recommendSlotsRequest.EventDuration) * time.Minute
 	// convert int to duration in minutes
 
@@ -173,7 +209,7 @@ func (ts *TimeslotServiceImplementaion) RecommendSlotsReconciler(ctx *gin.Contex
 	// get organizers timeslots
 
 	// prepare timeslot stant and end time and participants for easy reconciliation
-	organizerParticipant, participantsV2, err := ts.PrepareParticipantsDataForRecommendation(organizer, participants)
+	organizerParticipant, participantsV2, err := ts.PrepareParticipantsDataForRecommendation(requestOrgID(ctx), organizer, participants)
 	if err != nil {
 		log.Printf("error preparing participants data:: %s", err)
 		return []models.TimeSlotStartAndEnd{}, []models.MatchingEventSlots{}, err
@@ -216,13 +252,64 @@ func (ts *TimeslotServiceImplementaion) RecommendSlotsReconciler(ctx *gin.Contex
 		}
 	}
 
+	err = ts.rankSlots(requestOrgID(ctx), organizer, participants, eventDuration, matchedSlots, partialMatchSlots)
+	if err != nil {
+		log.Printf("error ranking slots:: %s", err)
+		return []models.TimeSlotStartAndEnd{}, []models.MatchingEventSlots{}, err
+	}
 	return matchedSlots, partialMatchSlots, nil
 
 }
 
-func (ts *TimeslotServiceImplementaion) PrepareParticipantsDataForRecommendation(organizer string, participants []string) (models.Participant, []models.Participant, error) {
+// rankSlots orders the slots best first and renders them in the home time zone of the organizer. Slots score for
+// every attendee whose working hours and preferred times they fall in, partial matches that more participants can
+// make come first regardless of their score.
+func (ts *TimeslotServiceImplementaion) rankSlots(orgID uuid.UUID, organizer string, participants []string, eventDuration time.Duration, matched []models.TimeSlotStartAndEnd, partial []models.MatchingEventSlots) error {
+	profiles, err := profilesOf(ts.ProfileRepo, orgID, append([]string{organizer}, participants...)...)
+	if err != nil {
+		return err
+	}
+	loc := utils.ProfileLocation(profiles[organizer])
+	score := func(slot models.TimeSlotStartAndEnd) int { return bestSlotScore(slot, eventDuration, profiles) }
+
+	slices.SortStableFunc(matched, func(a, b models.TimeSlotStartAndEnd) int { return score(b) - score(a) })
+	slices.SortStableFunc(partial, func(a, b models.MatchingEventSlots) int {
+		if len(a.AvailableParticipants) != len(b.AvailableParticipants) {
+			return len(b.AvailableParticipants) - len(a.AvailableParticipants)
+		}
+		return score(b.Slot) - score(a.Slot)
+	})
+
+	for i := range matched {
+		matched[i].StartTime, matched[i].EndTime = matched[i].StartTime.In(loc), matched[i].EndTime.In(loc)
+	}
+	for i := range partial {
+		partial[i].Slot.StartTime, partial[i].Slot.EndTime = partial[i].Slot.StartTime.In(loc), partial[i].Slot.EndTime.In(loc)
+	}
+	return nil
+}
+
+// bestSlotScore is the best score of the meetings starting on the hour within the slot, summed over the attendees
+func bestSlotScore(slot models.TimeSlotStartAndEnd, eventDuration time.Duration, profiles map[string]models.UserProfile) int {
+	if eventDuration <= 0 || eventDuration > slot.EndTime.Sub(slot.StartTime) {
+		eventDuration = slot.EndTime.Sub(slot.StartTime)
+	}
+
+	best := 0
+	for start := slot.StartTime; !start.Add(eventDuration).After(slot.EndTime); start = start.Add(time.Hour) {
+		meeting := models.TimeSlotStartAndEnd{StartTime: start, EndTime: start.Add(eventDuration)}
+		score := 0
+		for _, profile := range profiles {
+			score += utils.SlotScore(meeting, profile)
+		}
+		best = max(best, score)
+	}
+	return best
+}
+
+func (ts *TimeslotServiceImplementaion) PrepareParticipantsDataForRecommendation(orgID uuid.UUID, organizer string, participants []string) (models.Participant, []models.Participant, error) {
 	// get the time slots and prepare participant for organizer and participants
-	organizerParticipant, err := ts.GetUserTimeSlotsAndConvertToParticipant(organizer)
+	organizerParticipant, err := ts.GetUserTimeSlotsAndConvertToParticipant(orgID, organizer)
 	if err != nil {
 		log.Printf("error fetching organizer details:: %s", err)
 		return models.Participant{}, []models.Participant{}, err
@@ -230,7 +317,7 @@ func (ts *TimeslotServiceImplementaion) PrepareParticipantsDataForRecommendation
 
 	participantsV2 := []models.Participant{}
 	for _, participant := range participants {
-		p, err := ts.GetUserTimeSlotsAndConvertToParticipant(participant)
+		p, err := ts.GetUserTimeSlotsAndConvertToParticipant(orgID, participant)
 		if err != nil {
 			log.Printf("error fetching participant details:: %s", err)
 			return models.Participant{}, []models.Participant{}, err
@@ -242,9 +329,9 @@ func (ts *TimeslotServiceImplementaion) PrepareParticipantsDataForRecommendation
 	return organizerParticipant, participantsV2, nil
 }
 
-func (ts *TimeslotServiceImplementaion) GetUserTimeSlotsAndConvertToParticipant(userName string) (models.Participant, error) {
+func (ts *TimeslotServiceImplementaion) GetUserTimeSlotsAndConvertToParticipant(orgID uuid.UUID, userName string) (models.Participant, error) {
 
-	timeslotsOrganizer, err := ts.TimeslotRepo.GetTimeSlotsByUserName(userName)
+	timeslotsOrganizer, err := ts.TimeslotRepo.GetTimeSlotsByUserName(orgID, userName)
 	if err != nil {
 
 		return models.Participant{}, err
@@ -279,6 +366,8 @@ func (ts *TimeslotServiceImplementaion) GetUserTimeSlotsAndConvertToParticipant(
 // @Success      200  {object}  models.ServiceMessage
 // @Failure      400  {object}  models.ServiceError
 // @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /:username [delete]
 func (ts *TimeslotServiceImplementaion) DeleteTimeSlotsByUserName(ctx *gin.Context) {
 	userName := ctx.Param("username")
@@ -294,7 +383,7 @@ func (ts *TimeslotServiceImplementaion) DeleteTimeSlotsByUserName(ctx *gin.Conte
 		return
 	}
 
-	verifyTimeSlotExists, err := ts.TimeslotRepo.GetTimeSlotsByUserName(userName)
+	verifyTimeSlotExists, err := ts.TimeslotRepo.GetTimeSlotsByUserName(requestOrgID(ctx), userName)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, utils.ErrorHelper("Error fetching time slots", err))
 		return
@@ -311,11 +400,12 @@ func (ts *TimeslotServiceImplementaion) DeleteTimeSlotsByUserName(ctx *gin.Conte
 	}
 
 	fmt.Println(userName, timeslot.Timeslot)
-	err = ts.TimeslotRepo.DeleteTimeSlotsByUserName(userName, timeslot.Timeslot)
+	err = ts.TimeslotRepo.DeleteTimeSlotsByUserName(requestOrgID(ctx), userName, timeslot.Timeslot)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, utils.ErrorHelper("Error deleting time slots", err))
 		return
 	}
+	publishWebhook(ts.Webhooks, requestOrgID(ctx), models.WebhookTimeslotDeleted, models.TimeslotWebhookData{UserName: userName, TimeSlots: []string{timeslot.Timeslot}})
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "Time slots deleted successfully"})
 }
@@ -24,8 +24,8 @@ func (m *MockTimeslotRepo) Create(timeSlots []models.TimeSlot) error {
 	return args.Error(0)
 }
 
-func (m *MockTimeslotRepo) GetTimeSlotsByUserName(userName string) ([]string, error) {
-	args := m.Called(userName)
+func (m *MockTimeslotRepo) GetTimeSlotsByUserName(orgID uuid.UUID, userName string) ([]string, error) {
+	args := m.Called(orgID, userName)
 	return args.Get(0).([]string), args.Error(1)
 }
 
@@ -41,11 +41,13 @@ func TestCreateTimeSlot(t *testing.T) {
 		}
 
 		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
 		router.POST("/timeslot", timeslotService.CreateTimeSlot)
 
 		userID, _ := uuid.NewV4()
 		mockUser := models.User{ID: userID, Name: "John Doe"}
-		mockUserRepo.On("Get", "John Doe").Return(mockUser, nil)
+		mockUserRepo.On("Get", testOrg.ID, "John Doe").Return(mockUser, nil)
 
 		timeSlot := "02 Jan 2025 2-4 PM MST"
 		userTimeSlotReq := models.UserTimeSlotRequest{
@@ -76,6 +78,8 @@ func TestCreateTimeSlot(t *testing.T) {
 		}
 
 		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
 		router.POST("/timeslot", timeslotService.CreateTimeSlot)
 
 		req, _ := http.NewRequest(http.MethodPost, "/timeslot", bytes.NewBuffer([]byte("{invalid json}")))
@@ -97,6 +101,8 @@ func TestCreateTimeSlot(t *testing.T) {
 		}
 
 		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
 		router.POST("/timeslot", timeslotService.CreateTimeSlot)
 
 		userTimeSlotReq := models.UserTimeSlotRequest{
@@ -109,7 +115,7 @@ func TestCreateTimeSlot(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 
 		recorder := httptest.NewRecorder()
-		mockUserRepo.On("Get", "John Doe").Return(models.User{}, errors.New("user not found"))
+		mockUserRepo.On("Get", testOrg.ID, "John Doe").Return(models.User{}, errors.New("user not found"))
 
 		router.ServeHTTP(recorder, req)
 
@@ -126,11 +132,13 @@ func TestCreateTimeSlot(t *testing.T) {
 		}
 
 		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
 		router.POST("/timeslot", timeslotService.CreateTimeSlot)
 
 		userID, _ := uuid.NewV4()
 		mockUser := models.User{ID: userID, Name: "John Doe"}
-		mockUserRepo.On("Get", "John Doe").Return(mockUser, nil)
+		mockUserRepo.On("Get", testOrg.ID, "John Doe").Return(mockUser, nil)
 
 		userTimeSlotReq := models.UserTimeSlotRequest{
 			UserName:  "John Doe",
@@ -158,11 +166,13 @@ func TestCreateTimeSlot(t *testing.T) {
 		}
 
 		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
 		router.POST("/timeslot", timeslotService.CreateTimeSlot)
 
 		userID, _ := uuid.NewV4()
 		mockUser := models.User{ID: userID, Name: "John Doe"}
-		mockUserRepo.On("Get", "John Doe").Return(mockUser, nil)
+		mockUserRepo.On("Get", testOrg.ID, "John Doe").Return(mockUser, nil)
 
 		timeSlot := "02 Jan 2025 4-6 PM MST"
 		userTimeSlotReq := models.UserTimeSlotRequest{
@@ -195,10 +205,12 @@ func TestGetTimeSlotsByUserName(t *testing.T) {
 		}
 
 		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
 		router.GET("/timeslot/:username", timeslotService.GetTimeSlotsByUserName)
 
 		timeSlots := []string{"2023-10-10T10:00:00Z", "2023-10-11T10:00:00Z"}
-		mockTimeslotRepo.On("GetTimeSlotsByUserName", "John Doe").Return(timeSlots, nil)
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "John Doe").Return(timeSlots, nil)
 
 		req, _ := http.NewRequest(http.MethodGet, "/timeslot/John Doe", nil)
 		recorder := httptest.NewRecorder()
@@ -223,9 +235,11 @@ func TestGetTimeSlotsByUserName(t *testing.T) {
 		}
 
 		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
 		router.GET("/timeslot/:username", timeslotService.GetTimeSlotsByUserName)
 
-		mockTimeslotRepo.On("GetTimeSlotsByUserName", "John Doe").Return(nil, errors.New("user not found"))
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "John Doe").Return(nil, errors.New("user not found"))
 
 		req, _ := http.NewRequest(http.MethodGet, "/timeslot/John Doe", nil)
 		recorder := httptest.NewRecorder()
@@ -237,38 +251,29 @@ func TestGetTimeSlotsByUserName(t *testing.T) {
 	})
 }
 
-// type MockTimeslotRepo struct {
-// 	mock.Mock
-// }
-
-func (m *MockTimeslotRepo) RecommendSlots(req models.RecommendSlotsRequest) ([]models.TimeSlot, error) {
-	args := m.Called(req)
-	return args.Get(0).([]models.TimeSlot), args.Error(1)
+func (m *MockTimeslotRepo) DeleteTimeSlotsByUserName(orgID uuid.UUID, userName, timeSlot string) error {
+	args := m.Called(orgID, userName, timeSlot)
+	return args.Error(0)
 }
 
 func TestRecommendSlots(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
-	mockRepo := new(MockTimeslotRepo)
-	timeslotService := NewTimeslotService(mockRepo)
-
-	router := gin.Default()
-	router.POST("/recommend-slots", timeslotService.RecommendSlots)
+	newRouter := func(mockTimeslotRepo *MockTimeslotRepo) *gin.Engine {
+		timeslotService := &TimeslotServiceImplementaion{TimeslotRepo: mockTimeslotRepo}
+		router := gin.New()
+		router.Use(withOrg(testOrg))
+		router.POST("/recommend-slots", timeslotService.RecommendSlots)
+		return router
+	}
 
 	t.Run("Success", func(t *testing.T) {
-		reqBody := models.RecommendSlotsRequest{
-			UserID: "test-user-id",
-			// Add other fields as necessary
-		}
-		reqJSON, _ := json.Marshal(reqBody)
-
-		expectedSlots := []models.TimeSlot{
-			{ID: "slot1", Time: "10:00 AM"},
-			{ID: "slot2", Time: "11:00 AM"},
-		}
-
-		mockRepo.On("RecommendSlots", reqBody).Return(expectedSlots, nil)
+		mockTimeslotRepo := new(MockTimeslotRepo)
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "eshan").Return([]string{"06 Jan 2025 10-11 AM UTC", "06 Jan 2025 2-3 PM UTC"}, nil)
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "kevin").Return([]string{"06 Jan 2025 9-11 AM UTC"}, nil)
+		router := newRouter(mockTimeslotRepo)
 
+		reqJSON, _ := json.Marshal(models.RecommendSlotsRequest{Organizer: "eshan", Participants: []string{"kevin"}, EventDuration: 60})
 		req, _ := http.NewRequest(http.MethodPost, "/recommend-slots", bytes.NewBuffer(reqJSON))
 		req.Header.Set("Content-Type", "application/json")
 		resp := httptest.NewRecorder()
@@ -276,15 +281,18 @@ func TestRecommendSlots(t *testing.T) {
 		router.ServeHTTP(resp, req)
 
 		assert.Equal(t, http.StatusOK, resp.Code)
-		var response map[string][]models.TimeSlot
-		err := json.Unmarshal(resp.Body.Bytes(), &response)
-		assert.NoError(t, err)
-		assert.Equal(t, expectedSlots, response["slots"])
-		mockRepo.AssertExpectations(t)
+		var response models.RecommendSlotsResponse
+		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &response))
+		assert.Len(t, response.MatchedSlots, 1)
+		assert.Len(t, response.PartialSlots, 1)
+		assert.Equal(t, []string{"kevin"}, response.PartialSlots[0].UnavailableParticipants)
+		mockTimeslotRepo.AssertExpectations(t)
 	})
 
 	t.Run("InvalidRequestBody", func(t *testing.T) {
-		req, _ := http.NewRequest(http.MethodPost, "/recommend-slots", bytes.NewBuffer([]byte(`{}`)))
+		router := newRouter(new(MockTimeslotRepo))
+
+		req, _ := http.NewRequest(http.MethodPost, "/recommend-slots", bytes.NewBuffer([]byte(`{"organizer":`)))
 		req.Header.Set("Content-Type", "application/json")
 		resp := httptest.NewRecorder()
 
@@ -294,14 +302,11 @@ func TestRecommendSlots(t *testing.T) {
 	})
 
 	t.Run("InternalServerError", func(t *testing.T) {
-		reqBody := models.RecommendSlotsRequest{
-			UserID: "test-user-id",
-			// Add other fields as necessary
-		}
-		reqJSON, _ := json.Marshal(reqBody)
-
-		mockRepo.On("RecommendSlots", reqBody).Return(nil, assert.AnError)
+		mockTimeslotRepo := new(MockTimeslotRepo)
+		mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "eshan").Return([]string(nil), assert.AnError)
+		router := newRouter(mockTimeslotRepo)
 
+		reqJSON, _ := json.Marshal(models.RecommendSlotsRequest{Organizer: "eshan", Participants: []string{"kevin"}, EventDuration: 60})
 		req, _ := http.NewRequest(http.MethodPost, "/recommend-slots", bytes.NewBuffer(reqJSON))
 		req.Header.Set("Content-Type", "application/json")
 		resp := httptest.NewRecorder()
@@ -309,6 +314,6 @@ func TestRecommendSlots(t *testing.T) {
 		router.ServeHTTP(resp, req)
 
 		assert.Equal(t, http.StatusInternalServerError, resp.Code)
-		mockRepo.AssertExpectations(t)
+		mockTimeslotRepo.AssertExpectations(t)
 	})
 }
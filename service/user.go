@@ -1,7 +1,13 @@
 package service
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"timeslot-app/middleware"
 	"timeslot-app/models"
 	"timeslot-app/repository"
 
@@ -11,26 +17,42 @@ import (
 )
 
 type UserService struct {
-	userRepo repository.UserRepo
+	userRepo     repository.UserRepo
+	reminderRepo repository.ReminderRepo
+	profileRepo  repository.ProfileRepo
+	apiKeyRepo   repository.APIKeyRepo
+	delegateRepo repository.DelegateRepo
+	webhooks     WebhookPublisher
 }
 
-func NewUserService(db *pgx.Conn) *UserService {
+func NewUserService(db *pgx.ConnPool) *UserService {
 	service := new(UserService)
 	service.userRepo = repository.NewUserRepo(db)
+	service.reminderRepo = repository.NewReminderRepository(db)
+	service.profileRepo = repository.NewProfileRepository(db)
+	service.apiKeyRepo = repository.NewAPIKeyRepository(db)
+	service.delegateRepo = repository.NewDelegateRepository(db)
+	service.webhooks = NewWebhookOutbox(db)
 	return service
 }
 
 // ShowAccount godoc
 // @Summary      Create a user
-// @Description  Create a new user
+// @Description  Create a new user in the organization, the response carries their first API key which is not shown again.
+// @Description  Only admins add users, except for the first user of an organization who signs up without credentials
+// @Description  and is made its admin.
 // @Tags         Users
 // @Accept       json
 // @Produce      json
 // @Param        body   body   	models.UserCreateRequest   true "Create User request body"
-// @Success      200  {object}  string "User created successfully"
+// @Success      201  {object}  models.UserCreatedResponse
 // @Failure      400  {object}  string "Invalid request body"
+// @Failure      401  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
 // @Failure      500  {object}  string "Error creating user"
-// @Router       /user [post]
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users [post]
 func (ts *UserService) CreateUser(ctx *gin.Context) {
 	// create time slot
 	var userReq models.UserCreateRequest
@@ -47,7 +69,14 @@ func (ts *UserService) CreateUser(ctx *gin.Context) {
 	}
 
 	user.ID = userID
+	user.OrgID = requestOrgID(ctx)
 	user.Name = userReq.Name
+	// the name never grants more, whoever picks one shouldn't get a role with it. The first user of an
+	// organization administers it, later users are added as members
+	user.Role = models.RoleMember
+	if middleware.IsFirstUser(ctx) {
+		user.Role = models.RoleAdmin
+	}
 	// save the time slot for the user.
 
 	err = ts.userRepo.Create(user)
@@ -55,5 +84,260 @@ func (ts *UserService) CreateUser(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating user"})
 		return
 	}
-	ctx.JSON(http.StatusCreated, gin.H{"message": "User created successfully"})
+	publishWebhook(ts.webhooks, requestOrgID(ctx), models.WebhookUserCreated, user)
+
+	key, err := issueAPIKey(ts.apiKeyRepo, user.ID, "default", nil)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "User created but their API key could not be issued"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, models.UserCreatedResponse{Message: "User created successfully", User: user, APIKey: key})
+}
+
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+	// maxUserNameLength matches the users.name column
+	maxUserNameLength = 50
+)
+
+// ShowAccount godoc
+// @Summary      List users
+// @Description  List users ordered by name, optionally only the ones whose name contains the search
+// @Tags         Users
+// @Produce      json
+// @Param        search   query   string   false  "Part of the name, matched case insensitively"
+// @Param        limit   query   int   false  "Page size, 50 by default and 200 at most"
+// @Param        offset   query   int   false  "Number of users to skip"
+// @Success      200  {object}  models.UserListResponse
+// @Failure      400  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users [get]
+func (us *UserService) ListUsers(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(defaultUserPageSize)))
+	if err != nil || limit < 1 || limit > maxUserPageSize {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxUserPageSize)})
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "offset must be zero or more"})
+		return
+	}
+
+	users, total, err := us.userRepo.List(requestOrgID(ctx), ctx.Query("search"), limit, offset)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching users"})
+		return
+	}
+	ctx.JSON(http.StatusOK, models.UserListResponse{Users: users, Total: total, Limit: limit, Offset: offset})
+}
+
+// ShowAccount godoc
+// @Summary      Get a user
+// @Description  Get a user by ID
+// @Tags         Users
+// @Produce      json
+// @Param        id   path   string   true  "User ID"
+// @Success      200  {object}  models.User
+// @Failure      400  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{id} [get]
+func (us *UserService) GetUser(ctx *gin.Context) {
+	userID, err := uuid.FromString(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := us.userRepo.GetByID(requestOrgID(ctx), userID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return
+	}
+	ctx.JSON(http.StatusOK, user)
+}
+
+// ShowAccount godoc
+// @Summary      Rename a user
+// @Description  Change the name of a user, their time slots and events stay with them
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        id   path   string   true  "User ID"
+// @Param        body   body   	models.UserUpdateRequest   true "Update User request body"
+// @Success      200  {object}  models.User
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      409  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{id} [patch]
+func (us *UserService) UpdateUser(ctx *gin.Context) {
+	userID, err := uuid.FromString(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var userReq models.UserUpdateRequest
+	if err := ctx.BindJSON(&userReq); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	name := strings.TrimSpace(userReq.Name)
+	if name == "" || len(name) > maxUserNameLength {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name must be between 1 and %d characters", maxUserNameLength)})
+		return
+	}
+
+	err = us.userRepo.Rename(requestOrgID(ctx), userID, name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return
+	}
+	if errors.Is(err, repository.ErrUserExists) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		return
+	}
+
+	user := models.User{ID: userID, OrgID: requestOrgID(ctx), Name: name}
+	publishWebhook(us.webhooks, requestOrgID(ctx), models.WebhookUserUpdated, user)
+	ctx.JSON(http.StatusOK, user)
+}
+
+// ShowAccount godoc
+// @Summary      Delete a user
+// @Description  Delete a user along with their time slots, settings and event types, and take them off the events
+// @Description  they were invited to. owned_events says what happens to the events they own: delete gives the time
+// @Description  back to the other attendees, reassign hands them to the user named in reassign_to.
+// @Tags         Users
+// @Produce      json
+// @Param        id   path   string   true  "User ID"
+// @Param        owned_events   query   string   true  "delete or reassign"
+// @Param        reassign_to   query   string   false  "Name of the user taking over the events when reassigning"
+// @Success      204
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      409  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{id} [delete]
+func (us *UserService) DeleteUser(ctx *gin.Context) {
+	userID, err := uuid.FromString(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := us.userRepo.GetByID(requestOrgID(ctx), userID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return
+	}
+
+	var reassignTo uuid.NullUUID
+	switch ctx.Query("owned_events") {
+	case models.OwnedEventsDelete:
+		if ctx.Query("reassign_to") != "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "reassign_to is only used when owned_events is reassign"})
+			return
+		}
+	case models.OwnedEventsReassign:
+		newOwner, err := us.userRepo.Get(requestOrgID(ctx), ctx.Query("reassign_to"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "reassign_to must name the user taking over the events"})
+			return
+		}
+		if newOwner.ID == userID {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "events can't be reassigned to the user being deleted"})
+			return
+		}
+		reassignTo = uuid.NullUUID{UUID: newOwner.ID, Valid: true}
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "owned_events must be delete or reassign"})
+		return
+	}
+
+	err = us.userRepo.Delete(userID, reassignTo)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return
+	}
+	if errors.Is(err, repository.ErrEventConflict) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "the new owner is already booked during some of the events: " + err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting user"})
+		return
+	}
+
+	publishWebhook(us.webhooks, requestOrgID(ctx), models.WebhookUserDeleted, user)
+	ctx.Status(http.StatusNoContent)
+}
+
+// ShowAccount godoc
+// @Summary      Change a user's role
+// @Description  Make a user an admin, who acts on everyone's data, a member, who acts on their own and that of the
+// @Description  users they are a delegate of, or a viewer, who changes nothing. Only admins may change roles.
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        username   path   string   true  "Username"
+// @Param        body   body   	models.UserRoleRequest   true "Role request body"
+// @Success      200  {object}  models.User
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{username}/role [put]
+func (us *UserService) SetUserRole(ctx *gin.Context) {
+	var roleReq models.UserRoleRequest
+	if err := ctx.BindJSON(&roleReq); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if !slices.Contains([]string{models.RoleAdmin, models.RoleMember, models.RoleViewer}, roleReq.Role) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "role must be admin, member or viewer"})
+		return
+	}
+
+	user, err := us.userRepo.Get(requestOrgID(ctx), ctx.Param("username"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+		return
+	}
+
+	err = us.userRepo.SetRole(user.ID, roleReq.Role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		return
+	}
+
+	user.Role = roleReq.Role
+	publishWebhook(us.webhooks, requestOrgID(ctx), models.WebhookUserUpdated, user)
+	ctx.JSON(http.StatusOK, user)
 }
@@ -6,10 +6,15 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"timeslot-app/middleware"
 	"timeslot-app/models"
+	"timeslot-app/repository"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -23,13 +28,53 @@ func (m *MockUserRepo) Create(user models.User) error {
 	return args.Error(0)
 }
 
-func (m *MockUserRepo) UserExists(userName string) (bool, error) {
-	args := m.Called(userName)
+func (m *MockUserRepo) UserExists(orgID uuid.UUID, userName string) (bool, error) {
+	args := m.Called(orgID, userName)
 	return args.Bool(0), args.Error(1)
 }
 
-func (m *MockUserRepo) Get(userName string) (models.User, error) {
-	args := m.Called(userName)
+func (m *MockUserRepo) Get(orgID uuid.UUID, userName string) (models.User, error) {
+	args := m.Called(orgID, userName)
+	return args.Get(0).(models.User), args.Error(1)
+}
+
+func (m *MockUserRepo) GetByID(orgID, userID uuid.UUID) (models.User, error) {
+	args := m.Called(orgID, userID)
+	return args.Get(0).(models.User), args.Error(1)
+}
+
+func (m *MockUserRepo) GetUsersByNames(orgID uuid.UUID, userNames []string) ([]models.User, error) {
+	args := m.Called(orgID, userNames)
+	return args.Get(0).([]models.User), args.Error(1)
+}
+
+func (m *MockUserRepo) List(orgID uuid.UUID, search string, limit, offset int) ([]models.User, int, error) {
+	args := m.Called(orgID, search, limit, offset)
+	return args.Get(0).([]models.User), args.Int(1), args.Error(2)
+}
+
+func (m *MockUserRepo) Rename(orgID, userID uuid.UUID, name string) error {
+	args := m.Called(orgID, userID, name)
+	return args.Error(0)
+}
+
+func (m *MockUserRepo) Delete(userID uuid.UUID, reassignTo uuid.NullUUID) error {
+	args := m.Called(userID, reassignTo)
+	return args.Error(0)
+}
+
+func (m *MockUserRepo) SetRole(userID uuid.UUID, role string) error {
+	args := m.Called(userID, role)
+	return args.Error(0)
+}
+
+func (m *MockUserRepo) PromoteAdmins(orgID uuid.UUID, userNames []string) error {
+	args := m.Called(orgID, userNames)
+	return args.Error(0)
+}
+
+func (m *MockUserRepo) GetBySubject(orgID uuid.UUID, subject string) (models.User, error) {
+	args := m.Called(orgID, subject)
 	return args.Get(0).(models.User), args.Error(1)
 }
 
@@ -38,9 +83,12 @@ func TestCreateUser(t *testing.T) {
 
 	t.Run("Success", func(t *testing.T) {
 		mockUserRepo := new(MockUserRepo)
-		userService := &UserService{userRepo: mockUserRepo}
+		mockAPIKeyRepo := new(MockAPIKeyRepo)
+		userService := &UserService{userRepo: mockUserRepo, apiKeyRepo: mockAPIKeyRepo}
 
 		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
 		router.POST("/user", userService.CreateUser)
 
 		userReq := models.UserCreateRequest{Name: "John Doe"}
@@ -51,18 +99,77 @@ func TestCreateUser(t *testing.T) {
 
 		recorder := httptest.NewRecorder()
 		mockUserRepo.On("Create", mock.Anything).Return(nil)
+		mockAPIKeyRepo.On("CreateAPIKey", mock.Anything, mock.Anything).Return(nil)
 
 		router.ServeHTTP(recorder, req)
 
 		assert.Equal(t, http.StatusCreated, recorder.Code)
+		var response models.UserCreatedResponse
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, "John Doe", response.User.Name)
+		assert.True(t, strings.HasPrefix(response.APIKey.Key, "tsk_"))
+		assert.Equal(t, response.APIKey.Key[:12], response.APIKey.Prefix)
+		mockAPIKeyRepo.AssertCalled(t, "CreateAPIKey", mock.MatchedBy(func(key models.APIKey) bool {
+			return key.UserID == response.User.ID
+		}), mock.MatchedBy(func(hash string) bool {
+			return hash != response.APIKey.Key && len(hash) == 64
+		}))
 		mockUserRepo.AssertExpectations(t)
 	})
 
+	t.Run("Configured Admin Name", func(t *testing.T) {
+		mockUserRepo := new(MockUserRepo)
+		mockAPIKeyRepo := new(MockAPIKeyRepo)
+		userService := &UserService{userRepo: mockUserRepo, apiKeyRepo: mockAPIKeyRepo}
+
+		// admin_users are promoted at startup, signing up as one of them only makes a member
+		router := gin.Default()
+		router.Use(withOrg(models.Organization{ID: models.DefaultOrgID, Slug: models.DefaultOrgSlug}))
+
+		router.POST("/user", userService.CreateUser)
+
+		mockUserRepo.On("Create", mock.Anything).Return(nil)
+		mockAPIKeyRepo.On("CreateAPIKey", mock.Anything, mock.Anything).Return(nil)
+		for name, role := range map[string]string{"root": models.RoleMember, "John Doe": models.RoleMember} {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/user", models.UserCreateRequest{Name: name}))
+			assert.Equal(t, http.StatusCreated, recorder.Code)
+			mockUserRepo.AssertCalled(t, "Create", mock.MatchedBy(func(user models.User) bool {
+				return user.Name == name && user.Role == role
+			}))
+		}
+	})
+
+	t.Run("First User", func(t *testing.T) {
+		mockUserRepo := new(MockUserRepo)
+		mockAPIKeyRepo := new(MockAPIKeyRepo)
+		userService := &UserService{userRepo: mockUserRepo, apiKeyRepo: mockAPIKeyRepo}
+
+		// the first user of an organization administers it
+		auth := &middleware.Authenticator{UserRepo: mockUserRepo}
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
+		router.POST("/user", auth.FirstUser(userService.CreateUser), auth.Authenticate, userService.CreateUser)
+
+		mockUserRepo.On("List", testOrg.ID, "", 1, 0).Return([]models.User{}, 0, nil)
+		mockUserRepo.On("Create", mock.Anything).Return(nil)
+		mockAPIKeyRepo.On("CreateAPIKey", mock.Anything, mock.Anything).Return(nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, newJSONRequest(http.MethodPost, "/user", models.UserCreateRequest{Name: "John Doe"}))
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		mockUserRepo.AssertCalled(t, "Create", mock.MatchedBy(func(user models.User) bool {
+			return user.Name == "John Doe" && user.Role == models.RoleAdmin
+		}))
+	})
+
 	t.Run("Invalid Request Body", func(t *testing.T) {
 		mockUserRepo := new(MockUserRepo)
 		userService := &UserService{userRepo: mockUserRepo}
 
 		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
 		router.POST("/user", userService.CreateUser)
 
 		req, _ := http.NewRequest(http.MethodPost, "/user", bytes.NewBuffer([]byte("{invalid json}")))
@@ -80,6 +187,8 @@ func TestCreateUser(t *testing.T) {
 		userService := &UserService{userRepo: mockUserRepo}
 
 		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
 		router.POST("/user", userService.CreateUser)
 
 		userReq := models.UserCreateRequest{Name: "John Doe"}
@@ -97,3 +206,176 @@ func TestCreateUser(t *testing.T) {
 		mockUserRepo.AssertExpectations(t)
 	})
 }
+
+func TestListUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockUserRepo := new(MockUserRepo)
+	userService := &UserService{userRepo: mockUserRepo}
+
+	router := gin.Default()
+	router.Use(withOrg(testOrg))
+
+	router.GET("/users", userService.ListUsers)
+
+	users := []models.User{{Name: "eshan"}, {Name: "kevin"}}
+	mockUserRepo.On("List", testOrg.ID, "an", 2, 4).Return(users, 7, nil)
+
+	req, _ := http.NewRequest(http.MethodGet, "/users?search=an&limit=2&offset=4", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var resp models.UserListResponse
+	json.Unmarshal(recorder.Body.Bytes(), &resp)
+	assert.Equal(t, models.UserListResponse{Users: users, Total: 7, Limit: 2, Offset: 4}, resp)
+
+	for _, query := range []string{"limit=0", "limit=500", "offset=-1"} {
+		req, _ := http.NewRequest(http.MethodGet, "/users?"+query, nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, query)
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID, _ := uuid.NewV4()
+	missingID, _ := uuid.NewV4()
+
+	mockUserRepo := new(MockUserRepo)
+	userService := &UserService{userRepo: mockUserRepo}
+
+	router := gin.Default()
+	router.Use(withOrg(testOrg))
+
+	router.GET("/users/:id", userService.GetUser)
+
+	mockUserRepo.On("GetByID", testOrg.ID, userID).Return(models.User{ID: userID, Name: "kevin"}, nil)
+	mockUserRepo.On("GetByID", testOrg.ID, missingID).Return(models.User{}, pgx.ErrNoRows)
+
+	for target, code := range map[string]int{
+		"/users/" + userID.String():    http.StatusOK,
+		"/users/" + missingID.String(): http.StatusNotFound,
+		"/users/kevin":                 http.StatusBadRequest,
+	} {
+		req, _ := http.NewRequest(http.MethodGet, target, nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		assert.Equal(t, code, recorder.Code, target)
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID, _ := uuid.NewV4()
+
+	mockUserRepo := new(MockUserRepo)
+	mockPublisher := new(MockWebhookPublisher)
+	userService := &UserService{userRepo: mockUserRepo, webhooks: mockPublisher}
+
+	router := gin.Default()
+	router.Use(withOrg(testOrg))
+
+	router.PATCH("/users/:id", userService.UpdateUser)
+
+	rename := func(name string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.UserUpdateRequest{Name: name})
+		req, _ := http.NewRequest(http.MethodPatch, "/users/"+userID.String(), bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mockUserRepo.On("Rename", testOrg.ID, userID, "kevin").Return(nil).Once()
+		mockPublisher.On("Publish", testOrg.ID, models.WebhookUserUpdated, models.User{ID: userID, OrgID: testOrg.ID, Name: "kevin"}).Return().Once()
+
+		recorder := rename("  kevin ")
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		mockPublisher.AssertExpectations(t)
+	})
+
+	t.Run("Name taken", func(t *testing.T) {
+		mockUserRepo.On("Rename", testOrg.ID, userID, "eshan").Return(repository.ErrUserExists).Once()
+		assert.Equal(t, http.StatusConflict, rename("eshan").Code)
+	})
+
+	t.Run("Missing user", func(t *testing.T) {
+		mockUserRepo.On("Rename", testOrg.ID, userID, "jane").Return(pgx.ErrNoRows).Once()
+		assert.Equal(t, http.StatusNotFound, rename("jane").Code)
+	})
+
+	t.Run("Invalid name", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, rename(" ").Code)
+		assert.Equal(t, http.StatusBadRequest, rename(strings.Repeat("a", 51)).Code)
+	})
+
+	mockUserRepo.AssertExpectations(t)
+}
+
+func TestDeleteUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID, _ := uuid.NewV4()
+	eshanID, _ := uuid.NewV4()
+	user := models.User{ID: userID, Name: "kevin"}
+
+	newUserService := func() (*UserService, *MockUserRepo, *MockWebhookPublisher) {
+		mockUserRepo := new(MockUserRepo)
+		mockPublisher := new(MockWebhookPublisher)
+		mockUserRepo.On("GetByID", testOrg.ID, userID).Return(user, nil)
+		mockUserRepo.On("Get", testOrg.ID, "eshan").Return(models.User{ID: eshanID, Name: "eshan"}, nil)
+		mockUserRepo.On("Get", testOrg.ID, "kevin").Return(user, nil)
+		mockUserRepo.On("Get", testOrg.ID, "").Return(models.User{}, pgx.ErrNoRows)
+		return &UserService{userRepo: mockUserRepo, webhooks: mockPublisher}, mockUserRepo, mockPublisher
+	}
+
+	deleteUser := func(userService *UserService, query string) *httptest.ResponseRecorder {
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+		router.DELETE("/users/:id", userService.DeleteUser)
+
+		req, _ := http.NewRequest(http.MethodDelete, "/users/"+userID.String()+"?"+query, nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("Delete owned events", func(t *testing.T) {
+		userService, mockUserRepo, mockPublisher := newUserService()
+		mockUserRepo.On("Delete", userID, uuid.NullUUID{}).Return(nil)
+		mockPublisher.On("Publish", testOrg.ID, models.WebhookUserDeleted, user).Return()
+
+		assert.Equal(t, http.StatusNoContent, deleteUser(userService, "owned_events=delete").Code)
+		mockUserRepo.AssertCalled(t, "Delete", userID, uuid.NullUUID{})
+		mockPublisher.AssertExpectations(t)
+	})
+
+	t.Run("Reassign owned events", func(t *testing.T) {
+		userService, mockUserRepo, mockPublisher := newUserService()
+		mockUserRepo.On("Delete", userID, uuid.NullUUID{UUID: eshanID, Valid: true}).Return(nil)
+		mockPublisher.On("Publish", testOrg.ID, models.WebhookUserDeleted, user).Return()
+
+		assert.Equal(t, http.StatusNoContent, deleteUser(userService, "owned_events=reassign&reassign_to=eshan").Code)
+		mockUserRepo.AssertCalled(t, "Delete", userID, uuid.NullUUID{UUID: eshanID, Valid: true})
+	})
+
+	t.Run("New owner is booked", func(t *testing.T) {
+		userService, mockUserRepo, mockPublisher := newUserService()
+		mockUserRepo.On("Delete", userID, uuid.NullUUID{UUID: eshanID, Valid: true}).Return(repository.ErrEventConflict)
+
+		assert.Equal(t, http.StatusConflict, deleteUser(userService, "owned_events=reassign&reassign_to=eshan").Code)
+		mockPublisher.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Policy is required", func(t *testing.T) {
+		userService, mockUserRepo, _ := newUserService()
+
+		for _, query := range []string{"", "owned_events=keep", "owned_events=reassign", "owned_events=reassign&reassign_to=kevin", "owned_events=delete&reassign_to=eshan"} {
+			assert.Equal(t, http.StatusBadRequest, deleteUser(userService, query).Code, query)
+		}
+		mockUserRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+}
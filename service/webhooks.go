@@ -0,0 +1,490 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+	"timeslot-app/models"
+	"timeslot-app/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+)
+
+const (
+	defaultWebhookDeliveryPageSize = 50
+	maxWebhookDeliveryPageSize     = 200
+)
+
+var errWebhookTarget = errors.New("webhook URL must not point to a loopback, link-local or private address")
+
+// nonPublicNetworks are the ranges besides loopback, link-local and private ones a webhook may not reach, the
+// "this network" block and the carrier-grade NAT space
+var nonPublicNetworks = []*net.IPNet{
+	{IP: net.IPv4(0, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)},
+}
+
+// WebhookPublisher queues a lifecycle event for the webhooks of the organization subscribed to it
+type WebhookPublisher interface {
+	Publish(orgID uuid.UUID, eventType string, data any)
+}
+
+// WebhookOutbox stores published events as pending deliveries for the dispatcher to send. Publishing never fails
+// the request that caused it, an event that can't be queued is logged and dropped.
+type WebhookOutbox struct {
+	WebhookRepo repository.WebhookRepo
+}
+
+func NewWebhookOutbox(db *pgx.ConnPool) *WebhookOutbox {
+	return &WebhookOutbox{WebhookRepo: repository.NewWebhookRepository(db)}
+}
+
+func (wo *WebhookOutbox) Publish(orgID uuid.UUID, eventType string, data any) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("error encoding %s webhook:: %s", eventType, err)
+		return
+	}
+
+	payloadID, _ := uuid.NewV4()
+	payload := models.WebhookPayload{ID: payloadID, Type: eventType, CreatedAt: time.Now().UTC(), Data: encoded}
+	if err := wo.WebhookRepo.EnqueueWebhookPayload(orgID, payload); err != nil {
+		log.Printf("error queueing %s webhook:: %s", eventType, err)
+	}
+}
+
+// publishWebhook publishes through the publisher when the service has one
+func publishWebhook(publisher WebhookPublisher, orgID uuid.UUID, eventType string, data any) {
+	if publisher == nil {
+		return
+	}
+	if event, ok := data.(models.Event); ok {
+		data = withoutPrivateDetails(event)
+	}
+	publisher.Publish(orgID, eventType, data)
+}
+
+// withoutPrivateDetails leaves a private event with its time and attendees like conflicts report it, webhook
+// receivers are outside the rules that decide who sees the details
+func withoutPrivateDetails(event models.Event) models.Event {
+	if event.Visibility != models.EventVisibilityPrivate {
+		return event
+	}
+	event.Title = "Busy"
+	event.Description, event.Location, event.ConferenceURL = "", "", ""
+	return event
+}
+
+// publicAddress reports whether a webhook may be sent to the address, anything on the loopback, link-local or
+// private networks of the app is refused
+func publicAddress(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// refusePrivateDial stops connections to addresses that aren't public, it checks the address a host name
+// resolved to when it is dialed so a name pointed elsewhere after the webhook was registered is still refused
+func refusePrivateDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicAddress(ip) {
+		return errWebhookTarget
+	}
+	return nil
+}
+
+// refuseWebhookRedirect hands back a redirect as the response, a receiver can't send a delivery on to a target
+// that wasn't checked
+func refuseWebhookRedirect(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// newWebhookClient is the client deliveries are sent with, it only connects to public addresses, ignores proxy
+// settings and doesn't follow redirects
+func newWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: refusePrivateDial}
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout},
+		CheckRedirect: refuseWebhookRedirect,
+	}
+}
+
+// signWebhook is the signature a receiver recomputes to check a delivery, an HMAC-SHA256 with the webhook secret
+// over the timestamp header, a dot and the body
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookDispatcher sends queued webhook deliveries. Like reminders, deliveries are claimed in the database before
+// they are sent so several instances of the app can dispatch from the same queue.
+type WebhookDispatcher struct {
+	WebhookRepo repository.WebhookRepo
+	Client      *http.Client
+	// Interval is how often the dispatcher looks for due deliveries
+	Interval time.Duration
+	// BatchSize is the most deliveries claimed at a time
+	BatchSize int
+	// Lease is how long a claimed delivery is left to its sender before another dispatcher takes it over
+	Lease time.Duration
+	// MaxAttempts is how often a delivery is tried before it is dead-lettered
+	MaxAttempts int
+	// RetryBackoff is the wait after the first failed attempt, it doubles with every further attempt
+	RetryBackoff time.Duration
+}
+
+func NewWebhookDispatcher(db *pgx.ConnPool) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		WebhookRepo:  repository.NewWebhookRepository(db),
+		Client:       newWebhookClient(10 * time.Second),
+		Interval:     10 * time.Second,
+		BatchSize:    50,
+		Lease:        2 * time.Minute,
+		MaxAttempts:  8,
+		RetryBackoff: 30 * time.Second,
+	}
+}
+
+// Run sends due deliveries every interval until the context is done, it blocks and is meant to run in its own goroutine
+func (wd *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(wd.Interval)
+	defer ticker.Stop()
+
+	for {
+		delivered, err := wd.RunOnce(ctx)
+		if err != nil {
+			log.Printf("error sending webhooks:: %s", err)
+		} else if delivered > 0 {
+			log.Printf("delivered %d webhooks", delivered)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce claims the deliveries that are due and sends them, returning how many were delivered. Failed deliveries
+// are retried with exponential backoff and dead-lettered once they have used up their attempts.
+func (wd *WebhookDispatcher) RunOnce(ctx context.Context) (int, error) {
+	now := time.Now()
+	deliveries, err := wd.WebhookRepo.ClaimDueDeliveries(now, wd.Lease, wd.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	var errs []error
+	for _, delivery := range deliveries {
+		statusCode, err := wd.send(ctx, delivery)
+		if err == nil {
+			delivered++
+			errs = append(errs, wd.WebhookRepo.MarkDeliveryDelivered(delivery.ID, statusCode, time.Now()))
+			continue
+		}
+
+		var retryAt *time.Time
+		if delivery.Attempts < wd.MaxAttempts {
+			next := now.Add(wd.RetryBackoff << (delivery.Attempts - 1))
+			retryAt = &next
+		}
+		errs = append(errs, wd.WebhookRepo.MarkDeliveryFailed(delivery.ID, statusCode, err.Error(), retryAt))
+	}
+	return delivered, errors.Join(errs...)
+}
+
+// send posts a delivery, any response other than 2xx counts as a failure, redirects included
+func (wd *WebhookDispatcher) send(ctx context.Context, delivery models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-ID", delivery.ID.String())
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", signWebhook(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := wd.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+type WebhookService struct {
+	WebhookRepo repository.WebhookRepo
+	// LookupIPAddr resolves the host of a webhook URL when it is registered
+	LookupIPAddr func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+func NewWebhookService(db *pgx.ConnPool) *WebhookService {
+	return &WebhookService{WebhookRepo: repository.NewWebhookRepository(db), LookupIPAddr: net.DefaultResolver.LookupIPAddr}
+}
+
+// checkWebhookHost refuses a webhook host that is or resolves to an address that isn't public
+func (ws *WebhookService) checkWebhookHost(ctx context.Context, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if !publicAddress(ip) {
+			return errWebhookTarget
+		}
+		return nil
+	}
+
+	addrs, err := ws.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("webhook host %s can't be resolved", host)
+	}
+	for _, addr := range addrs {
+		if !publicAddress(addr.IP) {
+			return errWebhookTarget
+		}
+	}
+	return nil
+}
+
+// ShowAccount godoc
+// @Summary      Create a webhook
+// @Description  Subscribe a URL to lifecycle events: user.created, timeslot.created, timeslot.deleted, event.created,
+// @Description  event.updated, event.cancelled and rsvp.changed. Deliveries are signed with the returned secret, the
+// @Description  X-Webhook-Signature header is sha256= followed by the hex HMAC-SHA256 of X-Webhook-Timestamp, a dot and the body.
+// @Description  The URL must reach a public address, redirects aren't followed and private events are sent without their details.
+// @Tags         Webhooks
+// @Accept       json
+// @Produce      json
+// @Param        body   body   	models.WebhookRequest   true "Webhook request body"
+// @Success      201  {object}  models.Webhook
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /webhooks [post]
+func (ws *WebhookService) CreateWebhook(ctx *gin.Context) {
+	var webhookReq models.WebhookRequest
+	if err := ctx.BindJSON(&webhookReq); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	target, err := url.Parse(webhookReq.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Webhook URL must be an absolute http or https URL"})
+		return
+	}
+	if err := ws.checkWebhookHost(ctx.Request.Context(), target.Hostname()); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(webhookReq.Events) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Webhook events are required"})
+		return
+	}
+	events := []string{}
+	for _, event := range webhookReq.Events {
+		if !slices.Contains(models.WebhookEventTypes, event) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unknown webhook event " + event})
+			return
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating webhook secret"})
+		return
+	}
+
+	webhookID, _ := uuid.NewV4()
+	webhook := models.Webhook{
+		ID:        webhookID,
+		URL:       webhookReq.URL,
+		Events:    events,
+		Secret:    hex.EncodeToString(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+	err = ws.WebhookRepo.CreateWebhook(requestOrgID(ctx), webhook)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating webhook"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, webhook)
+}
+
+// ShowAccount godoc
+// @Summary      List webhooks
+// @Description  List the webhook subscriptions, secrets are only shown when a webhook is created
+// @Tags         Webhooks
+// @Produce      json
+// @Success      200  {array}  models.Webhook
+// @Failure      403  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /webhooks [get]
+func (ws *WebhookService) ListWebhooks(ctx *gin.Context) {
+	webhooks, err := ws.WebhookRepo.ListWebhooks(requestOrgID(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching webhooks"})
+		return
+	}
+	ctx.JSON(http.StatusOK, webhooks)
+}
+
+// ShowAccount godoc
+// @Summary      Delete a webhook
+// @Description  Delete a webhook subscription together with its delivery log
+// @Tags         Webhooks
+// @Produce      json
+// @Param        webhookID   path   string   true  "Webhook ID"
+// @Success      200  {object}  models.ServiceMessage
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /webhooks/{webhookID} [delete]
+func (ws *WebhookService) DeleteWebhook(ctx *gin.Context) {
+	webhookID := ctx.Param("webhookID")
+	if _, err := uuid.FromString(webhookID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	err := ws.WebhookRepo.DeleteWebhook(requestOrgID(ctx), webhookID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting webhook"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// ShowAccount godoc
+// @Summary      Webhook delivery log
+// @Description  List the deliveries of a webhook, newest first, with their attempts and last response
+// @Tags         Webhooks
+// @Produce      json
+// @Param        webhookID   path   string   true  "Webhook ID"
+// @Param        status  query   string   false  "Only deliveries with this status: pending, delivering, delivered or dead"
+// @Param        limit  query   int      false  "Page size, 50 by default and at most 200"
+// @Param        offset query   int      false  "Number of deliveries to skip"
+// @Success      200  {object}  models.WebhookDeliveriesResponse
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /webhooks/{webhookID}/deliveries [get]
+func (ws *WebhookService) ListWebhookDeliveries(ctx *gin.Context) {
+	webhookID := ctx.Param("webhookID")
+	if _, err := uuid.FromString(webhookID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	status := ctx.Query("status")
+	statuses := []string{models.WebhookDeliveryPending, models.WebhookDeliveryDelivering, models.WebhookDeliveryDelivered, models.WebhookDeliveryDead}
+	if status != "" && !slices.Contains(statuses, status) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of pending, delivering, delivered or dead"})
+		return
+	}
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(defaultWebhookDeliveryPageSize)))
+	if err != nil || limit < 1 || limit > maxWebhookDeliveryPageSize {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxWebhookDeliveryPageSize)})
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "offset must be zero or more"})
+		return
+	}
+
+	deliveries, err := ws.WebhookRepo.ListDeliveries(requestOrgID(ctx), webhookID, status, limit, offset)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching webhook deliveries"})
+		return
+	}
+	ctx.JSON(http.StatusOK, models.WebhookDeliveriesResponse{Deliveries: deliveries, Limit: limit, Offset: offset})
+}
+
+// ShowAccount godoc
+// @Summary      Retry a dead webhook delivery
+// @Description  Queue a dead-lettered delivery again, it gets a fresh set of attempts
+// @Tags         Webhooks
+// @Produce      json
+// @Param        webhookID   path   string   true  "Webhook ID"
+// @Param        deliveryID   path   string   true  "Delivery ID"
+// @Success      200  {object}  models.ServiceMessage
+// @Failure      400  {object}  models.ServiceError
+// @Failure      403  {object}  models.ServiceError
+// @Failure      404  {object}  models.ServiceError
+// @Failure      500  {object}  models.ServiceError
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /webhooks/{webhookID}/deliveries/{deliveryID}/retry [post]
+func (ws *WebhookService) RetryWebhookDelivery(ctx *gin.Context) {
+	webhookID, deliveryID := ctx.Param("webhookID"), ctx.Param("deliveryID")
+	_, err1 := uuid.FromString(webhookID)
+	_, err2 := uuid.FromString(deliveryID)
+	if err1 != nil || err2 != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook or delivery ID"})
+		return
+	}
+
+	err := ws.WebhookRepo.RetryDelivery(requestOrgID(ctx), webhookID, deliveryID, time.Now())
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "No dead delivery with this ID"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrying webhook delivery"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Delivery queued again"})
+}
@@ -0,0 +1,439 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"timeslot-app/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockWebhookRepo struct {
+	mock.Mock
+}
+
+func (m *MockWebhookRepo) CreateWebhook(orgID uuid.UUID, webhook models.Webhook) error {
+	args := m.Called(orgID, webhook)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepo) ListWebhooks(orgID uuid.UUID) ([]models.Webhook, error) {
+	args := m.Called(orgID)
+	return args.Get(0).([]models.Webhook), args.Error(1)
+}
+
+func (m *MockWebhookRepo) DeleteWebhook(orgID uuid.UUID, webhookID string) error {
+	args := m.Called(orgID, webhookID)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepo) EnqueueWebhookPayload(orgID uuid.UUID, payload models.WebhookPayload) error {
+	args := m.Called(orgID, payload)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepo) ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	args := m.Called(now, lease, limit)
+	return args.Get(0).([]models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookRepo) MarkDeliveryDelivered(deliveryID uuid.UUID, statusCode int, deliveredAt time.Time) error {
+	args := m.Called(deliveryID, statusCode, deliveredAt)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepo) MarkDeliveryFailed(deliveryID uuid.UUID, statusCode int, lastError string, retryAt *time.Time) error {
+	args := m.Called(deliveryID, statusCode, lastError, retryAt)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepo) ListDeliveries(orgID uuid.UUID, webhookID string, status string, limit, offset int) ([]models.WebhookDelivery, error) {
+	args := m.Called(orgID, webhookID, status, limit, offset)
+	return args.Get(0).([]models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookRepo) RetryDelivery(orgID uuid.UUID, webhookID, deliveryID string, at time.Time) error {
+	args := m.Called(orgID, webhookID, deliveryID, at)
+	return args.Error(0)
+}
+
+type MockWebhookPublisher struct {
+	mock.Mock
+}
+
+func (m *MockWebhookPublisher) Publish(orgID uuid.UUID, eventType string, data any) {
+	m.Called(orgID, eventType, data)
+}
+
+func TestCreateWebhook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	setup := func() (*MockWebhookRepo, *gin.Engine) {
+		mockWebhookRepo := new(MockWebhookRepo)
+		webhookService := &WebhookService{WebhookRepo: mockWebhookRepo, LookupIPAddr: func(_ context.Context, host string) ([]net.IPAddr, error) {
+			switch host {
+			case "hooks.example.com":
+				return []net.IPAddr{{IP: net.ParseIP("93.184.215.14")}}, nil
+			case "localhost":
+				return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}, {IP: net.ParseIP("::1")}}, nil
+			case "intranet.example.com":
+				return []net.IPAddr{{IP: net.ParseIP("93.184.215.14")}, {IP: net.ParseIP("10.0.3.7")}}, nil
+			}
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}}
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
+		router.POST("/webhooks", webhookService.CreateWebhook)
+		return mockWebhookRepo, router
+	}
+	createRequest := func(body string) *http.Request {
+		req, _ := http.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mockWebhookRepo, router := setup()
+		mockWebhookRepo.On("CreateWebhook", testOrg.ID, mock.Anything).Return(nil)
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, createRequest(`{"url": "https://hooks.example.com/timeslot", "events": ["event.created", "rsvp.changed", "event.created"]}`))
+
+		assert.Equal(t, http.StatusCreated, resp.Code)
+		var webhook models.Webhook
+		json.Unmarshal(resp.Body.Bytes(), &webhook)
+		assert.Len(t, webhook.Secret, 64)
+		assert.Equal(t, []string{models.WebhookEventCreated, models.WebhookRSVPChanged}, webhook.Events)
+		mockWebhookRepo.AssertExpectations(t)
+	})
+
+	t.Run("Unknown Event", func(t *testing.T) {
+		mockWebhookRepo, router := setup()
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, createRequest(`{"url": "https://hooks.example.com/timeslot", "events": ["event.deleted"]}`))
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		mockWebhookRepo.AssertNotCalled(t, "CreateWebhook", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Invalid URL", func(t *testing.T) {
+		mockWebhookRepo, router := setup()
+
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, createRequest(`{"url": "hooks.example.com", "events": ["event.created"]}`))
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		mockWebhookRepo.AssertNotCalled(t, "CreateWebhook", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Not Public", func(t *testing.T) {
+		for _, target := range []string{
+			"http://127.0.0.1:8080/hook",
+			"http://localhost/hook",
+			"http://[::1]/hook",
+			"http://169.254.169.254/latest/meta-data",
+			"http://192.168.1.10/hook",
+			"http://[::ffff:10.0.0.1]/hook",
+			"http://0.0.0.0/hook",
+			"https://intranet.example.com/hook",
+		} {
+			mockWebhookRepo, router := setup()
+
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, createRequest(`{"url": "`+target+`", "events": ["event.created"]}`))
+
+			assert.Equal(t, http.StatusBadRequest, resp.Code, target)
+			assert.Contains(t, resp.Body.String(), errWebhookTarget.Error(), target)
+			mockWebhookRepo.AssertNotCalled(t, "CreateWebhook", mock.Anything, mock.Anything)
+		}
+	})
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	payload := []byte(`{"id":"7d6a3b1e-8a52-4c1a-9d8e-1f2a3b4c5d6e","type":"event.created","data":{}}`)
+	newDelivery := func(url string, attempts int) models.WebhookDelivery {
+		id, _ := uuid.NewV4()
+		return models.WebhookDelivery{ID: id, EventType: models.WebhookEventCreated, Payload: payload, Attempts: attempts, URL: url, Secret: "s3cret"}
+	}
+	newDispatcher := func(mockWebhookRepo *MockWebhookRepo) *WebhookDispatcher {
+		return &WebhookDispatcher{
+			WebhookRepo:  mockWebhookRepo,
+			Client:       &http.Client{Timeout: time.Second},
+			BatchSize:    10,
+			Lease:        time.Minute,
+			MaxAttempts:  3,
+			RetryBackoff: time.Minute,
+		}
+	}
+
+	t.Run("Signed Delivery", func(t *testing.T) {
+		var body []byte
+		var header http.Header
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ = io.ReadAll(r.Body)
+			header = r.Header
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer receiver.Close()
+
+		delivery := newDelivery(receiver.URL, 1)
+		mockWebhookRepo := new(MockWebhookRepo)
+		mockWebhookRepo.On("ClaimDueDeliveries", mock.Anything, time.Minute, 10).Return([]models.WebhookDelivery{delivery}, nil)
+		mockWebhookRepo.On("MarkDeliveryDelivered", delivery.ID, http.StatusNoContent, mock.Anything).Return(nil)
+
+		delivered, err := newDispatcher(mockWebhookRepo).RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, delivered)
+		assert.Equal(t, payload, body)
+		assert.Equal(t, models.WebhookEventCreated, header.Get("X-Webhook-Event"))
+		assert.Equal(t, delivery.ID.String(), header.Get("X-Webhook-ID"))
+		timestamp, _ := strconv.ParseInt(header.Get("X-Webhook-Timestamp"), 10, 64)
+		assert.Equal(t, signWebhook("s3cret", timestamp, payload), header.Get("X-Webhook-Signature"))
+		assert.NotEqual(t, signWebhook("other", timestamp, payload), header.Get("X-Webhook-Signature"))
+		mockWebhookRepo.AssertExpectations(t)
+	})
+
+	t.Run("Retry With Backoff", func(t *testing.T) {
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer receiver.Close()
+
+		delivery := newDelivery(receiver.URL, 2)
+		mockWebhookRepo := new(MockWebhookRepo)
+		mockWebhookRepo.On("ClaimDueDeliveries", mock.Anything, time.Minute, 10).Return([]models.WebhookDelivery{delivery}, nil)
+		var retryAt *time.Time
+		mockWebhookRepo.On("MarkDeliveryFailed", delivery.ID, http.StatusServiceUnavailable, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			retryAt = args.Get(3).(*time.Time)
+		}).Return(nil)
+
+		start := time.Now()
+		delivered, err := newDispatcher(mockWebhookRepo).RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+		// the second failed attempt waits twice the backoff
+		if assert.NotNil(t, retryAt) {
+			assert.WithinDuration(t, start.Add(2*time.Minute), *retryAt, 5*time.Second)
+		}
+	})
+
+	t.Run("Redirect Not Followed", func(t *testing.T) {
+		followed := false
+		target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			followed = true
+		}))
+		defer target.Close()
+		receiver := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+		defer receiver.Close()
+
+		delivery := newDelivery(receiver.URL, 1)
+		mockWebhookRepo := new(MockWebhookRepo)
+		mockWebhookRepo.On("ClaimDueDeliveries", mock.Anything, time.Minute, 10).Return([]models.WebhookDelivery{delivery}, nil)
+		mockWebhookRepo.On("MarkDeliveryFailed", delivery.ID, http.StatusTemporaryRedirect, mock.Anything, mock.Anything).Return(nil)
+		dispatcher := newDispatcher(mockWebhookRepo)
+		dispatcher.Client.CheckRedirect = refuseWebhookRedirect
+
+		delivered, err := dispatcher.RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+		assert.False(t, followed)
+		mockWebhookRepo.AssertExpectations(t)
+	})
+
+	t.Run("Private Address Refused When Dialing", func(t *testing.T) {
+		reached := false
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reached = true
+		}))
+		defer receiver.Close()
+
+		// the host could have resolved to a public address when the webhook was registered
+		delivery := newDelivery(strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1), 1)
+		mockWebhookRepo := new(MockWebhookRepo)
+		mockWebhookRepo.On("ClaimDueDeliveries", mock.Anything, time.Minute, 10).Return([]models.WebhookDelivery{delivery}, nil)
+		mockWebhookRepo.On("MarkDeliveryFailed", delivery.ID, 0, mock.MatchedBy(func(message string) bool {
+			return strings.Contains(message, errWebhookTarget.Error())
+		}), mock.Anything).Return(nil)
+		dispatcher := newDispatcher(mockWebhookRepo)
+		dispatcher.Client = newWebhookClient(time.Second)
+
+		delivered, err := dispatcher.RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+		assert.False(t, reached)
+		mockWebhookRepo.AssertExpectations(t)
+	})
+
+	t.Run("Dead Letter", func(t *testing.T) {
+		delivery := newDelivery("http://127.0.0.1:1/unreachable", 3)
+		mockWebhookRepo := new(MockWebhookRepo)
+		mockWebhookRepo.On("ClaimDueDeliveries", mock.Anything, time.Minute, 10).Return([]models.WebhookDelivery{delivery}, nil)
+		mockWebhookRepo.On("MarkDeliveryFailed", delivery.ID, 0, mock.Anything, (*time.Time)(nil)).Return(nil)
+
+		delivered, err := newDispatcher(mockWebhookRepo).RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+		mockWebhookRepo.AssertExpectations(t)
+	})
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	webhookID, _ := uuid.NewV4()
+	deliveryID, _ := uuid.NewV4()
+
+	setup := func() (*MockWebhookRepo, *gin.Engine) {
+		mockWebhookRepo := new(MockWebhookRepo)
+		webhookService := &WebhookService{WebhookRepo: mockWebhookRepo, LookupIPAddr: func(_ context.Context, host string) ([]net.IPAddr, error) {
+			switch host {
+			case "hooks.example.com":
+				return []net.IPAddr{{IP: net.ParseIP("93.184.215.14")}}, nil
+			case "localhost":
+				return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}, {IP: net.ParseIP("::1")}}, nil
+			case "intranet.example.com":
+				return []net.IPAddr{{IP: net.ParseIP("93.184.215.14")}, {IP: net.ParseIP("10.0.3.7")}}, nil
+			}
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}}
+
+		router := gin.Default()
+		router.Use(withOrg(testOrg))
+
+		router.GET("/webhooks/:webhookID/deliveries", webhookService.ListWebhookDeliveries)
+		router.POST("/webhooks/:webhookID/deliveries/:deliveryID/retry", webhookService.RetryWebhookDelivery)
+		return mockWebhookRepo, router
+	}
+
+	t.Run("Delivery Log", func(t *testing.T) {
+		mockWebhookRepo, router := setup()
+		deliveries := []models.WebhookDelivery{{ID: deliveryID, WebhookID: webhookID, Status: models.WebhookDeliveryDead, Attempts: 8, LastStatusCode: 500}}
+		mockWebhookRepo.On("ListDeliveries", testOrg.ID, webhookID.String(), models.WebhookDeliveryDead, 10, 0).Return(deliveries, nil)
+
+		req, _ := http.NewRequest(http.MethodGet, "/webhooks/"+webhookID.String()+"/deliveries?status=dead&limit=10", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		var body models.WebhookDeliveriesResponse
+		json.Unmarshal(resp.Body.Bytes(), &body)
+		assert.Len(t, body.Deliveries, 1)
+		assert.Equal(t, 10, body.Limit)
+	})
+
+	t.Run("Invalid Status", func(t *testing.T) {
+		_, router := setup()
+
+		req, _ := http.NewRequest(http.MethodGet, "/webhooks/"+webhookID.String()+"/deliveries?status=lost", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("Retry Dead Delivery", func(t *testing.T) {
+		mockWebhookRepo, router := setup()
+		mockWebhookRepo.On("RetryDelivery", testOrg.ID, webhookID.String(), deliveryID.String(), mock.Anything).Return(nil)
+
+		req, _ := http.NewRequest(http.MethodPost, "/webhooks/"+webhookID.String()+"/deliveries/"+deliveryID.String()+"/retry", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+
+	t.Run("Retry Delivery That Isn't Dead", func(t *testing.T) {
+		mockWebhookRepo, router := setup()
+		mockWebhookRepo.On("RetryDelivery", testOrg.ID, webhookID.String(), deliveryID.String(), mock.Anything).Return(pgx.ErrNoRows)
+
+		req, _ := http.NewRequest(http.MethodPost, "/webhooks/"+webhookID.String()+"/deliveries/"+deliveryID.String()+"/retry", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+}
+
+func TestEventWebhooks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	timeSlot := "02 Jan 2025 2-4 PM MST"
+	userID, _ := uuid.NewV4()
+
+	mockEventRepo := new(MockEventRepo)
+	mockTimeslotRepo := new(MockTimeslotRepo)
+	mockUserRepo := new(MockUserRepo)
+	mockPublisher := new(MockWebhookPublisher)
+	eventService := &EventService{
+		EventRepo:    mockEventRepo,
+		TimeslotRepo: mockTimeslotRepo,
+		UserRepo:     mockUserRepo,
+		Webhooks:     mockPublisher,
+	}
+
+	mockUserRepo.On("Get", testOrg.ID, "eshan").Return(models.User{ID: userID, Name: "eshan"}, nil)
+	mockUserRepo.On("GetUsersByNames", testOrg.ID, mock.Anything).Return([]models.User{}, nil)
+	mockTimeslotRepo.On("GetTimeSlotsByUserName", testOrg.ID, "eshan").Return([]string{timeSlot}, nil)
+	mockEventRepo.On("GetConflictingEvents", []uuid.UUID{userID}, mock.Anything, uuid.Nil).Return([]models.EventConflict(nil), nil)
+	mockEventRepo.On("CreateEvent", mock.Anything).Return(nil)
+	var published models.Event
+	mockPublisher.On("Publish", testOrg.ID, models.WebhookEventCreated, mock.Anything).Run(func(args mock.Arguments) {
+		published = args.Get(2).(models.Event)
+	}).Return()
+
+	router := gin.Default()
+	router.Use(withOrg(testOrg))
+
+	router.POST("/events", eventService.CreateEvent)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, newEventRequest(models.EventRequest{
+		Title:         "Standup",
+		EventOwner:    "eshan",
+		EventTimeSlot: timeSlot,
+		Participants:  []string{},
+	}))
+
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	mockPublisher.AssertExpectations(t)
+	assert.Equal(t, "Standup", published.Title)
+	assert.Equal(t, userID, published.EventOwner)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, newEventRequest(models.EventRequest{
+		Title:         "Interview with a candidate",
+		EventOwner:    "eshan",
+		EventTimeSlot: timeSlot,
+		Participants:  []string{},
+		Description:   "CV attached",
+		Location:      "Room 4.01",
+		ConferenceURL: "https://meet.example.com/abc-defg-hij",
+		Visibility:    models.EventVisibilityPrivate,
+	}))
+
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "Busy", published.Title, "private events are published without their details")
+	assert.Empty(t, published.Description)
+	assert.Empty(t, published.Location)
+	assert.Empty(t, published.ConferenceURL)
+	assert.Equal(t, userID, published.EventOwner)
+}
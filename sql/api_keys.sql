@@ -0,0 +1,17 @@
+CREATE TABLE public.api_keys
+(
+    id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    name character varying NOT NULL,
+    prefix character varying NOT NULL,
+    key_hash character varying NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    last_used_at timestamp with time zone,
+    expires_at timestamp with time zone,
+    PRIMARY KEY (id),
+    CONSTRAINT api_keys_key_hash_key UNIQUE (key_hash),
+    CONSTRAINT api_keys_user_id_foreign_key FOREIGN KEY (user_id)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+);
@@ -0,0 +1,22 @@
+CREATE TABLE public.audit_log
+(
+    id uuid NOT NULL,
+    org_id uuid NOT NULL,
+    occurred_at timestamp with time zone NOT NULL,
+    user_id uuid NOT NULL,
+    user_name character varying NOT NULL,
+    role character varying NOT NULL,
+    action character varying NOT NULL,
+    resource_type character varying NOT NULL,
+    resource_id character varying NOT NULL,
+    owner character varying NOT NULL,
+    reason character varying NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT audit_log_org_id_foreign_key FOREIGN KEY (org_id)
+        REFERENCES public.organizations (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION
+);
+
+CREATE INDEX audit_log_occurred_at_idx ON public.audit_log (occurred_at);
+CREATE INDEX audit_log_org_id_occurred_at_idx ON public.audit_log (org_id, occurred_at);
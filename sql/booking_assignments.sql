@@ -0,0 +1,18 @@
+CREATE TABLE public.booking_assignments
+(
+    event_id uuid NOT NULL,
+    event_type_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    assigned_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (event_id),
+    CONSTRAINT booking_assignments_event_type_id_foreign_key FOREIGN KEY (event_type_id)
+        REFERENCES public.event_types (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT booking_assignments_user_id_foreign_key FOREIGN KEY (user_id)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+);
+
+CREATE INDEX booking_assignments_event_type_idx ON public.booking_assignments (event_type_id, user_id);
@@ -0,0 +1,14 @@
+CREATE TABLE public.calendar_imports
+(
+    user_id uuid NOT NULL,
+    uid character varying NOT NULL,
+    fingerprint character varying NOT NULL,
+    event_ids uuid[] NOT NULL DEFAULT '{}',
+    time_slot_ids uuid[] NOT NULL DEFAULT '{}',
+    imported_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (user_id, uid),
+    CONSTRAINT calendar_imports_user_id_foreign_key FOREIGN KEY (user_id)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+);
@@ -0,0 +1,20 @@
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+CREATE TABLE public.event_bookings
+(
+    event_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    during tstzrange NOT NULL,
+    forced boolean NOT NULL DEFAULT false,
+    PRIMARY KEY (event_id, user_id, during),
+    CONSTRAINT event_bookings_event_id_foreign_key FOREIGN KEY (event_id)
+        REFERENCES public.events (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT event_bookings_user_id_foreign_key FOREIGN KEY (user_id)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION,
+    CONSTRAINT event_bookings_no_overlap EXCLUDE USING gist (user_id WITH =, during WITH &&)
+        WHERE (NOT forced)
+);
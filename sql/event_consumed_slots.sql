@@ -0,0 +1,16 @@
+CREATE TABLE public.event_consumed_slots
+(
+    event_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    during tstzrange NOT NULL,
+    time_zone character varying NOT NULL,
+    PRIMARY KEY (event_id, user_id, during),
+    CONSTRAINT event_consumed_slots_event_id_foreign_key FOREIGN KEY (event_id)
+        REFERENCES public.events (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT event_consumed_slots_user_id_foreign_key FOREIGN KEY (user_id)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION
+);
@@ -0,0 +1,14 @@
+CREATE TABLE public.event_exceptions
+(
+    event_id uuid NOT NULL,
+    original_start_time timestamp with time zone NOT NULL,
+    cancelled boolean NOT NULL DEFAULT false,
+    event_start_time timestamp with time zone,
+    event_end_time timestamp with time zone,
+    PRIMARY KEY (event_id, original_start_time),
+    CONSTRAINT event_exceptions_event_id_foreign_key FOREIGN KEY (event_id)
+        REFERENCES public.events (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT event_exceptions_cancelled_or_moved CHECK (cancelled OR (event_start_time IS NOT NULL AND event_end_time IS NOT NULL))
+);
@@ -0,0 +1,28 @@
+CREATE TABLE public.event_participants
+(
+    id uuid NOT NULL,
+    event_id uuid NOT NULL,
+    user_id uuid,
+    guest_name character varying,
+    role character varying NOT NULL DEFAULT 'required',
+    status character varying NOT NULL DEFAULT 'needs_action',
+    response_comment character varying NOT NULL DEFAULT '',
+    proposed_start_time timestamp with time zone,
+    proposed_end_time timestamp with time zone,
+    responded_at timestamp with time zone,
+    via_group character varying,
+    PRIMARY KEY (id),
+    CONSTRAINT event_participants_event_id_foreign_key FOREIGN KEY (event_id)
+        REFERENCES public.events (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT event_participants_user_id_foreign_key FOREIGN KEY (user_id)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION,
+    CONSTRAINT event_participants_user_or_guest CHECK ((user_id IS NULL) <> (guest_name IS NULL)),
+    CONSTRAINT event_participants_event_user_unique UNIQUE (event_id, user_id),
+    CONSTRAINT event_participants_event_guest_unique UNIQUE (event_id, guest_name)
+);
+
+CREATE INDEX event_participants_user_id_idx ON public.event_participants (user_id, event_id);
@@ -0,0 +1,26 @@
+CREATE TABLE public.event_reminders
+(
+    id uuid NOT NULL,
+    event_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    occurrence_start timestamp with time zone NOT NULL,
+    offset_seconds bigint NOT NULL,
+    remind_at timestamp with time zone NOT NULL,
+    status character varying NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    claimed_at timestamp with time zone,
+    sent_at timestamp with time zone,
+    last_error character varying NOT NULL DEFAULT '',
+    PRIMARY KEY (id),
+    CONSTRAINT event_reminders_event_id_foreign_key FOREIGN KEY (event_id)
+        REFERENCES public.events (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT event_reminders_user_id_foreign_key FOREIGN KEY (user_id)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT event_reminders_unique UNIQUE (event_id, user_id, occurrence_start, offset_seconds)
+);
+
+CREATE INDEX event_reminders_due_idx ON public.event_reminders (remind_at) WHERE status IN ('pending', 'processing');
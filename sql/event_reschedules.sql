@@ -0,0 +1,16 @@
+CREATE TABLE public.event_reschedules
+(
+    id uuid NOT NULL,
+    event_id uuid NOT NULL,
+    previous_start_time timestamp with time zone NOT NULL,
+    previous_end_time timestamp with time zone NOT NULL,
+    new_start_time timestamp with time zone NOT NULL,
+    new_end_time timestamp with time zone NOT NULL,
+    reason character varying NOT NULL DEFAULT '',
+    rescheduled_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT event_reschedules_event_id_foreign_key FOREIGN KEY (event_id)
+        REFERENCES public.events (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+);
@@ -0,0 +1,23 @@
+CREATE TABLE public.event_types
+(
+    id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    slug character varying NOT NULL,
+    title character varying NOT NULL,
+    description character varying NOT NULL DEFAULT '',
+    location character varying NOT NULL DEFAULT '',
+    duration_minutes integer NOT NULL,
+    buffer_before_minutes integer NOT NULL DEFAULT 0,
+    buffer_after_minutes integer NOT NULL DEFAULT 0,
+    min_notice_minutes integer NOT NULL DEFAULT 0,
+    max_advance_days integer NOT NULL,
+    scheduling_mode character varying NOT NULL DEFAULT 'individual',
+    member_ids uuid[] NOT NULL DEFAULT '{}',
+    created_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT event_types_user_id_slug_key UNIQUE (user_id, slug),
+    CONSTRAINT event_types_user_id_foreign_key FOREIGN KEY (user_id)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+);
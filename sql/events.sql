@@ -1,15 +1,50 @@
 CREATE TABLE public.events
 (
     id uuid NOT NULL,
+    org_id uuid NOT NULL,
     event_owner character varying NOT NULL,
     title character varying NOT NULL,
     event_start_time timestamp with time zone NOT NULL,
     event_end_time timestamp with time zone NOT NULL,
-    participants character varying[] NOT NULL,
+    forced boolean NOT NULL DEFAULT false,
+    recurrence character varying NOT NULL DEFAULT '',
+    status character varying NOT NULL DEFAULT 'active',
+    cancelled_at timestamp with time zone,
+    cancelled_by uuid,
+    cancel_reason character varying NOT NULL DEFAULT '',
+    description character varying NOT NULL DEFAULT '',
+    location character varying NOT NULL DEFAULT '',
+    conference_url character varying NOT NULL DEFAULT '',
+    visibility character varying NOT NULL DEFAULT 'public',
+    labels jsonb NOT NULL DEFAULT '{}',
+    reminder_offsets bigint[],
+    time_zone character varying NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1,
+    ical_uid character varying,
+    caldav_name character varying,
+    acting_delegate uuid,
     PRIMARY KEY (id),
+    CONSTRAINT events_org_id_foreign_key FOREIGN KEY (org_id)
+        REFERENCES public.organizations (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION,
     CONSTRAINT event_owner_user_id__foreign_key FOREIGN KEY (event_owner)
         REFERENCES public.users (id) MATCH SIMPLE
         ON UPDATE NO ACTION
         ON DELETE NO ACTION
-        NOT VALID
-);
\ No newline at end of file
+        NOT VALID,
+    CONSTRAINT events_cancelled_by_foreign_key FOREIGN KEY (cancelled_by)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION,
+    CONSTRAINT events_acting_delegate_foreign_key FOREIGN KEY (acting_delegate)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE SET NULL
+);
+
+CREATE INDEX events_cancelled_at_idx ON public.events (cancelled_at) WHERE status = 'cancelled';
+CREATE INDEX events_owner_start_time_idx ON public.events (event_owner, event_start_time);
+CREATE INDEX events_start_time_idx ON public.events (event_start_time);
+CREATE INDEX events_labels_idx ON public.events USING gin (labels jsonb_path_ops);
+CREATE INDEX events_org_id_idx ON public.events (org_id);
@@ -0,0 +1,21 @@
+CREATE TABLE public.group_members
+(
+    group_id uuid NOT NULL,
+    user_id uuid,
+    member_group_id uuid,
+    CONSTRAINT group_members_group_id_foreign_key FOREIGN KEY (group_id)
+        REFERENCES public.groups (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT group_members_user_id_foreign_key FOREIGN KEY (user_id)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT group_members_member_group_id_foreign_key FOREIGN KEY (member_group_id)
+        REFERENCES public.groups (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT group_members_user_or_group CHECK ((user_id IS NULL) <> (member_group_id IS NULL)),
+    CONSTRAINT group_members_group_user_unique UNIQUE (group_id, user_id),
+    CONSTRAINT group_members_group_member_group_unique UNIQUE (group_id, member_group_id)
+);
@@ -0,0 +1,18 @@
+CREATE TABLE public.groups
+(
+    id uuid NOT NULL,
+    org_id uuid NOT NULL,
+    name character varying(50) NOT NULL,
+    created_by uuid,
+    created_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT groups_org_id_foreign_key FOREIGN KEY (org_id)
+        REFERENCES public.organizations (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT groups_created_by_foreign_key FOREIGN KEY (created_by)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE SET NULL,
+    CONSTRAINT groups_org_id_name_key UNIQUE (org_id, name)
+);
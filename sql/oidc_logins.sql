@@ -0,0 +1,13 @@
+CREATE TABLE public.oidc_logins
+(
+    state character varying NOT NULL,
+    org_id uuid NOT NULL,
+    nonce character varying NOT NULL,
+    code_verifier character varying NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (state),
+    CONSTRAINT oidc_logins_org_id_foreign_key FOREIGN KEY (org_id)
+        REFERENCES public.organizations (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION
+);
@@ -0,0 +1,9 @@
+CREATE TABLE public.organizations
+(
+    id uuid NOT NULL,
+    slug character varying (63) NOT NULL,
+    name character varying (100) NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT organizations_slug_key UNIQUE (slug)
+);
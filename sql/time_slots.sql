@@ -1,9 +1,14 @@
 CREATE TABLE public.time_slots
 (
     id uuid NOT NULL,
+    org_id uuid NOT NULL,
     user_id uuid NOT NULL,
     time_slot character varying NOT NULL,
     PRIMARY KEY (id),
+    CONSTRAINT time_slots_org_id_foreign_key FOREIGN KEY (org_id)
+        REFERENCES public.organizations (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION,
     CONSTRAINT user_id_foreign_key FOREIGN KEY (user_id)
         REFERENCES public.users (id) MATCH SIMPLE
         ON UPDATE NO ACTION
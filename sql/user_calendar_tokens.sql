@@ -0,0 +1,11 @@
+CREATE TABLE public.user_calendar_tokens
+(
+    user_id uuid NOT NULL,
+    token_hash character varying NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (user_id),
+    CONSTRAINT user_calendar_tokens_user_id_foreign_key FOREIGN KEY (user_id)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+);
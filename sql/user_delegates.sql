@@ -0,0 +1,17 @@
+CREATE TABLE public.user_delegates
+(
+    principal_id uuid NOT NULL,
+    delegate_id uuid NOT NULL,
+    scopes text[] NOT NULL DEFAULT '{availability,events}',
+    created_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (principal_id, delegate_id),
+    CONSTRAINT user_delegates_principal_id_foreign_key FOREIGN KEY (principal_id)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CONSTRAINT user_delegates_delegate_id_foreign_key FOREIGN KEY (delegate_id)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE,
+    CHECK (principal_id <> delegate_id)
+);
@@ -0,0 +1,18 @@
+CREATE TABLE public.user_profiles
+(
+    user_id uuid NOT NULL,
+    time_zone character varying(64) NOT NULL DEFAULT 'UTC',
+    locale character varying(35) NOT NULL DEFAULT 'en-US',
+    work_days text[] NOT NULL DEFAULT '{mon,tue,wed,thu,fri}',
+    work_start character varying(5) NOT NULL DEFAULT '09:00',
+    work_end character varying(5) NOT NULL DEFAULT '17:00',
+    buffer_before_minutes integer NOT NULL DEFAULT 0,
+    buffer_after_minutes integer NOT NULL DEFAULT 0,
+    preferred_times text[] NOT NULL DEFAULT '{}',
+    reminders boolean NOT NULL DEFAULT true,
+    PRIMARY KEY (user_id),
+    CONSTRAINT user_profiles_user_id_foreign_key FOREIGN KEY (user_id)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+);
@@ -0,0 +1,10 @@
+CREATE TABLE public.user_reminder_settings
+(
+    user_id uuid NOT NULL,
+    offsets bigint[] NOT NULL DEFAULT '{}',
+    PRIMARY KEY (user_id),
+    CONSTRAINT user_reminder_settings_user_id_foreign_key FOREIGN KEY (user_id)
+        REFERENCES public.users (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+);
@@ -1,5 +1,11 @@
 CREATE TABLE users_next (
   id UUID PRIMARY KEY,
-  name VARCHAR (50) UNIQUE NOT NULL,
+  org_id UUID NOT NULL REFERENCES organizations (id),
+  name VARCHAR (50) NOT NULL,
+  role VARCHAR NOT NULL DEFAULT 'member' CHECK (role IN ('admin', 'member', 'viewer')),
+  oidc_subject VARCHAR,
   timeslots VARCHAR[]
-);
\ No newline at end of file
+);
+
+CREATE UNIQUE INDEX users_org_id_name_idx ON users_next (org_id, name);
+CREATE UNIQUE INDEX users_org_id_oidc_subject_idx ON users_next (org_id, oidc_subject);
@@ -0,0 +1,24 @@
+CREATE TABLE public.webhook_deliveries
+(
+    id uuid NOT NULL,
+    webhook_id uuid NOT NULL,
+    event_type character varying NOT NULL,
+    payload jsonb NOT NULL,
+    status character varying NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp with time zone NOT NULL,
+    claimed_at timestamp with time zone,
+    last_status_code integer NOT NULL DEFAULT 0,
+    last_error character varying NOT NULL DEFAULT '',
+    created_at timestamp with time zone NOT NULL,
+    delivered_at timestamp with time zone,
+    PRIMARY KEY (id),
+    CONSTRAINT webhook_deliveries_webhook_id_foreign_key FOREIGN KEY (webhook_id)
+        REFERENCES public.webhooks (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON public.webhook_deliveries (next_attempt_at) WHERE status IN ('pending', 'delivering');
+
+CREATE INDEX webhook_deliveries_log_idx ON public.webhook_deliveries (webhook_id, created_at);
@@ -0,0 +1,16 @@
+CREATE TABLE public.webhooks
+(
+    id uuid NOT NULL,
+    org_id uuid NOT NULL,
+    url character varying NOT NULL,
+    events character varying[] NOT NULL,
+    secret character varying NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (id),
+    CONSTRAINT webhooks_org_id_foreign_key FOREIGN KEY (org_id)
+        REFERENCES public.organizations (id) MATCH SIMPLE
+        ON UPDATE NO ACTION
+        ON DELETE NO ACTION
+);
+
+CREATE INDEX webhooks_org_id_idx ON public.webhooks (org_id);
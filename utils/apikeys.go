@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix starts every API key, telling them apart from JWTs in the Authorization header
+const APIKeyPrefix = "tsk_"
+
+// GenerateAPIKey returns a new random API key and the part of it that is shown to recognise the key later
+func GenerateAPIKey() (key, displayPrefix string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	key = APIKeyPrefix + hex.EncodeToString(secret)
+	return key, key[:len(APIKeyPrefix)+8], nil
+}
+
+// IsAPIKey reports whether a credential looks like an API key rather than a JWT
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// HashAPIKey is what is stored for an API key, a leaked table doesn't give the keys away
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
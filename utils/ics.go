@@ -0,0 +1,332 @@
+package utils
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"timeslot-app/models"
+
+	"github.com/gofrs/uuid"
+)
+
+// icsLineLimit is the longest a content line may be in octets before it has to be folded
+const icsLineLimit = 75
+
+const (
+	icsDateTimeLayout    = "20060102T150405"
+	icsUTCDateTimeLayout = "20060102T150405Z"
+)
+
+// ICSUIDSuffix follows the event ID in the UID of exported events
+const ICSUIDSuffix = "@timeslot-app"
+
+var icsParticipantStatus = map[string]string{
+	models.ParticipantStatusNeedsAction:     "NEEDS-ACTION",
+	models.ParticipantStatusAccepted:        "ACCEPTED",
+	models.ParticipantStatusDeclined:        "DECLINED",
+	models.ParticipantStatusTentative:       "TENTATIVE",
+	models.ParticipantStatusProposedNewTime: "TENTATIVE",
+}
+
+// icsWriter collects the content lines of a calendar, folded and CRLF terminated as RFC 5545 requires
+type icsWriter struct {
+	b strings.Builder
+}
+
+func (w *icsWriter) line(name, value string) {
+	line := name + ":" + value
+	limit := icsLineLimit
+	for len(line) > limit {
+		// fold on a rune boundary, continuation lines start with a space that counts toward the limit
+		cut := limit
+		for !isRuneStart(line[cut]) {
+			cut--
+		}
+		w.b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = icsLineLimit - 1
+	}
+	w.b.WriteString(line + "\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// ICSEscapeText escapes a TEXT value, backslashes, semicolons, commas and newlines are backslash escaped
+func ICSEscapeText(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+}
+
+// icsParam renders a parameter value, quoting it when it holds characters that would end the parameter
+func icsParam(value string) string {
+	value = strings.ReplaceAll(value, `"`, "")
+	if strings.ContainsAny(value, ":;,") {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+// icsTime renders a time in its own time zone with a TZID, or in UTC when the zone has no name a client could know
+func icsTime(name string, t time.Time) (string, string) {
+	if tzid, ok := icsTZID(t.Location()); ok {
+		return name + ";TZID=" + icsParam(tzid), t.Format(icsDateTimeLayout)
+	}
+	return name, t.UTC().Format(icsUTCDateTimeLayout)
+}
+
+func icsTZID(loc *time.Location) (string, bool) {
+	name := loc.String()
+	if name == "" || name == "UTC" || name == "Local" {
+		return "", false
+	}
+	return name, true
+}
+
+// icsCalAddress is the calendar address of an attendee, registered users are addressed by their user ID
+// and external guests by their email address
+func icsCalAddress(userID uuid.NullUUID, name string) string {
+	if userID.Valid {
+		return "urn:uuid:" + userID.UUID.String()
+	}
+	return "mailto:" + name
+}
+
+// RenderICS renders events as an RFC 5545 calendar. Organizers maps the owner IDs of the events to user
+// names. Recurring events carry their rule, cancelled occurrences become EXDATEs and moved ones are
+// separate VEVENTs with a RECURRENCE-ID. Every time zone the events use gets a VTIMEZONE.
+func RenderICS(calendarName string, events []models.Event, organizers map[uuid.UUID]string, stamp time.Time) string {
+	w := &icsWriter{}
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", "-//timeslot-app//Calendar Feed//EN")
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	if calendarName != "" {
+		w.line("X-WR-CALNAME", ICSEscapeText(calendarName))
+	}
+	writeICSComponents(w, events, organizers, stamp)
+	return w.b.String()
+}
+
+// RenderICSObject renders a single event as a CalDAV calendar object resource, which unlike a feed carries no METHOD
+func RenderICSObject(event models.Event, organizer string, stamp time.Time) string {
+	w := &icsWriter{}
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", "-//timeslot-app//CalDAV//EN")
+	w.line("CALSCALE", "GREGORIAN")
+	writeICSComponents(w, []models.Event{event}, map[uuid.UUID]string{event.EventOwner: organizer}, stamp)
+	return w.b.String()
+}
+
+// ICSUID is the UID an event is exported with, the one a calendar client created it with or else one made from its ID
+func ICSUID(event models.Event) string {
+	if event.ICalUID != "" {
+		return event.ICalUID
+	}
+	return event.ID.String() + ICSUIDSuffix
+}
+
+// writeICSComponents writes the time zones and events of a calendar and closes it
+func writeICSComponents(w *icsWriter, events []models.Event, organizers map[uuid.UUID]string, stamp time.Time) {
+	for _, zone := range icsZones(events) {
+		writeVTimezone(w, zone.loc, zone.year)
+	}
+	for _, event := range events {
+		writeVEvent(w, event, organizers[event.EventOwner], stamp)
+	}
+
+	w.line("END", "VCALENDAR")
+}
+
+type icsZone struct {
+	loc  *time.Location
+	year int
+}
+
+// icsZones lists the named time zones used by the events with the earliest year each is needed for
+func icsZones(events []models.Event) []icsZone {
+	var zones []icsZone
+	for _, event := range events {
+		loc := event.EventStartTime.Location()
+		if _, ok := icsTZID(loc); !ok {
+			continue
+		}
+		year := event.EventStartTime.Year()
+		idx := slices.IndexFunc(zones, func(z icsZone) bool { return z.loc.String() == loc.String() })
+		if idx < 0 {
+			zones = append(zones, icsZone{loc: loc, year: year})
+		} else if year < zones[idx].year {
+			zones[idx].year = year
+		}
+	}
+	return zones
+}
+
+func writeVEvent(w *icsWriter, event models.Event, organizer string, stamp time.Time) {
+	uid := ICSUID(event)
+	exdates, moved := []models.EventException{}, []models.EventException{}
+	for _, e := range event.Exceptions {
+		if e.Cancelled {
+			exdates = append(exdates, e)
+		} else if e.EventStartTime != nil && e.EventEndTime != nil {
+			moved = append(moved, e)
+		}
+	}
+
+	writeVEventBody(w, event, organizer, uid, stamp, func() {
+		if event.Recurrence == "" {
+			return
+		}
+		if rule, err := ParseRRule(event.Recurrence); err == nil {
+			w.line("RRULE", rule.String())
+		}
+		for _, e := range exdates {
+			w.line(icsTime("EXDATE", e.OriginalStartTime.In(event.EventStartTime.Location())))
+		}
+	})
+
+	for _, e := range moved {
+		occurrence := event
+		occurrence.EventStartTime = e.EventStartTime.In(event.EventStartTime.Location())
+		occurrence.EventEndTime = e.EventEndTime.In(event.EventStartTime.Location())
+		writeVEventBody(w, occurrence, organizer, uid, stamp, func() {
+			w.line(icsTime("RECURRENCE-ID", e.OriginalStartTime.In(event.EventStartTime.Location())))
+		})
+	}
+}
+
+func writeVEventBody(w *icsWriter, event models.Event, organizer, uid string, stamp time.Time, recurrence func()) {
+	w.line("BEGIN", "VEVENT")
+	w.line("UID", uid)
+	w.line("DTSTAMP", stamp.UTC().Format(icsUTCDateTimeLayout))
+	w.line(icsTime("DTSTART", event.EventStartTime))
+	w.line(icsTime("DTEND", event.EventEndTime))
+	recurrence()
+	w.line("SUMMARY", ICSEscapeText(event.Title))
+	if event.Description != "" {
+		w.line("DESCRIPTION", ICSEscapeText(event.Description))
+	}
+	if event.Location != "" {
+		w.line("LOCATION", ICSEscapeText(event.Location))
+	}
+	if event.ConferenceURL != "" {
+		w.line("URL", event.ConferenceURL)
+	}
+	if event.Visibility == models.EventVisibilityPrivate {
+		w.line("CLASS", "PRIVATE")
+	} else {
+		w.line("CLASS", "PUBLIC")
+	}
+	if event.Status == models.EventStatusCancelled {
+		w.line("STATUS", "CANCELLED")
+	} else {
+		w.line("STATUS", "CONFIRMED")
+	}
+
+	if organizer != "" {
+		w.line("ORGANIZER;CN="+icsParam(organizer), icsCalAddress(uuid.NullUUID{UUID: event.EventOwner, Valid: true}, organizer))
+	}
+	for _, p := range event.Participants {
+		role := "REQ-PARTICIPANT"
+		if p.Role == models.ParticipantRoleOptional {
+			role = "OPT-PARTICIPANT"
+		}
+		partstat, ok := icsParticipantStatus[p.Status]
+		if !ok {
+			partstat = "NEEDS-ACTION"
+		}
+		w.line("ATTENDEE;CN="+icsParam(p.Name)+";ROLE="+role+";PARTSTAT="+partstat, icsCalAddress(p.UserID, p.Name))
+	}
+	w.line("END", "VEVENT")
+}
+
+// writeVTimezone describes a time zone from the given year on. The daylight saving transitions of that year
+// are turned into yearly rules, a zone without any has a single standard offset.
+func writeVTimezone(w *icsWriter, loc *time.Location, year int) {
+	tzid, _ := icsTZID(loc)
+	w.line("BEGIN", "VTIMEZONE")
+	w.line("TZID", tzid)
+
+	transitions := zoneTransitions(loc, year)
+	if len(transitions) == 0 {
+		name, offset := time.Date(year, time.January, 1, 0, 0, 0, 0, loc).Zone()
+		w.line("BEGIN", "STANDARD")
+		w.line("DTSTART", time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC).Format(icsDateTimeLayout))
+		w.line("TZOFFSETFROM", icsOffset(offset))
+		w.line("TZOFFSETTO", icsOffset(offset))
+		w.line("TZNAME", ICSEscapeText(name))
+		w.line("END", "STANDARD")
+	}
+
+	for _, t := range transitions {
+		_, before := t.Add(-time.Second).Zone()
+		name, after := t.Zone()
+		component := "STANDARD"
+		if t.IsDST() {
+			component = "DAYLIGHT"
+		}
+		// the observance starts at the wall clock time of the transition before it happens
+		local := t.UTC().Add(time.Duration(before) * time.Second)
+		week := (local.Day()-1)/7 + 1
+		if local.AddDate(0, 0, 7).Month() != local.Month() {
+			week = -1
+		}
+		day := ""
+		for name, weekday := range rruleWeekdays {
+			if weekday == local.Weekday() {
+				day = name
+			}
+		}
+
+		w.line("BEGIN", component)
+		w.line("DTSTART", local.Format(icsDateTimeLayout))
+		w.line("RRULE", fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%d%s", local.Month(), week, day))
+		w.line("TZOFFSETFROM", icsOffset(before))
+		w.line("TZOFFSETTO", icsOffset(after))
+		w.line("TZNAME", ICSEscapeText(name))
+		w.line("END", component)
+	}
+	w.line("END", "VTIMEZONE")
+}
+
+// zoneTransitions returns the instants the UTC offset of the location changes during the year
+func zoneTransitions(loc *time.Location, year int) []time.Time {
+	var transitions []time.Time
+	day := time.Date(year, time.January, 1, 12, 0, 0, 0, time.UTC)
+	for day.Year() == year {
+		next := day.AddDate(0, 0, 1)
+		_, from := day.In(loc).Zone()
+		_, to := next.In(loc).Zone()
+		if from != to {
+			// narrow the change down to the second
+			lo, hi := day, next
+			for hi.Sub(lo) > time.Second {
+				mid := lo.Add(hi.Sub(lo) / 2)
+				if _, offset := mid.In(loc).Zone(); offset == from {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			transitions = append(transitions, hi.In(loc))
+		}
+		day = next
+	}
+	return transitions
+}
+
+func icsOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	offset := fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+	if seconds%60 != 0 {
+		offset += fmt.Sprintf("%02d", seconds%60)
+	}
+	return offset
+}
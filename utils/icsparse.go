@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ICSProperty is one content line of a calendar, parameter names are upper case
+type ICSProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// ICSComponent is a BEGIN/END block of a calendar with its properties and nested components
+type ICSComponent struct {
+	Name       string
+	Properties []ICSProperty
+	Components []ICSComponent
+}
+
+// Property returns the first property with the name
+func (c ICSComponent) Property(name string) (ICSProperty, bool) {
+	for _, p := range c.Properties {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return ICSProperty{}, false
+}
+
+// PropertyValue returns the value of the first property with the name, empty when there is none
+func (c ICSComponent) PropertyValue(name string) string {
+	p, _ := c.Property(name)
+	return p.Value
+}
+
+// PropertiesNamed returns every property with the name
+func (c ICSComponent) PropertiesNamed(name string) []ICSProperty {
+	var props []ICSProperty
+	for _, p := range c.Properties {
+		if p.Name == name {
+			props = append(props, p)
+		}
+	}
+	return props
+}
+
+// ComponentsNamed returns the nested components with the name, looking through every level
+func (c ICSComponent) ComponentsNamed(name string) []ICSComponent {
+	var found []ICSComponent
+	for _, sub := range c.Components {
+		if sub.Name == name {
+			found = append(found, sub)
+		}
+		found = append(found, sub.ComponentsNamed(name)...)
+	}
+	return found
+}
+
+// ParseICS parses RFC 5545 calendar data into its top level components, usually a single VCALENDAR
+func ParseICS(data string) ([]ICSComponent, error) {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	// unfold continuation lines
+	data = strings.ReplaceAll(strings.ReplaceAll(data, "\n ", ""), "\n\t", "")
+
+	root := ICSComponent{}
+	stack := []*ICSComponent{&root}
+	for number, line := range strings.Split(data, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		prop, err := parseICSLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", number+1, err)
+		}
+
+		current := stack[len(stack)-1]
+		switch prop.Name {
+		case "BEGIN":
+			current.Components = append(current.Components, ICSComponent{Name: strings.ToUpper(prop.Value)})
+			stack = append(stack, &current.Components[len(current.Components)-1])
+		case "END":
+			if len(stack) == 1 || current.Name != strings.ToUpper(prop.Value) {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", number+1, prop.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("line %d: property %s outside of a component", number+1, prop.Name)
+			}
+			current.Properties = append(current.Properties, prop)
+		}
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("component %s isn't closed", stack[len(stack)-1].Name)
+	}
+	if len(root.Components) == 0 {
+		return nil, errors.New("no calendar data")
+	}
+	return root.Components, nil
+}
+
+// parseICSLine splits a content line into its name, parameters and value, the value starts at the first colon
+// that isn't inside a quoted parameter value
+func parseICSLine(line string) (ICSProperty, error) {
+	quoted := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		}
+		if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return ICSProperty{}, fmt.Errorf("invalid content line %q", line)
+	}
+
+	prop := ICSProperty{Params: map[string]string{}, Value: line[colon+1:]}
+	parts := splitICSParams(line[:colon])
+	prop.Name = strings.ToUpper(parts[0])
+	if prop.Name == "" {
+		return ICSProperty{}, fmt.Errorf("invalid content line %q", line)
+	}
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		prop.Params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+func splitICSParams(s string) []string {
+	var parts []string
+	quoted := false
+	last := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ';' && !quoted:
+			parts = append(parts, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, s[last:])
+}
+
+// ICSUnescapeText reverses ICSEscapeText
+func ICSUnescapeText(value string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(value)
+}
+
+// ParseICSTime parses a DATE-TIME or DATE property value. Times with a TZID are read in that time zone, UTC
+// times in UTC and floating times in the given default location. Dates are midnight in that location.
+func ParseICSTime(prop ICSProperty, defaultLoc *time.Location) (time.Time, error) {
+	loc := defaultLoc
+	if tzid := prop.Params["TZID"]; tzid != "" {
+		var err error
+		loc, err = time.LoadLocation(strings.TrimPrefix(tzid, "/"))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unknown time zone %q", tzid)
+		}
+	}
+	return parseICSTimeValue(prop.Value, loc)
+}
+
+func parseICSTimeValue(value string, loc *time.Location) (time.Time, error) {
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(icsUTCDateTimeLayout, value)
+	}
+	for _, layout := range []string{icsDateTimeLayout, "20060102"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date-time %q", value)
+}
+
+// ParseICSDuration parses an RFC 5545 duration such as PT1H30M or P1D, weeks and days count as whole days
+func ParseICSDuration(value string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid duration %q", value)
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(value, "-"):
+		sign, value = -1, value[1:]
+	case strings.HasPrefix(value, "+"):
+		value = value[1:]
+	}
+	if !strings.HasPrefix(value, "P") || len(value) < 3 {
+		return 0, invalid
+	}
+
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour, 'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+	var d time.Duration
+	inTime := false
+	number := ""
+	for i := 1; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == 'T':
+			inTime = true
+		case c >= '0' && c <= '9':
+			number += string(c)
+		default:
+			unit, ok := units[c]
+			n, err := strconv.Atoi(number)
+			if !ok || err != nil || (c == 'M' && !inTime) || (inTime && (c == 'W' || c == 'D')) {
+				return 0, invalid
+			}
+			d += time.Duration(n) * unit
+			number = ""
+		}
+	}
+	if number != "" {
+		return 0, invalid
+	}
+	return sign * d, nil
+}
+
+// ParseICSPeriod parses a period given as start/end or start/duration, as used by FREEBUSY
+func ParseICSPeriod(value string, loc *time.Location) (start, end time.Time, err error) {
+	from, to, found := strings.Cut(value, "/")
+	if !found {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid period %q", value)
+	}
+	start, err = parseICSTimeValue(from, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if strings.HasPrefix(to, "P") || strings.HasPrefix(to, "+P") {
+		d, err := ParseICSDuration(to)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		return start, start.Add(d), nil
+	}
+	end, err = parseICSTimeValue(to, loc)
+	return start, end, err
+}
@@ -0,0 +1,264 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// jwtLeeway absorbs clock drift between the token issuer and this server
+const jwtLeeway = time.Minute
+
+// JWTClaims are the registered claims of a bearer token, Raw holds every claim for callers that need others
+type JWTClaims struct {
+	Subject   string                     `json:"sub"`
+	Issuer    string                     `json:"iss"`
+	Audience  jwtAudience                `json:"aud"`
+	ExpiresAt int64                      `json:"exp"`
+	NotBefore int64                      `json:"nbf"`
+	IssuedAt  int64                      `json:"iat"`
+	Raw       map[string]json.RawMessage `json:"-"`
+}
+
+// jwtAudience accepts the aud claim as a single string or a list
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("aud must be a string or a list of strings")
+	}
+	*a = list
+	return nil
+}
+
+// JWTVerifier checks bearer tokens signed with a shared secret (HS256, HS384, HS512) or with one of the keys
+// of a JWKS (RS256, RS384, RS512, ES256, ES384, ES512). Issuer and Audience are only checked when set.
+type JWTVerifier struct {
+	Secret   []byte
+	Keys     map[string]crypto.PublicKey
+	Issuer   string
+	Audience string
+}
+
+// LoadJWKS reads the public keys of a JSON Web Key Set file, keyed by their kid
+func LoadJWKS(path string) (map[string]crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// ParseJWKS parses the RSA and EC public keys of a JSON Web Key Set, keys meant for anything but signatures are skipped
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := decodeJWKInt(k.N)
+			e, errE := decodeJWKInt(k.E)
+			if errN != nil || errE != nil || !e.IsInt64() {
+				return nil, fmt.Errorf("invalid RSA key %q", k.Kid)
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				return nil, fmt.Errorf("unsupported curve %q of key %q", k.Crv, k.Kid)
+			}
+			x, errX := decodeJWKInt(k.X)
+			y, errY := decodeJWKInt(k.Y)
+			if errX != nil || errY != nil || !curve.IsOnCurve(x, y) {
+				return nil, fmt.Errorf("invalid EC key %q", k.Kid)
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no signing keys")
+	}
+	return keys, nil
+}
+
+func decodeJWKInt(value string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Verify checks the signature and the time, issuer and audience claims of a token and returns its claims
+func (v *JWTVerifier) Verify(token string, now time.Time) (JWTClaims, error) {
+	var claims JWTClaims
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("token is not a JWT")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return claims, fmt.Errorf("invalid token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, errors.New("invalid token signature")
+	}
+	if err := v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], signature); err != nil {
+		return claims, err
+	}
+
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return claims, fmt.Errorf("invalid token claims: %w", err)
+	}
+	if err := decodeJWTPart(parts[1], &claims.Raw); err != nil {
+		return claims, fmt.Errorf("invalid token claims: %w", err)
+	}
+
+	if claims.ExpiresAt == 0 {
+		return claims, errors.New("token has no expiry")
+	}
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(jwtLeeway)) {
+		return claims, errors.New("token has expired")
+	}
+	if claims.NotBefore != 0 && now.Add(jwtLeeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return claims, errors.New("token is not valid yet")
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return claims, errors.New("token was issued by someone else")
+	}
+	if v.Audience != "" && !SearchString(claims.Audience, v.Audience) {
+		return claims, errors.New("token is meant for someone else")
+	}
+	if claims.Subject == "" {
+		return claims, errors.New("token has no subject")
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verifySignature checks the signature with the key the algorithm calls for, "none" and unknown algorithms fail
+func (v *JWTVerifier) verifySignature(alg, kid, signed string, signature []byte) error {
+	var newHash func() hash.Hash
+	var cryptoHash crypto.Hash
+	switch alg[min(2, len(alg)):] {
+	case "256":
+		newHash, cryptoHash = sha256.New, crypto.SHA256
+	case "384":
+		newHash, cryptoHash = sha512.New384, crypto.SHA384
+	case "512":
+		newHash, cryptoHash = sha512.New, crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported token algorithm %q", alg)
+	}
+
+	switch alg[:min(2, len(alg))] {
+	case "HS":
+		if len(v.Secret) == 0 {
+			return errors.New("tokens signed with a secret aren't accepted")
+		}
+		mac := hmac.New(newHash, v.Secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	case "RS", "ES":
+		key, err := v.key(kid)
+		if err != nil {
+			return err
+		}
+		h := newHash()
+		h.Write([]byte(signed))
+		digest := h.Sum(nil)
+
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			if alg[:2] != "RS" || rsa.VerifyPKCS1v15(key, cryptoHash, digest, signature) != nil {
+				return errors.New("invalid token signature")
+			}
+			return nil
+		case *ecdsa.PublicKey:
+			size := (key.Curve.Params().BitSize + 7) / 8
+			if alg[:2] != "ES" || len(signature) != 2*size {
+				return errors.New("invalid token signature")
+			}
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			if !ecdsa.Verify(key, digest, r, s) {
+				return errors.New("invalid token signature")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported token algorithm %q", alg)
+}
+
+// key returns the JWKS key named by kid, a token without kid can use the only key of a single key set
+func (v *JWTVerifier) key(kid string) (crypto.PublicKey, error) {
+	if key, found := v.Keys[kid]; found {
+		return key, nil
+	}
+	if kid == "" && len(v.Keys) == 1 {
+		for _, key := range v.Keys {
+			return key, nil
+		}
+	}
+	return nil, errors.New("token is signed with an unknown key")
+}
@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OIDCProvider holds the endpoints an OpenID Connect issuer publishes in its discovery document
+type OIDCProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCTokens is the token endpoint's answer to an authorization code
+type OIDCTokens struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+}
+
+// DiscoverOIDC reads the discovery document of the issuer, which must name the issuer itself
+func DiscoverOIDC(client *http.Client, issuer string) (OIDCProvider, error) {
+	var provider OIDCProvider
+	data, err := getOIDC(client, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration")
+	if err != nil {
+		return provider, err
+	}
+	if err := json.Unmarshal(data, &provider); err != nil {
+		return provider, fmt.Errorf("invalid discovery document: %w", err)
+	}
+	if strings.TrimSuffix(provider.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return provider, fmt.Errorf("discovery document is for issuer %q", provider.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return provider, errors.New("discovery document lacks an endpoint")
+	}
+	return provider, nil
+}
+
+// Verifier fetches the provider's signing keys and returns a verifier for the ID tokens it issues to the client
+func (p OIDCProvider) Verifier(client *http.Client, clientID string) (*JWTVerifier, error) {
+	data, err := getOIDC(client, p.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+	return &JWTVerifier{Keys: keys, Issuer: p.Issuer, Audience: clientID}, nil
+}
+
+// AuthorizationURL is where the user is sent to log in, the challenge binds the later code exchange to this login
+func (p OIDCProvider) AuthorizationURL(clientID, redirectURL string, scopes []string, state, nonce, codeChallenge string) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"redirect_uri":          {redirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// ExchangeCode trades an authorization code for tokens, proving with the verifier that this client started the login
+func (p OIDCProvider) ExchangeCode(client *http.Client, clientID, clientSecret, redirectURL, code, codeVerifier string) (OIDCTokens, error) {
+	var tokens OIDCTokens
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {clientID},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return tokens, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return tokens, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return tokens, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return tokens, fmt.Errorf("token endpoint answered %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return tokens, fmt.Errorf("invalid token response: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return tokens, errors.New("token response has no ID token")
+	}
+	return tokens, nil
+}
+
+func getOIDC(client *http.Client, target string) ([]byte, error) {
+	resp, err := client.Get(target)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %d", target, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// RandomURLToken returns a random token of the given number of bytes, fit for a URL
+func RandomURLToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// PKCEChallenge derives the S256 code challenge sent with the authorization request from the code verifier
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ClaimStrings reads a claim holding a string or a list of strings, as group claims do
+func ClaimStrings(claims JWTClaims, name string) []string {
+	raw, found := claims.Raw[name]
+	if !found {
+		return nil
+	}
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		return list
+	}
+	var single string
+	if json.Unmarshal(raw, &single) == nil && single != "" {
+		return []string{single}
+	}
+	return nil
+}
+
+// ClaimString reads a string claim, empty when it is missing or isn't a string
+func ClaimString(claims JWTClaims, name string) string {
+	var value string
+	json.Unmarshal(claims.Raw[name], &value)
+	return value
+}
@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"timeslot-app/models"
+)
+
+// localePattern accepts BCP 47 tags like "en", "en-US" or "zh-Hant-TW"
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// monthFirstRegions write the month before the day
+var monthFirstRegions = []string{"US", "PH", "FM", "MH"}
+
+// twelveHourRegions use a 12-hour clock
+var twelveHourRegions = []string{"US", "CA", "AU", "NZ", "IN", "PH", "PK", "EG", "SA", "BD", "MY"}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// WithDefaultZone appends the zone to a time slot that doesn't name one, "02 Jan 2025 2-4 PM" becomes
+// "02 Jan 2025 2-4 PM Europe/Berlin" for a zone of Europe/Berlin. Other slots are returned as they are.
+func WithDefaultZone(ts, zone string) string {
+	ts = strings.TrimSpace(ts)
+	sp := strings.Fields(ts)
+	if zone == "" || len(sp) < 5 {
+		return ts
+	}
+	// a slot without a zone ends with the half of the day
+	if last := strings.ToUpper(sp[len(sp)-1]); last != "AM" && last != "PM" {
+		return ts
+	}
+	return ts + " " + zone
+}
+
+// ValidLocale reports whether the locale is a well formed language tag
+func ValidLocale(locale string) bool {
+	return len(locale) <= 35 && localePattern.MatchString(locale)
+}
+
+// ParseClock parses a "15:04" time of day to the minutes since midnight, "24:00" is the end of the day
+func ParseClock(clock string) (int, error) {
+	if clock == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", clock)
+	if err != nil || len(clock) != 5 {
+		return 0, fmt.Errorf("%q is not a time of day like 09:30", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ParseWeekday parses the three letter weekday names of working hours
+func ParseWeekday(day string) (time.Weekday, error) {
+	weekday, ok := weekdays[strings.ToLower(day)]
+	if !ok {
+		return 0, fmt.Errorf("%q is not a weekday like mon", day)
+	}
+	return weekday, nil
+}
+
+// NormalizeProfile checks a profile and lowercases its weekdays
+func NormalizeProfile(profile *models.UserProfile) error {
+	if _, err := time.LoadLocation(profile.TimeZone); err != nil || profile.TimeZone == "" || profile.TimeZone == "Local" {
+		return fmt.Errorf("%q is not an IANA time zone", profile.TimeZone)
+	}
+	if !ValidLocale(profile.Locale) {
+		return fmt.Errorf("%q is not a locale like en-US", profile.Locale)
+	}
+
+	days := make([]string, 0, len(profile.WorkingHours.Days))
+	for _, day := range profile.WorkingHours.Days {
+		if _, err := ParseWeekday(day); err != nil {
+			return err
+		}
+		day = strings.ToLower(day)
+		if !slices.Contains(days, day) {
+			days = append(days, day)
+		}
+	}
+	profile.WorkingHours.Days = days
+	if err := validateDayWindow(models.DayWindow{Start: profile.WorkingHours.Start, End: profile.WorkingHours.End}); err != nil {
+		return fmt.Errorf("working hours: %w", err)
+	}
+
+	if profile.BufferBeforeMinutes < 0 || profile.BufferAfterMinutes < 0 {
+		return errors.New("buffers can't be negative")
+	}
+	if profile.PreferredTimes == nil {
+		profile.PreferredTimes = []models.DayWindow{}
+	}
+	for _, window := range profile.PreferredTimes {
+		if err := validateDayWindow(window); err != nil {
+			return fmt.Errorf("preferred times: %w", err)
+		}
+	}
+	return nil
+}
+
+func validateDayWindow(window models.DayWindow) error {
+	start, err := ParseClock(window.Start)
+	if err != nil {
+		return err
+	}
+	end, err := ParseClock(window.End)
+	if err != nil {
+		return err
+	}
+	if start >= end {
+		return fmt.Errorf("%s-%s ends before it starts", window.Start, window.End)
+	}
+	return nil
+}
+
+// InDayWindows reports whether the slot lies on a single day of the location and within one of the windows
+func InDayWindows(slot models.TimeSlotStartAndEnd, loc *time.Location, windows []models.DayWindow) bool {
+	start := slot.StartTime.In(loc)
+	end := slot.EndTime.In(loc)
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+	if end.YearDay() != start.YearDay() || end.Year() != start.Year() {
+		// a slot ending at midnight still belongs to the day it started on
+		if !end.Equal(time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, loc)) {
+			return false
+		}
+		endMinute = 24 * 60
+	}
+
+	for _, window := range windows {
+		from, errFrom := ParseClock(window.Start)
+		to, errTo := ParseClock(window.End)
+		if errFrom == nil && errTo == nil && startMinute >= from && endMinute <= to {
+			return true
+		}
+	}
+	return false
+}
+
+// InWorkingHours reports whether the slot lies within the working hours of the profile
+func InWorkingHours(slot models.TimeSlotStartAndEnd, profile models.UserProfile) bool {
+	loc := ProfileLocation(profile)
+	weekday := slot.StartTime.In(loc).Weekday()
+	if !slices.ContainsFunc(profile.WorkingHours.Days, func(day string) bool {
+		d, err := ParseWeekday(day)
+		return err == nil && d == weekday
+	}) {
+		return false
+	}
+	return InDayWindows(slot, loc, []models.DayWindow{{Start: profile.WorkingHours.Start, End: profile.WorkingHours.End}})
+}
+
+// SlotScore rates how well a slot suits the owner of the profile: two points within their working hours and
+// one more within a preferred time
+func SlotScore(slot models.TimeSlotStartAndEnd, profile models.UserProfile) int {
+	score := 0
+	if InWorkingHours(slot, profile) {
+		score += 2
+	}
+	if InDayWindows(slot, ProfileLocation(profile), profile.PreferredTimes) {
+		score++
+	}
+	return score
+}
+
+// ProfileLocation returns the home time zone of the profile, UTC when it can't be loaded
+func ProfileLocation(profile models.UserProfile) *time.Location {
+	loc, err := time.LoadLocation(profile.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// FormatLocalTime renders a time in the zone for the locale, "Thu, Jan 2, 2025 2:00 PM EST" for en-US and
+// "Thu, 2 Jan 2025 14:00 CET" for de-DE. Only the order of the date and the clock differ between locales,
+// names stay English.
+func FormatLocalTime(t time.Time, zone, locale string) string {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	region := ""
+	if parts := strings.Split(locale, "-"); len(parts) > 1 {
+		region = strings.ToUpper(parts[len(parts)-1])
+	}
+	date := "Mon, 2 Jan 2006"
+	if slices.Contains(monthFirstRegions, region) {
+		date = "Mon, Jan 2, 2006"
+	}
+	clock := "15:04"
+	if slices.Contains(twelveHourRegions, region) {
+		clock = "3:04 PM"
+	}
+	return t.In(loc).Format(date + " " + clock + " MST")
+}
@@ -0,0 +1,283 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"timeslot-app/models"
+)
+
+// MaxOccurrences caps how many occurrences a recurring event may expand to, every occurrence is
+// checked against availability and conflicts, so a longer series, e.g. a daily one running for
+// more than a year, is refused with ErrTooManyOccurrences and has to be split into several events
+const MaxOccurrences = 500
+
+// ErrTooManyOccurrences is returned for a rule that expands to more than MaxOccurrences occurrences
+var ErrTooManyOccurrences = fmt.Errorf("recurrence expands to more than %d occurrences, the most an event may have; end it sooner with COUNT or UNTIL or split it into several events", MaxOccurrences)
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// RRule is the subset of an RFC 5545 recurrence rule supported for events:
+// FREQ, INTERVAL, COUNT, UNTIL and BYDAY for weekly rules
+type RRule struct {
+	Freq     string
+	Interval int
+	Count    int
+	Until    time.Time
+	// UntilDate marks an UNTIL given as a date, every occurrence on that day in the series' time zone is included
+	UntilDate bool
+	ByDay     []time.Weekday
+}
+
+// ParseRRule parses a rule like "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10", a rule has to end through COUNT or UNTIL
+func ParseRRule(rule string) (RRule, error) {
+	r := RRule{Interval: 1}
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+
+	for _, part := range strings.Split(rule, ";") {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			return RRule{}, fmt.Errorf("invalid recurrence rule part %q", part)
+		}
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(value)
+			if !slices.Contains([]string{"DAILY", "WEEKLY", "MONTHLY", "YEARLY"}, r.Freq) {
+				return RRule{}, fmt.Errorf("unsupported recurrence frequency %q", value)
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 {
+				return RRule{}, fmt.Errorf("invalid recurrence interval %q", value)
+			}
+			r.Interval = interval
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return RRule{}, fmt.Errorf("invalid recurrence count %q", value)
+			}
+			if count > MaxOccurrences {
+				return RRule{}, ErrTooManyOccurrences
+			}
+			r.Count = count
+		case "UNTIL":
+			until, dateOnly, err := parseRRuleTime(value)
+			if err != nil {
+				return RRule{}, err
+			}
+			r.Until, r.UntilDate = until, dateOnly
+		case "BYDAY":
+			for _, day := range strings.Split(strings.ToUpper(value), ",") {
+				weekday, ok := rruleWeekdays[day]
+				if !ok {
+					return RRule{}, fmt.Errorf("unsupported recurrence day %q", day)
+				}
+				r.ByDay = append(r.ByDay, weekday)
+			}
+		default:
+			return RRule{}, fmt.Errorf("unsupported recurrence rule part %q", key)
+		}
+	}
+
+	if r.Freq == "" {
+		return RRule{}, errors.New("recurrence rule requires FREQ")
+	}
+	if r.Count == 0 && r.Until.IsZero() {
+		return RRule{}, errors.New("recurrence rule requires COUNT or UNTIL")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return RRule{}, errors.New("recurrence rule can't have both COUNT and UNTIL")
+	}
+	if len(r.ByDay) > 0 && r.Freq != "WEEKLY" {
+		return RRule{}, errors.New("BYDAY is only supported for weekly recurrence")
+	}
+	return r, nil
+}
+
+// parseRRuleTime reads a UTC date-time or a date, dateOnly is true for a date
+func parseRRuleTime(value string) (t time.Time, dateOnly bool, err error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.Parse("20060102", value); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("invalid recurrence until %q", value)
+}
+
+// String renders the rule back in RFC 5545 form
+func (r RRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, 0, len(r.ByDay))
+		for _, weekday := range r.ByDay {
+			for name, d := range rruleWeekdays {
+				if d == weekday {
+					days = append(days, name)
+				}
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.UntilDate {
+		parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+	} else if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Starts returns the start time of every occurrence of a series beginning at dtstart, the
+// wall clock time of dtstart is kept across daylight saving changes in its location. Like RFC 5545 has it,
+// dtstart is always the first occurrence even when the rule wouldn't produce it.
+func (r RRule) Starts(dtstart time.Time) ([]time.Time, error) {
+	starts := []time.Time{}
+	done := func(t time.Time) bool {
+		if r.Count > 0 && len(starts) >= r.Count {
+			return true
+		}
+		if r.UntilDate {
+			// the day is compared in the time zone of the series, it is included until its end
+			y, m, d := r.Until.Date()
+			return !t.Before(time.Date(y, m, d+1, 0, 0, 0, 0, dtstart.Location()))
+		}
+		return !r.Until.IsZero() && t.After(r.Until)
+	}
+
+	if done(dtstart) {
+		return starts, nil
+	}
+	starts = append(starts, dtstart)
+
+	for period := 0; period < 100*MaxOccurrences; period++ {
+		candidates := r.periodStarts(dtstart, period)
+		if len(candidates) == 0 {
+			// a monthly or yearly date that doesn't exist in this period, e.g. the 31st in April
+			continue
+		}
+		for _, t := range candidates {
+			if !t.After(dtstart) {
+				continue
+			}
+			if done(t) {
+				return starts, nil
+			}
+			starts = append(starts, t)
+			if len(starts) > MaxOccurrences {
+				return nil, ErrTooManyOccurrences
+			}
+		}
+	}
+	return starts, nil
+}
+
+// periodStarts returns the candidate starts within the n-th period of the rule
+func (r RRule) periodStarts(dtstart time.Time, n int) []time.Time {
+	step := n * r.Interval
+	switch r.Freq {
+	case "DAILY":
+		return []time.Time{dtstart.AddDate(0, 0, step)}
+	case "WEEKLY":
+		if len(r.ByDay) == 0 {
+			return []time.Time{dtstart.AddDate(0, 0, 7*step)}
+		}
+		// weeks start on monday, as RFC 5545 assumes by default
+		weekStart := dtstart.AddDate(0, 0, -((int(dtstart.Weekday())+6)%7)+7*step)
+		starts := []time.Time{}
+		for offset := 0; offset < 7; offset++ {
+			day := weekStart.AddDate(0, 0, offset)
+			if slices.Contains(r.ByDay, day.Weekday()) {
+				starts = append(starts, day)
+			}
+		}
+		return starts
+	case "MONTHLY":
+		t := dtstart.AddDate(0, step, 0)
+		if t.Day() != dtstart.Day() {
+			return nil
+		}
+		return []time.Time{t}
+	case "YEARLY":
+		t := dtstart.AddDate(step, 0, 0)
+		if t.Day() != dtstart.Day() {
+			return nil
+		}
+		return []time.Time{t}
+	}
+	return nil
+}
+
+// EventSlots returns the time of every occurrence of an event with cancelled occurrences
+// left out and moved ones at their new time, a one-off event has a single slot
+func EventSlots(event models.Event) ([]models.TimeSlotStartAndEnd, error) {
+	if event.Recurrence == "" {
+		return []models.TimeSlotStartAndEnd{{StartTime: event.EventStartTime, EndTime: event.EventEndTime}}, nil
+	}
+
+	occurrences, err := ExpandOccurrences(event, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	slots := make([]models.TimeSlotStartAndEnd, 0, len(occurrences))
+	for _, occurrence := range occurrences {
+		slots = append(slots, models.TimeSlotStartAndEnd{StartTime: occurrence.EventStartTime, EndTime: occurrence.EventEndTime})
+	}
+	return slots, nil
+}
+
+// ExpandOccurrences returns the occurrences of a recurring event that overlap [from, to), a zero
+// from or to leaves that side open. Every occurrence carries its original start as RecurrenceID.
+func ExpandOccurrences(event models.Event, from, to time.Time) ([]models.Event, error) {
+	rule, err := ParseRRule(event.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+	starts, err := rule.Starts(event.EventStartTime)
+	if err != nil {
+		return nil, err
+	}
+
+	duration := event.EventEndTime.Sub(event.EventStartTime)
+	occurrences := []models.Event{}
+	for _, start := range starts {
+		occurrence := event
+		occurrence.Exceptions = nil
+		occurrence.RecurrenceID = &start
+		occurrence.EventStartTime = start
+		occurrence.EventEndTime = start.Add(duration)
+
+		idx := slices.IndexFunc(event.Exceptions, func(e models.EventException) bool { return e.OriginalStartTime.Equal(start) })
+		if idx >= 0 {
+			exception := event.Exceptions[idx]
+			if exception.Cancelled {
+				continue
+			}
+			occurrence.EventStartTime = *exception.EventStartTime
+			occurrence.EventEndTime = *exception.EventEndTime
+		}
+
+		if (!from.IsZero() && !occurrence.EventEndTime.After(from)) || (!to.IsZero() && !occurrence.EventStartTime.Before(to)) {
+			continue
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+	return occurrences, nil
+}
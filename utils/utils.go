@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 	"time"
 	"timeslot-app/models"
@@ -26,106 +27,136 @@ func CreateFile(b []byte) {
 	fmt.Printf("\nfile length: %d\n", length)
 }
 
-// for this example we will assume the timezone is EST
+// ValidateTimeStamp reports whether ts is a time slot ValidateAndFormatTimeStamp reads
 func ValidateTimeStamp(ts string) bool {
+	_, _, valid := ValidateAndFormatTimeStamp(ts)
+	return valid
+}
+
+// ValidateAndFormatTimeStamp reads a time slot such as "2 Jan 2025 2-4 PM EST". Times may carry minutes, as in
+// "2 Jan 2025 10:30-11 AM EST", and a slot running across noon names the half of the day of its start as well,
+// as in "2 Jan 2025 11 AM-1:30 PM EST". Such a slot ending at 12 AM runs until the midnight after its start.
+func ValidateAndFormatTimeStamp(ts string) (startTime, endTime time.Time, valid bool) {
 	// layout := "2 Jan 2025 2-4 PM EST"
 
-	sp := strings.Split(ts, " ")
+	sp := strings.Fields(ts)
 	if len(sp) < 6 {
 		fmt.Println("Invalid timestamp1")
-		return false
+		return time.Time{}, time.Time{}, false
 
 	}
 
 	date := strings.Join(sp[0:3], " ")
-	partOfDay := strings.ToUpper(sp[4])
-	timezone := sp[5] // "EST"
+	timezone := sp[len(sp)-1] // "EST"
 
 	loc, err := time.LoadLocation(timezone)
 	if err != nil {
-		return false
+		return time.Time{}, time.Time{}, false
 	}
 
 	// split the time slots
 
-	timeSlots := strings.Split(sp[3], "-")
-	if len(timeSlots) < 2 {
+	timeSlots := strings.Split(strings.Join(sp[3:len(sp)-1], " "), "-")
+	if len(timeSlots) != 2 {
 		fmt.Println("Invalid timestamp2")
-		return false
+		return time.Time{}, time.Time{}, false
+	}
+	slotEnd := strings.ToUpper(strings.TrimSpace(timeSlots[1]))
+	clock, partOfDay, found := strings.Cut(slotEnd, " ")
+	if !found {
+		fmt.Println("Invalid timestamp2")
+		return time.Time{}, time.Time{}, false
+	}
+	slotStart := strings.ToUpper(strings.TrimSpace(timeSlots[0]))
+	ownPartOfDay := strings.Contains(slotStart, " ")
+	if !ownPartOfDay {
+		slotStart += " " + partOfDay
 	}
-	slotStart := fmt.Sprintf("%s %s %s", date, timeSlots[0], partOfDay)
-	slotEnd := fmt.Sprintf("%s %s %s", date, timeSlots[1], partOfDay)
 
-	layout := "02 Jan 2006 3 PM"
-	ss, err := time.ParseInLocation(layout, slotStart, loc)
+	ss, err := parseSlotTime(date, slotStart, loc)
 	if err != nil {
 		fmt.Println("Invalid timestamp3")
-		return false
+		return time.Time{}, time.Time{}, false
 	}
 
-	se, err := time.ParseInLocation(layout, slotEnd, loc)
+	se, err := parseSlotTime(date, slotEnd, loc)
 	if err != nil {
 		fmt.Println("Invalid timestamp4")
-		return false
+		return time.Time{}, time.Time{}, false
+	}
+	if ownPartOfDay && clock == "12" && partOfDay == "AM" && !se.After(ss) {
+		se = time.Date(ss.Year(), ss.Month(), ss.Day()+1, 0, 0, 0, 0, loc)
 	}
 
 	if ss.After(se) {
 		fmt.Println("Invalid timestamp5")
-		return false
+		return time.Time{}, time.Time{}, false
 	}
 
 	fmt.Println(ss, se)
-	return true
+	return ss, se, true
 }
 
-func ValidateAndFormatTimeStamp(ts string) (startTime, endTime time.Time, valid bool) {
-
-	sp := strings.Split(ts, " ")
-	if len(sp) < 6 {
-		fmt.Println("Invalid timestamp1")
-		return time.Time{}, time.Time{}, false
-
+// parseSlotTime reads the day and a time of day such as "3 PM" or "3:30 PM" of a time slot
+func parseSlotTime(date, clock string, loc *time.Location) (time.Time, error) {
+	layout := "02 Jan 2006 3 PM"
+	if strings.Contains(clock, ":") {
+		layout = "02 Jan 2006 3:04 PM"
 	}
+	return time.ParseInLocation(layout, date+" "+clock, loc)
+}
 
-	date := strings.Join(sp[0:3], " ")
-	partOfDay := strings.ToUpper(sp[4])
-	timezone := sp[5] // "EST"
-
-	loc, err := time.LoadLocation(timezone)
-	if err != nil {
-		return time.Time{}, time.Time{}, false
+// FormatTimeSlot renders a slot in the "02 Jan 2025 2-4 PM EST" form of ValidateAndFormatTimeStamp, in the
+// location of start. The form holds whole minutes of a single day, otherwise ok is false.
+func FormatTimeSlot(start, end time.Time) (timeSlot string, ok bool) {
+	end = end.In(start.Location())
+	wholeMinute := func(t time.Time) bool { return t.Second() == 0 && t.Nanosecond() == 0 }
+	if !start.Before(end) || !wholeMinute(start) || !wholeMinute(end) {
+		return "", false
 	}
 
-	// split the time slots
-
-	timeSlots := strings.Split(sp[3], "-")
-	if len(timeSlots) < 2 {
-		fmt.Println("Invalid timestamp2")
-		return time.Time{}, time.Time{}, false
+	clock := func(t time.Time) string {
+		if t.Minute() == 0 {
+			return t.Format("3")
+		}
+		return t.Format("3:04")
 	}
-	slotStart := fmt.Sprintf("%s %s %s", date, timeSlots[0], partOfDay)
-	slotEnd := fmt.Sprintf("%s %s %s", date, timeSlots[1], partOfDay)
-
-	layout := "02 Jan 2006 3 PM"
-	ss, err := time.ParseInLocation(layout, slotStart, loc)
-	if err != nil {
-		fmt.Println("Invalid timestamp3")
-		return time.Time{}, time.Time{}, false
+	times := fmt.Sprintf("%s %s-%s %s", clock(start), start.Format("PM"), clock(end), end.Format("PM"))
+	if start.Format("PM") == end.Format("PM") && end.Format("15:04") != "00:00" {
+		times = fmt.Sprintf("%s-%s %s", clock(start), clock(end), end.Format("PM"))
 	}
+	timeSlot = fmt.Sprintf("%s %s %s", start.Format("02 Jan 2006"), times, start.Location())
 
-	se, err := time.ParseInLocation(layout, slotEnd, loc)
-	if err != nil {
-		fmt.Println("Invalid timestamp4")
-		return time.Time{}, time.Time{}, false
+	// a slot running into the next day doesn't survive the round trip
+	ss, se, valid := ValidateAndFormatTimeStamp(timeSlot)
+	if !valid || !ss.Equal(start) || !se.Equal(end) {
+		return "", false
 	}
+	return timeSlot, true
+}
 
-	if ss.After(se) {
-		fmt.Println("Invalid timestamp5")
-		return time.Time{}, time.Time{}, false
+// TimeSlotsWithin returns the time slots that cover [start, end), in the location of start. A slot ends at midnight
+// at the latest, so the range is split by day, and the parts of a minute at either end are left out.
+func TimeSlotsWithin(start, end time.Time) []string {
+	loc := start.Location()
+	end = end.In(loc).Truncate(time.Minute)
+	t := start.Truncate(time.Minute)
+	if t.Before(start) {
+		t = t.Add(time.Minute)
 	}
 
-	fmt.Println(ss, se)
-	return ss, se, true
+	var timeSlots []string
+	for t.Before(end) {
+		slotEnd := time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		if end.Before(slotEnd) {
+			slotEnd = end
+		}
+		if timeSlot, ok := FormatTimeSlot(t, slotEnd); ok {
+			timeSlots = append(timeSlots, timeSlot)
+		}
+		t = slotEnd
+	}
+	return timeSlots
 }
 
 func CheckIfTimeSlotsOverlap(timeSlot1, timeSlot2 models.TimeSlotStartAndEnd, eventDuration time.Duration) bool {
@@ -172,6 +203,90 @@ func SuccessHelper(message string) []byte {
 	return marshalledErr
 }
 
+// IsCoveredBy reports whether slot lies entirely inside the union of the available slots,
+// overlapping or back to back availability counts as one continuous window
+func IsCoveredBy(slot models.TimeSlotStartAndEnd, available []models.TimeSlotStartAndEnd) bool {
+	sorted := slices.Clone(available)
+	slices.SortFunc(sorted, func(a, b models.TimeSlotStartAndEnd) int { return a.StartTime.Compare(b.StartTime) })
+
+	covered := slot.StartTime
+	for _, a := range sorted {
+		if a.StartTime.After(covered) {
+			break
+		}
+		if a.EndTime.After(covered) {
+			covered = a.EndTime
+		}
+	}
+	return !covered.Before(slot.EndTime)
+}
+
+// MergeSlots sorts the slots and joins the ones that overlap or follow each other back to back
+func MergeSlots(slots []models.TimeSlotStartAndEnd) []models.TimeSlotStartAndEnd {
+	sorted := slices.Clone(slots)
+	slices.SortFunc(sorted, func(a, b models.TimeSlotStartAndEnd) int { return a.StartTime.Compare(b.StartTime) })
+
+	merged := []models.TimeSlotStartAndEnd{}
+	for _, s := range sorted {
+		last := len(merged) - 1
+		if last >= 0 && !s.StartTime.After(merged[last].EndTime) {
+			if s.EndTime.After(merged[last].EndTime) {
+				merged[last].EndTime = s.EndTime
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// IntersectSlots returns the time covered by both lists of slots
+func IntersectSlots(a, b []models.TimeSlotStartAndEnd) []models.TimeSlotStartAndEnd {
+	intersection := []models.TimeSlotStartAndEnd{}
+	for _, x := range MergeSlots(a) {
+		for _, y := range MergeSlots(b) {
+			start, end := x.StartTime, x.EndTime
+			if y.StartTime.After(start) {
+				start = y.StartTime
+			}
+			if y.EndTime.Before(end) {
+				end = y.EndTime
+			}
+			if start.Before(end) {
+				intersection = append(intersection, models.TimeSlotStartAndEnd{StartTime: start, EndTime: end})
+			}
+		}
+	}
+	return intersection
+}
+
+// BookableTimes lists the meetings of the given duration that fit into the available slots without their buffers
+// touching a busy slot. Start times follow each other by the duration from the start of each window of
+// availability, and have to lie between earliest and latest.
+func BookableTimes(available, busy []models.TimeSlotStartAndEnd, duration, bufferBefore, bufferAfter time.Duration, earliest, latest time.Time) []models.TimeSlotStartAndEnd {
+	times := []models.TimeSlotStartAndEnd{}
+	if duration <= 0 {
+		return times
+	}
+
+	for _, window := range MergeSlots(available) {
+		start := window.StartTime
+		if start.Before(earliest) {
+			steps := (earliest.Sub(start) + duration - 1) / duration
+			start = start.Add(steps * duration)
+		}
+		for ; !start.Add(duration).After(window.EndTime) && !start.After(latest); start = start.Add(duration) {
+			padded := models.TimeSlotStartAndEnd{StartTime: start.Add(-bufferBefore), EndTime: start.Add(duration + bufferAfter)}
+			if !slices.ContainsFunc(busy, func(b models.TimeSlotStartAndEnd) bool {
+				return b.StartTime.Before(padded.EndTime) && b.EndTime.After(padded.StartTime)
+			}) {
+				times = append(times, models.TimeSlotStartAndEnd{StartTime: start, EndTime: start.Add(duration)})
+			}
+		}
+	}
+	return times
+}
+
 func SearchString(arr []string, str string) bool {
 	for _, s := range arr {
 		if s == str {
@@ -180,3 +295,50 @@ func SearchString(arr []string, str string) bool {
 	}
 	return false
 }
+
+// MaxReminderOffset is the furthest ahead of an event a reminder can be sent
+const MaxReminderOffset = 4 * 7 * 24 * time.Hour
+
+// ParseReminderOffsets parses offsets such as "24h" or "10m" telling how long before an event a reminder is sent
+func ParseReminderOffsets(offsets []string) ([]time.Duration, error) {
+	if offsets == nil {
+		return nil, nil
+	}
+	durations := make([]time.Duration, 0, len(offsets))
+	for _, offset := range offsets {
+		d, err := time.ParseDuration(offset)
+		if err != nil || d <= 0 || d > MaxReminderOffset || d%time.Second != 0 {
+			return nil, fmt.Errorf("invalid reminder offset %q, use whole seconds up to %s such as 24h or 10m", offset, FormatReminderOffset(MaxReminderOffset))
+		}
+		if !slices.Contains(durations, d) {
+			durations = append(durations, d)
+		}
+	}
+	slices.Sort(durations)
+	slices.Reverse(durations)
+	return durations, nil
+}
+
+// FormatReminderOffset renders an offset in the largest whole unit, e.g. 24h rather than 24h0m0s
+func FormatReminderOffset(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
+
+// NormalizeReminderOffsets parses and formats offsets back, nil stays nil
+func NormalizeReminderOffsets(offsets []string) ([]string, error) {
+	durations, err := ParseReminderOffsets(offsets)
+	if err != nil || durations == nil {
+		return nil, err
+	}
+	normalized := make([]string, 0, len(durations))
+	for _, d := range durations {
+		normalized = append(normalized, FormatReminderOffset(d))
+	}
+	return normalized, nil
+}